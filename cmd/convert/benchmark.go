@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/segmentio/parquet-go"
+
+	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+var benchmarkedCodecs = []string{"none", "snappy", "lz4", "zstd-fastest", "zstd-default", "zstd-better", "zstd-best"}
+
+// runCodecBenchmark writes the chunks of the first numSeries series in the block
+// with each codec, and reports the size of the file and the time to decode all of its pages.
+func runCodecBenchmark(out io.Writer, block tsdb.BlockReader, labelNames []string, numSeries int64) error {
+	sample, err := sampleChunks(block, numSeries)
+	if err != nil {
+		return errors.Wrap(err, "failed sampling chunks")
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "codec\tsize\twrite\tdecode\tdecode speed\t")
+	for _, name := range benchmarkedCodecs {
+		codec, err := schema.ParseCodec(name)
+		if err != nil {
+			return err
+		}
+		chunkSchema := schema.MakeChunkSchema(labelNames,
+			schema.WithCodec(schema.SeriesIDColumn, codec),
+			schema.WithCodec(schema.MinTColumn, codec),
+			schema.WithCodec(schema.MaxTColumn, codec),
+			schema.WithCodec(schema.ChunkBytesColumn, codec),
+			schema.WithCodec(schema.ChunkEncodingColumn, codec),
+			schema.WithCodec(schema.NumSamplesColumn, codec),
+			schema.WithLabelsCodec(codec),
+		)
+
+		start := time.Now()
+		file, err := writeSample(chunkSchema, sample)
+		if err != nil {
+			return errors.Wrapf(err, "failed writing sample with codec %s", name)
+		}
+		writeDuration := time.Since(start)
+
+		start = time.Now()
+		if err := decodePages(file); err != nil {
+			return errors.Wrapf(err, "failed decoding sample with codec %s", name)
+		}
+		decodeDuration := time.Since(start)
+
+		decodeSpeed := float64(len(file)) / decodeDuration.Seconds() / (1024 * 1024)
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%.1f MiB/s\t\n", name, len(file), writeDuration, decodeDuration, decodeSpeed)
+	}
+	return tw.Flush()
+}
+
+var errSampleComplete = errors.New("sample complete")
+
+func sampleChunks(block tsdb.BlockReader, numSeries int64) ([]schema.Chunk, error) {
+	var (
+		sample        []schema.Chunk
+		sampledSeries int64
+	)
+	err := db.ForEachSeries(block, func(chunks []schema.Chunk) error {
+		if sampledSeries == numSeries {
+			return errSampleComplete
+		}
+		sampledSeries++
+		sample = append(sample, chunks...)
+		return nil
+	})
+	if err != nil && err != errSampleComplete {
+		return nil, err
+	}
+	return sample, nil
+}
+
+func writeSample(chunkSchema *schema.ChunkSchema, sample []schema.Chunk) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := parquet.NewGenericWriter[any](&buf, chunkSchema.ParquetSchema())
+	rows := make([]parquet.Row, 0, len(sample))
+	for _, chunk := range sample {
+		rows = append(rows, chunkSchema.MakeChunkRow(chunk))
+	}
+	if _, err := writer.WriteRows(rows); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodePages reads and decodes every page of every column in the file.
+func decodePages(b []byte) error {
+	file, err := parquet.OpenFile(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+	values := make([]parquet.Value, 1024)
+	for _, rowGroup := range file.RowGroups() {
+		for _, columnChunk := range rowGroup.ColumnChunks() {
+			if err := decodeColumnChunk(columnChunk, values); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func decodeColumnChunk(columnChunk parquet.ColumnChunk, values []parquet.Value) error {
+	pages := columnChunk.Pages()
+	defer pages.Close()
+	for {
+		page, err := pages.ReadPage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		reader := page.Values()
+		for {
+			_, err := reader.ReadValues(values)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
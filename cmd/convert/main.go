@@ -1,13 +1,13 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"math"
 	"net/http"
 	"os"
 
-	"github.com/prometheus/prometheus/tsdb/chunks"
 	"github.com/prometheus/prometheus/tsdb/index"
 	"github.com/schollz/progressbar/v3"
 
@@ -20,12 +20,18 @@ import (
 	"github.com/prometheus/prometheus/tsdb"
 )
 
+var benchmarkCodecs = flag.Bool("benchmark-codecs", false, "report size and decode speed of each codec for a sample of the block instead of converting it")
+var benchmarkSeries = flag.Int64("benchmark-series", 10000, "number of series to sample when benchmarking codecs")
+var sortBySeries = flag.Bool("sort-by-series", false, "sort rows by labels and series ID so that the chunks of each series are contiguous")
+
 func main() {
+	flag.Parse()
+
 	go func() {
 		log.Println(http.ListenAndServe("localhost:8080", nil))
 	}()
 
-	tsdbBlock, block, err := openBlock("data", os.Args[1])
+	tsdbBlock, block, err := openBlock("data", flag.Arg(0))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -37,12 +43,6 @@ func main() {
 		log.Fatal(err)
 	}
 
-	chunkReader, err := block.Chunks()
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer chunkReader.Close()
-
 	allLabels, _, err := blockQuerier.LabelNames()
 	if err != nil {
 		log.Fatal(err)
@@ -54,13 +54,27 @@ func main() {
 	}
 	defer ir.Close()
 
+	if *benchmarkCodecs {
+		if err := runCodecBenchmark(os.Stdout, block, allLabels, *benchmarkSeries); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	metricNames, err := ir.LabelValues(labels.MetricName)
 	if err != nil {
 		log.Fatal(err)
 	}
 	log.Println("Converting metrics to parquet", "num_metrics", len(metricNames))
 
-	writer := db.NewWriter("./out", allLabels)
+	var writerOpts []db.WriterOption
+	if *sortBySeries {
+		writerOpts = append(writerOpts, db.WithSortOrder(db.SortBySeries))
+	}
+	writer, err := db.NewWriter("./out", allLabels, writerOpts...)
+	if err != nil {
+		log.Fatal(err)
+	}
 	defer writer.Close()
 
 	ps, err := ir.Postings(index.AllPostingsKey())
@@ -72,48 +86,16 @@ func main() {
 		numPostings++
 	}
 	log.Println("Converting postings to parquet", "num_postings", numPostings)
-	ps, err = ir.Postings(index.AllPostingsKey())
-	if err != nil {
-		log.Fatal(err)
-	}
-	ps = ir.SortedPostings(ps)
-	var (
-		lblBuilder labels.ScratchBuilder
-		chks       []chunks.Meta
-		seriesID   int64 = -1
-	)
 
 	bar := progressbar.Default(numPostings)
-	chunkBuffer := make([]schema.Chunk, 0, 1000)
-	for ps.Next() {
-		chunkBuffer = chunkBuffer[:0]
-		seriesID++
-		lblBuilder.Reset()
-		if err := ir.Series(ps.At(), &lblBuilder, &chks); err != nil {
-			log.Fatal(err)
-		}
-
-		lbls := lblBuilder.Labels()
-		for _, chunkMeta := range chks {
-			chk, err := chunkReader.Chunk(chunkMeta)
-			if err != nil {
-				log.Fatal(err)
-			}
-			chunk := schema.Chunk{
-				SeriesID:   seriesID,
-				Labels:     lbls.Map(),
-				MinT:       chunkMeta.MinTime,
-				MaxT:       chunkMeta.MaxTime,
-				ChunkBytes: chk.Bytes(),
-			}
-			chunkBuffer = append(chunkBuffer, chunk)
-		}
-		if err := writer.Write(chunkBuffer); err != nil {
-			log.Fatal(err)
-		}
-		if err := bar.Add(1); err != nil {
-			log.Fatal(err)
+	err = db.ForEachSeries(block, func(chunks []schema.Chunk) error {
+		if err := writer.Write(chunks); err != nil {
+			return err
 		}
+		return bar.Add(1)
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	if err := writer.Flush(); err != nil {
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"syscall"
+
+	arrowflight "github.com/apache/arrow/go/v10/arrow/flight"
+	"github.com/thanos-io/objstore/providers/filesystem"
+
+	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/flight"
+)
+
+var addr = flag.String("addr", "localhost:8815", "address to serve Arrow Flight on")
+var dir = flag.String("dir", "./out", "directory with parquet files and their metadata files")
+var cacheDir = flag.String("cache-dir", "", "directory to cache file sections in")
+
+func main() {
+	flag.Parse()
+
+	bucket, err := filesystem.NewBucket(*dir)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var readerOpts []db.FileReaderOpt
+	if *cacheDir != "" {
+		readerOpts = append(readerOpts, db.WithSectionCacheDir(*cacheDir))
+	}
+
+	server := arrowflight.NewServerWithMiddleware(nil)
+	server.RegisterFlightService(flight.NewServer(bucket, flight.WithFileReaderOptions(readerOpts...)))
+	if err := server.Init(*addr); err != nil {
+		log.Fatalln(err)
+	}
+	server.SetShutdownOnSignals(os.Interrupt, syscall.SIGTERM)
+
+	log.Println("Serving Arrow Flight", "addr", server.Addr())
+	if err := server.Serve(); err != nil {
+		log.Fatalln(err)
+	}
+}
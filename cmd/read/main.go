@@ -25,6 +25,7 @@ import (
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 var heapprofile = flag.String("heapprofile", "", "write heap profile to file")
 var tracefile = flag.String("trace", "", "write trace to file")
+var explain = flag.Bool("explain", false, "print execution stats for the query")
 
 const batchSize = 16 * 1024
 
@@ -107,6 +108,7 @@ func main() {
 	fmt.Println("Reading columns...")
 	projectStart := time.Now()
 	projectionColumns := []string{schema.ChunkBytesColumn}
+	queryStats := compute.NewStatsNode("Query", scanner.Stats())
 	for _, selection := range selections {
 		fmt.Println("Projecting", selection.NumRows(), "rows")
 		projection := compute.ProjectColumns(selection, reader.SectionLoader(), batchSize, projectionColumns...)
@@ -123,8 +125,15 @@ func main() {
 			printColumns(columns, io.Discard)
 			projection.Release(columns)
 		}
+		queryStats.Children = append(queryStats.Children, projection.Stats())
 	}
 	fmt.Println("Time taken:", time.Since(projectStart))
+
+	if *explain {
+		if err := queryStats.Explain(os.Stdout); err != nil {
+			log.Fatalln(err)
+		}
+	}
 }
 
 func printColumns(columns [][]parquet.Value, writer io.Writer) {
@@ -0,0 +1,387 @@
+package compute
+
+import (
+	"io"
+	"math"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/segmentio/parquet-go"
+	"golang.org/x/exp/slices"
+)
+
+// AggregateFunc is the function which aggregates the values of series in the same group.
+type AggregateFunc int
+
+const (
+	AggregateSum AggregateFunc = iota
+	AggregateCount
+	AggregateMin
+	AggregateMax
+	AggregateAvg
+)
+
+// ErrUnsupportedChunkEncoding is returned when aggregating chunks which do not contain float samples.
+var ErrUnsupportedChunkEncoding = errors.New("unsupported chunk encoding")
+
+// Steps are the timestamps at which series are aggregated, from Start to End every Interval milliseconds.
+// The value of a series at a step is its last sample at most Lookback milliseconds before the step.
+// There is a single step at Start when Interval is zero.
+type Steps struct {
+	Start    int64
+	End      int64
+	Interval int64
+	Lookback int64
+}
+
+func (s Steps) count() int {
+	if s.End < s.Start {
+		return 0
+	}
+	if s.Interval <= 0 {
+		return 1
+	}
+	return int((s.End-s.Start)/s.Interval) + 1
+}
+
+func (s Steps) timestamp(i int) int64 {
+	return s.Start + int64(i)*s.Interval
+}
+
+// firstAtOrAfter returns the index of the first step at or after t.
+func (s Steps) firstAtOrAfter(t int64) int {
+	if t <= s.Start {
+		return 0
+	}
+	if s.Interval <= 0 {
+		return 1
+	}
+	return int((t - s.Start + s.Interval - 1) / s.Interval)
+}
+
+// HashAggregate aggregates the samples of chunks by groups of label values at each step.
+// The input fragment has the series ID, the grouping columns, the min time, max time and bytes of chunks,
+// followed by the optional chunk encoding column. Chunks of a series can be in any order and any batch,
+// so all input is consumed before the first batch is returned.
+//
+// The last sample of each series at each step is kept until the input is consumed, so memory grows with
+// the number of series times the number of steps. Aggregates created with NewSortedHashAggregate only keep
+// the samples of the current series, and add them to its group once the series changes.
+//
+// Output batches have the grouping columns followed by the step timestamp as INT64 and the aggregated value as DOUBLE.
+// Each row is a group at a step at which at least one of its series has a sample. Groups are sorted by their label values.
+type HashAggregate struct {
+	input              Fragment
+	fn                 AggregateFunc
+	numGroupingColumns int
+	steps              Steps
+
+	series map[int64]*seriesSteps
+	groups map[string]*aggregateGroup
+	// sorted is set when the chunks of each series are contiguous. Only the steps
+	// of the current series are then kept instead of the steps of all series.
+	sorted    bool
+	current   *seriesSteps
+	currentID int64
+
+	output     []*aggregateGroup
+	outputStep int
+	done       bool
+
+	chunksIn int64
+	rowsOut  int64
+}
+
+// NewHashAggregate creates an aggregation of the input fragment with numGroupingColumns grouping columns after the series ID.
+func NewHashAggregate(input Fragment, fn AggregateFunc, numGroupingColumns int, steps Steps) *HashAggregate {
+	return &HashAggregate{
+		input:              input,
+		fn:                 fn,
+		numGroupingColumns: numGroupingColumns,
+		steps:              steps,
+		series:             make(map[int64]*seriesSteps),
+		groups:             make(map[string]*aggregateGroup),
+	}
+}
+
+// NewSortedHashAggregate is like NewHashAggregate for inputs in which the chunks of each series are contiguous,
+// such as files sorted by series. Series are only hashed into their groups, which bounds memory by
+// the number of groups times the number of steps.
+func NewSortedHashAggregate(input Fragment, fn AggregateFunc, numGroupingColumns int, steps Steps) *HashAggregate {
+	a := NewHashAggregate(input, fn, numGroupingColumns, steps)
+	a.sorted, a.series = true, nil
+	return a
+}
+
+// seriesSteps is the last sample of a series at each step.
+type seriesSteps struct {
+	group      *aggregateGroup
+	timestamps []int64
+	values     []float64
+}
+
+// aggregateGroup is the aggregated value of a group of series at each step.
+type aggregateGroup struct {
+	key    string
+	labels []string
+	counts []int64
+	values []float64
+}
+
+func (g *aggregateGroup) add(fn AggregateFunc, step int, v float64) {
+	g.counts[step]++
+	if g.counts[step] == 1 {
+		g.values[step] = v
+		return
+	}
+	switch fn {
+	case AggregateSum, AggregateAvg:
+		g.values[step] += v
+	case AggregateMin:
+		if g.values[step] > v || math.IsNaN(g.values[step]) {
+			g.values[step] = v
+		}
+	case AggregateMax:
+		if g.values[step] < v || math.IsNaN(g.values[step]) {
+			g.values[step] = v
+		}
+	}
+}
+
+func (g *aggregateGroup) value(fn AggregateFunc, step int) float64 {
+	switch fn {
+	case AggregateCount:
+		return float64(g.counts[step])
+	case AggregateAvg:
+		return g.values[step] / float64(g.counts[step])
+	default:
+		return g.values[step]
+	}
+}
+
+func (a *HashAggregate) NextBatch() (Batch, error) {
+	if !a.done {
+		if err := a.consume(); err != nil {
+			return nil, err
+		}
+		a.done = true
+	}
+
+	batchSize := int(a.MaxBatchSize())
+	batch := make(Batch, a.numGroupingColumns+2)
+	for len(a.output) > 0 && len(batch[0]) < batchSize {
+		group := a.output[0]
+		for ; a.outputStep < a.steps.count() && len(batch[0]) < batchSize; a.outputStep++ {
+			if group.counts[a.outputStep] == 0 {
+				continue
+			}
+			for i, label := range group.labels {
+				batch[i] = append(batch[i], parquet.ByteArrayValue([]byte(label)).Level(0, 0, i))
+			}
+			batch[a.numGroupingColumns] = append(batch[a.numGroupingColumns],
+				parquet.Int64Value(a.steps.timestamp(a.outputStep)).Level(0, 0, a.numGroupingColumns))
+			batch[a.numGroupingColumns+1] = append(batch[a.numGroupingColumns+1],
+				parquet.DoubleValue(group.value(a.fn, a.outputStep)).Level(0, 0, a.numGroupingColumns+1))
+		}
+		if a.outputStep == a.steps.count() {
+			a.output, a.outputStep = a.output[1:], 0
+		}
+	}
+	if len(batch[0]) == 0 {
+		return nil, io.EOF
+	}
+	a.rowsOut += int64(len(batch[0]))
+	return batch, nil
+}
+
+// consume reads the last sample of each series at each step from all input chunks,
+// and then aggregates the series of each group.
+func (a *HashAggregate) consume() error {
+	for {
+		batch, err := a.input.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		err = a.addBatch(batch)
+		a.input.Release(batch)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.current != nil {
+		a.fold(a.current)
+		a.current = nil
+	}
+	for _, s := range a.series {
+		a.fold(s)
+	}
+	a.series = nil
+
+	a.output = make([]*aggregateGroup, 0, len(a.groups))
+	for _, group := range a.groups {
+		a.output = append(a.output, group)
+	}
+	slices.SortFunc(a.output, func(a, b *aggregateGroup) bool {
+		return a.key < b.key
+	})
+	return nil
+}
+
+// fold adds the last sample of the series at each step to its group.
+func (a *HashAggregate) fold(s *seriesSteps) {
+	for step, ts := range s.timestamps {
+		if ts == math.MinInt64 || value.IsStaleNaN(s.values[step]) {
+			continue
+		}
+		s.group.add(a.fn, step, s.values[step])
+	}
+}
+
+func (a *HashAggregate) addBatch(batch Batch) error {
+	chunkColumns := batch[a.numGroupingColumns+1:]
+	for row := range batch[0] {
+		encoding := chunkenc.EncXOR
+		if len(chunkColumns) > 3 {
+			encoding = chunkenc.Encoding(chunkColumns[3][row].Int32())
+		}
+		if encoding != chunkenc.EncXOR {
+			return errors.Wrapf(ErrUnsupportedChunkEncoding, "failed aggregating %s chunk", encoding)
+		}
+		chk, err := chunkenc.FromData(encoding, chunkColumns[2][row].ByteArray())
+		if err != nil {
+			return errors.Wrap(err, "failed decoding chunk")
+		}
+
+		s := a.seriesSteps(batch, row)
+		if err := a.addChunk(s, chk.Iterator(nil)); err != nil {
+			return err
+		}
+		a.chunksIn++
+	}
+	return nil
+}
+
+func (a *HashAggregate) seriesSteps(batch Batch, row int) *seriesSteps {
+	seriesID := batch[0][row].Int64()
+	if a.sorted {
+		return a.sortedSeriesSteps(batch, row, seriesID)
+	}
+	if s, ok := a.series[seriesID]; ok {
+		return s
+	}
+
+	s := &seriesSteps{
+		group:      a.group(batch, row),
+		timestamps: make([]int64, a.steps.count()),
+		values:     make([]float64, a.steps.count()),
+	}
+	for i := range s.timestamps {
+		s.timestamps[i] = math.MinInt64
+	}
+	a.series[seriesID] = s
+	return s
+}
+
+// sortedSeriesSteps returns the steps of the current series. Once the series changes, the current series
+// has no more chunks, so it is added to its group and its steps are reused for the next series.
+func (a *HashAggregate) sortedSeriesSteps(batch Batch, row int, seriesID int64) *seriesSteps {
+	if a.current != nil && a.currentID == seriesID {
+		return a.current
+	}
+	if a.current == nil {
+		a.current = &seriesSteps{
+			timestamps: make([]int64, a.steps.count()),
+			values:     make([]float64, a.steps.count()),
+		}
+	} else {
+		a.fold(a.current)
+	}
+	a.current.group, a.currentID = a.group(batch, row), seriesID
+	for i := range a.current.timestamps {
+		a.current.timestamps[i] = math.MinInt64
+	}
+	return a.current
+}
+
+// group returns the group of the grouping label values of the row.
+func (a *HashAggregate) group(batch Batch, row int) *aggregateGroup {
+	labels := make([]string, a.numGroupingColumns)
+	for i := range labels {
+		labels[i] = batch[i+1][row].String()
+	}
+	key := strings.Join(labels, "\xff")
+	group, ok := a.groups[key]
+	if !ok {
+		group = &aggregateGroup{
+			key:    key,
+			labels: labels,
+			counts: make([]int64, a.steps.count()),
+			values: make([]float64, a.steps.count()),
+		}
+		a.groups[key] = group
+	}
+	return group
+}
+
+// addChunk sets the samples of the chunk as the samples of the series at the steps they are the last sample for.
+// A sample is the last sample for steps from its timestamp until the next sample or the end of the lookback.
+// Chunks of a series do not overlap, so samples of a later chunk replace samples of an earlier one.
+func (a *HashAggregate) addChunk(s *seriesSteps, it chunkenc.Iterator) error {
+	var (
+		prevT   int64
+		prevV   float64
+		hasPrev bool
+	)
+	for it.Next() == chunkenc.ValFloat {
+		t, v := it.At()
+		if hasPrev {
+			a.setSample(s, prevT, prevV, t)
+		}
+		prevT, prevV, hasPrev = t, v, true
+	}
+	if err := it.Err(); err != nil {
+		return errors.Wrap(err, "failed iterating chunk")
+	}
+	if hasPrev {
+		a.setSample(s, prevT, prevV, math.MaxInt64)
+	}
+	return nil
+}
+
+// setSample sets the sample at t as the sample of the series at steps from t until before next,
+// and within the lookback of t.
+func (a *HashAggregate) setSample(s *seriesSteps, t int64, v float64, next int64) {
+	end := t + a.steps.Lookback
+	for step := a.steps.firstAtOrAfter(t); step < len(s.timestamps); step++ {
+		ts := a.steps.timestamp(step)
+		if ts >= next || ts > end {
+			return
+		}
+		if t > s.timestamps[step] {
+			s.timestamps[step], s.values[step] = t, v
+		}
+	}
+}
+
+func (a *HashAggregate) MaxBatchSize() int64 {
+	return a.input.MaxBatchSize()
+}
+
+func (a *HashAggregate) Release(Batch) {}
+
+func (a *HashAggregate) Stats() *StatsNode {
+	return NewStatsNode("HashAggregate", a.input.Stats()).
+		Add("chunks_in", a.chunksIn).
+		Add("groups", len(a.groups)).
+		Add("rows_out", a.rowsOut)
+}
+
+func (a *HashAggregate) Close() error {
+	return a.input.Close()
+}
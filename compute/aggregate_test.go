@@ -0,0 +1,166 @@
+package compute
+
+import (
+	"io"
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/value"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/segmentio/parquet-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashAggregate(t *testing.T) {
+	type sample struct {
+		t int64
+		v float64
+	}
+	chunk := func(seriesID int64, job string, samples ...sample) []parquet.Value {
+		chk := chunkenc.NewXORChunk()
+		app, err := chk.Appender()
+		require.NoError(t, err)
+		for _, s := range samples {
+			app.Append(s.t, s.v)
+		}
+		return []parquet.Value{
+			parquet.Int64Value(seriesID),
+			parquet.ByteArrayValue([]byte(job)),
+			parquet.Int64Value(samples[0].t),
+			parquet.Int64Value(samples[len(samples)-1].t),
+			parquet.ByteArrayValue(chk.Bytes()),
+			parquet.Int32Value(int32(chunkenc.EncXOR)),
+		}
+	}
+	// Chunks of a series are not in time order, and are split across batches.
+	input := []Batch{
+		rowsToBatch(
+			chunk(0, "a", sample{60, 3}, sample{90, 4}),
+			chunk(1, "a", sample{0, 10}, sample{60, 20}),
+		),
+		rowsToBatch(
+			chunk(2, "b", sample{30, 5}, sample{60, math.Float64frombits(value.StaleNaN)}),
+			chunk(0, "a", sample{0, 1}, sample{30, 2}),
+		),
+	}
+	// Chunks of each series are contiguous for the sorted aggregate, but still split across batches.
+	sortedInput := []Batch{
+		rowsToBatch(
+			chunk(1, "a", sample{0, 10}, sample{60, 20}),
+			chunk(0, "a", sample{60, 3}, sample{90, 4}),
+		),
+		rowsToBatch(
+			chunk(0, "a", sample{0, 1}, sample{30, 2}),
+			chunk(2, "b", sample{30, 5}, sample{60, math.Float64frombits(value.StaleNaN)}),
+		),
+	}
+	steps := Steps{Start: 0, End: 120, Interval: 30, Lookback: 40}
+
+	type result struct {
+		job string
+		t   int64
+		v   float64
+	}
+	cases := []struct {
+		fn       AggregateFunc
+		expected []result
+	}{
+		{
+			fn:       AggregateSum,
+			expected: []result{{"a", 0, 11}, {"a", 30, 12}, {"a", 60, 23}, {"a", 90, 24}, {"a", 120, 4}, {"b", 30, 5}},
+		},
+		{
+			fn:       AggregateCount,
+			expected: []result{{"a", 0, 2}, {"a", 30, 2}, {"a", 60, 2}, {"a", 90, 2}, {"a", 120, 1}, {"b", 30, 1}},
+		},
+		{
+			fn:       AggregateMin,
+			expected: []result{{"a", 0, 1}, {"a", 30, 2}, {"a", 60, 3}, {"a", 90, 4}, {"a", 120, 4}, {"b", 30, 5}},
+		},
+		{
+			fn:       AggregateMax,
+			expected: []result{{"a", 0, 10}, {"a", 30, 10}, {"a", 60, 20}, {"a", 90, 20}, {"a", 120, 4}, {"b", 30, 5}},
+		},
+		{
+			fn:       AggregateAvg,
+			expected: []result{{"a", 0, 5.5}, {"a", 30, 6}, {"a", 60, 11.5}, {"a", 90, 12}, {"a", 120, 4}, {"b", 30, 5}},
+		},
+	}
+	for _, tcase := range cases {
+		for _, aggregate := range []*HashAggregate{
+			NewHashAggregate(&batchesFragment{batches: input, batchSize: 4}, tcase.fn, 1, steps),
+			NewSortedHashAggregate(&batchesFragment{batches: sortedInput, batchSize: 4}, tcase.fn, 1, steps),
+		} {
+			var results []result
+			for {
+				batch, err := aggregate.NextBatch()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				require.LessOrEqual(t, len(batch[0]), 4)
+				for i := range batch[0] {
+					results = append(results, result{batch[0][i].String(), batch[1][i].Int64(), batch[2][i].Double()})
+				}
+				aggregate.Release(batch)
+			}
+			require.NoError(t, aggregate.Close())
+			require.Equal(t, tcase.expected, results)
+		}
+	}
+}
+
+func TestHashAggregateInstant(t *testing.T) {
+	chk := chunkenc.NewXORChunk()
+	app, err := chk.Appender()
+	require.NoError(t, err)
+	app.Append(10, 1)
+	app.Append(20, 2)
+	input := rowsToBatch([]parquet.Value{
+		parquet.Int64Value(0),
+		parquet.Int64Value(10),
+		parquet.Int64Value(20),
+		parquet.ByteArrayValue(chk.Bytes()),
+	})
+
+	aggregate := NewHashAggregate(&batchesFragment{batches: []Batch{input}, batchSize: 10}, AggregateSum, 0, Steps{Start: 15, End: 15, Lookback: 10})
+	batch, err := aggregate.NextBatch()
+	require.NoError(t, err)
+	require.Len(t, batch, 2)
+	require.Equal(t, []int64{15}, []int64{batch[0][0].Int64()})
+	require.Equal(t, 1.0, batch[1][0].Double())
+	_, err = aggregate.NextBatch()
+	require.Equal(t, io.EOF, err)
+}
+
+// rowsToBatch transposes rows of values into a batch of columns.
+func rowsToBatch(rows ...[]parquet.Value) Batch {
+	batch := make(Batch, len(rows[0]))
+	for _, row := range rows {
+		for i, v := range row {
+			batch[i] = append(batch[i], v)
+		}
+	}
+	return batch
+}
+
+// batchesFragment returns a fixed list of batches.
+type batchesFragment struct {
+	batches   []Batch
+	batchSize int64
+	closed    bool
+}
+
+func (f *batchesFragment) NextBatch() (Batch, error) {
+	if len(f.batches) == 0 {
+		return nil, io.EOF
+	}
+	batch := f.batches[0]
+	f.batches = f.batches[1:]
+	return batch, nil
+}
+
+func (f *batchesFragment) MaxBatchSize() int64 { return f.batchSize }
+func (f *batchesFragment) Release(Batch)       {}
+func (f *batchesFragment) Stats() *StatsNode   { return NewStatsNode("Batches") }
+func (f *batchesFragment) Close() error        { f.closed = true; return nil }
@@ -56,6 +56,10 @@ func (c *Concurrent) Release(batch Batch) {
 	c.fragment.Release(batch)
 }
 
+func (c *Concurrent) Stats() *StatsNode {
+	return NewStatsNode("Concurrent", c.fragment.Stats())
+}
+
 func (c *Concurrent) Close() error {
 	if c.cancel != nil {
 		c.cancel()
@@ -75,5 +75,6 @@ func (t *testFragment) NextBatch() (Batch, error) {
 	t.numBatches--
 	return t.batch, nil
 }
-func (t *testFragment) Release(_ Batch) {}
-func (t *testFragment) Close() error    { return nil }
+func (t *testFragment) Release(_ Batch)   {}
+func (t *testFragment) Stats() *StatsNode { return NewStatsNode("Test") }
+func (t *testFragment) Close() error      { return nil }
@@ -1,61 +1,243 @@
 package compute
 
 import (
+	"bytes"
+	"encoding/binary"
+	"hash/maphash"
+	"io"
+
 	"github.com/segmentio/parquet-go"
 )
 
+// seenKeyOverhead is the approximate memory used by an entry of the set of seen keys, without the bytes of the key.
+const seenKeyOverhead = 48
+
+// Unique returns the first row of each distinct key, where keys are the values of one or more columns.
+//
+// Keys of hashed inputs are kept in a set until it uses more than the memory limit. Rows with keys
+// which are not in the set are then spilled to files partitioned by the hash of their key, and each
+// partition is deduplicated once the input is consumed. Rows of spilled keys are returned last.
 type Unique struct {
-	projection     Projections
-	distinctColumn int
+	input   Fragment
+	columns []int
+	// sorted is set when equal keys are contiguous. Only the last key
+	// is then kept instead of all seen keys.
+	sorted bool
+
+	spillOpts  spillOpts
+	seen       map[string]struct{}
+	seenSize   int64
+	key        []byte
+	lastKey    []byte
+	hasLastKey bool
+
+	seed        maphash.Seed
+	partitions  []*spillFile
+	numColumns  int
+	spilledRow  []parquet.Value
+	inputDone   bool
+	partition   int
+	partitionIn *Unique
+
+	rows []int
+	pool *valuesPool
+
+	rowsIn      int64
+	rowsOut     int64
+	spilledRows int64
+}
+
+func UniqueByColumn(byColumnIndex int, input Fragment) *Unique {
+	return UniqueByColumns([]int{byColumnIndex}, input)
+}
+
+// UniqueByColumns returns the first row of each distinct combination of values of the columns.
+func UniqueByColumns(columns []int, input Fragment, opts ...SpillOption) *Unique {
+	d := newUnique(columns, input, false)
+	d.seen = make(map[string]struct{})
+	d.seed = maphash.MakeSeed()
+	for _, opt := range opts {
+		opt(&d.spillOpts)
+	}
+	return d
+}
+
+// UniqueBySortedColumn is like UniqueByColumn for inputs in which equal values of the
+// column are contiguous, such as series IDs in files sorted by series.
+// Rows are deduplicated by comparing each value with the previous one, without hashing.
+func UniqueBySortedColumn(byColumnIndex int, input Fragment) *Unique {
+	return UniqueBySortedColumns([]int{byColumnIndex}, input)
+}
 
-	seenValues map[parquet.Value]struct{}
-	batchRows  []int
-	pool       *valuesPool
+// UniqueBySortedColumns is like UniqueByColumns for inputs in which equal keys are contiguous.
+// Only the previous key is kept in memory.
+func UniqueBySortedColumns(columns []int, input Fragment) *Unique {
+	return newUnique(columns, input, true)
 }
 
-func UniqueByColumn(byColumnIndex int, projections Projections) *Unique {
+func newUnique(columns []int, input Fragment, sorted bool) *Unique {
 	return &Unique{
-		projection:     projections,
-		distinctColumn: byColumnIndex,
+		input:     input,
+		columns:   columns,
+		sorted:    sorted,
+		spillOpts: defaultSpillOpts(),
 
-		pool:       newValuesPool(projections.MaxBatchSize()),
-		batchRows:  make([]int, int(projections.MaxBatchSize())),
-		seenValues: make(map[parquet.Value]struct{}),
+		pool: newValuesPool(input.MaxBatchSize()),
+		rows: make([]int, int(input.MaxBatchSize())),
 	}
 }
 
 func (d *Unique) NextBatch() (Batch, error) {
-	inputBatch, err := d.projection.NextBatch()
+	if !d.inputDone {
+		batch, err := d.nextInputBatch()
+		if err != io.EOF {
+			return batch, err
+		}
+		// Keys of spilled rows are never in the set, so it is no longer needed.
+		d.inputDone, d.seen = true, nil
+	}
+	return d.nextPartitionBatch()
+}
+
+func (d *Unique) nextInputBatch() (Batch, error) {
+	inputBatch, err := d.input.NextBatch()
 	if err != nil {
 		return nil, err
 	}
-	defer d.projection.Release(inputBatch)
+	defer d.input.Release(inputBatch)
 
-	outputBatch := make([][]parquet.Value, len(d.projection.columns))
+	outputBatch := make([][]parquet.Value, len(inputBatch))
 	for i := range inputBatch {
 		outputBatch[i] = d.pool.get()[:0]
 	}
 
-	d.batchRows = d.batchRows[:0]
-	for i, distinctValue := range inputBatch[d.distinctColumn] {
-		if _, ok := d.seenValues[distinctValue]; ok {
+	d.rows = d.rows[:0]
+	for row := 0; row < batchRows(inputBatch); row++ {
+		d.key = appendKey(d.key[:0], inputBatch, row, d.columns)
+		if d.sorted {
+			if d.hasLastKey && bytes.Equal(d.key, d.lastKey) {
+				continue
+			}
+			d.key, d.lastKey, d.hasLastKey = d.lastKey, d.key, true
+			d.rows = append(d.rows, row)
+			continue
+		}
+		if _, ok := d.seen[string(d.key)]; ok {
 			continue
 		}
-		d.seenValues[distinctValue] = struct{}{}
-		d.batchRows = append(d.batchRows, i)
+		if d.partitions != nil {
+			if err := d.spillRow(inputBatch, row); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		d.seen[string(d.key)] = struct{}{}
+		d.seenSize += int64(len(d.key)) + seenKeyOverhead
+		d.rows = append(d.rows, row)
+		if d.seenSize > d.spillOpts.memoryLimit {
+			if d.partitions, err = newSpillPartitions(d.spillOpts.dir, "unique-*"); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	for colIdx := range inputBatch {
-		for _, row := range d.batchRows {
+		for _, row := range d.rows {
 			outputBatch[colIdx] = append(outputBatch[colIdx], inputBatch[colIdx][row])
 		}
 	}
+	d.rowsIn += int64(batchRows(inputBatch))
+	d.rowsOut += int64(len(d.rows))
 
 	return outputBatch, nil
 }
 
+// spillRow writes a row to the partition of its key. All rows with the same key
+// are written to the same partition, which is deduplicated on its own.
+func (d *Unique) spillRow(batch Batch, row int) error {
+	d.numColumns = len(batch)
+	d.spilledRow = d.spilledRow[:0]
+	for i := range batch {
+		d.spilledRow = append(d.spilledRow, batch[i][row])
+	}
+	d.spilledRows++
+	partition := maphash.Bytes(d.seed, d.key) % uint64(len(d.partitions))
+	return d.partitions[partition].writeRow(d.spilledRow)
+}
+
+// nextPartitionBatch returns the unique rows of the spilled partitions. Each partition is read
+// by another Unique with a different hash seed, which spills again when the partition is too large.
+func (d *Unique) nextPartitionBatch() (Batch, error) {
+	for {
+		if d.partitionIn == nil {
+			if d.partition == len(d.partitions) {
+				return nil, io.EOF
+			}
+			file := d.partitions[d.partition]
+			if file.numRows == 0 {
+				if err := d.closePartition(); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			reader, err := file.reader(d.numColumns, d.MaxBatchSize())
+			if err != nil {
+				return nil, err
+			}
+			d.partitionIn = UniqueByColumns(d.columns, reader, WithMemoryLimit(d.spillOpts.memoryLimit), WithSpillDir(d.spillOpts.dir))
+			// Batches of the partition are released to this Unique.
+			d.partitionIn.pool = d.pool
+			continue
+		}
+
+		batch, err := d.partitionIn.NextBatch()
+		if err == io.EOF {
+			if err := d.closePartition(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		d.rowsOut += int64(batchRows(batch))
+		return batch, nil
+	}
+}
+
+// closePartition closes the Unique reading the current partition and removes its file.
+// Values of spill files are not read into pages, so batches of the partition remain valid.
+func (d *Unique) closePartition() error {
+	if d.partitionIn != nil {
+		if err := d.partitionIn.Close(); err != nil {
+			return err
+		}
+		d.partitionIn = nil
+	}
+	file := d.partitions[d.partition]
+	d.partitions[d.partition] = nil
+	d.partition++
+	return file.Close()
+}
+
+// appendKey appends the values of the columns of a row to the key. Each value is prefixed
+// with its length, so that keys of different values are different.
+func appendKey(key []byte, batch Batch, row int, columns []int) []byte {
+	for _, column := range columns {
+		value := batch[column][row]
+		if value.IsNull() {
+			key = binary.AppendUvarint(key, 0)
+			continue
+		}
+		valueBytes := value.Bytes()
+		key = binary.AppendUvarint(key, uint64(len(valueBytes))+1)
+		key = append(key, valueBytes...)
+	}
+	return key
+}
+
 func (d *Unique) MaxBatchSize() int64 {
-	return d.projection.MaxBatchSize()
+	return d.input.MaxBatchSize()
 }
 
 func (d *Unique) Release(batch Batch) {
@@ -64,6 +246,29 @@ func (d *Unique) Release(batch Batch) {
 	}
 }
 
+func (d *Unique) Stats() *StatsNode {
+	return NewStatsNode("Unique", d.input.Stats()).
+		Add("rows_in", d.rowsIn).
+		Add("rows_out", d.rowsOut).
+		Add("spilled_rows", d.spilledRows)
+}
+
+// Close closes the input and removes spill files.
 func (d *Unique) Close() error {
-	return d.projection.Close()
+	var spillErr error
+	if d.partitionIn != nil {
+		spillErr = d.partitionIn.Close()
+	}
+	for _, file := range d.partitions {
+		if file == nil {
+			continue
+		}
+		if err := file.Close(); err != nil && spillErr == nil {
+			spillErr = err
+		}
+	}
+	if err := d.input.Close(); err != nil {
+		return err
+	}
+	return spillErr
 }
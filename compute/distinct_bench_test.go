@@ -12,8 +12,6 @@ import (
 )
 
 func BenchmarkDistinct(b *testing.B) {
-	b.StopTimer()
-
 	numRows := 1_000_000
 	numPages := 20
 	numRowsPerPage := numRows / numPages
@@ -36,33 +34,43 @@ func BenchmarkDistinct(b *testing.B) {
 
 	var batchSize int64 = 32 * 1024
 	cols := []string{"ColumnA", "ColumnB"}
-	b.ReportAllocs()
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		b.StopTimer()
-		selection := dataset.SelectRows(file.RowGroups()[0], dataset.SelectAll())
-		projection := ProjectColumns(selection, &nopSectionLoader{}, batchSize, cols...)
-		distinct := UniqueByColumn(0, projection)
-		defer distinct.Close()
+	cases := []struct {
+		name   string
+		unique func(int, Fragment) *Unique
+	}{
+		{name: "hashed", unique: UniqueByColumn},
+		{name: "sorted", unique: UniqueBySortedColumn},
+	}
+	for _, tcase := range cases {
+		b.Run(tcase.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				selection := dataset.SelectRows(file.RowGroups()[0], dataset.SelectAll())
+				projection := ProjectColumns(selection, &nopSectionLoader{}, batchSize, cols...)
+				distinct := tcase.unique(0, projection)
+				defer distinct.Close()
 
-		b.StartTimer()
+				b.StartTimer()
 
-		var numRead int
-		for {
-			batch, err := distinct.NextBatch()
-			if err == io.EOF {
-				break
-			}
-			require.NoError(b, err)
-			for i := 1; i < len(batch); i++ {
-				require.Equal(b, len(batch[0]), len(batch[i]))
-			}
-			numRead += len(batch[0])
+				var numRead int
+				for {
+					batch, err := distinct.NextBatch()
+					if err == io.EOF {
+						break
+					}
+					require.NoError(b, err)
+					for i := 1; i < len(batch); i++ {
+						require.Equal(b, len(batch[0]), len(batch[i]))
+					}
+					numRead += len(batch[0])
 
-			require.Len(b, batch, len(cols))
-			require.LessOrEqual(b, int64(len(batch[0])), batchSize)
-			distinct.Release(batch)
-		}
-		require.EqualValues(b, 4, numRead)
+					require.Len(b, batch, len(cols))
+					require.LessOrEqual(b, int64(len(batch[0])), batchSize)
+					distinct.Release(batch)
+				}
+				require.EqualValues(b, 4, numRead)
+			}
+		})
 	}
 }
@@ -0,0 +1,136 @@
+package compute
+
+import (
+	"io"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/segmentio/parquet-go"
+	"github.com/stretchr/testify/require"
+
+	"Shopify/thanos-parquet-engine/dataset"
+	"Shopify/thanos-parquet-engine/pqtest"
+)
+
+func TestUnique(t *testing.T) {
+	rows := [][]pqtest.Row{{
+		pqtest.TwoColumnRow("val1", "val1"),
+		pqtest.TwoColumnRow("val1", "val2"),
+		pqtest.TwoColumnRow("val2", "val3"),
+	}, {
+		pqtest.TwoColumnRow("val2", "val4"),
+		pqtest.TwoColumnRow("val2", "val5"),
+		pqtest.TwoColumnRow("val3", "val6"),
+	}}
+	cases := []struct {
+		name   string
+		unique func(int, Fragment) *Unique
+	}{
+		{name: "hashed", unique: UniqueByColumn},
+		{name: "sorted", unique: UniqueBySortedColumn},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			pqFile, err := pqtest.CreateFile(rows)
+			require.NoError(t, err)
+
+			selection := dataset.SelectRows(pqFile.RowGroups()[0], dataset.SelectAll())
+			// Batches of two rows make equal values span batch boundaries.
+			unique := tcase.unique(0, ProjectColumns(selection, &nopSectionLoader{}, 2, "ColumnA", "ColumnB"))
+			defer unique.Close()
+
+			var result [][]string
+			for {
+				batch, err := unique.NextBatch()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				for i := range batch[0] {
+					result = append(result, []string{batch[0][i].String(), batch[1][i].String()})
+				}
+				unique.Release(batch)
+			}
+			require.Equal(t, [][]string{{"val1", "val1"}, {"val2", "val3"}, {"val3", "val6"}}, result)
+		})
+	}
+}
+
+func TestUniqueByColumns(t *testing.T) {
+	row := func(a, b string, value int64) []parquet.Value {
+		return []parquet.Value{parquet.ByteArrayValue([]byte(a)), parquet.ByteArrayValue([]byte(b)), parquet.Int64Value(value)}
+	}
+	withNull := func(row []parquet.Value, column int) []parquet.Value {
+		row[column] = parquet.NullValue()
+		return row
+	}
+	// Equal keys are contiguous, so the same input is valid for sorted keys.
+	newInput := func() *batchesFragment {
+		return &batchesFragment{batchSize: 2, batches: []Batch{
+			rowsToBatch(row("x", "1", 1), row("x", "1", 2)),
+			rowsToBatch(row("x", "2", 3), row("y", "1", 4)),
+			rowsToBatch(row("y", "1", 5), withNull(row("", "1", 6), 0)),
+			rowsToBatch(withNull(row("", "1", 7), 0), withNull(row("y", "", 8), 1)),
+			rowsToBatch(row("x", "12", 9), row("x1", "2", 10)),
+		}}
+	}
+
+	cases := []struct {
+		name   string
+		unique func(Fragment, string) *Unique
+		spills bool
+	}{
+		{
+			name: "hashed",
+			unique: func(input Fragment, _ string) *Unique {
+				return UniqueByColumns([]int{0, 1}, input)
+			},
+		},
+		{
+			name: "hashed with spilling",
+			unique: func(input Fragment, spillDir string) *Unique {
+				return UniqueByColumns([]int{0, 1}, input, WithMemoryLimit(1), WithSpillDir(spillDir))
+			},
+			spills: true,
+		},
+		{
+			name: "sorted",
+			unique: func(input Fragment, _ string) *Unique {
+				return UniqueBySortedColumns([]int{0, 1}, input)
+			},
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			spillDir := t.TempDir()
+			input := newInput()
+			unique := tcase.unique(input, spillDir)
+
+			var result []int64
+			for {
+				batch, err := unique.NextBatch()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				for _, v := range batch[2] {
+					result = append(result, v.Int64())
+				}
+				unique.Release(batch)
+			}
+			if tcase.spills {
+				// Rows of spilled keys are returned by partition.
+				sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+				require.Positive(t, unique.spilledRows)
+			}
+			require.Equal(t, []int64{1, 3, 4, 6, 8, 9, 10}, result)
+			require.NoError(t, unique.Close())
+			require.True(t, input.closed)
+
+			files, err := os.ReadDir(spillDir)
+			require.NoError(t, err)
+			require.Empty(t, files)
+		})
+	}
+}
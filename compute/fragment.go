@@ -13,4 +13,5 @@ type Fragment interface {
 	NextBatch() (Batch, error)
 	MaxBatchSize() int64
 	Release(Batch)
+	Stats() *StatsNode
 }
@@ -0,0 +1,734 @@
+package compute
+
+import (
+	"hash/maphash"
+	"io"
+
+	"github.com/segmentio/parquet-go"
+)
+
+// SemiJoin returns rows from the left fragment for which the value in the join column
+// is present in the join column of the right fragment. The right fragment is read
+// fully into a hash set before the first batch is returned.
+type SemiJoin struct {
+	left        Fragment
+	leftColumn  int
+	right       Fragment
+	rightColumn int
+
+	keys map[string]struct{}
+	pool *valuesPool
+
+	rightRows int64
+	rowsIn    int64
+	rowsOut   int64
+}
+
+func NewSemiJoin(left Fragment, leftColumn int, right Fragment, rightColumn int) *SemiJoin {
+	return &SemiJoin{
+		left:        left,
+		leftColumn:  leftColumn,
+		right:       right,
+		rightColumn: rightColumn,
+
+		pool: newValuesPool(left.MaxBatchSize()),
+	}
+}
+
+func (j *SemiJoin) NextBatch() (Batch, error) {
+	if j.keys == nil {
+		if err := j.readKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		inputBatch, err := j.left.NextBatch()
+		if err != nil {
+			return nil, err
+		}
+
+		outputBatch := make(Batch, len(inputBatch))
+		for i := range inputBatch {
+			outputBatch[i] = j.pool.get()[:0]
+		}
+		for row, key := range inputBatch[j.leftColumn] {
+			if _, ok := j.keys[joinKey(key)]; !ok {
+				continue
+			}
+			for i := range inputBatch {
+				outputBatch[i] = append(outputBatch[i], inputBatch[i][row])
+			}
+		}
+		j.rowsIn += int64(len(inputBatch[j.leftColumn]))
+		j.left.Release(inputBatch)
+
+		if numRows := len(outputBatch[j.leftColumn]); numRows > 0 {
+			j.rowsOut += int64(numRows)
+			return outputBatch, nil
+		}
+		j.Release(outputBatch)
+	}
+}
+
+func (j *SemiJoin) readKeys() error {
+	j.keys = make(map[string]struct{})
+	for {
+		batch, err := j.right.NextBatch()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, key := range batch[j.rightColumn] {
+			j.keys[joinKey(key)] = struct{}{}
+		}
+		j.rightRows += int64(len(batch[j.rightColumn]))
+		j.right.Release(batch)
+	}
+}
+
+func (j *SemiJoin) MaxBatchSize() int64 {
+	return j.left.MaxBatchSize()
+}
+
+func (j *SemiJoin) Release(batch Batch) {
+	for _, column := range batch {
+		j.pool.put(column)
+	}
+}
+
+func (j *SemiJoin) Stats() *StatsNode {
+	return NewStatsNode("SemiJoin", j.left.Stats(), j.right.Stats()).
+		Add("right_rows", j.rightRows).
+		Add("rows_in", j.rowsIn).
+		Add("rows_out", j.rowsOut)
+}
+
+func (j *SemiJoin) Close() error {
+	leftErr := j.left.Close()
+	if err := j.right.Close(); err != nil {
+		return err
+	}
+	return leftErr
+}
+
+// joinKey returns a key which is equal for equal values of the same type,
+// regardless of the column they were read from.
+func joinKey(value parquet.Value) string {
+	return string(value.Bytes())
+}
+
+// joinOutput appends the values of a row of the left batch and a row of right values to the output batch.
+func joinOutput(output Batch, left Batch, leftRow int, right []parquet.Value) {
+	for i := range left {
+		output[i] = append(output[i], left[i][leftRow])
+	}
+	for i, value := range right {
+		output[len(left)+i] = append(output[len(left)+i], value)
+	}
+}
+
+// cloneRow returns a copy of the values of a row of the batch which is valid after the batch is released.
+func cloneRow(batch Batch, row int) []parquet.Value {
+	values := make([]parquet.Value, len(batch))
+	for i := range batch {
+		values[i] = batch[i][row].Clone()
+	}
+	return values
+}
+
+// MergeJoin is an inner join of two fragments which are both sorted by their join column.
+// Output batches have the columns of the left fragment followed by the columns of the right fragment,
+// with a row for each pair of left and right rows with equal keys, in the order of the left fragment.
+// Rows with null keys do not match any row.
+//
+// Only the right rows of the current key are kept in memory, such as the chunks of a single series
+// when joining on the series ID.
+type MergeJoin struct {
+	left        Fragment
+	leftColumn  int
+	right       Fragment
+	rightColumn int
+
+	leftBatch Batch
+	leftRow   int
+	// match is the next right row of the group to join with the current left row.
+	match int
+
+	rightBatch     Batch
+	rightRow       int
+	rightColumns   int
+	rightExhausted bool
+	group          [][]parquet.Value
+
+	pool    *valuesPool
+	rowsIn  int64
+	rowsOut int64
+}
+
+func NewMergeJoin(left Fragment, leftColumn int, right Fragment, rightColumn int) *MergeJoin {
+	return &MergeJoin{
+		left:        left,
+		leftColumn:  leftColumn,
+		right:       right,
+		rightColumn: rightColumn,
+
+		pool: newValuesPool(left.MaxBatchSize()),
+	}
+}
+
+func (j *MergeJoin) NextBatch() (Batch, error) {
+	var output Batch
+	for {
+		if j.leftRow >= batchRows(j.leftBatch) {
+			// Output values point into the current left batch, so it is only released
+			// once the output has been returned.
+			if batchRows(output) > 0 {
+				return output, nil
+			}
+			if err := j.nextLeftBatch(); err != nil {
+				if output != nil {
+					j.Release(output)
+				}
+				return nil, err
+			}
+			continue
+		}
+		if output == nil {
+			output = j.newOutput()
+		}
+		if batchRows(output) == int(j.MaxBatchSize()) {
+			return output, nil
+		}
+
+		key := j.leftBatch[j.leftColumn][j.leftRow]
+		if key.IsNull() {
+			j.leftRow++
+			continue
+		}
+		if len(j.group) == 0 || compareValues(key, j.group[0][j.rightColumn]) > 0 {
+			if err := j.nextGroup(key); err != nil {
+				return nil, err
+			}
+		}
+		if len(j.group) == 0 {
+			// The right fragment has no more rows, so no more left rows can match.
+			j.leftRow = batchRows(j.leftBatch)
+			continue
+		}
+		if compareValues(key, j.group[0][j.rightColumn]) < 0 {
+			j.leftRow++
+			continue
+		}
+
+		for ; j.match < len(j.group) && batchRows(output) < int(j.MaxBatchSize()); j.match++ {
+			joinOutput(output, j.leftBatch, j.leftRow, j.group[j.match])
+			j.rowsOut++
+		}
+		if j.match == len(j.group) {
+			j.leftRow, j.match = j.leftRow+1, 0
+		}
+	}
+}
+
+func (j *MergeJoin) newOutput() Batch {
+	output := make(Batch, len(j.leftBatch)+j.rightColumns)
+	for i := range output {
+		output[i] = j.pool.get()[:0]
+	}
+	return output
+}
+
+func (j *MergeJoin) nextLeftBatch() error {
+	if j.leftBatch != nil {
+		j.left.Release(j.leftBatch)
+		j.leftBatch = nil
+	}
+	for j.leftBatch == nil {
+		batch, err := j.left.NextBatch()
+		if err != nil {
+			return err
+		}
+		if batchRows(batch) == 0 {
+			j.left.Release(batch)
+			continue
+		}
+		j.leftBatch, j.leftRow = batch, 0
+		j.rowsIn += int64(batchRows(batch))
+	}
+	// The number of right columns is only known once the first right batch is read.
+	if j.rightBatch == nil && !j.rightExhausted {
+		return j.nextRightBatch()
+	}
+	return nil
+}
+
+// nextGroup reads the right rows with the first key which is not smaller than the given key.
+// The group is empty when the right fragment has no more rows.
+func (j *MergeJoin) nextGroup(key parquet.Value) error {
+	j.group = j.group[:0]
+	for {
+		if j.rightRow >= batchRows(j.rightBatch) {
+			if j.rightExhausted {
+				return nil
+			}
+			if err := j.nextRightBatch(); err != nil {
+				return err
+			}
+			continue
+		}
+		rightKey := j.rightBatch[j.rightColumn][j.rightRow]
+		switch {
+		case rightKey.IsNull() || len(j.group) == 0 && compareValues(rightKey, key) < 0:
+			j.rightRow++
+		case len(j.group) == 0 || compareValues(rightKey, j.group[0][j.rightColumn]) == 0:
+			j.group = append(j.group, cloneRow(j.rightBatch, j.rightRow))
+			j.rightRow++
+		default:
+			return nil
+		}
+	}
+}
+
+func (j *MergeJoin) nextRightBatch() error {
+	if j.rightBatch != nil {
+		j.right.Release(j.rightBatch)
+		j.rightBatch = nil
+	}
+	batch, err := j.right.NextBatch()
+	if err == io.EOF {
+		j.rightExhausted = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	j.rightBatch, j.rightRow, j.rightColumns = batch, 0, len(batch)
+	return nil
+}
+
+func (j *MergeJoin) MaxBatchSize() int64 {
+	return j.left.MaxBatchSize()
+}
+
+func (j *MergeJoin) Release(batch Batch) {
+	for _, column := range batch {
+		j.pool.put(column)
+	}
+}
+
+func (j *MergeJoin) Stats() *StatsNode {
+	return NewStatsNode("MergeJoin", j.left.Stats(), j.right.Stats()).
+		Add("rows_in", j.rowsIn).
+		Add("rows_out", j.rowsOut)
+}
+
+func (j *MergeJoin) Close() error {
+	leftErr := j.left.Close()
+	if err := j.right.Close(); err != nil {
+		return err
+	}
+	return leftErr
+}
+
+// HashJoin is an inner join of two fragments which are not sorted by their join column.
+// Output batches have the columns of the left fragment followed by the columns of the right fragment,
+// with a row for each pair of left and right rows with equal keys, in the order of the left fragment.
+// Rows with null keys do not match any row.
+//
+// The right fragment is read into a hash table before the first batch is returned. When its rows
+// use more than the memory limit, rows of both fragments are partitioned by key into spill files,
+// and partitions are joined one at a time. Rows are then no longer returned in the order of the left fragment.
+// Partitions whose right rows still use more than the memory limit are joined by another HashJoin
+// with a different hash seed, which partitions them again.
+type HashJoin struct {
+	left        Fragment
+	leftColumn  int
+	right       Fragment
+	rightColumn int
+
+	spillOpts spillOpts
+
+	built        bool
+	table        map[string][][]parquet.Value
+	tableSize    int64
+	leftColumns  int
+	rightColumns int
+
+	seed            maphash.Seed
+	rightPartitions []*spillFile
+	leftPartitions  []*spillFile
+	partition       int
+	// nested joins the current partition when its right rows do not fit into memory.
+	nested *HashJoin
+
+	probe      Fragment
+	probeBatch Batch
+	probeRow   int
+	// match is the next right row to join with the current left row.
+	match int
+
+	pool        *valuesPool
+	rightRows   int64
+	spilledRows int64
+	rowsIn      int64
+	rowsOut     int64
+}
+
+func NewHashJoin(left Fragment, leftColumn int, right Fragment, rightColumn int, opts ...SpillOption) *HashJoin {
+	j := &HashJoin{
+		left:        left,
+		leftColumn:  leftColumn,
+		right:       right,
+		rightColumn: rightColumn,
+
+		spillOpts: defaultSpillOpts(),
+
+		table: make(map[string][][]parquet.Value),
+		seed:  maphash.MakeSeed(),
+		probe: left,
+		pool:  newValuesPool(left.MaxBatchSize()),
+	}
+	for _, opt := range opts {
+		opt(&j.spillOpts)
+	}
+	return j
+}
+
+func (j *HashJoin) NextBatch() (Batch, error) {
+	if !j.built {
+		if err := j.build(); err != nil {
+			return nil, err
+		}
+		j.built = true
+	}
+
+	var output Batch
+	for {
+		if j.nested != nil {
+			if output != nil {
+				j.Release(output)
+			}
+			return j.nextNestedBatch()
+		}
+		if j.probeRow >= batchRows(j.probeBatch) {
+			// Output values point into the current left batch, so it is only released
+			// once the output has been returned.
+			if batchRows(output) > 0 {
+				return output, nil
+			}
+			if err := j.nextProbeBatch(); err != nil {
+				if output != nil {
+					j.Release(output)
+				}
+				return nil, err
+			}
+			continue
+		}
+		if output == nil {
+			output = j.newOutput()
+		}
+		if batchRows(output) == int(j.MaxBatchSize()) {
+			return output, nil
+		}
+
+		var matches [][]parquet.Value
+		if key := j.probeBatch[j.leftColumn][j.probeRow]; !key.IsNull() {
+			matches = j.table[joinKey(key)]
+		}
+		for ; j.match < len(matches) && batchRows(output) < int(j.MaxBatchSize()); j.match++ {
+			joinOutput(output, j.probeBatch, j.probeRow, matches[j.match])
+			j.rowsOut++
+		}
+		if j.match == len(matches) {
+			j.probeRow, j.match = j.probeRow+1, 0
+		}
+	}
+}
+
+func (j *HashJoin) newOutput() Batch {
+	output := make(Batch, len(j.probeBatch)+j.rightColumns)
+	for i := range output {
+		output[i] = j.pool.get()[:0]
+	}
+	return output
+}
+
+// build reads the right fragment into the hash table, and partitions both fragments
+// into spill files once the table uses more than the memory limit.
+func (j *HashJoin) build() error {
+	for {
+		batch, err := j.right.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		j.rightColumns = len(batch)
+		for row := 0; row < batchRows(batch); row++ {
+			if batch[j.rightColumn][row].IsNull() {
+				continue
+			}
+			// Values point into pages which are released with the input batch.
+			if err := j.addRightRow(cloneRow(batch, row)); err != nil {
+				return err
+			}
+		}
+		j.rightRows += int64(batchRows(batch))
+		j.right.Release(batch)
+	}
+	if j.rightPartitions == nil {
+		return nil
+	}
+
+	j.table = nil
+	return j.partitionLeft()
+}
+
+func (j *HashJoin) addRightRow(values []parquet.Value) error {
+	if j.rightPartitions != nil {
+		return j.spillRow(j.rightPartitions, j.rightColumn, values)
+	}
+	key := joinKey(values[j.rightColumn])
+	j.table[key] = append(j.table[key], values)
+	j.tableSize += rowSize(values)
+	if j.tableSize <= j.spillOpts.memoryLimit {
+		return nil
+	}
+
+	var err error
+	if j.rightPartitions, err = newSpillPartitions(j.spillOpts.dir, "join-right-*"); err != nil {
+		return err
+	}
+	for _, rows := range j.table {
+		for _, values := range rows {
+			if err := j.spillRow(j.rightPartitions, j.rightColumn, values); err != nil {
+				return err
+			}
+		}
+	}
+	j.table, j.tableSize = make(map[string][][]parquet.Value), 0
+	return nil
+}
+
+// partitionLeft writes rows of the left fragment into the partitions of their keys.
+func (j *HashJoin) partitionLeft() error {
+	var err error
+	if j.leftPartitions, err = newSpillPartitions(j.spillOpts.dir, "join-left-*"); err != nil {
+		return err
+	}
+	values := make([]parquet.Value, 0)
+	for {
+		batch, err := j.left.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		j.leftColumns = len(batch)
+		for row := 0; row < batchRows(batch); row++ {
+			if batch[j.leftColumn][row].IsNull() {
+				continue
+			}
+			values = values[:0]
+			for i := range batch {
+				values = append(values, batch[i][row])
+			}
+			if err := j.spillRow(j.leftPartitions, j.leftColumn, values); err != nil {
+				return err
+			}
+		}
+		j.rowsIn += int64(batchRows(batch))
+		j.left.Release(batch)
+	}
+	j.probe = nil
+	return nil
+}
+
+func (j *HashJoin) spillRow(partitions []*spillFile, keyColumn int, values []parquet.Value) error {
+	partition := maphash.Bytes(j.seed, values[keyColumn].Bytes()) % uint64(len(partitions))
+	j.spilledRows++
+	return partitions[partition].writeRow(values)
+}
+
+func (j *HashJoin) nextProbeBatch() error {
+	if j.probeBatch != nil {
+		j.probe.Release(j.probeBatch)
+		j.probeBatch = nil
+	}
+	for j.probeBatch == nil {
+		if j.probe == nil {
+			if j.partition == len(j.leftPartitions) {
+				return io.EOF
+			}
+			if err := j.loadPartition(); err != nil {
+				return err
+			}
+			if j.nested != nil {
+				return nil
+			}
+			continue
+		}
+		batch, err := j.probe.NextBatch()
+		if err == io.EOF && j.leftPartitions != nil {
+			j.probe = nil
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if j.leftPartitions == nil {
+			j.rowsIn += int64(batchRows(batch))
+		}
+		if batchRows(batch) == 0 {
+			j.probe.Release(batch)
+			continue
+		}
+		j.probeBatch, j.probeRow = batch, 0
+	}
+	return nil
+}
+
+// loadPartition reads the right rows of the next partition into the hash table, and
+// probes it with the left rows of the partition. Files of the previous partition are removed.
+func (j *HashJoin) loadPartition() error {
+	if j.partition > 0 {
+		if err := j.closePartition(j.partition - 1); err != nil {
+			return err
+		}
+	}
+	partition := j.partition
+	j.partition++
+	// Rows of partitions without rows on either side never match.
+	if j.rightPartitions[partition].numRows == 0 || j.leftPartitions[partition].numRows == 0 {
+		return nil
+	}
+
+	right, err := j.rightPartitions[partition].reader(j.rightColumns, j.MaxBatchSize())
+	if err != nil {
+		return err
+	}
+	j.table, j.tableSize = make(map[string][][]parquet.Value), 0
+	for {
+		batch, err := right.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// Values of spill files are not read into pages, so rows reference them without cloning.
+		for row := 0; row < batchRows(batch); row++ {
+			values := make([]parquet.Value, len(batch))
+			for i := range batch {
+				values[i] = batch[i][row]
+			}
+			key := joinKey(values[j.rightColumn])
+			j.table[key] = append(j.table[key], values)
+			j.tableSize += rowSize(values)
+		}
+		// Rows of a single key cannot be split by partitioning them again, so they are joined in memory.
+		if j.tableSize > j.spillOpts.memoryLimit && len(j.table) > 1 {
+			return j.repartition(partition)
+		}
+	}
+
+	j.probe, err = j.leftPartitions[partition].reader(j.leftColumns, j.MaxBatchSize())
+	return err
+}
+
+// repartition joins the rows of a partition with a nested join, which partitions them again with a different seed.
+func (j *HashJoin) repartition(partition int) error {
+	j.table, j.tableSize = nil, 0
+	right, err := j.rightPartitions[partition].reader(j.rightColumns, j.MaxBatchSize())
+	if err != nil {
+		return err
+	}
+	left, err := j.leftPartitions[partition].reader(j.leftColumns, j.MaxBatchSize())
+	if err != nil {
+		return err
+	}
+	j.nested = NewHashJoin(left, j.leftColumn, right, j.rightColumn, WithMemoryLimit(j.spillOpts.memoryLimit), WithSpillDir(j.spillOpts.dir))
+	// Batches of the nested join are released to this HashJoin.
+	j.nested.pool = j.pool
+	return nil
+}
+
+// nextNestedBatch returns the next batch of the nested join, and continues with the next partition once it is exhausted.
+func (j *HashJoin) nextNestedBatch() (Batch, error) {
+	batch, err := j.nested.NextBatch()
+	if err == io.EOF {
+		if err := j.closeNested(); err != nil {
+			return nil, err
+		}
+		return j.NextBatch()
+	}
+	if err != nil {
+		return nil, err
+	}
+	j.rowsOut += int64(batchRows(batch))
+	return batch, nil
+}
+
+func (j *HashJoin) closeNested() error {
+	if j.nested == nil {
+		return nil
+	}
+	j.spilledRows += j.nested.spilledRows
+	err := j.nested.Close()
+	j.nested = nil
+	return err
+}
+
+func (j *HashJoin) closePartition(partition int) error {
+	for _, partitions := range [][]*spillFile{j.rightPartitions, j.leftPartitions} {
+		if partitions == nil || partitions[partition] == nil {
+			continue
+		}
+		if err := partitions[partition].Close(); err != nil {
+			return err
+		}
+		partitions[partition] = nil
+	}
+	return nil
+}
+
+func (j *HashJoin) MaxBatchSize() int64 {
+	return j.left.MaxBatchSize()
+}
+
+func (j *HashJoin) Release(batch Batch) {
+	for _, column := range batch {
+		j.pool.put(column)
+	}
+}
+
+func (j *HashJoin) Stats() *StatsNode {
+	return NewStatsNode("HashJoin", j.left.Stats(), j.right.Stats()).
+		Add("right_rows", j.rightRows).
+		Add("spilled_rows", j.spilledRows).
+		Add("rows_in", j.rowsIn).
+		Add("rows_out", j.rowsOut)
+}
+
+// Close closes both fragments and removes spill files.
+func (j *HashJoin) Close() error {
+	spillErr := j.closeNested()
+	for partition := range j.rightPartitions {
+		if err := j.closePartition(partition); err != nil && spillErr == nil {
+			spillErr = err
+		}
+	}
+	leftErr := j.left.Close()
+	if err := j.right.Close(); err != nil {
+		return err
+	}
+	if leftErr != nil {
+		return leftErr
+	}
+	return spillErr
+}
@@ -0,0 +1,228 @@
+package compute
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/segmentio/parquet-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeJoin(t *testing.T) {
+	row := func(key int64, value string) []parquet.Value {
+		return []parquet.Value{parquet.Int64Value(key), parquet.ByteArrayValue([]byte(value))}
+	}
+	nullRow := func(value string) []parquet.Value {
+		return []parquet.Value{parquet.NullValue(), parquet.ByteArrayValue([]byte(value))}
+	}
+
+	cases := []struct {
+		name     string
+		left     []Batch
+		right    []Batch
+		expected []string
+	}{
+		{
+			name:     "unique keys",
+			left:     []Batch{rowsToBatch(row(1, "a"), row(2, "b")), rowsToBatch(row(4, "d"))},
+			right:    []Batch{rowsToBatch(row(2, "x"), row(3, "y")), rowsToBatch(row(4, "z"))},
+			expected: []string{"2 b 2 x", "4 d 4 z"},
+		},
+		{
+			name:  "duplicate keys across batches",
+			left:  []Batch{rowsToBatch(row(1, "a"), row(1, "b")), rowsToBatch(row(1, "c"), row(2, "d"))},
+			right: []Batch{rowsToBatch(row(0, "w"), row(1, "x")), rowsToBatch(row(1, "y"), row(2, "z"))},
+			expected: []string{
+				"1 a 1 x", "1 a 1 y",
+				"1 b 1 x", "1 b 1 y",
+				"1 c 1 x", "1 c 1 y",
+				"2 d 2 z",
+			},
+		},
+		{
+			name:     "null keys",
+			left:     []Batch{rowsToBatch(nullRow("a"), row(1, "b"))},
+			right:    []Batch{rowsToBatch(nullRow("x"), row(1, "y"))},
+			expected: []string{"1 b 1 y"},
+		},
+		{
+			name:  "empty right",
+			left:  []Batch{rowsToBatch(row(1, "a"))},
+			right: nil,
+		},
+		{
+			name:  "right exhausted before left",
+			left:  []Batch{rowsToBatch(row(1, "a")), rowsToBatch(row(5, "b"), row(6, "c"))},
+			right: []Batch{rowsToBatch(row(1, "x"), row(2, "y"))},
+			expected: []string{
+				"1 a 1 x",
+			},
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			left := &batchesFragment{batchSize: 2, batches: tcase.left}
+			right := &batchesFragment{batchSize: 2, batches: tcase.right}
+			join := NewMergeJoin(left, 0, right, 0)
+
+			require.Equal(t, tcase.expected, readJoinRows(t, join))
+			require.NoError(t, join.Close())
+			require.True(t, left.closed)
+			require.True(t, right.closed)
+		})
+	}
+}
+
+func TestHashJoin(t *testing.T) {
+	row := func(key string, value int64) []parquet.Value {
+		return []parquet.Value{parquet.Int64Value(value), parquet.ByteArrayValue([]byte(key))}
+	}
+	newInputs := func() (*batchesFragment, *batchesFragment) {
+		left := &batchesFragment{batchSize: 2, batches: []Batch{
+			rowsToBatch(row("b", 1), row("a", 2)),
+			rowsToBatch(row("c", 3), row("b", 4)),
+			rowsToBatch([]parquet.Value{parquet.Int64Value(5), parquet.NullValue()}),
+		}}
+		right := &batchesFragment{batchSize: 2, batches: []Batch{
+			rowsToBatch(row("b", 10), row("d", 20)),
+			rowsToBatch(row("b", 30), row("a", 40)),
+			rowsToBatch([]parquet.Value{parquet.Int64Value(50), parquet.NullValue()}),
+		}}
+		return left, right
+	}
+	expected := []string{
+		"1 b 10 b", "1 b 30 b",
+		"2 a 40 a",
+		"4 b 10 b", "4 b 30 b",
+	}
+
+	cases := []struct {
+		name   string
+		opts   []SpillOption
+		spills bool
+	}{
+		{name: "in memory"},
+		{name: "spilled", opts: []SpillOption{WithMemoryLimit(1)}, spills: true},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			spillDir := t.TempDir()
+			left, right := newInputs()
+			join := NewHashJoin(left, 1, right, 1, append(tcase.opts, WithSpillDir(spillDir))...)
+
+			result := readJoinRows(t, join)
+			if tcase.spills {
+				// Partitions are joined one at a time, so rows are not in the order of the left fragment.
+				sort.Strings(result)
+				require.Positive(t, join.spilledRows)
+			}
+			require.Equal(t, expected, result)
+			require.NoError(t, join.Close())
+			require.True(t, left.closed)
+			require.True(t, right.closed)
+
+			files, err := os.ReadDir(spillDir)
+			require.NoError(t, err)
+			require.Empty(t, files)
+		})
+	}
+}
+
+func TestHashJoinRepartition(t *testing.T) {
+	const numKeys = 100
+	var leftRows, rightRows [][]parquet.Value
+	var expected []string
+	for i := 0; i < numKeys; i++ {
+		key := fmt.Sprintf("key-%03d", i)
+		leftRows = append(leftRows, []parquet.Value{parquet.Int64Value(int64(i)), parquet.ByteArrayValue([]byte(key))})
+		rightRows = append(rightRows, []parquet.Value{parquet.ByteArrayValue([]byte(key)), parquet.Int64Value(int64(i * 10))})
+		expected = append(expected, fmt.Sprintf("%d %s %s %d", i, key, key, i*10))
+	}
+	left := &batchesFragment{batchSize: numKeys, batches: []Batch{rowsToBatch(leftRows...)}}
+	right := &batchesFragment{batchSize: numKeys, batches: []Batch{rowsToBatch(rightRows...)}}
+
+	// Partitions of many keys are over the memory limit, so they are partitioned again.
+	// The spill dir does not exist yet, and is created by the join.
+	spillDir := filepath.Join(t.TempDir(), "spill")
+	join := NewHashJoin(left, 1, right, 0, WithMemoryLimit(1), WithSpillDir(spillDir))
+	result := readJoinRows(t, join)
+	sort.Strings(result)
+	sort.Strings(expected)
+	require.Equal(t, expected, result)
+	require.Greater(t, join.spilledRows, int64(2*numKeys))
+	require.NoError(t, join.Close())
+
+	files, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestSpillFile(t *testing.T) {
+	file, err := newSpillFile(t.TempDir(), "spill-*")
+	require.NoError(t, err)
+
+	rows := [][]parquet.Value{
+		{parquet.Int64Value(1).Level(0, 1, 0), parquet.ByteArrayValue([]byte("a")).Level(0, 1, 1)},
+		{parquet.DoubleValue(2.5).Level(0, 1, 0), parquet.ByteArrayValue(nil).Level(0, 1, 1)},
+		{parquet.BooleanValue(true).Level(0, 1, 0), parquet.NullValue().Level(0, 0, 1)},
+	}
+	for _, row := range rows {
+		require.NoError(t, file.writeRow(row))
+	}
+
+	reader, err := file.reader(2, 2)
+	require.NoError(t, err)
+	var result [][]parquet.Value
+	for {
+		batch, err := reader.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.LessOrEqual(t, batchRows(batch), 2)
+		for row := 0; row < batchRows(batch); row++ {
+			result = append(result, []parquet.Value{batch[0][row], batch[1][row]})
+		}
+	}
+	require.Len(t, result, len(rows))
+	for i := range rows {
+		for j := range rows[i] {
+			require.True(t, parquet.Equal(rows[i][j], result[i][j]), "row %d column %d: %v != %v", i, j, rows[i][j], result[i][j])
+			require.Equal(t, rows[i][j].Column(), result[i][j].Column())
+			require.Equal(t, rows[i][j].DefinitionLevel(), result[i][j].DefinitionLevel())
+		}
+	}
+
+	require.NoError(t, file.Close())
+	_, err = os.Stat(file.file.Name())
+	require.True(t, os.IsNotExist(err))
+}
+
+// readJoinRows reads all rows of a join and formats them as space separated values.
+func readJoinRows(t *testing.T, join Fragment) []string {
+	var result []string
+	for {
+		batch, err := join.NextBatch()
+		if err == io.EOF {
+			return result
+		}
+		require.NoError(t, err)
+		require.NotZero(t, batchRows(batch))
+		require.LessOrEqual(t, int64(batchRows(batch)), join.MaxBatchSize())
+		for row := 0; row < batchRows(batch); row++ {
+			var formatted string
+			for i := range batch {
+				if i > 0 {
+					formatted += " "
+				}
+				formatted += fmt.Sprint(batch[i][row])
+			}
+			result = append(result, formatted)
+		}
+		join.Release(batch)
+	}
+}
@@ -0,0 +1,277 @@
+package compute
+
+import (
+	"bytes"
+	"container/heap"
+	"io"
+
+	"github.com/segmentio/parquet-go"
+	"golang.org/x/exp/slices"
+)
+
+// Limit returns the first rows of the input fragment, up to a limit.
+// Once the limit is reached, the input is closed so that its sections stop loading pages.
+type Limit struct {
+	input Fragment
+	limit int64
+
+	inputClosed bool
+	rowsOut     int64
+}
+
+func NewLimit(input Fragment, limit int64) *Limit {
+	return &Limit{
+		input: input,
+		limit: limit,
+	}
+}
+
+func (l *Limit) NextBatch() (Batch, error) {
+	if l.rowsOut >= l.limit {
+		// Values of the last batch can point into pages of the input,
+		// so the input is only closed once the next batch is requested.
+		if err := l.closeInput(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	batch, err := l.input.NextBatch()
+	if err != nil {
+		return nil, err
+	}
+	numRows := int64(batchRows(batch))
+	if remaining := l.limit - l.rowsOut; numRows > remaining {
+		for i := range batch {
+			batch[i] = batch[i][:remaining]
+		}
+		numRows = remaining
+	}
+	l.rowsOut += numRows
+	return batch, nil
+}
+
+func (l *Limit) closeInput() error {
+	if l.inputClosed {
+		return nil
+	}
+	l.inputClosed = true
+	return l.input.Close()
+}
+
+func (l *Limit) MaxBatchSize() int64 {
+	return l.input.MaxBatchSize()
+}
+
+func (l *Limit) Release(batch Batch) {
+	l.input.Release(batch)
+}
+
+func (l *Limit) Stats() *StatsNode {
+	return NewStatsNode("Limit", l.input.Stats()).
+		Add("limit", l.limit).
+		Add("rows_out", l.rowsOut)
+}
+
+func (l *Limit) Close() error {
+	return l.closeInput()
+}
+
+// TopN returns the n rows of the input fragment with the smallest values of a column, in increasing order
+// of the column. Rows with equal values are returned in the order they were read.
+// Rows are kept in a heap of at most n rows, so all input is consumed before the first batch is returned,
+// and the input is closed as soon as it is consumed.
+type TopN struct {
+	input    Fragment
+	n        int
+	byColumn int
+
+	rows        topNRows
+	pool        *valuesPool
+	done        bool
+	inputClosed bool
+
+	rowsIn  int64
+	rowsOut int64
+}
+
+func NewTopN(input Fragment, n int, byColumn int) *TopN {
+	return &TopN{
+		input:    input,
+		n:        n,
+		byColumn: byColumn,
+		rows:     topNRows{byColumn: byColumn},
+		pool:     newValuesPool(input.MaxBatchSize()),
+	}
+}
+
+func (t *TopN) NextBatch() (Batch, error) {
+	if !t.done {
+		if err := t.consume(); err != nil {
+			return nil, err
+		}
+		t.done = true
+	}
+	if len(t.rows.rows) == 0 {
+		return nil, io.EOF
+	}
+
+	numRows := int64(len(t.rows.rows))
+	if numRows > t.MaxBatchSize() {
+		numRows = t.MaxBatchSize()
+	}
+	batch := make(Batch, len(t.rows.rows[0].values))
+	for i := range batch {
+		batch[i] = t.pool.get()[:0]
+	}
+	for _, row := range t.rows.rows[:numRows] {
+		for i, value := range row.values {
+			batch[i] = append(batch[i], value)
+		}
+	}
+	t.rows.rows = t.rows.rows[numRows:]
+	t.rowsOut += numRows
+	return batch, nil
+}
+
+// consume keeps the smallest rows of the input in a max-heap, so that the largest row is
+// replaced when a smaller one is read, and then sorts them.
+func (t *TopN) consume() error {
+	if t.n <= 0 {
+		return t.closeInput()
+	}
+	var seq int64
+	for {
+		batch, err := t.input.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for row := 0; row < batchRows(batch); row, seq = row+1, seq+1 {
+			// Rows read later are larger than earlier rows with equal values.
+			if len(t.rows.rows) == t.n && compareValues(batch[t.byColumn][row], t.rows.rows[0].values[t.byColumn]) >= 0 {
+				continue
+			}
+			// Values point into pages which are released with the input batch.
+			values := make([]parquet.Value, len(batch))
+			for i := range batch {
+				values[i] = batch[i][row].Clone()
+			}
+			if len(t.rows.rows) == t.n {
+				t.rows.rows[0] = topNRow{seq: seq, values: values}
+				heap.Fix(&t.rows, 0)
+			} else {
+				heap.Push(&t.rows, topNRow{seq: seq, values: values})
+			}
+		}
+		t.rowsIn += int64(batchRows(batch))
+		t.input.Release(batch)
+	}
+
+	slices.SortFunc(t.rows.rows, func(a, b topNRow) bool {
+		return t.rows.compare(a, b) < 0
+	})
+	return t.closeInput()
+}
+
+func (t *TopN) closeInput() error {
+	if t.inputClosed {
+		return nil
+	}
+	t.inputClosed = true
+	return t.input.Close()
+}
+
+func (t *TopN) MaxBatchSize() int64 {
+	return t.input.MaxBatchSize()
+}
+
+func (t *TopN) Release(batch Batch) {
+	for _, column := range batch {
+		t.pool.put(column)
+	}
+}
+
+func (t *TopN) Stats() *StatsNode {
+	return NewStatsNode("TopN", t.input.Stats()).
+		Add("n", t.n).
+		Add("rows_in", t.rowsIn).
+		Add("rows_out", t.rowsOut)
+}
+
+func (t *TopN) Close() error {
+	return t.closeInput()
+}
+
+type topNRow struct {
+	seq    int64
+	values []parquet.Value
+}
+
+// topNRows is a max-heap of rows ordered by the value of a column, and by the order they were read.
+type topNRows struct {
+	byColumn int
+	rows     []topNRow
+}
+
+func (h topNRows) compare(a, b topNRow) int {
+	if c := compareValues(a.values[h.byColumn], b.values[h.byColumn]); c != 0 {
+		return c
+	}
+	switch {
+	case a.seq < b.seq:
+		return -1
+	case a.seq > b.seq:
+		return 1
+	}
+	return 0
+}
+
+func (h topNRows) Len() int           { return len(h.rows) }
+func (h topNRows) Less(i, j int) bool { return h.compare(h.rows[i], h.rows[j]) > 0 }
+func (h topNRows) Swap(i, j int)      { h.rows[i], h.rows[j] = h.rows[j], h.rows[i] }
+
+func (h *topNRows) Push(x any) { h.rows = append(h.rows, x.(topNRow)) }
+
+func (h *topNRows) Pop() any {
+	last := h.rows[len(h.rows)-1]
+	h.rows = h.rows[:len(h.rows)-1]
+	return last
+}
+
+// compareValues compares two values of the same kind, with null values first.
+// Byte arrays are compared lexicographically.
+func compareValues(a, b parquet.Value) int {
+	switch {
+	case a.IsNull() && b.IsNull():
+		return 0
+	case a.IsNull():
+		return -1
+	case b.IsNull():
+		return 1
+	}
+	switch a.Kind() {
+	case parquet.Boolean:
+		return parquet.BooleanType.Compare(a, b)
+	case parquet.Int32:
+		return parquet.Int32Type.Compare(a, b)
+	case parquet.Int64:
+		return parquet.Int64Type.Compare(a, b)
+	case parquet.Float:
+		return parquet.FloatType.Compare(a, b)
+	case parquet.Double:
+		return parquet.DoubleType.Compare(a, b)
+	default:
+		return bytes.Compare(a.ByteArray(), b.ByteArray())
+	}
+}
+
+// batchRows returns the number of rows of a batch.
+func batchRows(batch Batch) int {
+	if len(batch) == 0 {
+		return 0
+	}
+	return len(batch[0])
+}
@@ -0,0 +1,146 @@
+package compute
+
+import (
+	"io"
+	"testing"
+
+	"github.com/segmentio/parquet-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimit(t *testing.T) {
+	newInput := func() *batchesFragment {
+		return &batchesFragment{batchSize: 2, batches: []Batch{
+			rowsToBatch([]parquet.Value{parquet.Int64Value(1)}, []parquet.Value{parquet.Int64Value(2)}),
+			rowsToBatch([]parquet.Value{parquet.Int64Value(3)}, []parquet.Value{parquet.Int64Value(4)}),
+			rowsToBatch([]parquet.Value{parquet.Int64Value(5)}),
+		}}
+	}
+
+	cases := []struct {
+		name        string
+		limit       int64
+		expected    []int64
+		closesInput bool
+	}{
+		{name: "zero", limit: 0, expected: nil, closesInput: true},
+		{name: "end of batch", limit: 2, expected: []int64{1, 2}, closesInput: true},
+		{name: "within batch", limit: 3, expected: []int64{1, 2, 3}, closesInput: true},
+		{name: "more than input", limit: 10, expected: []int64{1, 2, 3, 4, 5}},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			input := newInput()
+			limit := NewLimit(input, tcase.limit)
+
+			var result []int64
+			for {
+				batch, err := limit.NextBatch()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				require.False(t, input.closed, "input is closed before its last batch is released")
+				for _, v := range batch[0] {
+					result = append(result, v.Int64())
+				}
+				limit.Release(batch)
+			}
+			require.Equal(t, tcase.expected, result)
+			require.Equal(t, tcase.closesInput, input.closed)
+			require.NoError(t, limit.Close())
+		})
+	}
+}
+
+func TestLimitStopsReadingInput(t *testing.T) {
+	input := &batchesFragment{batchSize: 1, batches: []Batch{
+		rowsToBatch([]parquet.Value{parquet.Int64Value(1)}),
+		rowsToBatch([]parquet.Value{parquet.Int64Value(2)}),
+	}}
+	limit := NewLimit(input, 1)
+
+	_, err := limit.NextBatch()
+	require.NoError(t, err)
+	_, err = limit.NextBatch()
+	require.Equal(t, io.EOF, err)
+	require.True(t, input.closed)
+	require.Len(t, input.batches, 1)
+}
+
+func TestTopN(t *testing.T) {
+	row := func(name string, value int64) []parquet.Value {
+		return []parquet.Value{parquet.ByteArrayValue([]byte(name)), parquet.Int64Value(value)}
+	}
+	newInput := func() *batchesFragment {
+		return &batchesFragment{batchSize: 2, batches: []Batch{
+			rowsToBatch(row("c", 3), row("a", 10)),
+			rowsToBatch(row("b", -1), row("a", 1)),
+			rowsToBatch(row("d", 3)),
+		}}
+	}
+
+	type result struct {
+		name  string
+		value int64
+	}
+	cases := []struct {
+		name     string
+		n        int
+		byColumn int
+		expected []result
+	}{
+		{
+			name:     "by byte array column",
+			n:        3,
+			byColumn: 0,
+			expected: []result{{"a", 10}, {"a", 1}, {"b", -1}},
+		},
+		{
+			name:     "by int64 column",
+			n:        2,
+			byColumn: 1,
+			expected: []result{{"b", -1}, {"a", 1}},
+		},
+		{
+			name:     "equal values in read order",
+			n:        4,
+			byColumn: 1,
+			expected: []result{{"b", -1}, {"a", 1}, {"c", 3}, {"d", 3}},
+		},
+		{
+			name:     "more than input",
+			n:        10,
+			byColumn: 1,
+			expected: []result{{"b", -1}, {"a", 1}, {"c", 3}, {"d", 3}, {"a", 10}},
+		},
+		{
+			name:     "zero",
+			n:        0,
+			byColumn: 0,
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			input := newInput()
+			topN := NewTopN(input, tcase.n, tcase.byColumn)
+
+			var results []result
+			for {
+				batch, err := topN.NextBatch()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				require.True(t, input.closed)
+				require.LessOrEqual(t, len(batch[0]), 2)
+				for i := range batch[0] {
+					results = append(results, result{batch[0][i].String(), batch[1][i].Int64()})
+				}
+				topN.Release(batch)
+			}
+			require.Equal(t, tcase.expected, results)
+			require.NoError(t, topN.Close())
+		})
+	}
+}
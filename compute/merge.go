@@ -0,0 +1,180 @@
+package compute
+
+import (
+	"container/heap"
+	"io"
+)
+
+// SortedMerge merges fragments which are each sorted by the same key columns into a single sorted fragment.
+// Rows with equal keys are returned in the order of the fragments, such as the chunks of a series
+// in time aligned row groups. Only the current batch of each fragment is kept in memory.
+//
+// Output batches have the first numColumns columns of the inputs, so that columns which are only
+// read to compare keys can be dropped.
+type SortedMerge struct {
+	inputs     []Fragment
+	keyColumns []int
+	numColumns int
+
+	cursors mergeCursors
+	// exhausted are cursors whose batches are read again before the next output batch,
+	// since values of the previous output batch point into their batches.
+	exhausted []*mergeCursor
+	started   bool
+
+	maxBatchSize int64
+	pool         *valuesPool
+	rowsOut      int64
+}
+
+// NewSortedMerge merges the inputs by the values of the key columns, compared in order.
+func NewSortedMerge(inputs []Fragment, keyColumns []int, numColumns int) *SortedMerge {
+	var maxBatchSize int64
+	for _, input := range inputs {
+		if input.MaxBatchSize() > maxBatchSize {
+			maxBatchSize = input.MaxBatchSize()
+		}
+	}
+	return &SortedMerge{
+		inputs:       inputs,
+		keyColumns:   keyColumns,
+		numColumns:   numColumns,
+		cursors:      mergeCursors{keyColumns: keyColumns},
+		maxBatchSize: maxBatchSize,
+		pool:         newValuesPool(maxBatchSize),
+	}
+}
+
+func (m *SortedMerge) NextBatch() (Batch, error) {
+	if !m.started {
+		m.started = true
+		for i := range m.inputs {
+			m.exhausted = append(m.exhausted, &mergeCursor{input: i})
+		}
+	}
+	for _, cursor := range m.exhausted {
+		if err := m.nextCursorBatch(cursor); err != nil {
+			return nil, err
+		}
+	}
+	m.exhausted = m.exhausted[:0]
+	if m.cursors.Len() == 0 {
+		return nil, io.EOF
+	}
+
+	output := make(Batch, m.numColumns)
+	for i := range output {
+		output[i] = m.pool.get()[:0]
+	}
+	for m.cursors.Len() > 0 && batchRows(output) < int(m.maxBatchSize) {
+		cursor := m.cursors.cursors[0]
+		for i := range output {
+			output[i] = append(output[i], cursor.batch[i][cursor.row])
+		}
+		cursor.row++
+		if cursor.row < batchRows(cursor.batch) {
+			heap.Fix(&m.cursors, 0)
+			continue
+		}
+		heap.Pop(&m.cursors)
+		m.exhausted = append(m.exhausted, cursor)
+		break
+	}
+	m.rowsOut += int64(batchRows(output))
+	return output, nil
+}
+
+// nextCursorBatch releases the batch of the cursor and reads the next non-empty batch of its input.
+// The cursor is only added back to the heap if its input has more rows.
+func (m *SortedMerge) nextCursorBatch(cursor *mergeCursor) error {
+	input := m.inputs[cursor.input]
+	if cursor.batch != nil {
+		input.Release(cursor.batch)
+		cursor.batch = nil
+	}
+	for {
+		batch, err := input.NextBatch()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if batchRows(batch) == 0 {
+			input.Release(batch)
+			continue
+		}
+		cursor.batch, cursor.row = batch, 0
+		heap.Push(&m.cursors, cursor)
+		return nil
+	}
+}
+
+func (m *SortedMerge) MaxBatchSize() int64 {
+	return m.maxBatchSize
+}
+
+func (m *SortedMerge) Release(batch Batch) {
+	for _, column := range batch {
+		m.pool.put(column)
+	}
+}
+
+func (m *SortedMerge) Stats() *StatsNode {
+	children := make([]*StatsNode, 0, len(m.inputs))
+	for _, input := range m.inputs {
+		children = append(children, input.Stats())
+	}
+	return NewStatsNode("SortedMerge", children...).
+		Add("inputs", len(m.inputs)).
+		Add("rows_out", m.rowsOut)
+}
+
+func (m *SortedMerge) Close() error {
+	var firstErr error
+	for _, input := range m.inputs {
+		if err := input.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+type mergeCursor struct {
+	input int
+	batch Batch
+	row   int
+}
+
+// mergeCursors is a min-heap of cursors ordered by the key of their current row, and by their input.
+type mergeCursors struct {
+	keyColumns []int
+	cursors    []*mergeCursor
+}
+
+func (h mergeCursors) compare(a, b *mergeCursor) int {
+	for _, column := range h.keyColumns {
+		if c := compareValues(a.batch[column][a.row], b.batch[column][b.row]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a.input < b.input:
+		return -1
+	case a.input > b.input:
+		return 1
+	}
+	return 0
+}
+
+func (h mergeCursors) Len() int           { return len(h.cursors) }
+func (h mergeCursors) Less(i, j int) bool { return h.compare(h.cursors[i], h.cursors[j]) < 0 }
+func (h mergeCursors) Swap(i, j int)      { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *mergeCursors) Push(x any) { h.cursors = append(h.cursors, x.(*mergeCursor)) }
+
+func (h *mergeCursors) Pop() any {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+	return last
+}
@@ -0,0 +1,93 @@
+package compute
+
+import (
+	"io"
+	"testing"
+
+	"github.com/segmentio/parquet-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortedMerge(t *testing.T) {
+	row := func(name string, id int64, input int64) []parquet.Value {
+		return []parquet.Value{parquet.Int64Value(input), parquet.ByteArrayValue([]byte(name)), parquet.Int64Value(id)}
+	}
+	inputs := []*batchesFragment{
+		{batchSize: 2, batches: []Batch{
+			rowsToBatch(row("a", 2, 0), row("b", 1, 0)),
+			{},
+			rowsToBatch(row("c", 3, 0)),
+		}},
+		{batchSize: 3, batches: []Batch{
+			rowsToBatch(row("a", 1, 1), row("a", 2, 1), row("d", 4, 1)),
+		}},
+		{batchSize: 1},
+		{batchSize: 1, batches: []Batch{
+			rowsToBatch(row("b", 1, 3)),
+			rowsToBatch(row("c", 3, 3)),
+		}},
+	}
+	fragments := make([]Fragment, 0, len(inputs))
+	for _, input := range inputs {
+		fragments = append(fragments, input)
+	}
+	// Rows are merged by name and ID, and the input column is dropped from the output.
+	merge := NewSortedMerge(fragments, []int{1, 2, 0}, 2)
+	require.Equal(t, int64(3), merge.MaxBatchSize())
+
+	var result [][2]any
+	for {
+		batch, err := merge.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.Len(t, batch, 2)
+		require.LessOrEqual(t, int64(batchRows(batch)), merge.MaxBatchSize())
+		for i := range batch[0] {
+			result = append(result, [2]any{batch[0][i].Int64(), batch[1][i].String()})
+		}
+		merge.Release(batch)
+	}
+	require.Equal(t, [][2]any{
+		{int64(1), "a"},
+		{int64(0), "a"},
+		{int64(1), "a"},
+		{int64(0), "b"},
+		{int64(3), "b"},
+		{int64(0), "c"},
+		{int64(3), "c"},
+		{int64(1), "d"},
+	}, result)
+
+	require.NoError(t, merge.Close())
+	for _, input := range inputs {
+		require.True(t, input.closed)
+	}
+}
+
+func TestSortedMergeEqualKeys(t *testing.T) {
+	// Rows with equal keys are returned in the order of the inputs.
+	row := func(id int64, minT int64) []parquet.Value {
+		return []parquet.Value{parquet.Int64Value(id), parquet.Int64Value(minT)}
+	}
+	merge := NewSortedMerge([]Fragment{
+		&batchesFragment{batchSize: 4, batches: []Batch{rowsToBatch(row(1, 0), row(1, 10), row(2, 0))}},
+		&batchesFragment{batchSize: 4, batches: []Batch{rowsToBatch(row(1, 20), row(2, 20), row(3, 20))}},
+	}, []int{0}, 2)
+
+	var result [][2]int64
+	for {
+		batch, err := merge.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		for i := range batch[0] {
+			result = append(result, [2]int64{batch[0][i].Int64(), batch[1][i].Int64()})
+		}
+		merge.Release(batch)
+	}
+	require.Equal(t, [][2]int64{{1, 0}, {1, 10}, {1, 20}, {2, 0}, {2, 20}, {3, 20}}, result)
+	require.NoError(t, merge.Close())
+}
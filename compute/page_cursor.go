@@ -0,0 +1,113 @@
+package compute
+
+import (
+	"io"
+	"math"
+
+	"github.com/segmentio/parquet-go"
+
+	"Shopify/thanos-parquet-engine/dataset"
+	"Shopify/thanos-parquet-engine/db"
+)
+
+// noPageGap loads all selected pages of a column chunk in one section,
+// including the unselected pages between them.
+const noPageGap = math.MaxInt64
+
+// pageCursor iterates over the values of the selected pages of a column chunk,
+// for projections which copy values out of pages instead of referencing them.
+// Pages are loaded in one section for each span of coalesced pages.
+type pageCursor struct {
+	pages  dataset.RowIndexedPages
+	loader db.SectionLoader
+	stats  *dataset.ColumnStats
+
+	spans     []dataset.PageSpan
+	section   db.Section
+	pageIndex int64
+
+	page   parquet.Page
+	offset int64
+}
+
+// newPageCursor creates a cursor over the selected pages of the column. Selected pages which
+// are more than maxGap bytes apart are loaded in separate sections.
+func newPageCursor(column parquet.LeafColumn, selection dataset.SelectionResult, loader db.SectionLoader, maxGap int64) *pageCursor {
+	chunk := selection.RowGroup().ColumnChunks()[column.ColumnIndex]
+	pages := dataset.SelectPages(chunk, selection)
+	stats := dataset.NewColumnStats(column.Path[0])
+	stats.RecordPages(pages)
+
+	return &pageCursor{
+		pages:  pages,
+		loader: loader,
+		stats:  stats,
+		spans:  dataset.CoalescePages(pages, maxGap),
+	}
+}
+
+// next returns the page with the next values and the range [i, j) of at most n of its values.
+// The page is released once its values are exhausted, so values must be copied before next is called again.
+// It returns io.EOF when all pages have been read.
+func (c *pageCursor) next(n int64) (page parquet.Page, i, j int64, err error) {
+	for c.page == nil || c.offset == c.page.NumValues() {
+		c.releasePage()
+		if err := c.loadNext(); err != nil {
+			return nil, 0, 0, err
+		}
+		page, err := c.pages.ReadPage()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		c.stats.PagesRead++
+		c.pageIndex++
+		c.page, c.offset = page, 0
+	}
+
+	i = c.offset
+	j = c.page.NumValues()
+	if j-i > n {
+		j = i + n
+	}
+	c.offset = j
+	return c.page, i, j, nil
+}
+
+// loadNext loads the next part of the section with the next page, and opens
+// the section of the next span when the next page is its first page.
+func (c *pageCursor) loadNext() error {
+	if len(c.spans) > 0 && c.spans[0].FirstPage == c.pageIndex {
+		if c.section != nil {
+			c.section.Close()
+		}
+		span := c.spans[0]
+		c.spans = c.spans[1:]
+		section, err := c.loader.NewSection(span.From, c.pages.PageOffset(span.LastPage))
+		if err != nil {
+			return err
+		}
+		c.section = db.AsyncSection(section, 3)
+	}
+	if c.section == nil {
+		return nil
+	}
+	if err := c.section.LoadNext(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func (c *pageCursor) releasePage() {
+	if c.page != nil {
+		parquet.Release(c.page)
+		c.page = nil
+	}
+}
+
+func (c *pageCursor) Close() error {
+	c.releasePage()
+	if c.section != nil {
+		c.section.Close()
+	}
+	return c.pages.Close()
+}
@@ -3,6 +3,7 @@ package compute
 import (
 	"io"
 	"sync"
+	"time"
 
 	"github.com/segmentio/parquet-go"
 
@@ -60,6 +61,15 @@ func (p Projections) MaxBatchSize() int64 {
 	return p.batchSize
 }
 
+// Stats returns the pages and bytes read from each projected column.
+func (p Projections) Stats() *StatsNode {
+	node := NewStatsNode("Projection").Add("batch_size", p.batchSize)
+	for _, column := range p.columns {
+		node.Children = append(node.Children, columnStats(column.stats))
+	}
+	return node
+}
+
 func (p Projections) Close() error {
 	var lastErr error
 	for _, column := range p.columns {
@@ -79,8 +89,12 @@ type columnProjection struct {
 	batchSize     int64
 	currentPage   parquet.Page
 	currentReader parquet.ValueReader
+	// exhaustedPages are pages read into the last batch. Byte array values in the batch
+	// point into their buffers, so they are only released when the next batch is read.
+	exhaustedPages []parquet.Page
 
 	section db.Section
+	stats   *dataset.ColumnStats
 }
 
 func newColumnProjection(
@@ -96,8 +110,11 @@ func newColumnProjection(
 	if err != nil {
 		return nil, err
 	}
+	stats := dataset.NewColumnStats(column.Path[0])
+	stats.RecordPages(pages)
 
 	return &columnProjection{
+		stats:     stats,
 		batchSize: batchSize,
 		pages:     pages,
 		pool:      pool,
@@ -115,13 +132,19 @@ func (p *columnProjection) nextBatch() ([]parquet.Value, error) {
 		err     error
 		values  = p.pool.get()
 	)
+	decodeStart := time.Now()
+	defer func() { p.stats.DecodeTime += time.Since(decodeStart) }()
+	p.releaseExhaustedPages()
 	for numRead < p.batchSize {
 		n, readValsErr := p.currentReader.ReadValues(values[numRead:])
 		numRead += int64(n)
 
 		// If the current page is exhausted, move over to the next page.
 		if readValsErr == io.EOF {
-			parquet.Release(p.currentPage)
+			if p.currentPage != nil {
+				p.exhaustedPages = append(p.exhaustedPages, p.currentPage)
+				p.currentPage = nil
+			}
 			if loadErr := p.loadPages(); loadErr != nil {
 				return nil, loadErr
 			}
@@ -129,6 +152,7 @@ func (p *columnProjection) nextBatch() ([]parquet.Value, error) {
 			if err != nil {
 				break
 			}
+			p.stats.PagesRead++
 			p.currentReader = p.currentPage.Values()
 		}
 	}
@@ -152,7 +176,15 @@ func (p *columnProjection) loadPages() error {
 	return nil
 }
 
+func (p *columnProjection) releaseExhaustedPages() {
+	for _, page := range p.exhaustedPages {
+		parquet.Release(page)
+	}
+	p.exhaustedPages = p.exhaustedPages[:0]
+}
+
 func (p *columnProjection) Close() error {
+	p.releaseExhaustedPages()
 	if p.currentPage != nil {
 		parquet.Release(p.currentPage)
 	}
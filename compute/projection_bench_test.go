@@ -5,15 +5,15 @@ import (
 	"strconv"
 	"testing"
 
+	"github.com/segmentio/parquet-go"
 	"github.com/stretchr/testify/require"
 
 	"Shopify/thanos-parquet-engine/dataset"
 	"Shopify/thanos-parquet-engine/pqtest"
+	"Shopify/thanos-parquet-engine/schema"
 )
 
 func BenchmarkProjection(b *testing.B) {
-	b.StopTimer()
-
 	numRows := 1_000_000
 	numPages := 20
 	numRowsPerPage := numRows / numPages
@@ -34,33 +34,81 @@ func BenchmarkProjection(b *testing.B) {
 	file, err := createSortedFile(b.TempDir(), rows)
 	require.NoError(b, err)
 
+	benchmarkProjections(b, file, numRows, "ColumnA", "ColumnB")
+}
+
+func BenchmarkChunkProjection(b *testing.B) {
+	series := make([]map[string]string, 50_000)
+	for i := range series {
+		series[i] = map[string]string{"__name__": "metric-" + strconv.Itoa(i%10), "instance": strconv.Itoa(i)}
+	}
+	file := createChunksFile(b, series)
+
+	benchmarkProjections(b, file, 2*len(series),
+		schema.SeriesIDColumn,
+		schema.MinTColumn,
+		schema.MaxTColumn,
+		schema.ChunkBytesColumn,
+	)
+}
+
+func benchmarkProjections(b *testing.B, file *parquet.File, numRows int, cols ...string) {
 	var batchSize int64 = 32 * 1024
-	cols := []string{"ColumnA", "ColumnB"}
-	b.ReportAllocs()
-	b.StartTimer()
-	for i := 0; i < b.N; i++ {
-		b.StopTimer()
-		selection := dataset.SelectRows(file.RowGroups()[0], dataset.SelectAll())
-		projection := ProjectColumns(selection, &nopSectionLoader{}, batchSize, cols...)
-		defer projection.Close()
-		b.StartTimer()
+	b.Run("values", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			selection := dataset.SelectRows(file.RowGroups()[0], dataset.SelectAll())
+			projection := ProjectColumns(selection, &nopSectionLoader{}, batchSize, cols...)
+			b.StartTimer()
 
-		var numRead int
-		for {
-			batch, err := projection.NextBatch()
-			if err == io.EOF {
-				break
+			var numRead int
+			for {
+				batch, err := projection.NextBatch()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(b, err)
+				for i := 1; i < len(batch); i++ {
+					require.Equal(b, len(batch[0]), len(batch[i]))
+				}
+				numRead += len(batch[0])
+
+				require.Len(b, batch, len(cols))
+				require.LessOrEqual(b, int64(len(batch[0])), batchSize)
+				projection.Release(batch)
 			}
+			require.EqualValues(b, numRows, numRead)
+			require.NoError(b, projection.Close())
+		}
+	})
+	b.Run("typed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			selection := dataset.SelectRows(file.RowGroups()[0], dataset.SelectAll())
+			projection, err := ProjectTypedColumns(selection, &nopSectionLoader{}, batchSize, cols...)
 			require.NoError(b, err)
-			for i := 1; i < len(batch); i++ {
-				require.Equal(b, len(batch[0]), len(batch[i]))
-			}
-			numRead += len(batch[0])
+			b.StartTimer()
 
-			require.Len(b, batch, len(cols))
-			require.LessOrEqual(b, int64(len(batch[0])), batchSize)
-			projection.Release(batch)
+			var numRead int
+			for {
+				batch, err := projection.NextBatch()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(b, err)
+				for i := 1; i < len(batch); i++ {
+					require.Equal(b, batch[0].Len(), batch[i].Len())
+				}
+				numRead += batch[0].Len()
+
+				require.Len(b, batch, len(cols))
+				require.LessOrEqual(b, int64(batch[0].Len()), batchSize)
+				projection.Release(batch)
+			}
+			require.EqualValues(b, numRows, numRead)
+			require.NoError(b, projection.Close())
 		}
-		require.EqualValues(b, numRows, numRead)
-	}
+	})
 }
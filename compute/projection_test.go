@@ -8,7 +8,9 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"Shopify/thanos-parquet-engine/dataset"
+	"Shopify/thanos-parquet-engine/db"
 	"Shopify/thanos-parquet-engine/pqtest"
+	"Shopify/thanos-parquet-engine/schema"
 )
 
 func TestProjectColumns(t *testing.T) {
@@ -159,6 +161,9 @@ func TestProjectColumns(t *testing.T) {
 			)
 			projections := ProjectColumns(selection, &nopSectionLoader{}, tcase.chunkSize, tcase.columns...)
 			defer projections.Close()
+			typed, err := ProjectTypedColumns(selection, &nopSectionLoader{}, tcase.chunkSize, tcase.columns...)
+			require.NoError(t, err)
+			defer typed.Close()
 			for {
 				values, err := projections.NextBatch()
 				if err == io.EOF {
@@ -168,12 +173,156 @@ func TestProjectColumns(t *testing.T) {
 				require.Equal(t, tcase.expected[0], values)
 				projections.Release(values)
 
+				typedValues, err := typed.NextBatch()
+				require.NoError(t, err)
+				require.Len(t, typedValues, len(tcase.expected[0]))
+				for i, column := range typedValues {
+					require.Equal(t, len(tcase.expected[0][i]), column.Len())
+					for row, value := range tcase.expected[0][i] {
+						require.Equal(t, value.ByteArray(), column.ByteArray(row))
+					}
+				}
+				typed.Release(typedValues)
+
 				tcase.expected = tcase.expected[1:]
 			}
+			_, err = typed.NextBatch()
+			require.Equal(t, io.EOF, err)
 		})
 	}
 }
 
+func TestProjectSelections(t *testing.T) {
+	series := []map[string]string{
+		{"__name__": "http_requests_total", "instance": "abc"},
+		{"__name__": "http_requests_total", "instance": "def"},
+		{"__name__": "up", "instance": "abc"},
+	}
+	pqFile := createChunksFile(t, series, db.WithRowGroupRows(2), db.WithSortOrder(db.SortBySeries))
+	require.Len(t, pqFile.RowGroups(), 3)
+
+	selections, err := NewScanner(pqFile, &nopSectionLoader{}, Equals("instance", "abc")).Select()
+	require.NoError(t, err)
+	projection := ProjectSelections(selections, &nopSectionLoader{}, 1, schema.SeriesIDColumn)
+	defer projection.Close()
+
+	var seriesIDs []int64
+	for {
+		batch, err := projection.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		for _, value := range batch[0] {
+			seriesIDs = append(seriesIDs, value.Int64())
+		}
+		projection.Release(batch)
+	}
+	require.ElementsMatch(t, []int64{0, 0, 2, 2}, seriesIDs)
+	// The row group of the second series has no selected rows, so it is not projected.
+	require.Len(t, projection.Stats().Children, 2)
+}
+
+func TestProjectTypedColumnsTypes(t *testing.T) {
+	series := []map[string]string{
+		{"__name__": "http_requests_total", "instance": "abc"},
+		{"__name__": "up", "instance": "def"},
+		{"__name__": "up", "instance": "ghi"},
+	}
+	pqFile := createChunksFile(t, series)
+	columns := []string{
+		schema.SeriesIDColumn,
+		schema.ChunkBytesColumn,
+		schema.ChunkEncodingColumn,
+		schema.SeriesHashColumn,
+		"__name__",
+	}
+
+	selection := dataset.SelectRows(pqFile.RowGroups()[0], dataset.SelectAll())
+	typed, err := ProjectTypedColumns(selection, &nopSectionLoader{}, 4, columns...)
+	require.NoError(t, err)
+	defer typed.Close()
+	values := ProjectColumns(selection, &nopSectionLoader{}, 4, columns...)
+	defer values.Close()
+
+	var numRows int
+	for {
+		expected, err := values.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		batch, err := typed.NextBatch()
+		require.NoError(t, err)
+		require.Equal(t, len(expected[0]), batch[0].Len())
+		for row := range expected[0] {
+			require.Equal(t, expected[0][row].Int64(), batch[0].Int64[row])
+			require.Equal(t, expected[1][row].ByteArray(), batch[1].ByteArray(row))
+			require.Equal(t, expected[2][row].Int32(), batch[2].Int32[row])
+			require.Equal(t, expected[3][row].ByteArray(), batch[3].ByteArray(row))
+			require.Equal(t, expected[4][row].String(), string(batch[4].ByteArray(row)))
+		}
+		numRows += batch[0].Len()
+		values.Release(expected)
+		typed.Release(batch)
+	}
+	_, err = typed.NextBatch()
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 2*len(series), numRows)
+}
+
 func pqVal(val any, columnIndex int) parquet.Value {
 	return parquet.ValueOf(val).Level(0, 0, columnIndex)
 }
+
+func TestProjectSparseColumns(t *testing.T) {
+	file, err := pqtest.CreateFile([][]pqtest.Row{
+		{pqtest.TwoColumnRow("val1", "val1")},
+		{pqtest.TwoColumnRow("val1", "val2")},
+		{pqtest.TwoColumnRow("val1", "val3")},
+		{pqtest.TwoColumnRow("val1", "val4")},
+	})
+	require.NoError(t, err)
+	selection := dataset.NewSelectionResult(file.RowGroups()[0], []dataset.PickRange{dataset.Pick(0, 1), dataset.Pick(3, 4)})
+
+	cases := []struct {
+		name     string
+		maxGap   int64
+		sections int
+	}{
+		{name: "pages in separate sections", maxGap: 0, sections: 2},
+		{name: "pages in a single section", maxGap: noPageGap, sections: 1},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			loader := &recordingSectionLoader{}
+			projection, err := ProjectSparseColumns(selection, loader, 10, tcase.maxGap, "ColumnB")
+			require.NoError(t, err)
+			defer projection.Close()
+
+			batch, err := projection.NextBatch()
+			require.NoError(t, err)
+			require.Equal(t, 2, batch[0].Len())
+			require.Equal(t, "val1", string(batch[0].ByteArray(0)))
+			require.Equal(t, "val4", string(batch[0].ByteArray(1)))
+			projection.Release(batch)
+			_, err = projection.NextBatch()
+			require.Equal(t, io.EOF, err)
+			require.Len(t, loader.sections, tcase.sections)
+		})
+	}
+}
+
+// recordingSectionLoader records the byte ranges of the sections it creates.
+type recordingSectionLoader struct {
+	sections [][2]int64
+}
+
+func (r *recordingSectionLoader) NewSectionSize(from, to, _ int64) (db.Section, error) {
+	return r.NewSection(from, to)
+}
+
+func (r *recordingSectionLoader) NewSection(from, to int64) (db.Section, error) {
+	r.sections = append(r.sections, [2]int64{from, to})
+	return emptySection{}, nil
+}
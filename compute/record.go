@@ -0,0 +1,436 @@
+package compute
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/apache/arrow/go/v10/arrow"
+	"github.com/apache/arrow/go/v10/arrow/array"
+	"github.com/apache/arrow/go/v10/arrow/memory"
+	"github.com/pkg/errors"
+	"github.com/segmentio/parquet-go"
+	"github.com/segmentio/parquet-go/encoding"
+
+	"Shopify/thanos-parquet-engine/dataset"
+	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/generic"
+)
+
+// RecordFragment is a fragment which emits Arrow records with typed arrays instead of batches of parquet values.
+type RecordFragment interface {
+	io.Closer
+	Schema() *arrow.Schema
+	// NextRecord returns the next record, or io.EOF when all rows have been read.
+	// The caller owns the record and must release it.
+	NextRecord() (arrow.Record, error)
+	Stats() *StatsNode
+}
+
+// RecordProjection reads columns of a selection into Arrow records.
+// Values are copied from decoded pages into typed Arrow buffers, without boxing each value into a parquet.Value.
+// Columns map to Arrow types as follows:
+//   - INT32, INT64, FLOAT and DOUBLE columns map to the primitive type of the same width.
+//   - Dictionary encoded BYTE_ARRAY columns, such as labels, map to Dictionary<Int32, String>.
+//     Each record has its own dictionary with the values of its rows.
+//   - Other BYTE_ARRAY columns map to Binary.
+//   - FIXED_LEN_BYTE_ARRAY columns map to FixedSizeBinary.
+type RecordProjection struct {
+	schema    *arrow.Schema
+	columns   []*recordColumn
+	batchSize int64
+}
+
+// ProjectRecords creates a record projection of the columns in the selection. Columns which do not exist are skipped.
+func ProjectRecords(selection dataset.SelectionResult, reader db.SectionLoader, batchSize int64, columnNames ...string) (*RecordProjection, error) {
+	projection := &RecordProjection{batchSize: batchSize}
+	fields := make([]arrow.Field, 0, len(columnNames))
+	for _, columnName := range columnNames {
+		column, ok := selection.RowGroup().Schema().Lookup(columnName)
+		if !ok {
+			continue
+		}
+		field, err := ArrowField(column)
+		if err != nil {
+			projection.Close()
+			return nil, err
+		}
+		fields = append(fields, field)
+		projection.columns = append(projection.columns, newRecordColumn(column, field, selection, reader, batchSize))
+	}
+	projection.schema = arrow.NewSchema(fields, nil)
+	return projection, nil
+}
+
+// ArrowField returns the Arrow field which values of the parquet column are read into.
+func ArrowField(column parquet.LeafColumn) (arrow.Field, error) {
+	field := arrow.Field{Name: column.Path[0]}
+	switch typ := column.Node.Type(); typ.Kind() {
+	case parquet.Int32:
+		field.Type = arrow.PrimitiveTypes.Int32
+	case parquet.Int64:
+		field.Type = arrow.PrimitiveTypes.Int64
+	case parquet.Float:
+		field.Type = arrow.PrimitiveTypes.Float32
+	case parquet.Double:
+		field.Type = arrow.PrimitiveTypes.Float64
+	case parquet.ByteArray:
+		if isDictionaryEncoded(column.Node) {
+			field.Type = &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}
+		} else {
+			field.Type = arrow.BinaryTypes.Binary
+		}
+	case parquet.FixedLenByteArray:
+		field.Type = &arrow.FixedSizeBinaryType{ByteWidth: typ.Length()}
+	default:
+		return arrow.Field{}, errors.Errorf("unsupported type %s of column %s", typ, field.Name)
+	}
+	return field, nil
+}
+
+func isDictionaryEncoded(node parquet.Node) bool {
+	enc := node.Encoding()
+	return enc != nil && (enc.Encoding() == parquet.RLEDictionary.Encoding() || enc.Encoding() == parquet.PlainDictionary.Encoding())
+}
+
+func (p *RecordProjection) Schema() *arrow.Schema {
+	return p.schema
+}
+
+func (p *RecordProjection) NextRecord() (arrow.Record, error) {
+	arrays := make([]arrow.Array, len(p.columns))
+	err := generic.ParallelEach(p.columns, func(i int, column *recordColumn) error {
+		var err error
+		arrays[i], err = column.nextArray()
+		return err
+	})
+	defer func() {
+		for _, arr := range arrays {
+			if arr != nil {
+				arr.Release()
+			}
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+	if len(arrays) == 0 {
+		return nil, io.EOF
+	}
+	return array.NewRecord(p.schema, arrays, int64(arrays[0].Len())), nil
+}
+
+// Stats returns the pages and bytes read from each projected column.
+func (p *RecordProjection) Stats() *StatsNode {
+	node := NewStatsNode("RecordProjection").Add("batch_size", p.batchSize)
+	for _, column := range p.columns {
+		node.Children = append(node.Children, columnStats(column.cursor.stats))
+	}
+	return node
+}
+
+func (p *RecordProjection) Close() error {
+	var lastErr error
+	for _, column := range p.columns {
+		if colErr := column.Close(); colErr != nil {
+			lastErr = colErr
+		}
+	}
+	return lastErr
+}
+
+// RecordReader adapts a record fragment to an array.RecordReader, which is consumed by Arrow IPC and Flight writers.
+type RecordReader struct {
+	refCount int64
+	fragment RecordFragment
+	record   arrow.Record
+	err      error
+}
+
+// NewRecordReader returns a reader over the records of the fragment.
+// The fragment is closed once it is exhausted or the reader is released.
+func NewRecordReader(fragment RecordFragment) *RecordReader {
+	return &RecordReader{refCount: 1, fragment: fragment}
+}
+
+func (r *RecordReader) Retain() {
+	atomic.AddInt64(&r.refCount, 1)
+}
+
+func (r *RecordReader) Release() {
+	if atomic.AddInt64(&r.refCount, -1) > 0 {
+		return
+	}
+	r.releaseRecord()
+	r.fragment.Close()
+}
+
+func (r *RecordReader) Schema() *arrow.Schema {
+	return r.fragment.Schema()
+}
+
+func (r *RecordReader) Next() bool {
+	r.releaseRecord()
+	if r.err != nil {
+		return false
+	}
+	r.record, r.err = r.fragment.NextRecord()
+	return r.err == nil
+}
+
+func (r *RecordReader) Record() arrow.Record {
+	return r.record
+}
+
+// Err returns the error which stopped the reader, if any.
+func (r *RecordReader) Err() error {
+	if r.err == io.EOF {
+		return nil
+	}
+	return r.err
+}
+
+func (r *RecordReader) releaseRecord() {
+	if r.record != nil {
+		r.record.Release()
+		r.record = nil
+	}
+}
+
+type recordColumn struct {
+	cursor    *pageCursor
+	appender  arrayAppender
+	batchSize int64
+}
+
+func newRecordColumn(
+	column parquet.LeafColumn,
+	field arrow.Field,
+	selection dataset.SelectionResult,
+	loader db.SectionLoader,
+	batchSize int64,
+) *recordColumn {
+	return &recordColumn{
+		cursor:    newPageCursor(column, selection, loader, noPageGap),
+		appender:  newArrayAppender(memory.DefaultAllocator, field.Type),
+		batchSize: batchSize,
+	}
+}
+
+// nextArray reads the values of up to batchSize rows into an array.
+// Values are copied, so pages are released as soon as they are exhausted.
+func (c *recordColumn) nextArray() (arrow.Array, error) {
+	decodeStart := time.Now()
+	defer func() { c.cursor.stats.DecodeTime += time.Since(decodeStart) }()
+
+	var numRead int64
+	for numRead < c.batchSize {
+		page, i, j, err := c.cursor.next(c.batchSize - numRead)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.appender.appendPage(page, i, j)
+		numRead += j - i
+	}
+	if numRead == 0 {
+		return nil, io.EOF
+	}
+	return c.appender.newArray(), nil
+}
+
+func (c *recordColumn) Close() error {
+	c.appender.release()
+	return c.cursor.Close()
+}
+
+// arrayAppender appends values of parquet pages to an Arrow array.
+type arrayAppender interface {
+	// appendPage appends the values in [i, j) of the page.
+	appendPage(page parquet.Page, i, j int64)
+	// newArray returns the appended values and resets the appender.
+	newArray() arrow.Array
+	release()
+}
+
+func newArrayAppender(mem memory.Allocator, typ arrow.DataType) arrayAppender {
+	switch typ := typ.(type) {
+	case *arrow.Int32Type:
+		return &primitiveAppender[int32]{builder: array.NewInt32Builder(mem), values: (*encoding.Values).Int32}
+	case *arrow.Int64Type:
+		return &primitiveAppender[int64]{builder: array.NewInt64Builder(mem), values: (*encoding.Values).Int64}
+	case *arrow.Float32Type:
+		return &primitiveAppender[float32]{builder: array.NewFloat32Builder(mem), values: (*encoding.Values).Float}
+	case *arrow.Float64Type:
+		return &primitiveAppender[float64]{builder: array.NewFloat64Builder(mem), values: (*encoding.Values).Double}
+	case *arrow.FixedSizeBinaryType:
+		return &fixedSizeBinaryAppender{builder: array.NewFixedSizeBinaryBuilder(mem, typ)}
+	case *arrow.DictionaryType:
+		return newDictionaryAppender(mem, typ)
+	default:
+		return &binaryAppender{builder: array.NewBinaryBuilder(mem, arrow.BinaryTypes.Binary)}
+	}
+}
+
+type primitiveBuilder[T any] interface {
+	array.Builder
+	Append(T)
+	AppendValues([]T, []bool)
+}
+
+type primitiveAppender[T any] struct {
+	builder primitiveBuilder[T]
+	values  func(*encoding.Values) []T
+}
+
+func (a *primitiveAppender[T]) appendPage(page parquet.Page, i, j int64) {
+	data := page.Data()
+	if dict := page.Dictionary(); dict != nil {
+		dictData := dict.Page().Data()
+		dictValues := a.values(&dictData)
+		for _, index := range data.Int32()[i:j] {
+			a.builder.Append(dictValues[index])
+		}
+		return
+	}
+	a.builder.AppendValues(a.values(&data)[i:j], nil)
+}
+
+func (a *primitiveAppender[T]) newArray() arrow.Array { return a.builder.NewArray() }
+
+func (a *primitiveAppender[T]) release() { a.builder.Release() }
+
+type binaryAppender struct {
+	builder *array.BinaryBuilder
+}
+
+func (a *binaryAppender) appendPage(page parquet.Page, i, j int64) {
+	forEachByteArray(page, i, j, a.builder.Append)
+}
+
+func (a *binaryAppender) newArray() arrow.Array { return a.builder.NewArray() }
+
+func (a *binaryAppender) release() { a.builder.Release() }
+
+type fixedSizeBinaryAppender struct {
+	builder *array.FixedSizeBinaryBuilder
+}
+
+func (a *fixedSizeBinaryAppender) appendPage(page parquet.Page, i, j int64) {
+	data := page.Data()
+	if dict := page.Dictionary(); dict != nil {
+		dictData := dict.Page().Data()
+		values, size := dictData.FixedLenByteArray()
+		for _, index := range data.Int32()[i:j] {
+			a.builder.Append(values[int(index)*size : int(index+1)*size])
+		}
+		return
+	}
+	values, size := data.FixedLenByteArray()
+	for k := int(i); k < int(j); k++ {
+		a.builder.Append(values[k*size : (k+1)*size])
+	}
+}
+
+func (a *fixedSizeBinaryAppender) newArray() arrow.Array { return a.builder.NewArray() }
+
+func (a *fixedSizeBinaryAppender) release() { a.builder.Release() }
+
+// dictionaryAppender builds dictionary arrays of strings. Indexes of dictionary encoded pages
+// are translated to indexes of the record dictionary, so values of the page dictionary are
+// only hashed once for each record instead of once for each row.
+type dictionaryAppender struct {
+	typ     *arrow.DictionaryType
+	indices *array.Int32Builder
+	values  *array.StringBuilder
+	memo    map[string]int32
+
+	// pageDictionary is the dictionary of the last dictionary encoded page.
+	// translation maps its indexes to indexes of the record dictionary, or to -1 if not yet known.
+	pageDictionary parquet.Dictionary
+	translation    []int32
+}
+
+func newDictionaryAppender(mem memory.Allocator, typ *arrow.DictionaryType) *dictionaryAppender {
+	return &dictionaryAppender{
+		typ:     typ,
+		indices: array.NewInt32Builder(mem),
+		values:  array.NewStringBuilder(mem),
+		memo:    make(map[string]int32),
+	}
+}
+
+func (a *dictionaryAppender) appendPage(page parquet.Page, i, j int64) {
+	dict := page.Dictionary()
+	if dict == nil {
+		forEachByteArray(page, i, j, func(value []byte) {
+			a.indices.Append(a.insert(value))
+		})
+		return
+	}
+
+	if dict != a.pageDictionary {
+		a.pageDictionary = dict
+		a.translation = a.translation[:0]
+		for k := 0; k < dict.Len(); k++ {
+			a.translation = append(a.translation, -1)
+		}
+	}
+	dictData := dict.Page().Data()
+	values, offsets := dictData.ByteArray()
+	data := page.Data()
+	for _, index := range data.Int32()[i:j] {
+		if a.translation[index] < 0 {
+			a.translation[index] = a.insert(values[offsets[index]:offsets[index+1]])
+		}
+		a.indices.Append(a.translation[index])
+	}
+}
+
+// insert returns the index of the value in the record dictionary, and adds the value if it does not exist.
+func (a *dictionaryAppender) insert(value []byte) int32 {
+	if index, ok := a.memo[string(value)]; ok {
+		return index
+	}
+	index := int32(len(a.memo))
+	a.memo[string(value)] = index
+	a.values.BinaryBuilder.Append(value)
+	return index
+}
+
+func (a *dictionaryAppender) newArray() arrow.Array {
+	indices := a.indices.NewArray()
+	defer indices.Release()
+	values := a.values.NewArray()
+	defer values.Release()
+
+	// Each record has its own dictionary.
+	a.memo = make(map[string]int32, len(a.memo))
+	a.pageDictionary, a.translation = nil, a.translation[:0]
+	return array.NewDictionaryArray(a.typ, indices, values)
+}
+
+func (a *dictionaryAppender) release() {
+	a.indices.Release()
+	a.values.Release()
+}
+
+// forEachByteArray calls fn with the byte array values in [i, j) of the page.
+// The values point into the page and must be copied to be retained.
+func forEachByteArray(page parquet.Page, i, j int64, fn func([]byte)) {
+	data := page.Data()
+	if dict := page.Dictionary(); dict != nil {
+		dictData := dict.Page().Data()
+		values, offsets := dictData.ByteArray()
+		for _, index := range data.Int32()[i:j] {
+			fn(values[offsets[index]:offsets[index+1]])
+		}
+		return
+	}
+	values, offsets := data.ByteArray()
+	for k := i; k < j; k++ {
+		fn(values[offsets[k]:offsets[k+1]])
+	}
+}
@@ -0,0 +1,162 @@
+package compute
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/apache/arrow/go/v10/arrow"
+	"github.com/apache/arrow/go/v10/arrow/array"
+	"github.com/apache/arrow/go/v10/arrow/ipc"
+	"github.com/stretchr/testify/require"
+
+	"Shopify/thanos-parquet-engine/dataset"
+	"Shopify/thanos-parquet-engine/pqtest"
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+func TestProjectRecords(t *testing.T) {
+	pqFile, err := pqtest.CreateFile([][]pqtest.Row{{
+		pqtest.TwoColumnRow("val1", "val1"),
+		pqtest.TwoColumnRow("val1", "val2"),
+		pqtest.TwoColumnRow("val1", "val3"),
+	}, {
+		pqtest.TwoColumnRow("val2", "val4"),
+		pqtest.TwoColumnRow("val2", "val5"),
+		pqtest.TwoColumnRow("val3", "val6"),
+	}})
+	require.NoError(t, err)
+
+	selection := dataset.NewSelectionResult(pqFile.RowGroups()[0], []dataset.PickRange{dataset.Pick(1, 6)})
+	projection, err := ProjectRecords(selection, &nopSectionLoader{}, 3, "ColumnA", "ColumnB", "Missing")
+	require.NoError(t, err)
+	defer projection.Close()
+
+	dictType := &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}
+	require.Equal(t, arrow.NewSchema([]arrow.Field{
+		{Name: "ColumnA", Type: dictType},
+		{Name: "ColumnB", Type: dictType},
+	}, nil), projection.Schema())
+
+	expected := [][][]string{
+		{{"val1", "val1", "val2"}, {"val2", "val3", "val4"}},
+		{{"val2", "val3"}, {"val5", "val6"}},
+	}
+	for _, expectedColumns := range expected {
+		record, err := projection.NextRecord()
+		require.NoError(t, err)
+		require.Equal(t, int64(len(expectedColumns[0])), record.NumRows())
+		for i, expectedValues := range expectedColumns {
+			require.Equal(t, expectedValues, dictionaryStrings(record.Column(i).(*array.Dictionary)))
+		}
+		record.Release()
+	}
+	_, err = projection.NextRecord()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestProjectRecordsTypes(t *testing.T) {
+	series := []map[string]string{
+		{"__name__": "http_requests_total", "instance": "abc"},
+		{"__name__": "up", "instance": "def"},
+	}
+	pqFile := createChunksFile(t, series)
+	columns := []string{
+		schema.SeriesIDColumn,
+		schema.ChunkBytesColumn,
+		schema.ChunkEncodingColumn,
+		schema.SeriesHashColumn,
+		"__name__",
+	}
+
+	selection := dataset.SelectRows(pqFile.RowGroups()[0], dataset.SelectAll())
+	projection, err := ProjectRecords(selection, &nopSectionLoader{}, 3, columns...)
+	require.NoError(t, err)
+	records := NewRecordReader(projection)
+	defer records.Release()
+
+	// Records are written to and read from an IPC stream, as they would be sent to Arrow consumers.
+	var buf bytes.Buffer
+	writer := ipc.NewWriter(&buf, ipc.WithSchema(records.Schema()))
+	for records.Next() {
+		require.NoError(t, writer.Write(records.Record()))
+	}
+	require.NoError(t, records.Err())
+	require.NoError(t, writer.Close())
+
+	reader, err := ipc.NewReader(&buf)
+	require.NoError(t, err)
+	defer reader.Release()
+
+	values := ProjectColumns(selection, &nopSectionLoader{}, 3, columns...)
+	defer values.Close()
+	var numRows int
+	for reader.Next() {
+		record := reader.Record()
+		batch, err := values.NextBatch()
+		require.NoError(t, err)
+		require.Equal(t, len(batch[0]), int(record.NumRows()))
+		for row := range batch[0] {
+			require.Equal(t, batch[0][row].Int64(), record.Column(0).(*array.Int64).Value(row))
+			require.Equal(t, batch[1][row].ByteArray(), record.Column(1).(*array.Binary).Value(row))
+			require.Equal(t, batch[2][row].Int32(), record.Column(2).(*array.Int32).Value(row))
+			require.Equal(t, batch[3][row].ByteArray(), record.Column(3).(*array.FixedSizeBinary).Value(row))
+			require.Equal(t, batch[4][row].String(), dictionaryStrings(record.Column(4).(*array.Dictionary))[row])
+		}
+		numRows += int(record.NumRows())
+		values.Release(batch)
+	}
+	require.NoError(t, reader.Err())
+	require.Equal(t, 2*len(series), numRows)
+}
+
+func dictionaryStrings(arr *array.Dictionary) []string {
+	dict := arr.Dictionary().(*array.String)
+	values := make([]string, arr.Len())
+	for i := range values {
+		values[i] = dict.Value(arr.GetValueIndex(i))
+	}
+	return values
+}
+
+func BenchmarkRecordProjection(b *testing.B) {
+	rows := make([]pqtest.Row, 100_000)
+	for i := range rows {
+		rows[i] = pqtest.TwoColumnRow("value-"+string(rune('a'+i%4)), "value-"+string(rune('a'+i%16)))
+	}
+	pqFile, err := pqtest.CreateFile([][]pqtest.Row{rows})
+	require.NoError(b, err)
+	selection := dataset.SelectRows(pqFile.RowGroups()[0], dataset.SelectAll())
+
+	b.Run("values", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			projection := ProjectColumns(selection, &nopSectionLoader{}, 32*1024, "ColumnA", "ColumnB")
+			for {
+				batch, err := projection.NextBatch()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(b, err)
+				projection.Release(batch)
+			}
+			require.NoError(b, projection.Close())
+		}
+	})
+	b.Run("records", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			projection, err := ProjectRecords(selection, &nopSectionLoader{}, 32*1024, "ColumnA", "ColumnB")
+			require.NoError(b, err)
+			for {
+				record, err := projection.NextRecord()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(b, err)
+				record.Release()
+			}
+			require.NoError(b, projection.Close())
+		}
+	})
+}
@@ -1,30 +1,70 @@
 package compute
 
 import (
-	"sort"
+	"time"
 
 	"github.com/segmentio/parquet-go"
 
 	"Shopify/thanos-parquet-engine/dataset"
 	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/schema"
 )
 
+// Scanner selects the rows of each row group which match all its options.
+// Row groups are first pruned with the column statistics in the file footer,
+// and then by bloom filters, dictionaries and page indexes.
 type Scanner struct {
-	reader db.SectionLoader
-	file   *parquet.File
+	reader       db.SectionLoader
+	file         *parquet.File
+	dictionaries *dataset.Dictionaries
 
-	predicates dataset.Predicates
+	predicates []dataset.Predicate
+	stats      scanStats
 }
 
 type ScannerOption func(*Scanner)
 
+// Equals selects rows where the column is equal to the value.
+// Values of columns which do not exist are empty, so no rows are selected unless the value is empty.
 func Equals(column string, value string) ScannerOption {
 	return func(scanner *Scanner) {
 		col, ok := scanner.file.Schema().Lookup(column)
 		if !ok {
+			if value != "" {
+				scanner.predicates = append(scanner.predicates, selectNone())
+			}
 			return
 		}
-		scanner.predicates = append(scanner.predicates, dataset.NewEqualsPredicate(scanner.reader, col, value))
+		scanner.predicates = append(scanner.predicates, dataset.NewEqualsPredicate(scanner.reader, scanner.dictionaries, col, value))
+	}
+}
+
+// NotEquals selects rows where the column is not equal to the value.
+// Rows of dictionary encoded pages are filtered by the dictionary values which are not equal.
+// Values of columns which do not exist are empty, so all rows are selected unless the value is empty.
+func NotEquals(column string, value string) ScannerOption {
+	return func(scanner *Scanner) {
+		col, ok := scanner.file.Schema().Lookup(column)
+		if !ok {
+			if value == "" {
+				scanner.predicates = append(scanner.predicates, selectNone())
+			}
+			return
+		}
+		scanner.predicates = append(scanner.predicates, dataset.NewNotEqualsPredicate(scanner.reader, col, value))
+	}
+}
+
+// SeriesHashEquals selects rows of the series with the given hash, so that a series can be looked up
+// in any file without comparing its labels. Row groups which do not contain the series are skipped
+// using the footer statistics and the bloom filter of the series hash column.
+func SeriesHashEquals(hash schema.SeriesHash) ScannerOption {
+	return func(scanner *Scanner) {
+		col, ok := scanner.file.Schema().Lookup(schema.SeriesHashColumn)
+		if !ok {
+			return
+		}
+		scanner.predicates = append(scanner.predicates, dataset.NewValueEqualsPredicate(scanner.reader, col, hash.Value()))
 	}
 }
 
@@ -48,89 +88,148 @@ func LessThanOrEqual(column string, value parquet.Value) ScannerOption {
 	}
 }
 
+// TimeRangeOverlaps selects chunks which have at least one sample in the time range [mint, maxt].
+// Chunks which straddle either end of the range are selected as well, and samples outside
+// of the range need to be trimmed when the chunks are read.
+func TimeRangeOverlaps(mint, maxt int64) ScannerOption {
+	return func(scanner *Scanner) {
+		minT, ok := scanner.file.Schema().Lookup(schema.MinTColumn)
+		if !ok {
+			return
+		}
+		maxT, ok := scanner.file.Schema().Lookup(schema.MaxTColumn)
+		if !ok {
+			return
+		}
+		scanner.predicates = append(scanner.predicates, dataset.NewTimeRangePredicate(scanner.reader, minT, maxT, mint, maxt))
+	}
+}
+
+// RowRanges selects rows inside the given ranges of each row group, such as ranges resolved from a series index.
+func RowRanges(rowGroups [][]dataset.PickRange) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.predicates = append(scanner.predicates, dataset.NewRowRangesPredicate(rowGroups))
+	}
+}
+
+// Matches selects rows for which the matches function returns true on the column value.
+// Row groups and pages without values starting with the prefix are skipped without decoding.
+// Values of columns which do not exist are empty, so either all or no rows are selected.
+func Matches(column string, prefix string, matches func(string) bool) ScannerOption {
+	return func(scanner *Scanner) {
+		col, ok := scanner.file.Schema().Lookup(column)
+		if !ok {
+			if !matches("") {
+				scanner.predicates = append(scanner.predicates, selectNone())
+			}
+			return
+		}
+		scanner.predicates = append(scanner.predicates, dataset.NewMatchPredicate(scanner.reader, col, prefix, matches))
+	}
+}
+
+// And selects rows which match all the given options. It is used to combine options inside of Or.
+func And(options ...ScannerOption) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.predicates = append(scanner.predicates, dataset.And(scanner.collect(options)...))
+	}
+}
+
+// Or selects rows which match any of the given options.
+func Or(options ...ScannerOption) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.predicates = append(scanner.predicates, dataset.Or(scanner.collect(options)...))
+	}
+}
+
+// Not selects rows which do not match all the given options.
+func Not(options ...ScannerOption) ScannerOption {
+	return func(scanner *Scanner) {
+		scanner.predicates = append(scanner.predicates, dataset.Not(dataset.And(scanner.collect(options)...)))
+	}
+}
+
+// selectNone returns a predicate which selects no rows, as the negation of a predicate which selects all rows.
+func selectNone() dataset.Predicate {
+	return dataset.Not(dataset.And())
+}
+
 func NewScanner(file *parquet.File, reader db.SectionLoader, options ...ScannerOption) *Scanner {
 	scanner := &Scanner{
-		file:       file,
-		reader:     reader,
-		predicates: make(dataset.Predicates, 0),
+		file:         file,
+		reader:       reader,
+		dictionaries: dataset.NewDictionaries(file),
+		predicates:   make([]dataset.Predicate, 0),
 	}
 	for _, option := range options {
 		option(scanner)
 	}
-	sort.Sort(scanner.predicates)
 	return scanner
 }
 
+// collect returns a predicate for each option without adding them to the scanner.
+// Options which do not add predicates, such as options on missing columns which
+// match empty values, select all rows.
+func (s *Scanner) collect(options []ScannerOption) []dataset.Predicate {
+	predicates := make([]dataset.Predicate, 0, len(options))
+	for _, option := range options {
+		nested := &Scanner{
+			file:         s.file,
+			reader:       s.reader,
+			dictionaries: s.dictionaries,
+			predicates:   make([]dataset.Predicate, 0, 1),
+		}
+		option(nested)
+		if len(nested.predicates) == 1 {
+			predicates = append(predicates, nested.predicates[0])
+		} else {
+			predicates = append(predicates, dataset.And(nested.predicates...))
+		}
+	}
+	return predicates
+}
+
 func (s *Scanner) Select() ([]dataset.SelectionResult, error) {
+	start := time.Now()
+	defer func() { s.stats.duration += time.Since(start) }()
+
+	predicate := dataset.And(s.predicates...)
 	result := make([]dataset.SelectionResult, 0, len(s.file.RowGroups()))
-	for _, rowGroup := range s.file.RowGroups() {
-		rowSelections := s.predicates.SelectRows(rowGroup)
-		filteredRows, err := s.predicates.FilterRows(rowGroup, rowSelections)
+	for i, rowGroup := range dataset.FileRowGroups(s.file) {
+		s.stats.rowGroups++
+		s.stats.rowsScanned += rowGroup.NumRows()
+		if !predicate.SelectRowGroup(rowGroup) {
+			result = append(result, dataset.NewSelectionResult(s.file.RowGroups()[i], []dataset.PickRange{}))
+			continue
+		}
+
+		filteredRows, err := predicate.FilterRows(rowGroup, predicate.SelectRows(rowGroup))
 		if err != nil {
 			return nil, err
 		}
 
-		rowGroupRows := dataset.SelectRows(rowGroup, filteredRows)
+		rowGroupRows := dataset.SelectRows(s.file.RowGroups()[i], filteredRows)
 		result = append(result, rowGroupRows)
+		if numRows := rowGroupRows.NumRows(); numRows > 0 {
+			s.stats.rowGroupsSelected++
+			s.stats.rowsSelected += numRows
+		}
 	}
 
 	return result, nil
 }
 
-//var compact = thrift.CompactProtocol{}
-
-//type pageDictionaries map[int64]parquet.DictionaryPageHeader
-//
-//func (s *Scanner) decodeDictionaries() error {
-//	decoder := thrift.NewDecoder(compact.NewReader(nil))
-//	for rowID, rowGroup := range s.file.Metadata().RowGroups {
-//		for colID, column := range rowGroup.Columns {
-//			if column.MetaData.DictionaryPageOffset == 0 {
-//				continue
-//			}
-//			sectionReader := io.NewSectionReader(s.reader, column.MetaData.DictionaryPageOffset, column.MetaData.TotalCompressedSize)
-//			buffer := bufio.NewReader(sectionReader)
-//
-//			chunk := s.file.RowGroups()[rowID].ColumnChunks()[colID]
-//			dictionary, err := decodeChunkDictionaries(buffer, decoder, chunk)
-//			if err != nil {
-//				return err
-//			}
-//			if dictionary == nil {
-//				continue
-//			}
-//		}
-//	}
-//}
-//
-//func decodeChunkDictionaries(buffer *bufio.Reader, decoder *thrift.Decoder, chunk parquet.ColumnChunk) (pageDictionaries, error) {
-//	dictionaries := make(pageDictionaries)
-//
-//	decoder.Reset(compact.NewReader(buffer))
-//	header := &format.PageHeader{}
-//	if err := decoder.Decode(header); err != nil {
-//		panic(err)
-//	}
-//	if header.DictionaryPageHeader.NumValues == 0 {
-//		return nil, nil
-//	}
-//	capacity := header.CompressedPageSize + (readPageSize - header.CompressedPageSize%readPageSize)
-//	pageData := make([]byte, header.CompressedPageSize, capacity)
-//	if _, err := io.ReadFull(buffer, pageData); err != nil && err != io.EOF {
-//		panic(err)
-//	}
-//
-//	encoding := header.DictionaryPageHeader.Encoding
-//	if encoding == format.PlainDictionary {
-//		encoding = format.Plain
-//	}
-//
-//	pageType := chunk.Type()
-//	values, err := pageType.Decode(pageType.NewValues(nil, nil), pageData, parquet.LookupEncoding(encoding))
-//	if err != nil {
-//		return nil, err
-//	}
-//
-//
-//	return pageType.NewDictionary(chunk.Column(), int(values.Size()), values), nil
-//}
+// Stats returns the execution stats of all Select calls on the scanner,
+// with one child node for each predicate.
+func (s *Scanner) Stats() *StatsNode {
+	node := NewStatsNode("Scan").
+		Add("row_groups", s.stats.rowGroups).
+		Add("row_groups_selected", s.stats.rowGroupsSelected).
+		Add("rows_scanned", s.stats.rowsScanned).
+		Add("rows_selected", s.stats.rowsSelected).
+		Add("time", s.stats.duration)
+	for _, stats := range dataset.And(s.predicates...).Stats() {
+		node.Children = append(node.Children, predicateStats(stats))
+	}
+	return node
+}
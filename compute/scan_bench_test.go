@@ -5,6 +5,7 @@ import (
 	"path"
 	"sort"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/segmentio/parquet-go"
@@ -51,6 +52,101 @@ func BenchmarkScanner_Scan(b *testing.B) {
 	}
 }
 
+func BenchmarkScanner_Filters(b *testing.B) {
+	const numRows = 1_000_000
+	rows := make([]pqtest.Row, numRows)
+	for row := range rows {
+		rows[row] = pqtest.Row{
+			ColumnA: strconv.Itoa(row % 4),
+			ColumnB: strconv.Itoa(row % 3),
+			ColumnC: strconv.Itoa(row % 2),
+			ColumnD: strconv.Itoa(row % 1000),
+		}
+	}
+	file, err := createSortedFile(b.TempDir(), [][]pqtest.Row{rows})
+	require.NoError(b, err)
+
+	// Chunks are not sorted by time, so time ranges select scattered rows.
+	chunks := make([]timeRangeRow, numRows)
+	for row := range chunks {
+		minT := int64(row*7919%numRows) * 10
+		chunks[row] = timeRangeRow{MinT: minT, MaxT: minT + 10}
+	}
+	chunksFile, err := createTimeRangeFile(b.TempDir(), chunks)
+	require.NoError(b, err)
+
+	cases := []struct {
+		name     string
+		file     *parquet.File
+		options  []ScannerOption
+		expected int64
+	}{
+		{
+			name:     "regex",
+			file:     file,
+			options:  []ScannerOption{Matches("ColumnD", "", func(s string) bool { return strings.HasSuffix(s, "7") })},
+			expected: 100_000,
+		},
+		{
+			name:     "not equal",
+			file:     file,
+			options:  []ScannerOption{NotEquals("ColumnB", "1")},
+			expected: 666_667,
+		},
+		{
+			name:     "time range",
+			file:     chunksFile,
+			options:  []ScannerOption{TimeRangeOverlaps(1_000_000, 2_000_000)},
+			expected: 100_002,
+		},
+	}
+	for _, tcase := range cases {
+		b.Run(tcase.name, func(b *testing.B) {
+			scanner := NewScanner(tcase.file, &nopSectionLoader{}, tcase.options...)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				result, err := scanner.Select()
+				require.NoError(b, err)
+				require.EqualValues(b, tcase.expected, result[0].NumRows())
+			}
+		})
+	}
+}
+
+type timeRangeRow struct {
+	MinT int64 `parquet:"__mint"`
+	MaxT int64 `parquet:"__maxt"`
+}
+
+func createTimeRangeFile(dir string, rows []timeRangeRow) (*parquet.File, error) {
+	filePath := path.Join(dir, "time_range.parquet")
+	f, err := os.Create(filePath)
+	if err != nil {
+		return nil, err
+	}
+	writer := parquet.NewGenericWriter[timeRangeRow](f)
+	if _, err := writer.Write(rows); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+
+	f, err = os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return parquet.OpenFile(f, stat.Size())
+}
+
 func createSortedFile(dir string, parts [][]pqtest.Row) (*parquet.File, error) {
 	buffer := parquet.NewGenericBuffer[pqtest.Row](
 		parquet.SortingRowGroupConfig(
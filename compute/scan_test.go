@@ -1,6 +1,11 @@
 package compute
 
 import (
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/segmentio/parquet-go"
@@ -9,6 +14,7 @@ import (
 	"Shopify/thanos-parquet-engine/dataset"
 	"Shopify/thanos-parquet-engine/db"
 	"Shopify/thanos-parquet-engine/pqtest"
+	"Shopify/thanos-parquet-engine/schema"
 )
 
 func TestScan(t *testing.T) {
@@ -145,6 +151,46 @@ func TestScan(t *testing.T) {
 			},
 			expectedRanges: []dataset.PickRange{dataset.Pick(3, 6), dataset.Pick(8, 10), dataset.Pick(11, 12)},
 		},
+		{
+			//
+			//	pages:      |_____||_____|
+			//	selection:  |_|      |___|
+			name: "or and not predicates",
+			parts: [][]pqtest.Row{{
+				pqtest.TwoColumnRow("val1", "val1"),
+				pqtest.TwoColumnRow("val1", "val2"),
+				pqtest.TwoColumnRow("val1", "val3"),
+			}, {
+				pqtest.TwoColumnRow("val2", "val1"),
+				pqtest.TwoColumnRow("val2", "val2"),
+				pqtest.TwoColumnRow("val2", "val3"),
+			}},
+			predicates: []ScannerOption{
+				Or(Equals("ColumnB", "val1"), Equals("ColumnA", "val2")),
+				Not(Equals("ColumnB", "val1"), Equals("ColumnA", "val2")),
+			},
+			expectedRanges: []dataset.PickRange{dataset.Pick(0, 1), dataset.Pick(4, 6)},
+		},
+		{
+			//
+			//	pages:      |_____||_____|
+			//	selection:  |_| |_|  |_|
+			name: "not equals and regex predicates",
+			parts: [][]pqtest.Row{{
+				pqtest.TwoColumnRow("val1", "val1"),
+				pqtest.TwoColumnRow("val1", "val2"),
+				pqtest.TwoColumnRow("val1", "val3"),
+			}, {
+				pqtest.TwoColumnRow("val2", "val1"),
+				pqtest.TwoColumnRow("val2", "val2"),
+				pqtest.TwoColumnRow("val3", "val3"),
+			}},
+			predicates: []ScannerOption{
+				NotEquals("ColumnB", "val2"),
+				Matches("ColumnA", "val", func(s string) bool { return s == "val1" || s == "val3" }),
+			},
+			expectedRanges: []dataset.PickRange{dataset.Pick(0, 1), dataset.Pick(2, 3), dataset.Pick(5, 6)},
+		},
 	}
 
 	for _, tcase := range cases {
@@ -178,3 +224,185 @@ type emptySection struct{}
 func (n emptySection) LoadNext() error { return nil }
 func (n emptySection) LoadAll() error  { return nil }
 func (n emptySection) Close() error    { return nil }
+
+func TestScanLargePages(t *testing.T) {
+	const numRows = 10_000
+	rows := make([]pqtest.Row, numRows)
+	for row := range rows {
+		rows[row] = pqtest.Row{
+			ColumnA: strconv.Itoa(row % 2),
+			ColumnB: strconv.Itoa(row),
+		}
+	}
+	// Pages have more rows than are decoded at once.
+	file, err := createSortedFile(t.TempDir(), [][]pqtest.Row{rows})
+	require.NoError(t, err)
+
+	cases := []struct {
+		name     string
+		options  []ScannerOption
+		expected int64
+	}{
+		{
+			name:     "regex",
+			options:  []ScannerOption{Matches("ColumnB", "", func(s string) bool { return strings.HasSuffix(s, "7") })},
+			expected: numRows / 10,
+		},
+		{
+			name:     "not equals",
+			options:  []ScannerOption{NotEquals("ColumnA", "1")},
+			expected: numRows / 2,
+		},
+		{
+			name:     "not equals missing column",
+			options:  []ScannerOption{NotEquals("Missing", "1")},
+			expected: numRows,
+		},
+		{
+			name:     "not equals empty value of missing column",
+			options:  []ScannerOption{NotEquals("Missing", "")},
+			expected: 0,
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			result, err := NewScanner(file, &nopSectionLoader{}, tcase.options...).Select()
+			require.NoError(t, err)
+			require.Equal(t, tcase.expected, result[0].NumRows())
+		})
+	}
+
+	chunks := make([]timeRangeRow, numRows)
+	for row := range chunks {
+		minT := int64(row*7919%numRows) * 10
+		chunks[row] = timeRangeRow{MinT: minT, MaxT: minT + 10}
+	}
+	chunksFile, err := createTimeRangeFile(t.TempDir(), chunks)
+	require.NoError(t, err)
+	result, err := NewScanner(chunksFile, &nopSectionLoader{}, TimeRangeOverlaps(1000, 2000)).Select()
+	require.NoError(t, err)
+	require.Equal(t, int64(102), result[0].NumRows())
+}
+
+func TestScanStats(t *testing.T) {
+	parts := [][]pqtest.Row{{
+		pqtest.TwoColumnRow("val1", "val1"),
+		pqtest.TwoColumnRow("val1", "val2"),
+		pqtest.TwoColumnRow("val1", "val3"),
+	}, {
+		pqtest.TwoColumnRow("val2", "val4"),
+		pqtest.TwoColumnRow("val2", "val5"),
+		pqtest.TwoColumnRow("val2", "val6"),
+	}}
+	pqFile, err := pqtest.CreateFile(parts)
+	require.NoError(t, err)
+
+	scanner := NewScanner(pqFile, &nopSectionLoader{}, Equals("ColumnB", "val5"))
+	_, err = scanner.Select()
+	require.NoError(t, err)
+
+	stats := scanner.Stats()
+	require.Equal(t, "Scan", stats.Name)
+	require.Contains(t, stats.Stats, Stat{Name: "rows_scanned", Value: int64(6)})
+	require.Contains(t, stats.Stats, Stat{Name: "rows_selected", Value: int64(1)})
+
+	require.Len(t, stats.Children, 1)
+	predicate := stats.Children[0]
+	require.Equal(t, "Predicate[ColumnB]", predicate.Name)
+	require.Contains(t, predicate.Stats, Stat{Name: "pages_skipped_by_stats", Value: int64(1)})
+	require.Contains(t, predicate.Stats, Stat{Name: "rows_skipped_by_stats", Value: int64(3)})
+	require.Contains(t, predicate.Stats, Stat{Name: "rows_filtered_by_dictionary", Value: int64(2)})
+	require.Contains(t, predicate.Stats, Stat{Name: "pages_read", Value: int64(1)})
+
+	var explain strings.Builder
+	require.NoError(t, stats.Explain(&explain))
+	require.Contains(t, explain.String(), "Scan (row_groups=1")
+	require.Contains(t, explain.String(), "└── Predicate[ColumnB]")
+}
+
+func TestScanSeriesHash(t *testing.T) {
+	series := []map[string]string{
+		{"__name__": "http_requests_total", "instance": "abc"},
+		{"__name__": "http_requests_total", "instance": "def"},
+		{"__name__": "up", "instance": "abc"},
+	}
+	pqFile := createChunksFile(t, series, db.WithRowGroupRows(2))
+
+	for i, lbls := range series {
+		scanner := NewScanner(pqFile, &nopSectionLoader{}, SeriesHashEquals(schema.HashSeries(lbls)))
+		selections, err := scanner.Select()
+		require.NoError(t, err)
+
+		var seriesIDs []int64
+		for _, selection := range selections {
+			rows := selection.RowGroup().Rows()
+			for it := dataset.NewRowRangeIterator(selection); it.Next(); {
+				from, to := it.At()
+				require.NoError(t, rows.SeekToRow(from))
+				buf := make([]parquet.Row, to-from)
+				n, err := rows.ReadRows(buf)
+				if err != io.EOF {
+					require.NoError(t, err)
+				}
+				for _, row := range buf[:n] {
+					seriesIDs = append(seriesIDs, row[schema.SeriesIDPos].Int64())
+				}
+			}
+			require.NoError(t, rows.Close())
+		}
+		require.Equal(t, []int64{int64(i), int64(i)}, seriesIDs)
+		require.Contains(t, scanner.Stats().Stats, Stat{Name: "rows_selected", Value: int64(2)})
+	}
+}
+
+func TestScanMaxDictionarySize(t *testing.T) {
+	series := []map[string]string{
+		{"__name__": "http_requests_total", "instance": "abc"},
+		{"__name__": "http_requests_total", "instance": "def"},
+		{"__name__": "http_requests_total", "instance": "ghi"},
+	}
+	// Dictionaries of instances fit a single value, so each row group has the chunks of one series.
+	pqFile := createChunksFile(t, series, db.WithMaxDictionarySize(4), db.WithSortOrder(db.SortBySeries))
+	require.Len(t, pqFile.RowGroups(), len(series))
+
+	for i, lbls := range series {
+		scanner := NewScanner(pqFile, &nopSectionLoader{}, Equals("instance", lbls["instance"]))
+		selections, err := scanner.Select()
+		require.NoError(t, err)
+		for j, selection := range selections {
+			if j == i {
+				require.EqualValues(t, 2, selection.NumRows())
+			} else {
+				require.Zero(t, selection.NumRows())
+			}
+		}
+		// Other row groups are discarded by statistics, bloom filters or dictionaries,
+		// so only the page of the row group with the series is decoded.
+		stats := scanner.Stats().Children[0]
+		require.Contains(t, stats.Stats, Stat{Name: "pages_read", Value: int64(1)})
+	}
+}
+
+// createChunksFile writes a file with two chunks for each series using the db writer.
+func createChunksFile(t testing.TB, series []map[string]string, opts ...db.WriterOption) *parquet.File {
+	dir := t.TempDir()
+	writer, err := db.NewWriter(dir, []string{"__name__", "instance"}, opts...)
+	require.NoError(t, err)
+	for i, lbls := range series {
+		require.NoError(t, writer.Write([]schema.Chunk{
+			{Labels: lbls, SeriesID: int64(i), MinT: 0, MaxT: 10, ChunkBytes: []byte{0}, NumSamples: 1},
+			{Labels: lbls, SeriesID: int64(i), MinT: 10, MaxT: 20, ChunkBytes: []byte{1, 2}, NumSamples: 2},
+		}))
+	}
+	require.NoError(t, writer.Close())
+	require.NoError(t, writer.Compact())
+
+	file, err := os.Open(filepath.Join(dir, "compact.parquet"))
+	require.NoError(t, err)
+	t.Cleanup(func() { file.Close() })
+	stat, err := file.Stat()
+	require.NoError(t, err)
+	pqFile, err := parquet.OpenFile(file, stat.Size())
+	require.NoError(t, err)
+	return pqFile
+}
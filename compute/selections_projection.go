@@ -0,0 +1,90 @@
+package compute
+
+import (
+	"io"
+
+	"Shopify/thanos-parquet-engine/dataset"
+	"Shopify/thanos-parquet-engine/db"
+)
+
+// SelectionsProjection projects the same columns of the selections of several row groups
+// as a single fragment, returning the rows of each row group in order.
+// Row groups are projected one at a time, once the previous row group is exhausted,
+// and row groups without selected rows are skipped.
+type SelectionsProjection struct {
+	selections  []dataset.SelectionResult
+	reader      db.SectionLoader
+	batchSize   int64
+	columnNames []string
+
+	current Fragment
+	next    int
+	stats   []*StatsNode
+}
+
+func ProjectSelections(selections []dataset.SelectionResult, reader db.SectionLoader, batchSize int64, columnNames ...string) *SelectionsProjection {
+	return &SelectionsProjection{
+		selections:  selections,
+		reader:      reader,
+		batchSize:   batchSize,
+		columnNames: columnNames,
+	}
+}
+
+func (p *SelectionsProjection) NextBatch() (Batch, error) {
+	for {
+		if p.current == nil {
+			for p.next < len(p.selections) && p.selections[p.next].NumRows() == 0 {
+				p.next++
+			}
+			if p.next == len(p.selections) {
+				return nil, io.EOF
+			}
+			p.current = ProjectColumns(p.selections[p.next], p.reader, p.batchSize, p.columnNames...)
+			p.next++
+		}
+
+		batch, err := p.current.NextBatch()
+		if err != io.EOF {
+			return batch, err
+		}
+		// Batches of the exhausted row group have been released before the next batch is requested,
+		// so its projection can be closed.
+		if err := p.closeCurrent(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *SelectionsProjection) closeCurrent() error {
+	if p.current == nil {
+		return nil
+	}
+	p.stats = append(p.stats, p.current.Stats())
+	err := p.current.Close()
+	p.current = nil
+	return err
+}
+
+func (p *SelectionsProjection) Release(batch Batch) {
+	if p.current != nil {
+		p.current.Release(batch)
+	}
+}
+
+func (p *SelectionsProjection) MaxBatchSize() int64 {
+	return p.batchSize
+}
+
+// Stats returns the stats of the projection of each row group which has been read.
+func (p *SelectionsProjection) Stats() *StatsNode {
+	children := append([]*StatsNode{}, p.stats...)
+	if p.current != nil {
+		children = append(children, p.current.Stats())
+	}
+	return NewStatsNode("SelectionsProjection", children...).Add("row_groups", len(p.selections))
+}
+
+func (p *SelectionsProjection) Close() error {
+	return p.closeCurrent()
+}
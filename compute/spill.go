@@ -0,0 +1,227 @@
+package compute
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/parquet-go"
+
+	"Shopify/thanos-parquet-engine/db"
+)
+
+const (
+	defaultMemoryLimit = 256 * 1024 * 1024
+	// spillPartitions is the number of files which rows are partitioned into by hash when they are spilled.
+	spillPartitions = 16
+)
+
+type spillOpts struct {
+	memoryLimit int64
+	dir         string
+}
+
+func defaultSpillOpts() spillOpts {
+	return spillOpts{
+		memoryLimit: defaultMemoryLimit,
+		dir:         db.DefaultSectionCacheDir,
+	}
+}
+
+type SpillOption func(*spillOpts)
+
+// WithMemoryLimit sets the approximate memory in bytes which an operator uses for its rows
+// before they are spilled to disk.
+func WithMemoryLimit(bytes int64) SpillOption {
+	return func(opts *spillOpts) {
+		opts.memoryLimit = bytes
+	}
+}
+
+// WithSpillDir sets the directory of the files which rows are spilled to.
+func WithSpillDir(dir string) SpillOption {
+	return func(opts *spillOpts) {
+		opts.dir = dir
+	}
+}
+
+// valueSize is the approximate memory used by a value, without the bytes of byte arrays.
+const valueSize = 24
+
+// rowSize returns the approximate memory used by the values of a row.
+func rowSize(values []parquet.Value) int64 {
+	size := int64(len(values)) * valueSize
+	for _, value := range values {
+		if kind := value.Kind(); kind == parquet.ByteArray || kind == parquet.FixedLenByteArray {
+			size += int64(len(value.ByteArray()))
+		}
+	}
+	return size
+}
+
+// spillFile is a temporary file of rows which operators write when they run out of memory.
+// Rows are written one after the other, and are read back in the same order once writing is done.
+type spillFile struct {
+	file    *os.File
+	writer  *bufio.Writer
+	header  []byte
+	numRows int64
+}
+
+// newSpillFile creates a spill file in dir, which is created if it does not exist.
+func newSpillFile(dir string, pattern string) (*spillFile, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, errors.Wrap(err, "failed creating spill dir")
+	}
+	file, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed creating spill file")
+	}
+	return &spillFile{
+		file:   file,
+		writer: bufio.NewWriter(file),
+	}, nil
+}
+
+// writeRow writes the values of a row. Each value is written with its levels
+// and column index, followed by its bytes, so that it is read back unchanged.
+func (f *spillFile) writeRow(values []parquet.Value) error {
+	for _, value := range values {
+		f.header = f.header[:0]
+		f.header = append(f.header, byte(value.Kind()), byte(value.RepetitionLevel()), byte(value.DefinitionLevel()))
+		f.header = binary.AppendUvarint(f.header, uint64(value.Column()+1))
+		if value.IsNull() {
+			f.header = binary.AppendUvarint(f.header, 0)
+		} else {
+			bytes := value.Bytes()
+			f.header = binary.AppendUvarint(f.header, uint64(len(bytes))+1)
+			f.header = append(f.header, bytes...)
+		}
+		if _, err := f.writer.Write(f.header); err != nil {
+			return errors.Wrap(err, "failed writing spill file")
+		}
+	}
+	f.numRows++
+	return nil
+}
+
+// newSpillPartitions creates the spill files of rows partitioned by hash.
+func newSpillPartitions(dir string, pattern string) ([]*spillFile, error) {
+	partitions := make([]*spillFile, spillPartitions)
+	for i := range partitions {
+		file, err := newSpillFile(dir, pattern)
+		if err != nil {
+			for _, file := range partitions[:i] {
+				_ = file.Close()
+			}
+			return nil, err
+		}
+		partitions[i] = file
+	}
+	return partitions, nil
+}
+
+// reader finishes writing the file and returns a fragment which reads its rows in batches of batchSize rows.
+func (f *spillFile) reader(numColumns int, batchSize int64) (*spillReader, error) {
+	if err := f.writer.Flush(); err != nil {
+		return nil, errors.Wrap(err, "failed flushing spill file")
+	}
+	if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "failed seeking spill file")
+	}
+	return &spillReader{
+		reader:     bufio.NewReader(f.file),
+		numColumns: numColumns,
+		numRows:    f.numRows,
+		batchSize:  batchSize,
+	}, nil
+}
+
+// Close closes and removes the file.
+func (f *spillFile) Close() error {
+	closeErr := f.file.Close()
+	if err := os.Remove(f.file.Name()); err != nil {
+		return errors.Wrap(err, "failed removing spill file")
+	}
+	return closeErr
+}
+
+// spillReader is a fragment of the rows of a spill file. Values of batches are not read into pages,
+// so they remain valid once batches are released.
+type spillReader struct {
+	reader     *bufio.Reader
+	numColumns int
+	numRows    int64
+	batchSize  int64
+}
+
+func (r *spillReader) NextBatch() (Batch, error) {
+	if r.numRows == 0 {
+		return nil, io.EOF
+	}
+	numRows := r.batchSize
+	if r.numRows < numRows {
+		numRows = r.numRows
+	}
+	batch := make(Batch, r.numColumns)
+	for i := range batch {
+		batch[i] = make([]parquet.Value, numRows)
+	}
+	for row := 0; row < int(numRows); row++ {
+		for i := range batch {
+			value, err := r.readValue()
+			if err != nil {
+				return nil, errors.Wrap(err, "failed reading spill file")
+			}
+			batch[i][row] = value
+		}
+	}
+	r.numRows -= numRows
+	return batch, nil
+}
+
+func (r *spillReader) MaxBatchSize() int64 {
+	return r.batchSize
+}
+
+func (r *spillReader) Release(Batch) {}
+
+func (r *spillReader) Stats() *StatsNode {
+	return NewStatsNode("SpillReader")
+}
+
+// Close does not close the file, which is closed and removed by the operator which wrote it.
+func (r *spillReader) Close() error {
+	return nil
+}
+
+func (r *spillReader) readValue() (parquet.Value, error) {
+	var levels [3]byte
+	if _, err := io.ReadFull(r.reader, levels[:]); err != nil {
+		return parquet.Value{}, err
+	}
+	column, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return parquet.Value{}, err
+	}
+	length, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return parquet.Value{}, err
+	}
+
+	var value parquet.Value
+	if length > 0 {
+		bytes := make([]byte, length-1)
+		if _, err := io.ReadFull(r.reader, bytes); err != nil {
+			return parquet.Value{}, err
+		}
+		value = parquet.Kind(int8(levels[0])).Value(bytes)
+	}
+	if column == 0 {
+		// Values which were not read from a column have no levels.
+		return value, nil
+	}
+	return value.Level(int(levels[1]), int(levels[2]), int(column)-1), nil
+}
@@ -0,0 +1,95 @@
+package compute
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"Shopify/thanos-parquet-engine/dataset"
+)
+
+// Stat is a single named measurement attached to a StatsNode.
+type Stat struct {
+	Name  string
+	Value any
+}
+
+// StatsNode is a node in the execution statistics tree of a query.
+// Each operator reports its own stats and the stats of its inputs as children.
+type StatsNode struct {
+	Name     string
+	Stats    []Stat
+	Children []*StatsNode
+}
+
+func NewStatsNode(name string, children ...*StatsNode) *StatsNode {
+	return &StatsNode{Name: name, Children: children}
+}
+
+func (n *StatsNode) Add(name string, value any) *StatsNode {
+	n.Stats = append(n.Stats, Stat{Name: name, Value: value})
+	return n
+}
+
+// Explain writes the stats tree in a human-readable form, similar to EXPLAIN ANALYZE.
+func (n *StatsNode) Explain(w io.Writer) error {
+	return n.explain(w, "", "")
+}
+
+func (n *StatsNode) explain(w io.Writer, prefix string, childPrefix string) error {
+	stats := make([]string, 0, len(n.Stats))
+	for _, s := range n.Stats {
+		stats = append(stats, fmt.Sprintf("%s=%v", s.Name, s.Value))
+	}
+	if _, err := fmt.Fprintf(w, "%s%s (%s)\n", prefix, n.Name, strings.Join(stats, ", ")); err != nil {
+		return err
+	}
+	for i, child := range n.Children {
+		if i == len(n.Children)-1 {
+			if err := child.explain(w, childPrefix+"└── ", childPrefix+"    "); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := child.explain(w, childPrefix+"├── ", childPrefix+"│   "); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (n *StatsNode) String() string {
+	var sb strings.Builder
+	_ = n.Explain(&sb)
+	return sb.String()
+}
+
+func predicateStats(stats *dataset.PredicateStats) *StatsNode {
+	return NewStatsNode("Predicate["+stats.Column+"]").
+		Add("row_groups_skipped_by_stats", stats.RowGroupsSkippedByStats).
+		Add("row_groups_skipped_by_bloom", stats.RowGroupsSkippedByBloom).
+		Add("row_groups_skipped_by_dictionary", stats.RowGroupsSkippedByDictionary).
+		Add("pages_skipped_by_stats", stats.PagesSkippedByStats).
+		Add("rows_skipped_by_stats", stats.RowsSkippedByStats).
+		Add("rows_filtered_by_dictionary", stats.RowsFilteredByDictionary).
+		Add("rows_filtered_by_decoding", stats.RowsFilteredByDecoding).
+		Add("pages_read", stats.PagesRead).
+		Add("bytes_read", stats.BytesRead).
+		Add("decode_time", stats.DecodeTime)
+}
+
+func columnStats(stats *dataset.ColumnStats) *StatsNode {
+	return NewStatsNode("Column["+stats.Column+"]").
+		Add("pages_read", stats.PagesRead).
+		Add("bytes_read", stats.BytesRead).
+		Add("decode_time", stats.DecodeTime)
+}
+
+type scanStats struct {
+	rowGroups         int
+	rowGroupsSelected int
+	rowsScanned       int64
+	rowsSelected      int64
+	duration          time.Duration
+}
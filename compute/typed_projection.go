@@ -0,0 +1,347 @@
+package compute
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/parquet-go"
+	"github.com/segmentio/parquet-go/encoding"
+	"golang.org/x/exp/slices"
+
+	"Shopify/thanos-parquet-engine/dataset"
+	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/generic"
+)
+
+// TypedColumn holds the values of a column in a typed batch.
+// Only the buffers matching the kind of the column are set.
+type TypedColumn struct {
+	Kind parquet.Kind
+
+	Int32  []int32
+	Int64  []int64
+	Float  []float32
+	Double []float64
+	// Data and Offsets hold BYTE_ARRAY and FIXED_LEN_BYTE_ARRAY values.
+	// Value i is Data[Offsets[i]:Offsets[i+1]].
+	Data    []byte
+	Offsets []uint32
+	// Indexes and Dictionary hold BYTE_ARRAY values which are read from dictionary encoded pages
+	// without being copied. Value i is the dictionary value at Indexes[i]. Data and Offsets are
+	// empty when Dictionary is set.
+	Indexes    []int32
+	Dictionary parquet.Dictionary
+
+	dictValues  []byte
+	dictOffsets []uint32
+}
+
+// Len returns the number of values in the column.
+func (c *TypedColumn) Len() int {
+	switch c.Kind {
+	case parquet.Int32:
+		return len(c.Int32)
+	case parquet.Int64:
+		return len(c.Int64)
+	case parquet.Float:
+		return len(c.Float)
+	case parquet.Double:
+		return len(c.Double)
+	default:
+		if c.Dictionary != nil {
+			return len(c.Indexes)
+		}
+		return len(c.Offsets) - 1
+	}
+}
+
+// ByteArray returns the byte array value at index i. It points into the column buffer
+// or the dictionary, and is only valid until the batch is released.
+func (c *TypedColumn) ByteArray(i int) []byte {
+	if c.Dictionary != nil {
+		index := c.Indexes[i]
+		return c.dictValues[c.dictOffsets[index]:c.dictOffsets[index+1]]
+	}
+	return c.Data[c.Offsets[i]:c.Offsets[i+1]]
+}
+
+func (c *TypedColumn) reset() {
+	c.Int32 = c.Int32[:0]
+	c.Int64 = c.Int64[:0]
+	c.Float = c.Float[:0]
+	c.Double = c.Double[:0]
+	c.Data = c.Data[:0]
+	c.Offsets = append(c.Offsets[:0], 0)
+	c.Indexes = c.Indexes[:0]
+	c.Dictionary, c.dictValues, c.dictOffsets = nil, nil, nil
+}
+
+// TypedBatch is a batch of typed columns with the same number of values.
+type TypedBatch []*TypedColumn
+
+// TypedProjections read columns of a selection into typed buffers which are reused between batches.
+// Unlike Projections, values are copied straight from decoded pages without being boxed into parquet.Values,
+// and values of dictionary encoded BYTE_ARRAY columns are returned as indexes into the dictionary of the column chunk.
+// BOOLEAN and INT96 columns are not supported.
+type TypedProjections struct {
+	columns   []*typedColumnProjection
+	batchSize int64
+}
+
+// ProjectTypedColumns creates typed projections of the columns in the selection. Columns which do not exist are skipped.
+func ProjectTypedColumns(selection dataset.SelectionResult, reader db.SectionLoader, batchSize int64, columnNames ...string) (TypedProjections, error) {
+	return projectTypedColumns(selection, reader, batchSize, noPageGap, columnNames)
+}
+
+// ProjectSparseColumns creates typed projections for selections with few rows spread over the column chunks,
+// such as the rows of series which remain after their labels have been filtered. Selected pages which are more
+// than maxGap bytes apart are loaded in separate sections, so that unselected pages between them are not read.
+func ProjectSparseColumns(selection dataset.SelectionResult, reader db.SectionLoader, batchSize, maxGap int64, columnNames ...string) (TypedProjections, error) {
+	return projectTypedColumns(selection, reader, batchSize, maxGap, columnNames)
+}
+
+func projectTypedColumns(selection dataset.SelectionResult, reader db.SectionLoader, batchSize, maxGap int64, columnNames []string) (TypedProjections, error) {
+	projections := TypedProjections{batchSize: batchSize}
+	for _, columnName := range columnNames {
+		column, ok := selection.RowGroup().Schema().Lookup(columnName)
+		if !ok {
+			continue
+		}
+		colProjection, err := newTypedColumnProjection(column, selection, reader, batchSize, maxGap)
+		if err != nil {
+			projections.Close()
+			return TypedProjections{}, err
+		}
+		projections.columns = append(projections.columns, colProjection)
+	}
+	return projections, nil
+}
+
+// NextBatch reads the next batch of up to batchSize values of each column, or returns io.EOF when all rows have been read.
+// The batch must be released once its values are no longer used.
+func (p TypedProjections) NextBatch() (TypedBatch, error) {
+	batch := make(TypedBatch, len(p.columns))
+	err := generic.ParallelEach(p.columns, func(i int, column *typedColumnProjection) error {
+		var err error
+		batch[i], err = column.nextBatch()
+		return err
+	})
+	if err != nil {
+		p.Release(batch)
+		return nil, err
+	}
+	return batch, nil
+}
+
+// Release returns the buffers of the batch so that they are reused by the next batches.
+func (p TypedProjections) Release(batch TypedBatch) {
+	for i, column := range batch {
+		if column != nil {
+			p.columns[i].put(column)
+		}
+	}
+}
+
+func (p TypedProjections) MaxBatchSize() int64 {
+	return p.batchSize
+}
+
+// Stats returns the pages and bytes read from each projected column.
+func (p TypedProjections) Stats() *StatsNode {
+	node := NewStatsNode("TypedProjection").Add("batch_size", p.batchSize)
+	for _, column := range p.columns {
+		node.Children = append(node.Children, columnStats(column.cursor.stats))
+	}
+	return node
+}
+
+func (p TypedProjections) Close() error {
+	var lastErr error
+	for _, column := range p.columns {
+		if colErr := column.Close(); colErr != nil {
+			lastErr = colErr
+		}
+	}
+	return lastErr
+}
+
+type typedColumnProjection struct {
+	cursor    *pageCursor
+	kind      parquet.Kind
+	batchSize int64
+
+	mu   sync.Mutex
+	free []*TypedColumn
+}
+
+func newTypedColumnProjection(
+	column parquet.LeafColumn,
+	selection dataset.SelectionResult,
+	loader db.SectionLoader,
+	batchSize int64,
+	maxGap int64,
+) (*typedColumnProjection, error) {
+	kind := column.Node.Type().Kind()
+	switch kind {
+	case parquet.Int32, parquet.Int64, parquet.Float, parquet.Double, parquet.ByteArray, parquet.FixedLenByteArray:
+	default:
+		return nil, errors.Errorf("unsupported type %s of column %s", column.Node.Type(), column.Path[0])
+	}
+	return &typedColumnProjection{
+		cursor:    newPageCursor(column, selection, loader, maxGap),
+		kind:      kind,
+		batchSize: batchSize,
+	}, nil
+}
+
+func (p *typedColumnProjection) nextBatch() (*TypedColumn, error) {
+	decodeStart := time.Now()
+	defer func() { p.cursor.stats.DecodeTime += time.Since(decodeStart) }()
+
+	column := p.get()
+	var numRead int64
+	for numRead < p.batchSize {
+		page, i, j, err := p.cursor.next(p.batchSize - numRead)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			p.put(column)
+			return nil, err
+		}
+		column.appendPage(page, i, j)
+		numRead += j - i
+	}
+	if numRead == 0 {
+		p.put(column)
+		return nil, io.EOF
+	}
+	return column, nil
+}
+
+func (p *typedColumnProjection) get() *TypedColumn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.free) == 0 {
+		column := &TypedColumn{Kind: p.kind}
+		column.reset()
+		return column
+	}
+	column := p.free[len(p.free)-1]
+	p.free = p.free[:len(p.free)-1]
+	return column
+}
+
+func (p *typedColumnProjection) put(column *TypedColumn) {
+	column.reset()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.free = append(p.free, column)
+}
+
+func (p *typedColumnProjection) Close() error {
+	return p.cursor.Close()
+}
+
+// appendPage copies the values in [i, j) of the page into the column buffers.
+func (c *TypedColumn) appendPage(page parquet.Page, i, j int64) {
+	switch c.Kind {
+	case parquet.Int32:
+		c.Int32 = appendTypedValues(c.Int32, page, i, j, (*encoding.Values).Int32)
+	case parquet.Int64:
+		c.Int64 = appendTypedValues(c.Int64, page, i, j, (*encoding.Values).Int64)
+	case parquet.Float:
+		c.Float = appendTypedValues(c.Float, page, i, j, (*encoding.Values).Float)
+	case parquet.Double:
+		c.Double = appendTypedValues(c.Double, page, i, j, (*encoding.Values).Double)
+	case parquet.ByteArray:
+		c.appendByteArrays(page, i, j)
+	case parquet.FixedLenByteArray:
+		c.appendFixedLenByteArrays(page, i, j)
+	}
+}
+
+// appendTypedValues appends the values in [i, j) of the page to dst, resolving indexes of dictionary encoded pages.
+func appendTypedValues[T any](dst []T, page parquet.Page, i, j int64, values func(*encoding.Values) []T) []T {
+	data := page.Data()
+	if dict := page.Dictionary(); dict != nil {
+		dictData := dict.Page().Data()
+		dictValues := values(&dictData)
+		for _, index := range data.Int32()[i:j] {
+			dst = append(dst, dictValues[index])
+		}
+		return dst
+	}
+	return append(dst, values(&data)[i:j]...)
+}
+
+func (c *TypedColumn) appendByteArrays(page parquet.Page, i, j int64) {
+	data := page.Data()
+	dict := page.Dictionary()
+	// Pages of a column chunk share its dictionary, so indexes are kept unless the batch
+	// has values of plain pages.
+	if dict != nil && (dict == c.Dictionary || c.Len() == 0) {
+		if c.Dictionary == nil {
+			dictData := dict.Page().Data()
+			c.Dictionary = dict
+			c.dictValues, c.dictOffsets = dictData.ByteArray()
+		}
+		c.Indexes = append(c.Indexes, data.Int32()[i:j]...)
+		return
+	}
+	c.materialize()
+	if dict != nil {
+		dictData := dict.Page().Data()
+		values, offsets := dictData.ByteArray()
+		// Buffers are appended to as locals, which avoids write barriers on each value.
+		buf, bufOffsets := c.Data, slices.Grow(c.Offsets, int(j-i))
+		for _, index := range data.Int32()[i:j] {
+			buf = append(buf, values[offsets[index]:offsets[index+1]]...)
+			bufOffsets = append(bufOffsets, uint32(len(buf)))
+		}
+		c.Data, c.Offsets = buf, bufOffsets
+		return
+	}
+	// Values of plain pages are contiguous, so they are copied at once and only offsets are rebased.
+	values, offsets := data.ByteArray()
+	start := uint32(len(c.Data))
+	c.Data = append(c.Data, values[offsets[i]:offsets[j]]...)
+	for _, offset := range offsets[i+1 : j+1] {
+		c.Offsets = append(c.Offsets, start+offset-offsets[i])
+	}
+}
+
+// materialize copies the dictionary values of the indexes into the data buffer.
+func (c *TypedColumn) materialize() {
+	if c.Dictionary == nil {
+		return
+	}
+	for i := range c.Indexes {
+		c.appendByteArray(c.ByteArray(i))
+	}
+	c.Indexes = c.Indexes[:0]
+	c.Dictionary, c.dictValues, c.dictOffsets = nil, nil, nil
+}
+
+func (c *TypedColumn) appendFixedLenByteArrays(page parquet.Page, i, j int64) {
+	data := page.Data()
+	if dict := page.Dictionary(); dict != nil {
+		dictData := dict.Page().Data()
+		values, size := dictData.FixedLenByteArray()
+		for _, index := range data.Int32()[i:j] {
+			c.appendByteArray(values[int(index)*size : int(index+1)*size])
+		}
+		return
+	}
+	values, size := data.FixedLenByteArray()
+	for k := int(i); k < int(j); k++ {
+		c.appendByteArray(values[k*size : (k+1)*size])
+	}
+}
+
+func (c *TypedColumn) appendByteArray(value []byte) {
+	c.Data = append(c.Data, value...)
+	c.Offsets = append(c.Offsets, uint32(len(c.Data)))
+}
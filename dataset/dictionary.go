@@ -0,0 +1,166 @@
+package dataset
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/encoding/thrift"
+	"github.com/segmentio/parquet-go"
+	"github.com/segmentio/parquet-go/format"
+)
+
+// Dictionaries reads and decodes the dictionary pages of column chunks
+// without touching any of their data pages. It is safe for concurrent use.
+type Dictionaries struct {
+	reader   io.ReaderAt
+	protocol thrift.CompactProtocol
+
+	mu           sync.Mutex
+	dictionaries map[int64]*dictionaryEntry
+}
+
+// dictionaryEntry decodes a dictionary page once, so that concurrent readers of the same
+// column chunk wait for a single read while readers of other column chunks are not blocked.
+type dictionaryEntry struct {
+	once       sync.Once
+	dictionary parquet.Dictionary
+	err        error
+}
+
+func NewDictionaries(reader io.ReaderAt) *Dictionaries {
+	return &Dictionaries{
+		reader:       reader,
+		dictionaries: make(map[int64]*dictionaryEntry),
+	}
+}
+
+// Read returns the dictionary of a column chunk, or nil if the chunk is not dictionary encoded.
+// Decoded dictionaries are cached by their offset in the file. Failed reads are not cached.
+func (d *Dictionaries) Read(chunk parquet.ColumnChunk, metadata format.ColumnMetaData) (parquet.Dictionary, error) {
+	dictionaryOffset := metadata.DictionaryPageOffset
+	if dictionaryOffset == 0 || metadata.DataPageOffset <= dictionaryOffset {
+		return nil, nil
+	}
+
+	d.mu.Lock()
+	entry, ok := d.dictionaries[dictionaryOffset]
+	if !ok {
+		entry = &dictionaryEntry{}
+		d.dictionaries[dictionaryOffset] = entry
+	}
+	d.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.dictionary, entry.err = d.decode(chunk, metadata)
+	})
+	if entry.err != nil {
+		d.mu.Lock()
+		if d.dictionaries[dictionaryOffset] == entry {
+			delete(d.dictionaries, dictionaryOffset)
+		}
+		d.mu.Unlock()
+		return nil, errors.Wrap(entry.err, "failed decoding dictionary page")
+	}
+	return entry.dictionary, nil
+}
+
+func (d *Dictionaries) decode(chunk parquet.ColumnChunk, metadata format.ColumnMetaData) (parquet.Dictionary, error) {
+	dictionarySize := metadata.DataPageOffset - metadata.DictionaryPageOffset
+	section := io.NewSectionReader(d.reader, metadata.DictionaryPageOffset, dictionarySize)
+	buffer := bufio.NewReaderSize(section, int(minInt64(dictionarySize, 64*1024)))
+
+	var header format.PageHeader
+	decoder := thrift.NewDecoder(d.protocol.NewReader(buffer))
+	if err := decoder.Decode(&header); err != nil {
+		return nil, err
+	}
+	if header.DictionaryPageHeader == nil {
+		return nil, parquet.ErrMissingPageHeader
+	}
+
+	pageData := make([]byte, header.CompressedPageSize)
+	if _, err := io.ReadFull(buffer, pageData); err != nil {
+		return nil, err
+	}
+	if metadata.Codec != format.Uncompressed {
+		codec := parquet.LookupCompressionCodec(metadata.Codec)
+		decompressed, err := codec.Decode(make([]byte, 0, header.UncompressedPageSize), pageData)
+		if err != nil {
+			return nil, err
+		}
+		pageData = decompressed
+	}
+
+	pageEncoding := header.DictionaryPageHeader.Encoding
+	if pageEncoding == format.PlainDictionary {
+		pageEncoding = format.Plain
+	}
+	pageType := chunk.Type()
+	values, err := pageType.Decode(pageType.NewValues(nil, nil), pageData, parquet.LookupEncoding(pageEncoding))
+	if err != nil {
+		return nil, err
+	}
+	numValues := int(header.DictionaryPageHeader.NumValues)
+	return pageType.NewDictionary(chunk.Column(), numValues, values), nil
+}
+
+// onlyDictionaryPages returns true if all data pages of a column chunk are dictionary encoded,
+// so that rows can only have values of its dictionary. Writers can fall back to plain encoded
+// pages once the dictionary grows too large, and the values of these pages are not in the dictionary.
+// Without page encoding stats, plain pages cannot be told apart from a plain encoded dictionary page.
+func onlyDictionaryPages(metadata format.ColumnMetaData) bool {
+	if len(metadata.EncodingStats) == 0 {
+		for _, enc := range metadata.Encoding {
+			switch enc {
+			case format.RLEDictionary, format.PlainDictionary, format.RLE, format.BitPacked:
+			default:
+				return false
+			}
+		}
+		return true
+	}
+	for _, stats := range metadata.EncodingStats {
+		if stats.PageType != format.DataPage && stats.PageType != format.DataPageV2 {
+			continue
+		}
+		if stats.Encoding != format.RLEDictionary && stats.Encoding != format.PlainDictionary {
+			return false
+		}
+	}
+	return true
+}
+
+// dictionarySelector discards entire column chunks when none of the values
+// in their dictionary match, before any of their data pages are read.
+// Column chunks with pages which are not dictionary encoded are always selected.
+type dictionarySelector struct {
+	dictionaries *Dictionaries
+	matches      matchFunc
+}
+
+func newDictionarySelector(dictionaries *Dictionaries, matches matchFunc) *dictionarySelector {
+	return &dictionarySelector{dictionaries: dictionaries, matches: matches}
+}
+
+func (s dictionarySelector) SelectRowGroup(rowGroup RowGroup, column int, stats *PredicateStats) RowSelection {
+	chunk := rowGroup.ColumnChunks()[column]
+	metadata := rowGroup.Metadata().Columns[column].MetaData
+	if !onlyDictionaryPages(metadata) {
+		return SelectAll()
+	}
+	dictionary, err := s.dictionaries.Read(chunk, metadata)
+	if err != nil || dictionary == nil {
+		return SelectAll()
+	}
+	for i := 0; i < dictionary.Len(); i++ {
+		if s.matches(dictionary.Index(int32(i))) {
+			return SelectAll()
+		}
+	}
+
+	var selection RowSelection
+	stats.RowGroupsSkippedByDictionary++
+	return selection.Skip(0, chunk.NumValues())
+}
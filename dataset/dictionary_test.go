@@ -0,0 +1,157 @@
+package dataset
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/segmentio/parquet-go/format"
+	"github.com/stretchr/testify/require"
+
+	"Shopify/thanos-parquet-engine/pqtest"
+)
+
+func TestDictionarySelector(t *testing.T) {
+	file, err := pqtest.CreateFile([][]pqtest.Row{{
+		pqtest.TwoColumnRow("val1", "val1"),
+		pqtest.TwoColumnRow("val1", "val3"),
+		pqtest.TwoColumnRow("val2", "val1"),
+		pqtest.TwoColumnRow("val2", "val3"),
+	}})
+	require.NoError(t, err)
+	columnB, _ := file.Schema().Lookup("ColumnB")
+	rowGroup := FileRowGroups(file)[0]
+
+	dictionaries := NewDictionaries(file)
+	dictionary, err := dictionaries.Read(rowGroup.ColumnChunks()[columnB.ColumnIndex], rowGroup.Metadata().Columns[columnB.ColumnIndex].MetaData)
+	require.NoError(t, err)
+	require.Equal(t, 2, dictionary.Len())
+	require.Equal(t, "val1", dictionary.Index(0).String())
+	require.Equal(t, "val3", dictionary.Index(1).String())
+
+	// Page statistics cannot discard val2 since it is between the min and max value of each page.
+	predicate := NewEqualsPredicate(nopSectionLoader{}, dictionaries, columnB, "val2")
+	selection := predicate.SelectRows(rowGroup)
+	require.Zero(t, SelectRows(rowGroup, selection).NumRows())
+
+	stats := predicate.Stats()[0]
+	require.EqualValues(t, 1, stats.RowGroupsSkippedByDictionary)
+	require.Zero(t, stats.PagesSkippedByStats)
+	require.Zero(t, stats.PagesRead)
+
+	predicate = NewEqualsPredicate(nopSectionLoader{}, dictionaries, columnB, "val3")
+	selection = predicate.SelectRows(rowGroup)
+	require.EqualValues(t, 4, SelectRows(rowGroup, selection).NumRows())
+}
+
+func TestDictionaryFallbackPages(t *testing.T) {
+	rows := make([]pqtest.Row, 0, 256)
+	for i := 0; i < 128; i++ {
+		rows = append(rows, pqtest.TwoColumnRow("val1", "val1"), pqtest.TwoColumnRow("val1", "val3"))
+	}
+	file, err := pqtest.CreateFile([][]pqtest.Row{rows})
+	require.NoError(t, err)
+	columnB, _ := file.Schema().Lookup("ColumnB")
+	rowGroup := FileRowGroups(file)[0]
+
+	// The writer does not fall back to plain pages, so a fallback page is added to the
+	// encoding stats of the column chunk. Values of such pages do not have to be in the dictionary,
+	// so the column chunk cannot be skipped.
+	metadata := rowGroup.Metadata()
+	metadata.Columns = append([]format.ColumnChunk{}, metadata.Columns...)
+	columnMetadata := &metadata.Columns[columnB.ColumnIndex].MetaData
+	require.True(t, onlyDictionaryPages(*columnMetadata))
+	columnMetadata.EncodingStats = append(append([]format.PageEncodingStats{}, columnMetadata.EncodingStats...), format.PageEncodingStats{
+		PageType: format.DataPage,
+		Encoding: format.Plain,
+		Count:    1,
+	})
+	require.False(t, onlyDictionaryPages(*columnMetadata))
+	fallbackRowGroup := &fileRowGroup{RowGroup: rowGroup, metadata: metadata}
+
+	cases := []struct {
+		name             string
+		rowGroup         RowGroup
+		skippedRowGroups int64
+		allPagesRead     bool
+	}{
+		{name: "dictionary pages", rowGroup: rowGroup, skippedRowGroups: 1},
+		{name: "fallback pages", rowGroup: fallbackRowGroup, allPagesRead: true},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			predicate := NewEqualsPredicate(nopSectionLoader{}, NewDictionaries(file), columnB, "val2")
+			selection := predicate.SelectRows(tcase.rowGroup)
+			require.Equal(t, tcase.skippedRowGroups, predicate.Stats()[0].RowGroupsSkippedByDictionary)
+			if tcase.skippedRowGroups == 0 {
+				require.EqualValues(t, tcase.rowGroup.NumRows(), SelectRows(tcase.rowGroup, selection).NumRows())
+			}
+
+			// Without dictionaries, the row group is only discarded by the filter.
+			predicate = NewEqualsPredicate(nopSectionLoader{}, nil, columnB, "val2")
+			selection = predicate.SelectRows(tcase.rowGroup)
+			pages := selectCoveringPages(tcase.rowGroup.ColumnChunks()[columnB.ColumnIndex], SelectRows(tcase.rowGroup, selection))
+			numPages := pages.NumPages()
+			require.NoError(t, pages.Close())
+			require.Greater(t, numPages, int64(1))
+			filtered, err := predicate.FilterRows(tcase.rowGroup, selection)
+			require.NoError(t, err)
+			require.Zero(t, SelectRows(tcase.rowGroup, filtered).NumRows())
+
+			pagesRead := predicate.Stats()[0].PagesRead
+			if tcase.allPagesRead {
+				require.EqualValues(t, numPages, pagesRead)
+			} else {
+				require.EqualValues(t, 1, pagesRead)
+			}
+		})
+	}
+}
+
+// countingReader counts the reads which start at an offset.
+type countingReader struct {
+	io.ReaderAt
+	offset int64
+	reads  atomic.Int64
+}
+
+func (r *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off == r.offset {
+		r.reads.Add(1)
+	}
+	return r.ReaderAt.ReadAt(p, off)
+}
+
+func TestDictionariesConcurrentRead(t *testing.T) {
+	file, err := pqtest.CreateFile([][]pqtest.Row{{
+		pqtest.TwoColumnRow("val1", "val1"),
+		pqtest.TwoColumnRow("val2", "val3"),
+	}})
+	require.NoError(t, err)
+	columnB, _ := file.Schema().Lookup("ColumnB")
+	rowGroup := FileRowGroups(file)[0]
+	chunk := rowGroup.ColumnChunks()[columnB.ColumnIndex]
+	metadata := rowGroup.Metadata().Columns[columnB.ColumnIndex].MetaData
+
+	reader := &countingReader{ReaderAt: file, offset: metadata.DictionaryPageOffset}
+	dictionaries := NewDictionaries(reader)
+
+	var wg sync.WaitGroup
+	results := make([]int, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			dictionary, err := dictionaries.Read(chunk, metadata)
+			require.NoError(t, err)
+			results[i] = dictionary.Len()
+		}(i)
+	}
+	wg.Wait()
+	for _, numValues := range results {
+		require.Equal(t, 2, numValues)
+	}
+	// The dictionary page is only read once.
+	require.EqualValues(t, 1, reader.reads.Load())
+}
@@ -0,0 +1,200 @@
+package dataset
+
+import (
+	"math/bits"
+
+	"github.com/segmentio/parquet-go"
+)
+
+// bitmap is a set of bits packed in 64 bit words, such as the rows of a page
+// or the indexes of a dictionary which match a predicate.
+type bitmap []uint64
+
+// resize returns a bitmap with room for n bits which are all unset, reusing the words of b.
+func (b bitmap) resize(n int) bitmap {
+	numWords := (n + 63) / 64
+	if cap(b) < numWords {
+		return make(bitmap, numWords)
+	}
+	b = b[:numWords]
+	for i := range b {
+		b[i] = 0
+	}
+	return b
+}
+
+func (b bitmap) set(i int) {
+	b[i>>6] |= 1 << (i & 63)
+}
+
+func (b bitmap) isSet(i int) bool {
+	return b[i>>6]&(1<<(i&63)) != 0
+}
+
+// count returns the number of set bits.
+func (b bitmap) count() int64 {
+	var n int
+	for _, word := range b {
+		n += bits.OnesCount64(word)
+	}
+	return int64(n)
+}
+
+// nextSet returns the first set bit at or after i, or n if there is none before n.
+func (b bitmap) nextSet(i, n int) int {
+	for i < n {
+		word := b[i>>6] >> (i & 63)
+		if word != 0 {
+			return minInt(i+bits.TrailingZeros64(word), n)
+		}
+		i = (i | 63) + 1
+	}
+	return n
+}
+
+// nextUnset returns the first unset bit at or after i, or n if there is none before n.
+func (b bitmap) nextUnset(i, n int) int {
+	for i < n {
+		word := ^b[i>>6] >> (i & 63)
+		if word != 0 {
+			return minInt(i+bits.TrailingZeros64(word), n)
+		}
+		i = (i | 63) + 1
+	}
+	return n
+}
+
+// clearRange unsets the bits in [i, j).
+func (b bitmap) clearRange(i, j int) {
+	for i < j {
+		word := i >> 6
+		// The mask covers bits from i to the end of the word, or to j when it is in the same word.
+		mask := ^uint64(0) << (i & 63)
+		if end := (word + 1) << 6; j < end {
+			mask &= ^uint64(0) >> (end - j)
+		}
+		b[word] &^= mask
+		i = (i | 63) + 1
+	}
+}
+
+// setRange sets the bits in [i, j).
+func (b bitmap) setRange(i, j int) {
+	for i < j {
+		word := i >> 6
+		mask := ^uint64(0) << (i & 63)
+		if end := (word + 1) << 6; j < end {
+			mask &= ^uint64(0) >> (end - j)
+		}
+		b[word] |= mask
+		i = (i | 63) + 1
+	}
+}
+
+// clearUnselected unsets the bits of rows which are not in the sorted ranges, where bit i is the
+// row at fromRow+i. It returns the ranges which continue after the last of the n rows.
+func (b bitmap) clearUnselected(fromRow int64, n int, ranges []PickRange) []PickRange {
+	toRow := fromRow + int64(n)
+	next := fromRow
+	for len(ranges) > 0 && ranges[0].from < toRow {
+		r := ranges[0]
+		if r.from > next {
+			b.clearRange(int(next-fromRow), int(r.from-fromRow))
+		}
+		if r.to > next {
+			next = r.to
+		}
+		if r.to > toRow {
+			break
+		}
+		ranges = ranges[1:]
+	}
+	if next < toRow {
+		b.clearRange(int(next-fromRow), n)
+	}
+	return ranges
+}
+
+// dictionaryBitmap returns a bitmap of the indexes of dictionary values which match.
+func dictionaryBitmap(dictionary parquet.Dictionary, matches matchFunc) bitmap {
+	matching := bitmap(nil).resize(dictionary.Len())
+	for i := 0; i < dictionary.Len(); i++ {
+		if matches(dictionary.Index(int32(i))) {
+			matching.set(i)
+		}
+	}
+	return matching
+}
+
+// filterIndexes sets the bits of rows whose dictionary index is set in the matching bitmap.
+// Rows are processed a word at a time, so that bits are written without branching on each row.
+func filterIndexes(rows bitmap, indexes []int32, matching bitmap) {
+	if len(matching) == 1 {
+		// Indexes of dictionaries with at most 64 values are looked up in a single word.
+		mask := matching[0]
+		for w := 0; w*64 < len(indexes); w++ {
+			block := indexes[w*64 : minInt((w+1)*64, len(indexes))]
+			var word uint64
+			for j, index := range block {
+				word |= (mask >> (uint32(index) & 63) & 1) << j
+			}
+			rows[w] = word
+		}
+		return
+	}
+	for w := 0; w*64 < len(indexes); w++ {
+		block := indexes[w*64 : minInt((w+1)*64, len(indexes))]
+		var word uint64
+		for j, index := range block {
+			word |= (matching[index>>6] >> (index & 63) & 1) << j
+		}
+		rows[w] = word
+	}
+}
+
+// filterIndexEquals sets the bits of rows whose dictionary index is equal to the given index,
+// or not equal to it when negate is set.
+func filterIndexEquals(rows bitmap, indexes []int32, index int32, negate bool) {
+	for w := 0; w*64 < len(indexes); w++ {
+		block := indexes[w*64 : minInt((w+1)*64, len(indexes))]
+		var word uint64
+		for j, value := range block {
+			if value == index {
+				word |= 1 << j
+			}
+		}
+		if negate {
+			word = ^word
+			if len(block) < 64 {
+				word &= 1<<len(block) - 1
+			}
+		}
+		rows[w] = word
+	}
+}
+
+// filterInt64Range sets the bits of rows whose value is in the range [min, max].
+// The range check uses a single unsigned comparison, which holds for all values when min <= max.
+func filterInt64Range(rows bitmap, values []int64, min, max int64) {
+	if min > max {
+		return
+	}
+	width := uint64(max - min)
+	for w := 0; w*64 < len(values); w++ {
+		block := values[w*64 : minInt((w+1)*64, len(values))]
+		var word uint64
+		for j, value := range block {
+			if uint64(value-min) <= width {
+				word |= 1 << j
+			}
+		}
+		rows[w] = word
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,147 @@
+package dataset
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func bitmapOf(n int, bits ...int) bitmap {
+	b := bitmap(nil).resize(n)
+	for _, i := range bits {
+		b.set(i)
+	}
+	return b
+}
+
+func setBits(b bitmap, n int) []int {
+	bits := make([]int, 0)
+	for i := 0; i < n; i++ {
+		if b.isSet(i) {
+			bits = append(bits, i)
+		}
+	}
+	return bits
+}
+
+func TestBitmapClearUnselected(t *testing.T) {
+	cases := []struct {
+		name      string
+		ranges    []PickRange
+		expected  []int
+		remaining []PickRange
+	}{
+		{
+			name:      "range within page",
+			ranges:    []PickRange{Pick(105, 110)},
+			expected:  []int{105, 109},
+			remaining: []PickRange{},
+		},
+		{
+			name:      "ranges across words",
+			ranges:    []PickRange{Pick(100, 101), Pick(160, 170)},
+			expected:  []int{100, 160, 164, 165, 169},
+			remaining: []PickRange{},
+		},
+		{
+			name:      "range continues after page",
+			ranges:    []PickRange{Pick(90, 101), Pick(199, 250), Pick(300, 310)},
+			expected:  []int{100, 199},
+			remaining: []PickRange{Pick(199, 250), Pick(300, 310)},
+		},
+		{
+			name:      "range after page",
+			ranges:    []PickRange{Pick(200, 210)},
+			remaining: []PickRange{Pick(200, 210)},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Rows 100 to 200 with bits set at the first and last row of each 5 rows.
+			b := bitmap(nil).resize(100)
+			for i := 0; i < 100; i += 5 {
+				b.set(i)
+				b.set(i + 4)
+			}
+			remaining := b.clearUnselected(100, 100, tc.ranges)
+
+			expected := make([]int, 0, len(tc.expected))
+			for _, row := range tc.expected {
+				expected = append(expected, row-100)
+			}
+			require.Equal(t, expected, setBits(b, 100))
+			require.Equal(t, tc.remaining, remaining)
+		})
+	}
+}
+
+func TestFilterIndexes(t *testing.T) {
+	indexesOf := func(dictionarySize int) []int32 {
+		indexes := make([]int32, 150)
+		for i := range indexes {
+			indexes[i] = int32(i % dictionarySize)
+		}
+		return indexes
+	}
+	cases := []struct {
+		name     string
+		indexes  []int32
+		matching bitmap
+		expected []int
+	}{
+		{
+			name:     "single word dictionary",
+			indexes:  indexesOf(64),
+			matching: bitmapOf(64, 3, 63),
+			expected: []int{3, 63, 67, 127, 131},
+		},
+		{
+			name:     "multiple words dictionary",
+			indexes:  indexesOf(100),
+			matching: bitmapOf(100, 3, 70, 99),
+			expected: []int{3, 70, 99, 103},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rows := bitmap(nil).resize(len(tc.indexes))
+			filterIndexes(rows, tc.indexes, tc.matching)
+			require.Equal(t, tc.expected, setBits(rows, len(tc.indexes)))
+		})
+	}
+}
+
+func TestFilterIndexEquals(t *testing.T) {
+	indexes := []int32{0, 1, 2, 1, 0}
+	rows := bitmap(nil).resize(len(indexes))
+	filterIndexEquals(rows, indexes, 1, false)
+	require.Equal(t, []int{1, 3}, setBits(rows, len(indexes)))
+
+	rows = rows.resize(len(indexes))
+	filterIndexEquals(rows, indexes, 1, true)
+	require.Equal(t, []int{0, 2, 4}, setBits(rows, len(indexes)))
+	require.Equal(t, int64(3), rows.count(), "bits after the last row are not set")
+}
+
+func TestFilterInt64Range(t *testing.T) {
+	values := []int64{math.MinInt64, -10, 0, 10, math.MaxInt64}
+	cases := []struct {
+		name     string
+		min, max int64
+		expected []int
+	}{
+		{name: "bounded", min: -10, max: 10, expected: []int{1, 2, 3}},
+		{name: "unbounded min", min: math.MinInt64, max: 0, expected: []int{0, 1, 2}},
+		{name: "unbounded max", min: 0, max: math.MaxInt64, expected: []int{2, 3, 4}},
+		{name: "unbounded", min: math.MinInt64, max: math.MaxInt64, expected: []int{0, 1, 2, 3, 4}},
+		{name: "empty range", min: 10, max: -10, expected: []int{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rows := bitmap(nil).resize(len(values))
+			filterInt64Range(rows, values, tc.min, tc.max)
+			require.Equal(t, tc.expected, setBits(rows, len(values)))
+		})
+	}
+}
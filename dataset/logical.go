@@ -0,0 +1,182 @@
+package dataset
+
+import (
+	"golang.org/x/exp/slices"
+)
+
+type and struct {
+	predicates []Predicate
+}
+
+// And selects rows which match all predicates.
+// Predicates are evaluated in order of their estimated selectivity and cost,
+// and each predicate only decodes pages which are still selected by the previous ones.
+func And(predicates ...Predicate) Predicate {
+	return &and{predicates: predicates}
+}
+
+func (a and) SelectRowGroup(rowGroup RowGroup) bool {
+	for _, p := range a.predicates {
+		if !p.SelectRowGroup(rowGroup) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a and) SelectRows(rowGroup RowGroup) RowSelection {
+	var selection RowSelection
+	for _, p := range a.predicates {
+		selection = append(selection, p.SelectRows(rowGroup)...)
+	}
+	return selection
+}
+
+func (a and) FilterRows(rowGroup RowGroup, selection Selection) (Selection, error) {
+	for _, p := range plan(rowGroup, selection, a.predicates) {
+		if numSelected(rowGroup, selection) == 0 {
+			break
+		}
+		var err error
+		selection, err = p.FilterRows(rowGroup, selection)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return selection, nil
+}
+
+func (a and) Estimate(rowGroup RowGroup, selection Selection) Estimate {
+	estimate := Estimate{Selectivity: 1}
+	for _, p := range a.predicates {
+		e := p.Estimate(rowGroup, selection)
+		estimate.Selectivity *= e.Selectivity
+		estimate.Cost += e.Cost
+	}
+	return estimate
+}
+
+func (a and) Stats() []*PredicateStats {
+	return collectStats(a.predicates)
+}
+
+type or struct {
+	predicates []Predicate
+}
+
+// Or selects rows which match any of the predicates.
+// Each predicate only decodes rows which were not already matched by the previous ones.
+func Or(predicates ...Predicate) Predicate {
+	return &or{predicates: predicates}
+}
+
+func (o or) SelectRowGroup(rowGroup RowGroup) bool {
+	for _, p := range o.predicates {
+		if p.SelectRowGroup(rowGroup) {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectRows only discards rows which are discarded by all predicates.
+func (o or) SelectRows(rowGroup RowGroup) RowSelection {
+	picked := make([]PickRange, 0)
+	for _, p := range o.predicates {
+		picked = append(picked, SelectRows(rowGroup, p.SelectRows(rowGroup)).ranges...)
+	}
+	return pickUnion(rowGroup.NumRows(), picked)
+}
+
+func (o or) FilterRows(rowGroup RowGroup, selection Selection) (Selection, error) {
+	var (
+		numRows   = rowGroup.NumRows()
+		picked    = NewRowBitmap(numRows)
+		remaining = selection.Bitmap(numRows)
+	)
+	for _, p := range plan(rowGroup, selection, o.predicates) {
+		if remaining.Cardinality() == 0 {
+			break
+		}
+		filtered, err := p.FilterRows(rowGroup, remaining)
+		if err != nil {
+			return nil, err
+		}
+		matches := filtered.Bitmap(numRows)
+		picked = picked.Or(matches)
+		remaining = remaining.AndNot(matches)
+	}
+	return picked, nil
+}
+
+func (o or) Estimate(rowGroup RowGroup, selection Selection) Estimate {
+	var (
+		nonMatching = 1.0
+		cost        int64
+	)
+	for _, p := range o.predicates {
+		e := p.Estimate(rowGroup, selection)
+		nonMatching *= 1 - e.Selectivity
+		cost += e.Cost
+	}
+	return Estimate{Selectivity: 1 - nonMatching, Cost: cost}
+}
+
+func (o or) Stats() []*PredicateStats {
+	return collectStats(o.predicates)
+}
+
+type not struct {
+	predicate Predicate
+}
+
+// Not selects rows which do not match the predicate.
+func Not(predicate Predicate) Predicate {
+	return &not{predicate: predicate}
+}
+
+// SelectRowGroup selects all row groups since statistics can only
+// prove that rows do not match a predicate, and not that they do.
+func (n not) SelectRowGroup(_ RowGroup) bool {
+	return true
+}
+
+// SelectRows selects all rows since column indexes can only
+// prove that rows do not match a predicate, and not that they do.
+func (n not) SelectRows(_ RowGroup) RowSelection {
+	return SelectAll()
+}
+
+func (n not) FilterRows(rowGroup RowGroup, selection Selection) (Selection, error) {
+	filtered, err := n.predicate.FilterRows(rowGroup, selection)
+	if err != nil {
+		return nil, err
+	}
+	numRows := rowGroup.NumRows()
+	return selection.Bitmap(numRows).AndNot(filtered.Bitmap(numRows)), nil
+}
+
+func (n not) Estimate(rowGroup RowGroup, selection Selection) Estimate {
+	e := n.predicate.Estimate(rowGroup, selection)
+	return Estimate{Selectivity: 1 - e.Selectivity, Cost: e.Cost}
+}
+
+func (n not) Stats() []*PredicateStats {
+	return n.predicate.Stats()
+}
+
+// pickUnion returns a selection which skips all rows outside the union of the picked ranges.
+func pickUnion(numRows int64, picked []PickRange) RowSelection {
+	slices.SortFunc(picked, func(a, b PickRange) bool {
+		return a.from < b.from
+	})
+	return selectPicked(numRows, picked)
+}
+
+func collectStats(predicates []Predicate) []*PredicateStats {
+	stats := make([]*PredicateStats, 0, len(predicates))
+	for _, p := range predicates {
+		stats = append(stats, p.Stats()...)
+	}
+	return stats
+}
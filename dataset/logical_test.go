@@ -0,0 +1,135 @@
+package dataset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/pqtest"
+)
+
+func TestLogicalPredicates(t *testing.T) {
+	file, err := pqtest.CreateFile([][]pqtest.Row{{
+		pqtest.TwoColumnRow("val1", "val1"),
+		pqtest.TwoColumnRow("val1", "val2"),
+		pqtest.TwoColumnRow("val1", "val3"),
+	}, {
+		pqtest.TwoColumnRow("val2", "val1"),
+		pqtest.TwoColumnRow("val2", "val2"),
+		pqtest.TwoColumnRow("val2", "val3"),
+	}})
+	require.NoError(t, err)
+
+	columnA, _ := file.Schema().Lookup("ColumnA")
+	columnB, _ := file.Schema().Lookup("ColumnB")
+	equals := func(column string, value string) Predicate {
+		if column == "ColumnA" {
+			return NewEqualsPredicate(nopSectionLoader{}, nil, columnA, value)
+		}
+		return NewEqualsPredicate(nopSectionLoader{}, nil, columnB, value)
+	}
+
+	cases := []struct {
+		name      string
+		predicate Predicate
+		expected  []PickRange
+	}{
+		{
+			name:      "and",
+			predicate: And(equals("ColumnA", "val2"), equals("ColumnB", "val2")),
+			expected:  []PickRange{Pick(4, 5)},
+		},
+		{
+			name:      "and without matches",
+			predicate: And(equals("ColumnA", "val3"), equals("ColumnB", "val2")),
+			expected:  []PickRange{},
+		},
+		{
+			name:      "or",
+			predicate: Or(equals("ColumnB", "val1"), equals("ColumnB", "val3")),
+			expected:  []PickRange{Pick(0, 1), Pick(2, 4), Pick(5, 6)},
+		},
+		{
+			name:      "or with overlapping matches",
+			predicate: Or(equals("ColumnA", "val1"), equals("ColumnB", "val1")),
+			expected:  []PickRange{Pick(0, 4)},
+		},
+		{
+			name:      "not",
+			predicate: Not(equals("ColumnB", "val2")),
+			expected:  []PickRange{Pick(0, 1), Pick(2, 4), Pick(5, 6)},
+		},
+		{
+			name:      "not a missing value",
+			predicate: Not(equals("ColumnB", "val4")),
+			expected:  []PickRange{Pick(0, 6)},
+		},
+		{
+			name: "and of or and not",
+			predicate: And(
+				Or(equals("ColumnB", "val1"), equals("ColumnB", "val2")),
+				Not(equals("ColumnA", "val1")),
+			),
+			expected: []PickRange{Pick(3, 5)},
+		},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			rowGroup := FileRowGroups(file)[0]
+			selection, err := tcase.predicate.FilterRows(rowGroup, tcase.predicate.SelectRows(rowGroup))
+			require.NoError(t, err)
+
+			result := SelectRows(rowGroup, selection)
+			require.Equal(t, tcase.expected, result.ranges)
+		})
+	}
+}
+
+func TestAndShortCircuits(t *testing.T) {
+	file, err := pqtest.CreateFile([][]pqtest.Row{{
+		pqtest.TwoColumnRow("val1", "val1"),
+		pqtest.TwoColumnRow("val1", "val2"),
+		pqtest.TwoColumnRow("val1", "val3"),
+	}, {
+		pqtest.TwoColumnRow("val2", "val1"),
+		pqtest.TwoColumnRow("val2", "val2"),
+		pqtest.TwoColumnRow("val2", "val3"),
+	}})
+	require.NoError(t, err)
+
+	columnA, _ := file.Schema().Lookup("ColumnA")
+	columnB, _ := file.Schema().Lookup("ColumnB")
+	selective := NewEqualsPredicate(nopSectionLoader{}, nil, columnA, "val3")
+	unselective := NewEqualsPredicate(nopSectionLoader{}, nil, columnB, "val2")
+
+	rowGroup := FileRowGroups(file)[0]
+	planned := plan(rowGroup, SelectAll(), []Predicate{unselective, selective})
+	require.Equal(t, []Predicate{selective, unselective}, planned)
+
+	predicate := And(unselective, selective)
+	selection, err := predicate.FilterRows(rowGroup, SelectAll())
+	require.NoError(t, err)
+	require.Zero(t, SelectRows(rowGroup, selection).NumRows())
+
+	// The predicate on ColumnB should not read any pages since
+	// the predicate on ColumnA already discarded all rows.
+	require.Zero(t, unselective.Stats()[0].PagesRead)
+}
+
+type nopSectionLoader struct{}
+
+func (n nopSectionLoader) NewSectionSize(_, _, _ int64) (db.Section, error) {
+	return emptySection{}, nil
+}
+
+func (n nopSectionLoader) NewSection(_, _ int64) (db.Section, error) {
+	return emptySection{}, nil
+}
+
+type emptySection struct{}
+
+func (n emptySection) LoadNext() error { return nil }
+func (n emptySection) LoadAll() error  { return nil }
+func (n emptySection) Close() error    { return nil }
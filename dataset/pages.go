@@ -11,12 +11,16 @@ type RowIndexedPages interface {
 	parquet.PageReader
 	CurrentRowIndex() int64
 	PageOffset(i int64) int64
+	// CompressedPageSize returns the size of the i-th selected page in the file, including its header.
+	CompressedPageSize(i int64) int64
 	NumPages() int64
+	CompressedSize() int64
 }
 
 type pageSelection struct {
-	pageOffset int64
-	rowRange   rowRange
+	pageOffset     int64
+	compressedSize int64
+	rowRange       rowRange
 }
 
 type selectedPages struct {
@@ -27,12 +31,49 @@ type selectedPages struct {
 	pages                 parquet.Pages
 }
 
-func SelectPages(chunk parquet.ColumnChunk, selection SelectionResult) RowIndexedPages {
-	ranges := selection.ranges
-	if len(ranges) == 0 {
+// SelectPages selects the pages of the chunk with selected rows, and slices them to the selected ranges.
+// The selection can be a SelectionResult, a RowSelection or a RowBitmap of the rows of the chunk.
+func SelectPages(chunk parquet.ColumnChunk, selection Selection) RowIndexedPages {
+	selected := selectPageRanges(chunk, selection.Ranges(chunk.NumValues()))
+	if len(selected) == 0 {
+		return &emptyPageSelection{}
+	}
+
+	return &selectedPages{
+		pages:    chunk.Pages(),
+		selected: selected,
+	}
+}
+
+// selectCoveringPages selects each page with selected rows once, from its first to its last selected row.
+// Rows between the selected rows of a page are read as well, which avoids seeking and decoding the page
+// again for each selected range when filtering scattered rows.
+func selectCoveringPages(chunk parquet.ColumnChunk, selection SelectionResult) RowIndexedPages {
+	selected := selectPageRanges(chunk, selection.ranges)
+	if len(selected) == 0 {
 		return &emptyPageSelection{}
 	}
 
+	covering := selected[:1]
+	for _, page := range selected[1:] {
+		last := &covering[len(covering)-1]
+		if page.pageOffset == last.pageOffset {
+			last.rowRange.to = page.rowRange.to
+			continue
+		}
+		covering = append(covering, page)
+	}
+	return &selectedPages{
+		pages:    chunk.Pages(),
+		selected: covering,
+	}
+}
+
+func selectPageRanges(chunk parquet.ColumnChunk, ranges []PickRange) []pageSelection {
+	if len(ranges) == 0 {
+		return nil
+	}
+
 	iRange := 0
 	iPages := 0
 	selected := make([]pageSelection, 0)
@@ -42,8 +83,9 @@ func SelectPages(chunk parquet.ColumnChunk, selection SelectionResult) RowIndexe
 		currentRange := ranges[iRange]
 		if currentRange.overlaps(currentPage.rowRange) {
 			selected = append(selected, pageSelection{
-				pageOffset: currentPage.pageOffset,
-				rowRange:   currentPage.rowRange.intersect(currentRange.rowRange),
+				pageOffset:     currentPage.pageOffset,
+				compressedSize: currentPage.compressedSize,
+				rowRange:       currentPage.rowRange.intersect(currentRange.rowRange),
 			})
 		}
 
@@ -53,14 +95,7 @@ func SelectPages(chunk parquet.ColumnChunk, selection SelectionResult) RowIndexe
 			iPages++
 		}
 	}
-	if len(selected) == 0 {
-		return &emptyPageSelection{}
-	}
-
-	return &selectedPages{
-		pages:    chunk.Pages(),
-		selected: selected,
-	}
+	return selected
 }
 
 func (p *selectedPages) ReadPage() (parquet.Page, error) {
@@ -97,10 +132,29 @@ func (p *selectedPages) PageOffset(i int64) int64 {
 	return p.selected[i].pageOffset
 }
 
+func (p *selectedPages) CompressedPageSize(i int64) int64 {
+	return p.selected[i].compressedSize
+}
+
 func (p *selectedPages) NumPages() int64 {
 	return int64(len(p.selected))
 }
 
+func (p *selectedPages) CompressedSize() int64 {
+	return compressedSize(p.selected)
+}
+
+func compressedSize(selected []pageSelection) int64 {
+	var size int64
+	for i, page := range selected {
+		if i > 0 && page.pageOffset == selected[i-1].pageOffset {
+			continue
+		}
+		size += page.compressedSize
+	}
+	return size
+}
+
 func (p *selectedPages) Close() error {
 	return p.pages.Close()
 }
@@ -114,15 +168,48 @@ func getCurrentPage(iPages int, offsetIndex parquet.OffsetIndex, numRows int64)
 		lastRowIndex = numRows
 	}
 	return pageSelection{
-		pageOffset: offsetIndex.Offset(iPages),
-		rowRange:   rowRange{from: firstRowIndex, to: lastRowIndex},
+		pageOffset:     offsetIndex.Offset(iPages),
+		compressedSize: offsetIndex.CompressedPageSize(iPages),
+		rowRange:       rowRange{from: firstRowIndex, to: lastRowIndex},
 	}
 }
 
 type emptyPageSelection struct{}
 
-func (e emptyPageSelection) ReadPage() (parquet.Page, error) { return nil, io.EOF }
-func (e emptyPageSelection) NumPages() int64                 { return 0 }
-func (e emptyPageSelection) CurrentRowIndex() int64          { return 0 }
-func (e emptyPageSelection) PageOffset(_ int64) int64        { return 0 }
-func (e emptyPageSelection) Close() error                    { return nil }
+func (e emptyPageSelection) ReadPage() (parquet.Page, error)  { return nil, io.EOF }
+func (e emptyPageSelection) NumPages() int64                  { return 0 }
+func (e emptyPageSelection) CurrentRowIndex() int64           { return 0 }
+func (e emptyPageSelection) PageOffset(_ int64) int64         { return 0 }
+func (e emptyPageSelection) CompressedPageSize(_ int64) int64 { return 0 }
+func (e emptyPageSelection) CompressedSize() int64            { return 0 }
+func (e emptyPageSelection) Close() error                     { return nil }
+
+// PageSpan is a byte range of the file with consecutive selected pages.
+type PageSpan struct {
+	// FirstPage and LastPage are the indexes of the first and last selected page in the span.
+	FirstPage int64
+	LastPage  int64
+	// From and To are the offsets of the first byte of the first page and of the byte after the last page.
+	From int64
+	To   int64
+}
+
+// CoalescePages groups selected pages into spans which can each be fetched with a single read.
+// Pages are added to the span of the previous page when they start less than maxGap bytes after it,
+// so that a few unselected bytes are read instead of issuing another request.
+func CoalescePages(pages RowIndexedPages, maxGap int64) []PageSpan {
+	var spans []PageSpan
+	for i := int64(0); i < pages.NumPages(); i++ {
+		from := pages.PageOffset(i)
+		to := from + pages.CompressedPageSize(i)
+		if n := len(spans); n > 0 && from-spans[n-1].To <= maxGap {
+			spans[n-1].LastPage = i
+			if to > spans[n-1].To {
+				spans[n-1].To = to
+			}
+			continue
+		}
+		spans = append(spans, PageSpan{FirstPage: i, LastPage: i, From: from, To: to})
+	}
+	return spans
+}
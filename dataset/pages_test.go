@@ -0,0 +1,89 @@
+package dataset
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"Shopify/thanos-parquet-engine/pqtest"
+)
+
+func TestCoalescePages(t *testing.T) {
+	file, err := pqtest.CreateFile([][]pqtest.Row{
+		{pqtest.TwoColumnRow("val1", "val1")},
+		{pqtest.TwoColumnRow("val1", "val2")},
+		{pqtest.TwoColumnRow("val1", "val3")},
+		{pqtest.TwoColumnRow("val1", "val4")},
+	})
+	require.NoError(t, err)
+	rowGroup := file.RowGroups()[0]
+	chunk := rowGroup.ColumnChunks()[1]
+	offsets := chunk.OffsetIndex()
+	require.Equal(t, 4, offsets.NumPages())
+	pageEnd := func(i int) int64 { return offsets.Offset(i) + offsets.CompressedPageSize(i) }
+
+	cases := []struct {
+		name     string
+		ranges   []PickRange
+		maxGap   int64
+		expected []PageSpan
+	}{
+		{
+			name:   "adjacent pages",
+			ranges: []PickRange{Pick(0, 2)},
+			expected: []PageSpan{
+				{FirstPage: 0, LastPage: 1, From: offsets.Offset(0), To: pageEnd(1)},
+			},
+		},
+		{
+			name:   "pages with a gap",
+			ranges: []PickRange{Pick(0, 1), Pick(3, 4)},
+			expected: []PageSpan{
+				{FirstPage: 0, LastPage: 0, From: offsets.Offset(0), To: pageEnd(0)},
+				{FirstPage: 1, LastPage: 1, From: offsets.Offset(3), To: pageEnd(3)},
+			},
+		},
+		{
+			name:   "pages with a gap smaller than the max gap",
+			ranges: []PickRange{Pick(0, 1), Pick(3, 4)},
+			maxGap: math.MaxInt64,
+			expected: []PageSpan{
+				{FirstPage: 0, LastPage: 1, From: offsets.Offset(0), To: pageEnd(3)},
+			},
+		},
+		{
+			name: "no pages",
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			pages := SelectPages(chunk, NewSelectionResult(rowGroup, tcase.ranges))
+			defer pages.Close()
+			require.Equal(t, tcase.expected, CoalescePages(pages, tcase.maxGap))
+		})
+	}
+}
+
+func TestSelectPagesOfBitmap(t *testing.T) {
+	file, err := pqtest.CreateFile([][]pqtest.Row{
+		{pqtest.TwoColumnRow("val1", "val1")},
+		{pqtest.TwoColumnRow("val1", "val2")},
+		{pqtest.TwoColumnRow("val1", "val3")},
+		{pqtest.TwoColumnRow("val1", "val4")},
+	})
+	require.NoError(t, err)
+	rowGroup := file.RowGroups()[0]
+	chunk := rowGroup.ColumnChunks()[1]
+
+	for _, selection := range []Selection{
+		NewRowBitmap(rowGroup.NumRows(), Pick(1, 2), Pick(3, 4)),
+		RowSelection{skip(0, 1), skip(2, 3)},
+	} {
+		pages := SelectPages(chunk, selection)
+		require.EqualValues(t, 2, pages.NumPages())
+		require.Equal(t, chunk.OffsetIndex().Offset(1), pages.PageOffset(0))
+		require.Equal(t, chunk.OffsetIndex().Offset(3), pages.PageOffset(1))
+		require.NoError(t, pages.Close())
+	}
+}
@@ -0,0 +1,98 @@
+package dataset
+
+import (
+	"math"
+	"sort"
+
+	"github.com/segmentio/parquet-go"
+	"github.com/segmentio/parquet-go/format"
+)
+
+const (
+	// dictionaryFilterCost is the relative cost of filtering one byte of dictionary encoded pages.
+	dictionaryFilterCost = 1
+	// decodingFilterCost is the relative cost of filtering one byte of pages which need to be fully decoded.
+	decodingFilterCost = 4
+)
+
+// Estimate is the expected selectivity and cost of evaluating a predicate on a row group.
+type Estimate struct {
+	// Selectivity is the estimated fraction of selected rows which match the predicate.
+	Selectivity float64
+	// Cost is the relative cost of reading and filtering the pages which the predicate needs to decode.
+	Cost int64
+}
+
+// rank orders estimates so that cheap predicates which discard many rows come first.
+func (e Estimate) rank() float64 {
+	if e.Selectivity >= 1 {
+		return math.Inf(1)
+	}
+	return float64(e.Cost) / (1 - e.Selectivity)
+}
+
+// plan orders predicates by their estimated selectivity and cost on the selected rows.
+// Predicates with equal rank keep their original order.
+func plan(rowGroup RowGroup, selection Selection, predicates []Predicate) []Predicate {
+	ranks := make(map[int]float64, len(predicates))
+	order := make([]int, len(predicates))
+	for i, p := range predicates {
+		order[i] = i
+		ranks[i] = p.Estimate(rowGroup, selection).rank()
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return ranks[order[i]] < ranks[order[j]]
+	})
+
+	planned := make([]Predicate, 0, len(predicates))
+	for _, i := range order {
+		planned = append(planned, predicates[i])
+	}
+	return planned
+}
+
+// Estimate reuses the rows selected by the indexes of the predicate in the last SelectRows call on the row group.
+// Predicates whose indexes were not evaluated on the row group, such as predicates nested in Not,
+// are estimated from the selection alone.
+func (p columnPredicate) Estimate(rowGroup RowGroup, selection Selection) Estimate {
+	selected := numSelected(rowGroup, selection)
+	if selected == 0 {
+		return Estimate{}
+	}
+
+	chunk := rowGroup.ColumnChunks()[p.column.ColumnIndex]
+	metadata := rowGroup.Metadata().Columns[p.column.ColumnIndex].MetaData
+	indexed := SelectRows(rowGroup, selection)
+	if p.indexed.rowGroup == rowGroup.Ordinal() {
+		indexed = SelectRows(rowGroup, selection, p.indexed.selection)
+	}
+	selectivity := float64(indexed.NumRows()) / float64(selected)
+	if p.matchesSingleValue {
+		selectivity = math.Min(selectivity, 1/estimateDistinctValues(metadata, p.value))
+	}
+
+	var size int64
+	if chunk.OffsetIndex() != nil {
+		size = compressedSize(selectPageRanges(chunk, indexed.ranges))
+	} else if numRows := indexed.NumRows(); numRows > 0 {
+		// Without an offset index pages cannot be counted, so the selected rows
+		// are assumed to be spread evenly across the column chunk.
+		size = maxInt64(1, metadata.TotalCompressedSize*numRows/rowGroup.NumRows())
+	}
+	return Estimate{
+		Selectivity: selectivity,
+		Cost:        size * p.filterCost,
+	}
+}
+
+// estimateDistinctValues approximates the number of values in a column chunk dictionary
+// from the size of the dictionary page, assuming values of similar size to the given one.
+func estimateDistinctValues(metadata format.ColumnMetaData, value parquet.Value) float64 {
+	if metadata.DictionaryPageOffset == 0 || metadata.DataPageOffset <= metadata.DictionaryPageOffset {
+		return 1
+	}
+	dictionarySize := metadata.DataPageOffset - metadata.DictionaryPageOffset
+	// Plain encoded byte arrays are prefixed by their 4 byte length.
+	valueSize := int64(len(value.ByteArray()) + 4)
+	return math.Max(1, float64(dictionarySize/valueSize))
+}
@@ -0,0 +1,79 @@
+package dataset
+
+import (
+	"testing"
+
+	"github.com/segmentio/parquet-go"
+	"github.com/stretchr/testify/require"
+
+	"Shopify/thanos-parquet-engine/pqtest"
+)
+
+func TestPlan(t *testing.T) {
+	file, err := pqtest.CreateFile([][]pqtest.Row{{
+		pqtest.TwoColumnRow("val1", "val1"),
+		pqtest.TwoColumnRow("val1", "val2"),
+		pqtest.TwoColumnRow("val1", "val3"),
+	}, {
+		pqtest.TwoColumnRow("val2", "val1"),
+		pqtest.TwoColumnRow("val2", "val2"),
+		pqtest.TwoColumnRow("val2", "val3"),
+	}})
+	require.NoError(t, err)
+
+	columnA, _ := file.Schema().Lookup("ColumnA")
+	columnB, _ := file.Schema().Lookup("ColumnB")
+	selective := NewEqualsPredicate(nopSectionLoader{}, nil, columnA, "val3")
+	unselective := NewEqualsPredicate(nopSectionLoader{}, nil, columnB, "val2")
+
+	rowGroup := FileRowGroups(file)[0]
+	// Before the indexes of the predicates are evaluated, both are estimated from their dictionaries.
+	require.Positive(t, selective.Estimate(rowGroup, SelectAll()).Selectivity)
+
+	// Page statistics of ColumnA exclude val3, so all rows are discarded without decoding pages.
+	// The estimate reuses the rows selected by the indexes instead of evaluating them again.
+	And(selective, unselective).SelectRows(rowGroup)
+	skippedPages := selective.Stats()[0].PagesSkippedByStats
+	require.Positive(t, skippedPages)
+	require.Zero(t, selective.Estimate(rowGroup, SelectAll()).Selectivity)
+	require.Positive(t, unselective.Estimate(rowGroup, SelectAll()).Selectivity)
+	require.Equal(t, skippedPages, selective.Stats()[0].PagesSkippedByStats)
+
+	planned := plan(rowGroup, SelectAll(), []Predicate{unselective, selective})
+	require.Equal(t, []Predicate{selective, unselective}, planned)
+}
+
+// noOffsetIndexRowGroup hides the offset indexes of its column chunks.
+type noOffsetIndexRowGroup struct {
+	RowGroup
+}
+
+type noOffsetIndexChunk struct {
+	parquet.ColumnChunk
+}
+
+func (r noOffsetIndexRowGroup) ColumnChunks() []parquet.ColumnChunk {
+	chunks := make([]parquet.ColumnChunk, 0, len(r.RowGroup.ColumnChunks()))
+	for _, chunk := range r.RowGroup.ColumnChunks() {
+		chunks = append(chunks, noOffsetIndexChunk{ColumnChunk: chunk})
+	}
+	return chunks
+}
+
+func (c noOffsetIndexChunk) OffsetIndex() parquet.OffsetIndex {
+	return nil
+}
+
+func TestEstimateWithoutOffsetIndex(t *testing.T) {
+	file, err := pqtest.CreateFile([][]pqtest.Row{{
+		pqtest.TwoColumnRow("val1", "val1"),
+		pqtest.TwoColumnRow("val1", "val2"),
+	}})
+	require.NoError(t, err)
+	columnB, _ := file.Schema().Lookup("ColumnB")
+	rowGroup := noOffsetIndexRowGroup{RowGroup: FileRowGroups(file)[0]}
+
+	// Pages cannot be counted without an offset index, but filtering the rows still has a cost.
+	predicate := NewEqualsPredicate(nopSectionLoader{}, nil, columnB, "val2")
+	require.Positive(t, predicate.Estimate(rowGroup, SelectAll()).Cost)
+}
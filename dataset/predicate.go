@@ -1,113 +1,274 @@
 package dataset
 
 import (
+	"math"
+
 	"github.com/segmentio/parquet-go"
 
 	"Shopify/thanos-parquet-engine/db"
 )
 
 type Predicate interface {
-	SelectRows(rowGroup parquet.RowGroup) RowSelection
-	FilterRows(rowGroup parquet.RowGroup, selection RowSelection) (RowSelection, error)
+	// SelectRowGroup uses column chunk statistics from the file footer
+	// to check whether any row in the row group can match the predicate.
+	SelectRowGroup(rowGroup RowGroup) bool
+	// SelectRows uses column indexes, such as bloom filters and page statistics,
+	// to discard rows which cannot match the predicate.
+	SelectRows(rowGroup RowGroup) RowSelection
+	// FilterRows decodes pages to discard rows from the selection which do not match the predicate.
+	// The selection can be a RowSelection or a RowBitmap, and the returned selection only selects
+	// rows from the input selection.
+	FilterRows(rowGroup RowGroup, selection Selection) (Selection, error)
+	// Estimate returns the expected selectivity and cost of filtering rows from the selection.
+	Estimate(rowGroup RowGroup, selection Selection) Estimate
+	Stats() []*PredicateStats
 }
 
-type Predicates []columnPredicate
+type columnPredicate struct {
+	column parquet.LeafColumn
+	value  parquet.Value
 
-func (ps Predicates) Len() int { return len(ps) }
+	rowGroups  *rowGroupSelector
+	selectors  RowSelectors
+	dictionary *dictionarySelector
+	filter     RowFilter
+	stats      *PredicateStats
+	// indexed is the result of the last SelectRows call, which is reused to estimate the predicate.
+	indexed *indexedRows
 
-func (ps Predicates) Swap(i, j int) { ps[i], ps[j] = ps[j], ps[i] }
+	filterCost         int64
+	matchesSingleValue bool
+}
 
-func (ps Predicates) Less(i, j int) bool {
-	return db.CompareColumns(ps[i].column.Path[0], ps[j].column.Path[0])
+// indexedRows is the selection of a row group by the indexes of a predicate.
+type indexedRows struct {
+	rowGroup  int
+	selection RowSelection
 }
 
-func (ps Predicates) SelectRows(rowGroup parquet.RowGroup) RowSelection {
-	var selection RowSelection
-	for _, p := range ps {
-		selection = append(selection, p.SelectRows(rowGroup)...)
-	}
-	return selection
+func newIndexedRows() *indexedRows {
+	return &indexedRows{rowGroup: -1}
 }
 
-func (ps Predicates) FilterRows(rowGroup parquet.RowGroup, rowSelection RowSelection) (RowSelection, error) {
-	for _, p := range ps {
-		filteredRows, err := p.FilterRows(rowGroup, rowSelection)
-		if err != nil {
-			return nil, err
-		}
-		rowSelection = append(rowSelection, filteredRows...)
+func (p columnPredicate) SelectRowGroup(rowGroup RowGroup) bool {
+	if p.rowGroups == nil || p.rowGroups.SelectRowGroup(rowGroup, p.column) {
+		return true
 	}
-
-	return rowSelection, nil
+	p.stats.RowGroupsSkippedByStats++
+	return false
 }
 
-type columnPredicate struct {
-	column parquet.LeafColumn
-	value  parquet.Value
-
-	selectors RowSelectors
-	filter    RowFilter
+func (p columnPredicate) SelectRows(rowGroup RowGroup) RowSelection {
+	chunk := rowGroup.ColumnChunks()[p.column.ColumnIndex]
+	selection := p.selectors.SelectRows(chunk, p.stats)
+	if p.dictionary != nil && SelectRows(rowGroup, selection).NumRows() > 0 {
+		selection = append(selection, p.dictionary.SelectRowGroup(rowGroup, p.column.ColumnIndex, p.stats)...)
+	}
+	p.indexed.rowGroup = rowGroup.Ordinal()
+	p.indexed.selection = selection
+	return selection
 }
 
-func (p columnPredicate) SelectRows(rowGroup parquet.RowGroup) RowSelection {
+func (p columnPredicate) FilterRows(rowGroup RowGroup, selection Selection) (Selection, error) {
 	chunk := rowGroup.ColumnChunks()[p.column.ColumnIndex]
-	return p.selectors.SelectRows(chunk)
+	filtered, err := p.filter.FilterRows(chunk, SelectRows(rowGroup, selection))
+	if err != nil {
+		return nil, err
+	}
+	return filtered, nil
 }
 
-func (p columnPredicate) FilterRows(rowGroup parquet.RowGroup, selection RowSelection) (RowSelection, error) {
-	chunk := rowGroup.ColumnChunks()[p.column.ColumnIndex]
-	return p.filter.FilterRows(chunk, SelectRows(rowGroup, selection))
+func (p columnPredicate) Stats() []*PredicateStats {
+	return []*PredicateStats{p.stats}
 }
 
-func NewEqualsPredicate(reader db.SectionLoader, column parquet.LeafColumn, value string) columnPredicate {
+// NewEqualsPredicate selects rows where the column is equal to the given value.
+// If dictionaries is not nil, column chunks whose dictionary does not contain
+// the value are discarded before any of their data pages are read.
+func NewEqualsPredicate(reader db.SectionLoader, dictionaries *Dictionaries, column parquet.LeafColumn, value string) Predicate {
 	pqValue := parquet.ByteArrayValue([]byte(value))
 	compare := column.Node.Type().Compare
+	stats := NewPredicateStats(column.Path[0])
+	matches := func(value parquet.Value) bool {
+		return compare(value, pqValue) == 0
+	}
+	inRange := func(min, max parquet.Value) bool {
+		return compare(min, pqValue) <= 0 && compare(max, pqValue) >= 0
+	}
+
+	var dictionary *dictionarySelector
+	if dictionaries != nil {
+		dictionary = newDictionarySelector(dictionaries, matches)
+	}
 
 	return columnPredicate{
-		column: column,
-		value:  pqValue,
+		column:    column,
+		value:     pqValue,
+		rowGroups: newRowGroupSelector(inRange),
 		selectors: []RowSelector{
 			newBloomSelector(pqValue),
-			newStatsSelector(func(min, max parquet.Value) bool {
-				return compare(min, pqValue) <= 0 && compare(max, pqValue) >= 0
-			}),
+			newStatsSelector(inRange),
 		},
-		filter: NewDictionaryFilter(reader, func(value parquet.Value) bool {
-			return compare(value, pqValue) == 0
-		}),
+		dictionary: dictionary,
+		filter:     NewDictionaryFilter(reader, matches, stats),
+		stats:      stats,
+		indexed:    newIndexedRows(),
+
+		filterCost:         dictionaryFilterCost,
+		matchesSingleValue: true,
 	}
 }
 
-func NewGTEPredicate(reader db.SectionLoader, column parquet.LeafColumn, threshold parquet.Value) columnPredicate {
+// NewValueEqualsPredicate selects rows which are equal to the value in columns which are not
+// dictionary encoded, such as hashes. Row groups are discarded using bloom filters and statistics,
+// and the remaining pages are decoded.
+func NewValueEqualsPredicate(reader db.SectionLoader, column parquet.LeafColumn, value parquet.Value) Predicate {
 	compare := column.Node.Type().Compare
+	stats := NewPredicateStats(column.Path[0])
+	inRange := func(min, max parquet.Value) bool {
+		return compare(min, value) <= 0 && compare(max, value) >= 0
+	}
 	return columnPredicate{
 		column: column,
-		value:  threshold,
+		value:  value,
 
+		rowGroups: newRowGroupSelector(inRange),
 		selectors: []RowSelector{
-			newStatsSelector(func(_, max parquet.Value) bool {
-				return compare(max, threshold) >= 0
-			}),
+			newBloomSelector(value),
+			newStatsSelector(inRange),
 		},
 		filter: NewDecodingFilter(reader, func(rowValue parquet.Value) bool {
+			return compare(rowValue, value) == 0
+		}, stats),
+		stats:   stats,
+		indexed: newIndexedRows(),
+
+		filterCost: decodingFilterCost,
+	}
+}
+
+func NewGTEPredicate(reader db.SectionLoader, column parquet.LeafColumn, threshold parquet.Value) Predicate {
+	compare := column.Node.Type().Compare
+	stats := NewPredicateStats(column.Path[0])
+	inRange := func(_, max parquet.Value) bool {
+		return compare(max, threshold) >= 0
+	}
+	return columnPredicate{
+		column: column,
+		value:  threshold,
+
+		rowGroups: newRowGroupSelector(inRange),
+		selectors: []RowSelector{
+			newStatsSelector(inRange),
+		},
+		filter: newRangeFilter(reader, column, stats, threshold, parquet.Value{}, func(rowValue parquet.Value) bool {
 			return compare(rowValue, threshold) >= 0
 		}),
+		stats:   stats,
+		indexed: newIndexedRows(),
+
+		filterCost: decodingFilterCost,
 	}
 }
 
-func NewLTEPredicate(reader db.SectionLoader, column parquet.LeafColumn, value parquet.Value) columnPredicate {
+func NewLTEPredicate(reader db.SectionLoader, column parquet.LeafColumn, value parquet.Value) Predicate {
 	compare := column.Node.Type().Compare
+	stats := NewPredicateStats(column.Path[0])
+	inRange := func(min, _ parquet.Value) bool {
+		return compare(min, value) <= 0
+	}
 	return columnPredicate{
 		column: column,
 		value:  value,
 
+		rowGroups: newRowGroupSelector(inRange),
 		selectors: []RowSelector{
-			newStatsSelector(func(min, _ parquet.Value) bool {
-				return compare(min, value) <= 0
-			}),
+			newStatsSelector(inRange),
 		},
-		filter: NewDecodingFilter(reader, func(rowValue parquet.Value) bool {
+		filter: newRangeFilter(reader, column, stats, parquet.Value{}, value, func(rowValue parquet.Value) bool {
 			return compare(rowValue, value) <= 0
 		}),
+		stats:   stats,
+		indexed: newIndexedRows(),
+
+		filterCost: decodingFilterCost,
+	}
+}
+
+// NewMatchPredicate selects rows for which the matches function returns true.
+// Arbitrary functions cannot be evaluated against statistics, so only row groups and pages
+// which cannot contain values starting with the given prefix are discarded without decoding.
+// The function is evaluated once for each dictionary value of dictionary encoded column chunks.
+func NewMatchPredicate(reader db.SectionLoader, column parquet.LeafColumn, prefix string, matches func(string) bool) Predicate {
+	stats := NewPredicateStats(column.Path[0])
+	inRange := prefixRange(column.Node.Type().Compare, prefix)
+	return columnPredicate{
+		column: column,
+
+		rowGroups: newRowGroupSelector(inRange),
+		selectors: []RowSelector{
+			newStatsSelector(inRange),
+		},
+		filter: NewDictionaryFilter(reader, func(rowValue parquet.Value) bool {
+			return matches(rowValue.String())
+		}, stats),
+		stats:   stats,
+		indexed: newIndexedRows(),
+
+		filterCost: decodingFilterCost,
 	}
 }
+
+// NewNotEqualsPredicate selects rows where the column is not equal to the given value.
+// Only row groups and pages which contain nothing but the value are discarded using statistics,
+// and rows of dictionary encoded pages are filtered by a bitmap of the dictionary values which are not equal.
+func NewNotEqualsPredicate(reader db.SectionLoader, column parquet.LeafColumn, value string) Predicate {
+	pqValue := parquet.ByteArrayValue([]byte(value))
+	compare := column.Node.Type().Compare
+	stats := NewPredicateStats(column.Path[0])
+	inRange := func(min, max parquet.Value) bool {
+		return compare(min, pqValue) != 0 || compare(max, pqValue) != 0
+	}
+	return columnPredicate{
+		column: column,
+
+		rowGroups: newRowGroupSelector(inRange),
+		selectors: []RowSelector{
+			newStatsSelector(inRange),
+		},
+		filter: NewDictionaryFilter(reader, func(rowValue parquet.Value) bool {
+			return compare(rowValue, pqValue) != 0
+		}, stats),
+		stats:   stats,
+		indexed: newIndexedRows(),
+
+		filterCost: dictionaryFilterCost,
+	}
+}
+
+// newRangeFilter returns a filter of rows between min and max, where a null bound is unbounded.
+// INT64 columns are compared without boxing values, and other columns are decoded and compared with matches.
+func newRangeFilter(reader db.SectionLoader, column parquet.LeafColumn, stats *PredicateStats, min, max parquet.Value, matches matchFunc) RowFilter {
+	if column.Node.Type().Kind() != parquet.Int64 {
+		return NewDecodingFilter(reader, matches, stats)
+	}
+	minInt64, maxInt64 := int64(math.MinInt64), int64(math.MaxInt64)
+	if !min.IsNull() {
+		minInt64 = min.Int64()
+	}
+	if !max.IsNull() {
+		maxInt64 = max.Int64()
+	}
+	return NewInt64RangeFilter(reader, minInt64, maxInt64, stats)
+}
+
+// NewTimeRangePredicate selects rows for chunks which overlap the time range [mint, maxt],
+// which are all chunks for which maxT >= mint and minT <= maxt.
+// Pages are discarded using the statistics of both columns, so a range of rows is skipped
+// when it only contains chunks which end before mint, or only contains chunks which start after maxt.
+func NewTimeRangePredicate(reader db.SectionLoader, minT, maxT parquet.LeafColumn, mint, maxt int64) Predicate {
+	return And(
+		NewGTEPredicate(reader, maxT, parquet.Int64Value(mint)),
+		NewLTEPredicate(reader, minT, parquet.Int64Value(maxt)),
+	)
+}
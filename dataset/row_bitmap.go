@@ -0,0 +1,282 @@
+package dataset
+
+import (
+	"math/bits"
+)
+
+const (
+	// containerRows is the number of rows in each container of a RowBitmap.
+	containerRows = 1 << 16
+	// containerWords is the number of words of a container which stores its rows as a bitmap.
+	containerWords = containerRows / 64
+)
+
+// Selection is a selection of rows of a row group. A RowSelection lists ranges of skipped rows,
+// which is compact for rows selected with statistics and indexes. A RowBitmap has a bit for each
+// row, which stays compact and fast to combine for the scattered rows matched by filters.
+// A SelectionResult is a selection of the picked ranges of rows.
+type Selection interface {
+	// Ranges returns the sorted and non-overlapping ranges of selected rows out of numRows rows.
+	Ranges(numRows int64) []PickRange
+	// Bitmap returns the selected rows out of numRows rows as a bitmap.
+	Bitmap(numRows int64) RowBitmap
+}
+
+// RowBitmap is a set of selected rows of a row group. Rows are split into containers of 65536 rows,
+// and each container holds its rows either as runs of selected rows, or as a bitmap when it has too
+// many runs. Bitmaps are immutable, and combining them returns a new bitmap.
+type RowBitmap struct {
+	numRows    int64
+	containers []container
+}
+
+// container holds the selected rows of a range of containerRows rows, relative to the first row of the range.
+// Empty containers have neither runs nor words.
+type container struct {
+	runs        []run
+	words       bitmap
+	cardinality int
+}
+
+// run is a range of selected rows [from, to) of a container.
+type run struct {
+	from, to int32
+}
+
+// NewRowBitmap returns a bitmap of numRows rows which selects the given ranges.
+// Ranges must be sorted by their first row, and can overlap.
+func NewRowBitmap(numRows int64, ranges ...PickRange) RowBitmap {
+	builder := newRowBitmapBuilder(numRows)
+	for _, r := range ranges {
+		builder.add(r.from, r.to)
+	}
+	return builder.build()
+}
+
+// Cardinality returns the number of selected rows.
+func (b RowBitmap) Cardinality() int64 {
+	var cardinality int64
+	for _, c := range b.containers {
+		cardinality += int64(c.cardinality)
+	}
+	return cardinality
+}
+
+// Ranges returns the ranges of selected rows. The bitmap has its own number of rows, so numRows is ignored.
+func (b RowBitmap) Ranges(_ int64) []PickRange {
+	ranges := make([]PickRange, 0)
+	add := func(from, to int64) {
+		// Runs which end at the end of a container continue in the next one.
+		if last := len(ranges) - 1; last >= 0 && ranges[last].to == from {
+			ranges[last].to = to
+			return
+		}
+		ranges = append(ranges, Pick(from, to))
+	}
+	for i, c := range b.containers {
+		firstRow := int64(i) * containerRows
+		if c.words == nil {
+			for _, r := range c.runs {
+				add(firstRow+int64(r.from), firstRow+int64(r.to))
+			}
+			continue
+		}
+		for from := c.words.nextSet(0, containerRows); from < containerRows; {
+			to := c.words.nextUnset(from, containerRows)
+			add(firstRow+int64(from), firstRow+int64(to))
+			from = c.words.nextSet(to, containerRows)
+		}
+	}
+	return ranges
+}
+
+// Bitmap returns the bitmap itself, which has its own number of rows, so numRows is ignored.
+func (b RowBitmap) Bitmap(_ int64) RowBitmap {
+	return b
+}
+
+// And returns a bitmap of the rows selected by both bitmaps.
+func (b RowBitmap) And(other RowBitmap) RowBitmap {
+	return b.combine(other, func(x, y container, size int) (container, bool) {
+		switch {
+		case x.cardinality == 0 || y.cardinality == 0:
+			return container{}, true
+		case x.cardinality == size:
+			return y, true
+		case y.cardinality == size:
+			return x, true
+		}
+		return container{}, false
+	}, func(x, y uint64) uint64 { return x & y })
+}
+
+// Or returns a bitmap of the rows selected by either bitmap.
+func (b RowBitmap) Or(other RowBitmap) RowBitmap {
+	return b.combine(other, func(x, y container, size int) (container, bool) {
+		switch {
+		case x.cardinality == 0 || y.cardinality == size:
+			return y, true
+		case y.cardinality == 0 || x.cardinality == size:
+			return x, true
+		}
+		return container{}, false
+	}, func(x, y uint64) uint64 { return x | y })
+}
+
+// AndNot returns a bitmap of the rows selected by b which are not selected by other.
+func (b RowBitmap) AndNot(other RowBitmap) RowBitmap {
+	return b.combine(other, func(x, y container, size int) (container, bool) {
+		switch {
+		case x.cardinality == 0 || y.cardinality == size:
+			return container{}, true
+		case y.cardinality == 0:
+			return x, true
+		}
+		return container{}, false
+	}, func(x, y uint64) uint64 { return x &^ y })
+}
+
+// combine combines the containers of both bitmaps. Containers which are empty or full are combined by
+// the shortcut function, and others are combined a word at a time. The result has the rows of b.
+func (b RowBitmap) combine(other RowBitmap, shortcut func(x, y container, size int) (container, bool), op func(x, y uint64) uint64) RowBitmap {
+	result := RowBitmap{
+		numRows:    b.numRows,
+		containers: make([]container, len(b.containers)),
+	}
+	var x, y, words bitmap
+	for i, c := range b.containers {
+		var o container
+		if i < len(other.containers) {
+			o = other.containers[i]
+		}
+		if combined, ok := shortcut(c, o, b.containerSize(i)); ok {
+			result.containers[i] = combined
+			continue
+		}
+		x, y = c.toWords(x), o.toWords(y)
+		words = words.resize(containerRows)
+		for w := range words {
+			words[w] = op(x[w], y[w])
+		}
+		result.containers[i] = newContainer(words)
+	}
+	return result
+}
+
+// containerSize returns the number of rows of the i-th container, which is smaller than containerRows for the last one.
+func (b RowBitmap) containerSize(i int) int {
+	return int(minInt64(containerRows, b.numRows-int64(i)*containerRows))
+}
+
+// newContainer returns a container of the set bits of words, which are copied if the container is stored as a bitmap.
+// Containers are stored as runs when their runs take less space than a bitmap.
+func newContainer(words bitmap) container {
+	var (
+		cardinality, numRuns int
+		carry                uint64
+	)
+	for _, word := range words {
+		cardinality += bits.OnesCount64(word)
+		// A run starts at each set bit whose previous bit is unset.
+		numRuns += bits.OnesCount64(word &^ (word<<1 | carry))
+		carry = word >> 63
+	}
+	if cardinality == 0 {
+		return container{}
+	}
+	// Each run takes as much space as 1 word.
+	if numRuns >= containerWords {
+		return container{words: append(bitmap(nil), words...), cardinality: cardinality}
+	}
+
+	runs := make([]run, 0, numRuns)
+	for from := words.nextSet(0, containerRows); from < containerRows; {
+		to := words.nextUnset(from, containerRows)
+		runs = append(runs, run{from: int32(from), to: int32(to)})
+		from = words.nextSet(to, containerRows)
+	}
+	return container{runs: runs, cardinality: cardinality}
+}
+
+// toWords returns the rows of the container as a bitmap, which is written to scratch if the container is stored as runs.
+func (c container) toWords(scratch bitmap) bitmap {
+	if c.words != nil {
+		return c.words
+	}
+	scratch = scratch.resize(containerRows)
+	for _, r := range c.runs {
+		scratch.setRange(int(r.from), int(r.to))
+	}
+	return scratch
+}
+
+// rowBitmapBuilder builds a RowBitmap from ranges of rows which are added in order of their first row.
+// Rows of the container which is being built are set in a bitmap, which is stored as a container
+// once a range after the container is added.
+type rowBitmapBuilder struct {
+	result  RowBitmap
+	current int
+	words   bitmap
+	dirty   bool
+	// next is the row after the last added row, since rows before it are already set.
+	next int64
+}
+
+func newRowBitmapBuilder(numRows int64) *rowBitmapBuilder {
+	return &rowBitmapBuilder{
+		result: RowBitmap{
+			numRows:    numRows,
+			containers: make([]container, (numRows+containerRows-1)/containerRows),
+		},
+		words: bitmap(nil).resize(containerRows),
+	}
+}
+
+// add selects the rows in [from, to).
+func (b *rowBitmapBuilder) add(from, to int64) {
+	from, to = maxInt64(from, b.next), minInt64(to, b.result.numRows)
+	for from < to {
+		i := int(from / containerRows)
+		if i != b.current {
+			b.flush()
+			b.current = i
+		}
+		firstRow := int64(i) * containerRows
+		end := minInt64(to, firstRow+containerRows)
+		b.words.setRange(int(from-firstRow), int(end-firstRow))
+		b.dirty = true
+		from = end
+	}
+	b.next = maxInt64(b.next, to)
+}
+
+// addBits selects the rows whose bit is set among the first n bits, where bit i is the row at fromRow+i.
+func (b *rowBitmapBuilder) addBits(fromRow int64, rows bitmap, n int) {
+	for from := rows.nextSet(0, n); from < n; {
+		to := rows.nextUnset(from, n)
+		b.add(fromRow+int64(from), fromRow+int64(to))
+		from = rows.nextSet(to, n)
+	}
+}
+
+func (b *rowBitmapBuilder) flush() {
+	if !b.dirty {
+		return
+	}
+	b.result.containers[b.current] = newContainer(b.words)
+	b.words = b.words.resize(containerRows)
+	b.dirty = false
+}
+
+func (b *rowBitmapBuilder) build() RowBitmap {
+	b.flush()
+	return b.result
+}
+
+// numSelected returns the number of selected rows of the row group.
+func numSelected(rowGroup RowGroup, selection Selection) int64 {
+	if b, ok := selection.(RowBitmap); ok {
+		return b.Cardinality()
+	}
+	return SelectRows(rowGroup, selection).NumRows()
+}
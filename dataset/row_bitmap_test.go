@@ -0,0 +1,100 @@
+package dataset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRowBitmap(t *testing.T) {
+	const numRows = 3*containerRows + 100
+
+	// Every other row of the second container is stored as a bitmap instead of runs.
+	scattered := make([]PickRange, 0, containerRows/2)
+	for row := int64(containerRows); row < 2*containerRows; row += 2 {
+		scattered = append(scattered, Pick(row, row+1))
+	}
+	scatteredBitmap := NewRowBitmap(numRows, scattered...)
+	require.NotNil(t, scatteredBitmap.containers[1].words)
+
+	cases := []struct {
+		name     string
+		bitmap   RowBitmap
+		expected []PickRange
+	}{
+		{
+			name:     "empty",
+			bitmap:   NewRowBitmap(numRows),
+			expected: []PickRange{},
+		},
+		{
+			name:     "ranges across containers",
+			bitmap:   NewRowBitmap(numRows, Pick(10, 20), Pick(containerRows-5, 2*containerRows+5), Pick(numRows-1, numRows)),
+			expected: []PickRange{Pick(10, 20), Pick(containerRows-5, 2*containerRows+5), Pick(numRows-1, numRows)},
+		},
+		{
+			name:     "overlapping ranges",
+			bitmap:   NewRowBitmap(numRows, Pick(0, 100), Pick(10, 20), Pick(50, 150)),
+			expected: []PickRange{Pick(0, 150)},
+		},
+		{
+			name:     "and",
+			bitmap:   NewRowBitmap(numRows, Pick(0, 100)).And(NewRowBitmap(numRows, Pick(50, 150))),
+			expected: []PickRange{Pick(50, 100)},
+		},
+		{
+			name:     "and with full container",
+			bitmap:   NewRowBitmap(numRows, Pick(0, numRows)).And(NewRowBitmap(numRows, Pick(5, 10))),
+			expected: []PickRange{Pick(5, 10)},
+		},
+		{
+			name:     "and with bitmap container",
+			bitmap:   scatteredBitmap.And(NewRowBitmap(numRows, Pick(containerRows+10, containerRows+15))),
+			expected: []PickRange{Pick(containerRows+10, containerRows+11), Pick(containerRows+12, containerRows+13), Pick(containerRows+14, containerRows+15)},
+		},
+		{
+			name:     "or",
+			bitmap:   NewRowBitmap(numRows, Pick(0, 10), Pick(containerRows, containerRows+10)).Or(NewRowBitmap(numRows, Pick(5, 20))),
+			expected: []PickRange{Pick(0, 20), Pick(containerRows, containerRows+10)},
+		},
+		{
+			name:     "or with bitmap container",
+			bitmap:   scatteredBitmap.Or(NewRowBitmap(numRows, Pick(containerRows+1, 2*containerRows))),
+			expected: []PickRange{Pick(containerRows, 2*containerRows)},
+		},
+		{
+			name:     "and not",
+			bitmap:   NewRowBitmap(numRows, Pick(0, numRows)).AndNot(NewRowBitmap(numRows, Pick(10, containerRows+10))),
+			expected: []PickRange{Pick(0, 10), Pick(containerRows+10, numRows)},
+		},
+		{
+			name:     "and not with bitmap container",
+			bitmap:   NewRowBitmap(numRows, Pick(containerRows, containerRows+6)).AndNot(scatteredBitmap),
+			expected: []PickRange{Pick(containerRows+1, containerRows+2), Pick(containerRows+3, containerRows+4), Pick(containerRows+5, containerRows+6)},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.expected, tc.bitmap.Ranges(numRows))
+
+			var cardinality int64
+			for _, r := range tc.expected {
+				cardinality += r.length()
+			}
+			require.Equal(t, cardinality, tc.bitmap.Cardinality())
+		})
+	}
+}
+
+func TestRowBitmapBuilderAddBits(t *testing.T) {
+	rows := bitmapOf(200, 0, 63, 64, 65, 199)
+	builder := newRowBitmapBuilder(containerRows + 100)
+	builder.addBits(containerRows-100, rows, 200)
+
+	expected := []PickRange{
+		Pick(containerRows-100, containerRows-99),
+		Pick(containerRows-37, containerRows-34),
+		Pick(containerRows+99, containerRows+100),
+	}
+	require.Equal(t, expected, builder.build().Ranges(0))
+}
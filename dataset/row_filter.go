@@ -2,150 +2,246 @@ package dataset
 
 import (
 	"io"
-	"sync"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/segmentio/parquet-go"
 
 	"Shopify/thanos-parquet-engine/db"
 )
 
 type RowFilter interface {
-	FilterRows(parquet.ColumnChunk, SelectionResult) (RowSelection, error)
+	// FilterRows returns a bitmap of the selected rows which match.
+	FilterRows(parquet.ColumnChunk, SelectionResult) (RowBitmap, error)
 }
 
 type matchFunc func(parquet.Value) bool
 
-type decodingFilter struct {
-	reader  db.SectionLoader
-	matches func(parquet.Value) bool
-}
+// errNoMatchingValues is returned by page filters when no row of the column chunk can match,
+// such as when none of the values in its dictionary match and all of its pages are dictionary encoded.
+var errNoMatchingValues = errors.New("no matching values in column chunk")
 
-func NewDecodingFilter(reader db.SectionLoader, matches matchFunc) RowFilter {
-	return &decodingFilter{
-		reader:  reader,
-		matches: matches,
-	}
-}
+// pageFilter sets the bits of the rows of a page which match a predicate.
+// Bits of rows which do not match are already unset.
+type pageFilter func(page parquet.Page, rows bitmap) error
 
-func (r decodingFilter) FilterRows(chunk parquet.ColumnChunk, ranges SelectionResult) (RowSelection, error) {
-	pages := SelectPages(chunk, ranges)
+// filterPages reads the pages of the chunk with selected rows, and returns a bitmap of the selected
+// rows which the page filter matches, and the number of matching rows.
+// Each page is read once, and rows between selected ranges of a page are discarded after filtering.
+func filterPages(reader db.SectionLoader, chunk parquet.ColumnChunk, ranges SelectionResult, stats *PredicateStats, filter pageFilter) (RowBitmap, int64, error) {
+	pages := selectCoveringPages(chunk, ranges)
 	defer pages.Close()
 
 	offsetFrom, offsetTo := pages.PageOffset(0), pages.PageOffset(pages.NumPages()-1)
-	section, err := r.reader.NewSection(offsetFrom, offsetTo)
+	section, err := reader.NewSection(offsetFrom, offsetTo)
 	if err != nil {
-		return nil, err
+		return RowBitmap{}, 0, err
 	}
 	section = db.AsyncSection(section, 3)
 	defer section.Close()
-
-	var numMatches int64
-	var selection RowSelection
-	values := make([]parquet.Value, 4*1024)
+	stats.RecordPages(pages)
+
+	var (
+		numMatches int64
+		matches    = newRowBitmapBuilder(ranges.rowGroup.NumRows())
+		rows       bitmap
+		remaining  = ranges.ranges
+	)
 	for {
 		if loadErr := section.LoadNext(); loadErr != nil && loadErr != io.EOF {
-			return nil, loadErr
+			return RowBitmap{}, 0, loadErr
 		}
+		decodeStart := time.Now()
 		page, err := pages.ReadPage()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, err
+			return RowBitmap{}, 0, err
 		}
-		n, err := page.Values().ReadValues(values)
-		if err != nil && err != io.EOF {
-			return nil, err
+
+		numRows, fromRow := int(page.NumRows()), pages.CurrentRowIndex()
+		rows = rows.resize(numRows)
+		err = filter(page, rows)
+		parquet.Release(page)
+		stats.RecordPage(time.Since(decodeStart))
+		if err == errNoMatchingValues {
+			return NewRowBitmap(ranges.rowGroup.NumRows()), 0, nil
 		}
+		if err != nil {
+			return RowBitmap{}, 0, err
+		}
+		remaining = rows.clearUnselected(fromRow, numRows, remaining)
+		numMatches += rows.count()
+		matches.addBits(fromRow, rows, numRows)
+	}
+	return matches.build(), numMatches, nil
+}
+
+type decodingFilter struct {
+	reader  db.SectionLoader
+	matches func(parquet.Value) bool
+	stats   *PredicateStats
+}
+
+func NewDecodingFilter(reader db.SectionLoader, matches matchFunc, stats *PredicateStats) RowFilter {
+	return &decodingFilter{
+		reader:  reader,
+		matches: matches,
+		stats:   stats,
+	}
+}
 
-		skipFrom, skipTo := pages.CurrentRowIndex(), pages.CurrentRowIndex()
+func (r decodingFilter) FilterRows(chunk parquet.ColumnChunk, ranges SelectionResult) (RowBitmap, error) {
+	values := make([]parquet.Value, 4*1024)
+	selection, numMatches, err := filterPages(r.reader, chunk, ranges, r.stats, func(page parquet.Page, rows bitmap) error {
+		return decodeValues(page, rows, values, r.matches)
+	})
+	if err != nil {
+		return RowBitmap{}, err
+	}
+	r.stats.RowsFilteredByDecoding += ranges.NumRows() - numMatches
+	return selection, nil
+}
+
+// decodeValues sets the bits of rows whose value matches by decoding each value of the page.
+func decodeValues(page parquet.Page, rows bitmap, values []parquet.Value, matches matchFunc) error {
+	reader := page.Values()
+	for row := 0; ; {
+		n, err := reader.ReadValues(values)
 		for i := 0; i < n; i++ {
-			skipTo++
-			matches := r.matches(values[i])
-			if matches {
-				numMatches++
-				selection = selection.Skip(skipFrom, skipTo-1)
-				skipFrom = skipTo
+			if matches(values[i]) {
+				rows.set(row + i)
 			}
 		}
-		parquet.Release(page)
-		selection = selection.Skip(skipFrom, skipTo)
+		row += n
+		if err == io.EOF || n == 0 && err == nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return selection, nil
 }
 
+// dictionaryFilter matches the values of the dictionary of a column chunk once, and then
+// filters rows by their dictionary indexes. Pages which are not dictionary encoded, such as
+// pages written after the dictionary grew too large, are decoded.
 type dictionaryFilter struct {
 	reader  db.SectionLoader
 	matches func(parquet.Value) bool
+	stats   *PredicateStats
 }
 
-func NewDictionaryFilter(reader db.SectionLoader, matches matchFunc) RowFilter {
+func NewDictionaryFilter(reader db.SectionLoader, matches matchFunc, stats *PredicateStats) RowFilter {
 	return &dictionaryFilter{
 		reader:  reader,
 		matches: matches,
+		stats:   stats,
 	}
 }
 
-func (r dictionaryFilter) FilterRows(chunk parquet.ColumnChunk, ranges SelectionResult) (RowSelection, error) {
-	pages := SelectPages(chunk, ranges)
-	defer pages.Close()
-
-	offsetFrom, offsetTo := pages.PageOffset(0), pages.PageOffset(pages.NumPages()-1)
-	section, err := r.reader.NewSection(offsetFrom, offsetTo)
-	if err != nil {
-		return nil, err
+func (r dictionaryFilter) FilterRows(chunk parquet.ColumnChunk, ranges SelectionResult) (RowBitmap, error) {
+	var (
+		dictionary parquet.Dictionary
+		matching   bitmap
+		numMatches int64
+		values     []parquet.Value
+		// Rows of the remaining pages can only be skipped once no dictionary value matches
+		// if no page of the chunk has fallen back to another encoding.
+		onlyDictionary bool
+	)
+	if rowGroup, ok := ranges.RowGroup().(RowGroup); ok {
+		onlyDictionary = onlyDictionaryPages(rowGroup.Metadata().Columns[chunk.Column()].MetaData)
 	}
-	section = db.AsyncSection(section, 3)
-	defer section.Close()
-
-	var dictionaryValue int32 = -1
-	var once sync.Once
-	var selection RowSelection
-	for {
-		if loadErr := section.LoadNext(); loadErr != nil && loadErr != io.EOF {
-			return nil, loadErr
+	selection, numRowMatches, err := filterPages(r.reader, chunk, ranges, r.stats, func(page parquet.Page, rows bitmap) error {
+		pageDictionary := page.Dictionary()
+		if pageDictionary == nil || page.NumNulls() > 0 {
+			if values == nil {
+				values = make([]parquet.Value, 4*1024)
+			}
+			return decodeValues(page, rows, values, r.matches)
 		}
-		page, err := pages.ReadPage()
-		if err == io.EOF {
-			break
+		// All pages in a column chunk share the same dictionary.
+		if pageDictionary != dictionary {
+			dictionary = pageDictionary
+			matching = dictionaryBitmap(dictionary, r.matches)
+			numMatches = matching.count()
 		}
-		if err != nil {
-			return nil, err
+		if numMatches == 0 {
+			if onlyDictionary {
+				return errNoMatchingValues
+			}
+			return nil
 		}
 
+		// Predicates which match a single value, or all but one value, compare indexes directly.
 		data := page.Data()
-		once.Do(func() {
-			dictionaryValue = getDictionaryEncodedValue(page, r.matches)
-		})
-		if dictionaryValue == -1 {
-			selection = selection.Skip(pages.CurrentRowIndex(), page.NumRows())
-			parquet.Release(page)
-			break
+		switch int(numMatches) {
+		case 1:
+			filterIndexEquals(rows, data.Int32(), int32(matching.nextSet(0, dictionary.Len())), false)
+		case dictionary.Len() - 1:
+			filterIndexEquals(rows, data.Int32(), int32(matching.nextUnset(0, dictionary.Len())), true)
+		default:
+			filterIndexes(rows, data.Int32(), matching)
 		}
-
-		encodedValues := data.Int32()
-		skipFrom, skipTo := pages.CurrentRowIndex(), pages.CurrentRowIndex()
-		for _, val := range encodedValues {
-			skipTo++
-			if val == dictionaryValue {
-				selection = selection.Skip(skipFrom, skipTo-1)
-				skipFrom = skipTo
-			}
-		}
-		parquet.Release(page)
-		selection = selection.Skip(skipFrom, skipTo)
+		return nil
+	})
+	if err != nil {
+		return RowBitmap{}, err
 	}
+	r.stats.RowsFilteredByDictionary += ranges.NumRows() - numRowMatches
 	return selection, nil
 }
 
-func getDictionaryEncodedValue(page parquet.Page, matches matchFunc) int32 {
-	dictionaryData := page.Dictionary().Page().Data()
-	vals, offsets := dictionaryData.ByteArray()
-	for i := 0; i < len(offsets)-1; i++ {
-		val := parquet.ByteArrayValue(vals[offsets[i]:offsets[i+1]])
-		if matches(val) {
-			return int32(i)
+// int64RangeFilter filters rows of INT64 columns, such as chunk time columns, whose value is in the range [min, max].
+// Values are compared straight from the decoded page buffers.
+type int64RangeFilter struct {
+	reader   db.SectionLoader
+	min, max int64
+	stats    *PredicateStats
+}
+
+func NewInt64RangeFilter(reader db.SectionLoader, min, max int64, stats *PredicateStats) RowFilter {
+	return &int64RangeFilter{
+		reader: reader,
+		min:    min,
+		max:    max,
+		stats:  stats,
+	}
+}
+
+func (r int64RangeFilter) FilterRows(chunk parquet.ColumnChunk, ranges SelectionResult) (RowBitmap, error) {
+	matches := func(value parquet.Value) bool {
+		return !value.IsNull() && value.Int64() >= r.min && value.Int64() <= r.max
+	}
+	var (
+		dictionary parquet.Dictionary
+		matching   bitmap
+		values     []parquet.Value
+	)
+	selection, numMatches, err := filterPages(r.reader, chunk, ranges, r.stats, func(page parquet.Page, rows bitmap) error {
+		if page.NumNulls() > 0 {
+			if values == nil {
+				values = make([]parquet.Value, 4*1024)
+			}
+			return decodeValues(page, rows, values, matches)
 		}
+		data := page.Data()
+		if pageDictionary := page.Dictionary(); pageDictionary != nil {
+			if pageDictionary != dictionary {
+				dictionary = pageDictionary
+				matching = dictionaryBitmap(dictionary, matches)
+			}
+			filterIndexes(rows, data.Int32(), matching)
+			return nil
+		}
+		filterInt64Range(rows, data.Int64(), r.min, r.max)
+		return nil
+	})
+	if err != nil {
+		return RowBitmap{}, err
 	}
-	return -1
+	r.stats.RowsFilteredByDecoding += ranges.NumRows() - numMatches
+	return selection, nil
 }
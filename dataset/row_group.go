@@ -0,0 +1,78 @@
+package dataset
+
+import (
+	"strings"
+
+	"github.com/segmentio/parquet-go"
+	"github.com/segmentio/parquet-go/format"
+
+	"Shopify/thanos-parquet-engine/db"
+)
+
+// RowGroup is a parquet row group which also exposes
+// the metadata stored for it in the file footer.
+type RowGroup interface {
+	parquet.RowGroup
+	// Ordinal is the position of the row group in the file.
+	Ordinal() int
+	Metadata() format.RowGroup
+}
+
+type fileRowGroup struct {
+	parquet.RowGroup
+	ordinal  int
+	metadata format.RowGroup
+}
+
+// segmentioCreatedBy is the prefix of the created_by field in files written by segmentio/parquet-go.
+const segmentioCreatedBy = "github.com/segmentio/parquet-go"
+
+// FileRowGroups returns the row groups of a parquet file together with their metadata.
+func FileRowGroups(file *parquet.File) []RowGroup {
+	metadata := file.Metadata()
+	_, validStatistics := file.Lookup(db.ByteArrayStatisticsKey)
+	validStatistics = validStatistics || !strings.HasPrefix(metadata.CreatedBy, segmentioCreatedBy)
+	rowGroups := make([]RowGroup, 0, len(file.RowGroups()))
+	for i, rowGroup := range file.RowGroups() {
+		rowGroupMetadata := metadata.RowGroups[i]
+		if i < len(metadata.RowGroups)-1 && !validStatistics {
+			rowGroupMetadata = withoutByteArrayStatistics(rowGroupMetadata)
+		}
+		rowGroups = append(rowGroups, &fileRowGroup{
+			RowGroup: rowGroup,
+			ordinal:  i,
+			metadata: rowGroupMetadata,
+		})
+	}
+	return rowGroups
+}
+
+// withoutByteArrayStatistics removes the min and max values of byte array and fixed length
+// byte array columns from the metadata.
+// The segmentio/parquet-go writer keeps references to its buffers for these values, so they get
+// overwritten by the values of the following row groups before the footer is written.
+// Only the statistics of the last row group in a file can be trusted, unless the file was
+// written by db.Writer, which replaces them with the values it tracked itself.
+func withoutByteArrayStatistics(metadata format.RowGroup) format.RowGroup {
+	columns := make([]format.ColumnChunk, len(metadata.Columns))
+	copy(columns, metadata.Columns)
+	for i := range columns {
+		switch columns[i].MetaData.Type {
+		case format.ByteArray, format.FixedLenByteArray:
+		default:
+			continue
+		}
+		columns[i].MetaData.Statistics.MinValue = nil
+		columns[i].MetaData.Statistics.MaxValue = nil
+	}
+	metadata.Columns = columns
+	return metadata
+}
+
+func (r fileRowGroup) Ordinal() int {
+	return r.ordinal
+}
+
+func (r fileRowGroup) Metadata() format.RowGroup {
+	return r.metadata
+}
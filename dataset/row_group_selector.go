@@ -0,0 +1,40 @@
+package dataset
+
+import (
+	"bytes"
+
+	"github.com/segmentio/parquet-go"
+)
+
+// rowGroupSelector uses the column chunk statistics stored in the file footer
+// to discard entire row groups without reading page indexes or bloom filters.
+// Row groups without statistics, such as byte array columns of all but the last row group
+// of files written by segmentio/parquet-go outside of db.Writer, are always selected.
+type rowGroupSelector struct {
+	compare compareFunc
+}
+
+func newRowGroupSelector(compare compareFunc) *rowGroupSelector {
+	return &rowGroupSelector{compare: compare}
+}
+
+func (s rowGroupSelector) SelectRowGroup(rowGroup RowGroup, column parquet.LeafColumn) bool {
+	statistics := rowGroup.Metadata().Columns[column.ColumnIndex].MetaData.Statistics
+	if statistics.MinValue == nil || statistics.MaxValue == nil {
+		return true
+	}
+	kind := column.Node.Type().Kind()
+	return s.compare(kind.Value(statistics.MinValue), kind.Value(statistics.MaxValue))
+}
+
+// prefixRange returns a compareFunc which checks whether a range of values
+// can contain a value starting with the given prefix.
+func prefixRange(compare func(a, b parquet.Value) int, prefix string) compareFunc {
+	pqPrefix := parquet.ByteArrayValue([]byte(prefix))
+	return func(min, max parquet.Value) bool {
+		if compare(max, pqPrefix) < 0 {
+			return false
+		}
+		return compare(min, pqPrefix) <= 0 || bytes.HasPrefix(min.ByteArray(), pqPrefix.ByteArray())
+	}
+}
@@ -0,0 +1,115 @@
+package dataset
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"Shopify/thanos-parquet-engine/pqtest"
+)
+
+func TestRowGroupSelector(t *testing.T) {
+	file, err := pqtest.CreateFileWithRowGroups([][]pqtest.Row{
+		{
+			pqtest.TwoColumnRow("api-1", "val1"),
+			pqtest.TwoColumnRow("api-2", "val2"),
+		},
+		{
+			pqtest.TwoColumnRow("kubelet-1", "val3"),
+			pqtest.TwoColumnRow("kubelet-2", "val4"),
+		},
+	})
+	require.NoError(t, err)
+	columnA, _ := file.Schema().Lookup("ColumnA")
+	columnB, _ := file.Schema().Lookup("ColumnB")
+	rowGroups := FileRowGroups(file)
+
+	// Only byte array statistics of the last row group are written correctly.
+	statistics := rowGroups[0].Metadata().Columns[columnA.ColumnIndex].MetaData.Statistics
+	require.Nil(t, statistics.MinValue)
+	require.Nil(t, statistics.MaxValue)
+	statistics = rowGroups[1].Metadata().Columns[columnA.ColumnIndex].MetaData.Statistics
+	require.Equal(t, "kubelet-1", string(statistics.MinValue))
+	require.Equal(t, "kubelet-2", string(statistics.MaxValue))
+
+	cases := []struct {
+		name      string
+		predicate Predicate
+		expected  []bool
+	}{
+		{
+			name:      "equals",
+			predicate: NewEqualsPredicate(nopSectionLoader{}, nil, columnB, "val1"),
+			expected:  []bool{true, false},
+		},
+		{
+			name:      "equals outside of all row groups",
+			predicate: NewEqualsPredicate(nopSectionLoader{}, nil, columnA, "zzz"),
+			expected:  []bool{true, false},
+		},
+		{
+			name:      "match with prefix",
+			predicate: NewMatchPredicate(nopSectionLoader{}, columnA, "kube", func(string) bool { return true }),
+			expected:  []bool{true, true},
+		},
+		{
+			name:      "match with prefix of the min value",
+			predicate: NewMatchPredicate(nopSectionLoader{}, columnA, "api", func(string) bool { return true }),
+			expected:  []bool{true, false},
+		},
+		{
+			name:      "match with prefix of a value",
+			predicate: NewMatchPredicate(nopSectionLoader{}, columnA, "kubelet-10", func(string) bool { return true }),
+			expected:  []bool{true, true},
+		},
+		{
+			name:      "match without prefix",
+			predicate: NewMatchPredicate(nopSectionLoader{}, columnA, "", func(string) bool { return true }),
+			expected:  []bool{true, true},
+		},
+		{
+			name:      "not",
+			predicate: Not(NewEqualsPredicate(nopSectionLoader{}, nil, columnB, "val1")),
+			expected:  []bool{true, true},
+		},
+		{
+			name: "or",
+			predicate: Or(
+				NewEqualsPredicate(nopSectionLoader{}, nil, columnA, "api-1"),
+				NewEqualsPredicate(nopSectionLoader{}, nil, columnB, "val4"),
+			),
+			expected: []bool{true, true},
+		},
+		{
+			name: "or without matching row groups",
+			predicate: Or(
+				NewEqualsPredicate(nopSectionLoader{}, nil, columnA, "api-1"),
+				NewEqualsPredicate(nopSectionLoader{}, nil, columnB, "val1"),
+			),
+			expected: []bool{true, false},
+		},
+		{
+			name: "and",
+			predicate: And(
+				NewEqualsPredicate(nopSectionLoader{}, nil, columnA, "kubelet-1"),
+				NewEqualsPredicate(nopSectionLoader{}, nil, columnB, "val2"),
+			),
+			expected: []bool{true, false},
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			selected := make([]bool, 0, len(rowGroups))
+			for _, rowGroup := range rowGroups {
+				selected = append(selected, tcase.predicate.SelectRowGroup(rowGroup))
+			}
+			require.Equal(t, tcase.expected, selected)
+		})
+	}
+
+	predicate := NewEqualsPredicate(nopSectionLoader{}, nil, columnA, "zzz")
+	for _, rowGroup := range rowGroups {
+		predicate.SelectRowGroup(rowGroup)
+	}
+	require.EqualValues(t, 1, predicate.Stats()[0].RowGroupsSkippedByStats)
+}
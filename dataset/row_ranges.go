@@ -0,0 +1,53 @@
+package dataset
+
+type rowRangesPredicate struct {
+	rowGroups [][]PickRange
+	stats     *PredicateStats
+}
+
+// NewRowRangesPredicate selects rows which are inside the picked ranges of each row group,
+// for example row ranges resolved from a series index. The ranges of each row group must be
+// sorted and must not overlap. Row groups without ranges are discarded.
+func NewRowRangesPredicate(rowGroups [][]PickRange) Predicate {
+	return rowRangesPredicate{
+		rowGroups: rowGroups,
+		stats:     NewPredicateStats("row_ranges"),
+	}
+}
+
+func (p rowRangesPredicate) SelectRowGroup(rowGroup RowGroup) bool {
+	if len(p.ranges(rowGroup)) > 0 {
+		return true
+	}
+	p.stats.RowGroupsSkippedByStats++
+	return false
+}
+
+func (p rowRangesPredicate) SelectRows(rowGroup RowGroup) RowSelection {
+	return selectPicked(rowGroup.NumRows(), p.ranges(rowGroup))
+}
+
+// FilterRows does not need to decode any pages since SelectRows is already exact.
+func (p rowRangesPredicate) FilterRows(rowGroup RowGroup, selection Selection) (Selection, error) {
+	return SelectRows(rowGroup, selection, p.SelectRows(rowGroup)), nil
+}
+
+func (p rowRangesPredicate) Estimate(rowGroup RowGroup, selection Selection) Estimate {
+	selected := numSelected(rowGroup, selection)
+	if selected == 0 {
+		return Estimate{}
+	}
+	picked := SelectRows(rowGroup, selection, p.SelectRows(rowGroup)).NumRows()
+	return Estimate{Selectivity: float64(picked) / float64(selected)}
+}
+
+func (p rowRangesPredicate) Stats() []*PredicateStats {
+	return []*PredicateStats{p.stats}
+}
+
+func (p rowRangesPredicate) ranges(rowGroup RowGroup) []PickRange {
+	if rowGroup.Ordinal() >= len(p.rowGroups) {
+		return nil
+	}
+	return p.rowGroups[rowGroup.Ordinal()]
+}
@@ -69,30 +69,80 @@ func (r RowSelection) Skip(from, to int64) RowSelection {
 	return append(r, skip(from, to))
 }
 
-func SelectRows(rowGroup parquet.RowGroup, skips ...RowSelection) SelectionResult {
-	if len(skips) == 0 {
-		return SelectionResult{
-			rowGroup: rowGroup,
-			ranges:   []PickRange{Pick(0, rowGroup.NumRows())},
+// Union returns a selection which skips rows skipped by either of the two selections.
+func (r RowSelection) Union(other RowSelection) RowSelection {
+	union := make(RowSelection, 0, len(r)+len(other))
+	union = append(union, r...)
+	return append(union, other...)
+}
+
+// selectPicked returns a selection which skips all rows outside the given ranges.
+// The ranges can overlap, but need to be sorted by their starting row.
+func selectPicked(numRows int64, ranges []PickRange) RowSelection {
+	selection := make(RowSelection, 0, len(ranges)+1)
+	fromRow := int64(0)
+	for _, r := range ranges {
+		if r.from > fromRow {
+			selection = selection.Skip(fromRow, r.from)
 		}
+		fromRow = maxInt64(fromRow, r.to)
 	}
+	return selection.Skip(fromRow, maxInt64(fromRow, numRows))
+}
 
-	allRanges := make(RowSelection, 0, len(skips))
-	for _, selection := range skips {
-		allRanges = append(allRanges, selection...)
-	}
-	if len(allRanges) == 0 {
-		return SelectionResult{
-			rowGroup: rowGroup,
-			ranges:   []PickRange{Pick(0, rowGroup.NumRows())},
+// SelectRows returns the ranges of rows of the row group which are selected by all selections.
+// Skips of RowSelections are merged with each other, and other selections are intersected as bitmaps.
+func SelectRows(rowGroup parquet.RowGroup, selections ...Selection) SelectionResult {
+	var (
+		numRows = rowGroup.NumRows()
+		skips   = make(RowSelection, 0, len(selections))
+		others  = make([]Selection, 0)
+	)
+	for _, selection := range selections {
+		if s, ok := selection.(RowSelection); ok {
+			skips = append(skips, s...)
+			continue
 		}
+		others = append(others, selection)
+	}
+	switch {
+	case len(others) == 0:
+		return SelectionResult{rowGroup: rowGroup, ranges: skips.Ranges(numRows)}
+	case len(others) == 1 && len(skips) == 0:
+		return SelectionResult{rowGroup: rowGroup, ranges: others[0].Ranges(numRows)}
+	}
+
+	selected := others[0].Bitmap(numRows)
+	for _, other := range others[1:] {
+		selected = selected.And(other.Bitmap(numRows))
 	}
+	if len(skips) > 0 {
+		selected = selected.And(skips.Bitmap(numRows))
+	}
+	return SelectionResult{rowGroup: rowGroup, ranges: selected.Ranges(numRows)}
+}
+
+// Ranges returns the ranges of rows which are not skipped.
+func (r RowSelection) Ranges(numRows int64) []PickRange {
+	if len(r) == 0 {
+		return []PickRange{Pick(0, numRows)}
+	}
+
+	// Skips are sorted by their first row, so that a skip which contains
+	// several earlier skips is merged with all of them.
+	allRanges := make(RowSelection, len(r))
+	copy(allRanges, r)
 	slices.SortFunc(allRanges, func(a, b skipRange) bool {
-		return a.before(b.rowRange)
+		return a.from < b.from
 	})
 
 	merged := mergeOverlappingRanges(allRanges)
-	return pickRanges(rowGroup, merged)
+	return pickRanges(numRows, merged)
+}
+
+// Bitmap returns a bitmap of the rows which are not skipped.
+func (r RowSelection) Bitmap(numRows int64) RowBitmap {
+	return NewRowBitmap(numRows, r.Ranges(numRows)...)
 }
 
 type PickRange struct {
@@ -128,7 +178,7 @@ func mergeOverlappingRanges(allRanges []skipRange) RowSelection {
 	return merged
 }
 
-func pickRanges(rowGroup parquet.RowGroup, skips RowSelection) SelectionResult {
+func pickRanges(numRows int64, skips RowSelection) []PickRange {
 	ranges := make([]PickRange, 0, len(skips))
 	fromRow := int64(0)
 	for _, s := range skips {
@@ -137,13 +187,10 @@ func pickRanges(rowGroup parquet.RowGroup, skips RowSelection) SelectionResult {
 		}
 		fromRow = s.to
 	}
-	if fromRow < rowGroup.NumRows() {
-		ranges = append(ranges, Pick(fromRow, rowGroup.NumRows()))
-	}
-	return SelectionResult{
-		rowGroup: rowGroup,
-		ranges:   ranges,
+	if fromRow < numRows {
+		ranges = append(ranges, Pick(fromRow, numRows))
 	}
+	return ranges
 }
 
 func minInt64(a, b int64) int64 {
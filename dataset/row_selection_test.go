@@ -17,7 +17,7 @@ func TestRowSelection(t *testing.T) {
 
 	cases := []struct {
 		name       string
-		selections []RowSelection
+		selections []Selection
 		expected   []PickRange
 	}{
 		{
@@ -27,35 +27,35 @@ func TestRowSelection(t *testing.T) {
 		},
 		{
 			name:       "single skip",
-			selections: []RowSelection{{skip(0, 10)}},
+			selections: []Selection{RowSelection{skip(0, 10)}},
 			expected:   []PickRange{Pick(10, numRows)},
 		},
 		{
 			name:       "multiple skips",
-			selections: []RowSelection{{skip(0, 10), skip(25, 32)}},
+			selections: []Selection{RowSelection{skip(0, 10), skip(25, 32)}},
 			expected:   []PickRange{Pick(10, 25), Pick(32, numRows)},
 		},
 		{
 			name: "two equal selections",
-			selections: []RowSelection{
-				{skip(5, 10), skip(35, numRows)},
-				{skip(5, 10), skip(35, numRows)},
+			selections: []Selection{
+				RowSelection{skip(5, 10), skip(35, numRows)},
+				RowSelection{skip(5, 10), skip(35, numRows)},
 			},
 			expected: []PickRange{Pick(0, 5), Pick(10, 35)},
 		},
 		{
 			name: "one selection is a subset of another",
-			selections: []RowSelection{
-				{skip(0, 10), skip(28, 37)},
-				{skip(5, 8), skip(30, 35)},
+			selections: []Selection{
+				RowSelection{skip(0, 10), skip(28, 37)},
+				RowSelection{skip(5, 8), skip(30, 35)},
 			},
 			expected: []PickRange{Pick(10, 28), Pick(37, numRows)},
 		},
 		{
 			name: "two different selections",
-			selections: []RowSelection{
-				{skip(10, 20), skip(25, 30)},
-				{skip(0, 5), skip(15, 23), skip(26, 28)},
+			selections: []Selection{
+				RowSelection{skip(10, 20), skip(25, 30)},
+				RowSelection{skip(0, 5), skip(15, 23), skip(26, 28)},
 			},
 			expected: []PickRange{
 				Pick(5, 10), Pick(23, 25), Pick(30, numRows),
@@ -63,15 +63,39 @@ func TestRowSelection(t *testing.T) {
 		},
 		{
 			name: "multiple different selections",
-			selections: []RowSelection{
-				{skip(0, 10), skip(20, 30)},
-				{skip(0, 5), skip(15, 23), skip(23, 28), skip(28, 30)},
-				{skip(0, 3), skip(21, 24), skip(24, 30)},
+			selections: []Selection{
+				RowSelection{skip(0, 10), skip(20, 30)},
+				RowSelection{skip(0, 5), skip(15, 23), skip(23, 28), skip(28, 30)},
+				RowSelection{skip(0, 3), skip(21, 24), skip(24, 30)},
 			},
 			expected: []PickRange{
 				Pick(10, 15), Pick(30, numRows),
 			},
 		},
+		{
+			name: "bitmap and skips",
+			selections: []Selection{
+				NewRowBitmap(numRows, Pick(0, 5), Pick(8, 30)),
+				RowSelection{skip(10, 20)},
+			},
+			expected: []PickRange{Pick(0, 5), Pick(8, 10), Pick(20, 30)},
+		},
+		{
+			name: "bitmap and selection result",
+			selections: []Selection{
+				NewRowBitmap(numRows, Pick(0, 30)),
+				NewSelectionResult(rowGroup, []PickRange{Pick(25, numRows)}),
+			},
+			expected: []PickRange{Pick(25, 30)},
+		},
+		{
+			name: "skip contains several earlier skips",
+			selections: []Selection{
+				RowSelection{skip(5, 6), skip(10, 20)},
+				RowSelection{skip(0, 30)},
+			},
+			expected: []PickRange{Pick(30, numRows)},
+		},
 	}
 
 	for _, testCase := range cases {
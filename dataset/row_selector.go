@@ -5,15 +5,15 @@ import (
 )
 
 type RowSelector interface {
-	SelectRows(mode parquet.ColumnChunk) RowSelection
+	SelectRows(chunk parquet.ColumnChunk, stats *PredicateStats) RowSelection
 }
 
 type RowSelectors []RowSelector
 
-func (p RowSelectors) SelectRows(chunk parquet.ColumnChunk) RowSelection {
+func (p RowSelectors) SelectRows(chunk parquet.ColumnChunk, stats *PredicateStats) RowSelection {
 	var selection RowSelection
 	for _, selector := range p {
-		selection = append(selection, selector.SelectRows(chunk)...)
+		selection = append(selection, selector.SelectRows(chunk, stats)...)
 	}
 	return selection
 }
@@ -26,7 +26,7 @@ func newBloomSelector(value parquet.Value) *bloomSelector {
 	return &bloomSelector{value: value}
 }
 
-func (s bloomSelector) SelectRows(chunk parquet.ColumnChunk) RowSelection {
+func (s bloomSelector) SelectRows(chunk parquet.ColumnChunk, stats *PredicateStats) RowSelection {
 	var selection RowSelection
 	bloomFilter := chunk.BloomFilter()
 	if bloomFilter == nil {
@@ -37,6 +37,7 @@ func (s bloomSelector) SelectRows(chunk parquet.ColumnChunk) RowSelection {
 	if err != nil || ok {
 		return SelectAll()
 	}
+	stats.RowGroupsSkippedByBloom++
 	return selection.Skip(0, chunk.NumValues())
 }
 
@@ -50,7 +51,7 @@ func newStatsSelector(compare compareFunc) *statsSelector {
 	return &statsSelector{compare: compare}
 }
 
-func (s statsSelector) SelectRows(chunk parquet.ColumnChunk) RowSelection {
+func (s statsSelector) SelectRows(chunk parquet.ColumnChunk, stats *PredicateStats) RowSelection {
 	var selection RowSelection
 	offsetIndex := chunk.OffsetIndex()
 	columnIndex := chunk.ColumnIndex()
@@ -65,6 +66,8 @@ func (s statsSelector) SelectRows(chunk parquet.ColumnChunk) RowSelection {
 
 		matches := s.compare(columnIndex.MinValue(i), columnIndex.MaxValue(i))
 		if !matches {
+			stats.PagesSkippedByStats++
+			stats.RowsSkippedByStats += toRow - fromRow
 			selection = append(selection, skip(fromRow, toRow))
 		}
 	}
@@ -23,6 +23,16 @@ func (s SelectionResult) NumRows() int64 {
 	return numRows
 }
 
+// Ranges returns the picked ranges of rows.
+func (s SelectionResult) Ranges(_ int64) []PickRange {
+	return s.ranges
+}
+
+// Bitmap returns a bitmap of the picked ranges of rows.
+func (s SelectionResult) Bitmap(numRows int64) RowBitmap {
+	return NewRowBitmap(numRows, s.ranges...)
+}
+
 type RowsIterator struct {
 	i      int
 	result SelectionResult
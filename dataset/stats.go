@@ -0,0 +1,43 @@
+package dataset
+
+import "time"
+
+// ColumnStats tracks the pages and bytes read from a single column,
+// as well as the time spent decoding them.
+type ColumnStats struct {
+	Column     string
+	PagesRead  int64
+	BytesRead  int64
+	DecodeTime time.Duration
+}
+
+func NewColumnStats(column string) *ColumnStats {
+	return &ColumnStats{Column: column}
+}
+
+func (s *ColumnStats) RecordPages(pages RowIndexedPages) {
+	s.BytesRead += pages.CompressedSize()
+}
+
+func (s *ColumnStats) RecordPage(decodeTime time.Duration) {
+	s.PagesRead++
+	s.DecodeTime += decodeTime
+}
+
+// PredicateStats tracks how many row groups, pages and rows a
+// predicate pruned, and which mechanism did the pruning.
+type PredicateStats struct {
+	ColumnStats
+
+	RowGroupsSkippedByStats      int64
+	RowGroupsSkippedByBloom      int64
+	RowGroupsSkippedByDictionary int64
+	PagesSkippedByStats          int64
+	RowsSkippedByStats           int64
+	RowsFilteredByDictionary     int64
+	RowsFilteredByDecoding       int64
+}
+
+func NewPredicateStats(column string) *PredicateStats {
+	return &PredicateStats{ColumnStats: ColumnStats{Column: column}}
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+// ConvertBlock writes all series of a TSDB block into the writer and compacts the written parts.
+// Series get sequential IDs in the order of their labels.
+func ConvertBlock(block tsdb.BlockReader, writer *Writer) error {
+	err := ForEachSeries(block, func(chunks []schema.Chunk) error {
+		return writer.Write(chunks)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return errors.Wrap(err, "failed flushing writer")
+	}
+	return writer.Compact()
+}
+
+// ForEachSeries calls fn with the chunks of each series in the block, in the order of their labels.
+// The chunks carry their encoding and number of samples, so any chunk type including
+// native histograms can be converted. The slice passed to fn is reused between calls.
+func ForEachSeries(block tsdb.BlockReader, fn func(chunks []schema.Chunk) error) error {
+	ir, err := block.Index()
+	if err != nil {
+		return errors.Wrap(err, "failed opening index")
+	}
+	defer ir.Close()
+
+	chunkReader, err := block.Chunks()
+	if err != nil {
+		return errors.Wrap(err, "failed opening chunks")
+	}
+	defer chunkReader.Close()
+
+	ps, err := ir.Postings(index.AllPostingsKey())
+	if err != nil {
+		return errors.Wrap(err, "failed reading postings")
+	}
+	ps = ir.SortedPostings(ps)
+
+	var (
+		lblBuilder  labels.ScratchBuilder
+		chks        []chunks.Meta
+		seriesID    int64 = -1
+		chunkBuffer       = make([]schema.Chunk, 0, 1000)
+	)
+	for ps.Next() {
+		chunkBuffer = chunkBuffer[:0]
+		seriesID++
+		lblBuilder.Reset()
+		if err := ir.Series(ps.At(), &lblBuilder, &chks); err != nil {
+			return errors.Wrap(err, "failed reading series")
+		}
+
+		lbls := lblBuilder.Labels().Map()
+		for _, chunkMeta := range chks {
+			chk, err := chunkReader.Chunk(chunkMeta)
+			if err != nil {
+				return errors.Wrap(err, "failed reading chunk")
+			}
+			chunkBuffer = append(chunkBuffer, schema.Chunk{
+				SeriesID:   seriesID,
+				Labels:     lbls,
+				MinT:       chunkMeta.MinTime,
+				MaxT:       chunkMeta.MaxTime,
+				ChunkBytes: chk.Bytes(),
+				Encoding:   chk.Encoding(),
+				NumSamples: int64(chk.NumSamples()),
+			})
+		}
+		if err := fn(chunkBuffer); err != nil {
+			return err
+		}
+	}
+	return ps.Err()
+}
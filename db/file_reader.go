@@ -16,12 +16,14 @@ import (
 )
 
 const (
-	ReadBufferSize         = 4 * 1024
-	defaultSectionCacheDir = "./cache"
+	ReadBufferSize = 4 * 1024
+	// DefaultSectionCacheDir is the directory in which sections are cached when no other directory is set.
+	DefaultSectionCacheDir = "./cache"
 )
 
 type fileReaderOpts struct {
-	sectionCacheDir string
+	sectionCacheDir     string
+	preloadDictionaries bool
 }
 
 type FileReaderOpt func(*fileReaderOpts)
@@ -32,6 +34,15 @@ func WithSectionCacheDir(dir string) FileReaderOpt {
 	}
 }
 
+// WithDictionaryPreloading loads the dictionary pages of all column chunks when the file is opened.
+// Predicates can then discard column chunks whose dictionary has no matching values
+// without fetching any data pages from the bucket.
+func WithDictionaryPreloading() FileReaderOpt {
+	return func(opts *fileReaderOpts) {
+		opts.preloadDictionaries = true
+	}
+}
+
 type FileReader struct {
 	size       int64
 	file       *parquet.File
@@ -65,10 +76,11 @@ func NewFileReader(partName string, bucket objstore.Bucket, opts ...FileReaderOp
 		return nil, errors.Wrap(err, "error reading column bloom filters")
 	}
 
-	//fmt.Println("Loading dictionary sections")
-	//if err := loadDictionaryPages(fsSectionLoader, partMetadata); err != nil {
-	//	return nil, errors.Wrap(err, "error reading column dictionaries")
-	//}
+	if readerOpts.preloadDictionaries {
+		if err := loadDictionaryPages(fsSectionLoader, partMetadata); err != nil {
+			return nil, errors.Wrap(err, "error reading column dictionaries")
+		}
+	}
 
 	reader := &FileReader{
 		size:          dataFileAtts.Size,
@@ -81,7 +93,7 @@ func NewFileReader(partName string, bucket objstore.Bucket, opts ...FileReaderOp
 
 func applyOpts(opts []FileReaderOpt) fileReaderOpts {
 	readerOpts := fileReaderOpts{
-		sectionCacheDir: defaultSectionCacheDir,
+		sectionCacheDir: DefaultSectionCacheDir,
 	}
 	for _, opt := range opts {
 		opt(&readerOpts)
@@ -93,6 +105,11 @@ func (r *FileReader) SectionLoader() SectionLoader {
 	return r.sectionLoader
 }
 
+// SectionCacheDir returns the directory in which sections of the file are cached.
+func (r *FileReader) SectionCacheDir() string {
+	return r.sectionLoader.cacheDir
+}
+
 func (r *FileReader) ReadAt(p []byte, off int64) (n int, err error) {
 	n, err = r.sectionLoader.ReadAt(p, off)
 	if err == errSectionNotFound {
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"os"
+	"path"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/parquet-go"
+
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+const (
+	metricMetadataSuffix = ".metric_metadata"
+	exemplarsSuffix      = ".exemplars"
+)
+
+// WriteMetadata adds the TYPE, HELP and UNIT of metrics to the metadata file.
+// Identical entries are only stored once, but a metric can have several different entries.
+// The metadata file is only written when metadata was added.
+func (w *Writer) WriteMetadata(metadata []schema.Metadata) {
+	if w.metadata == nil {
+		w.metadata = make(map[schema.Metadata]struct{})
+	}
+	for _, m := range metadata {
+		w.metadata[m] = struct{}{}
+	}
+}
+
+// WriteExemplars adds exemplars of series to the exemplars file.
+// Exemplars are kept in memory until the writer is compacted.
+// The exemplars file is only written when exemplars were added.
+func (w *Writer) WriteExemplars(exemplars []schema.Exemplar) {
+	w.exemplars = append(w.exemplars, exemplars...)
+}
+
+// writeMetadataFiles writes the metadata and exemplars files next to the compacted parquet file.
+func (w *Writer) writeMetadataFiles() error {
+	if len(w.metadata) > 0 {
+		metadataSchema := schema.MakeMetadataSchema(w.schemaOptions...)
+		metadata := make([]schema.Metadata, 0, len(w.metadata))
+		for m := range w.metadata {
+			metadata = append(metadata, m)
+		}
+		sort.Slice(metadata, func(i, j int) bool {
+			a, b := metadata[i], metadata[j]
+			if a.MetricName != b.MetricName {
+				return a.MetricName < b.MetricName
+			}
+			if a.Type != b.Type {
+				return a.Type < b.Type
+			}
+			if a.Help != b.Help {
+				return a.Help < b.Help
+			}
+			return a.Unit < b.Unit
+		})
+		rows := make([]parquet.Row, 0, len(metadata))
+		for _, m := range metadata {
+			rows = append(rows, metadataSchema.MakeMetadataRow(m))
+		}
+		partName := path.Join(w.dir, "compact"+metricMetadataSuffix)
+		if err := w.writeParquetRows(partName, metadataSchema.ParquetSchema(), rows); err != nil {
+			return errors.Wrap(err, "failed writing metadata")
+		}
+	}
+
+	if len(w.exemplars) > 0 {
+		exemplarSchema := schema.MakeExemplarSchema(w.schemaOptions...)
+		sort.SliceStable(w.exemplars, func(i, j int) bool {
+			if w.exemplars[i].SeriesID != w.exemplars[j].SeriesID {
+				return w.exemplars[i].SeriesID < w.exemplars[j].SeriesID
+			}
+			return w.exemplars[i].Ts < w.exemplars[j].Ts
+		})
+		rows := make([]parquet.Row, 0, len(w.exemplars))
+		for _, e := range w.exemplars {
+			rows = append(rows, exemplarSchema.MakeExemplarRow(e))
+		}
+		partName := path.Join(w.dir, "compact"+exemplarsSuffix)
+		if err := w.writeParquetRows(partName, exemplarSchema.ParquetSchema(), rows); err != nil {
+			return errors.Wrap(err, "failed writing exemplars")
+		}
+	}
+	return nil
+}
+
+// writeParquetRows writes the rows into a parquet file and its metadata file.
+func (w *Writer) writeParquetRows(partName string, pqSchema *parquet.Schema, rows []parquet.Row) error {
+	if err := writeParquetFile(partName+dataFileSuffix, pqSchema, rows); err != nil {
+		return err
+	}
+	return w.createMetadataFile(partName)
+}
+
+func writeParquetFile(fileName string, pqSchema *parquet.Schema, rows []parquet.Row) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pqWriter := parquet.NewGenericWriter[any](f, pqSchema, parquet.DataPageStatistics(true))
+	if _, err := pqWriter.WriteRows(rows); err != nil {
+		return err
+	}
+	return pqWriter.Close()
+}
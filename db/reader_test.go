@@ -4,7 +4,9 @@ import (
 	"context"
 	"io"
 	"os"
+	"path/filepath"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/prometheus/prometheus/model/labels"
@@ -55,9 +57,88 @@ func TestSectionLoading(t *testing.T) {
 	assertNumSections(t, cacheDir, 0)
 }
 
+func TestSharedSections(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, generatePart(dir, 10000))
+	expected, err := os.ReadFile(filepath.Join(dir, "part.0.parquet"))
+	require.NoError(t, err)
+
+	bucket, err := filesystem.NewBucket(dir)
+	require.NoError(t, err)
+	cacheDir := t.TempDir()
+	reader, err := NewFileReader("part.0", bucket, WithSectionCacheDir(cacheDir))
+	require.NoError(t, err)
+	defer reader.Close()
+
+	// Readers of the same byte range share a section, and load it concurrently.
+	loader := reader.SectionLoader()
+	sections := make([]Section, 2)
+	for i := range sections {
+		sections[i], err = loader.NewSectionSize(0, reader.FileSize(), int64(i+1)*1024)
+		require.NoError(t, err)
+	}
+	assertNumSections(t, cacheDir, 2)
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(sections))
+	for i, sec := range sections {
+		wg.Add(1)
+		go func(i int, sec Section) {
+			defer wg.Done()
+			for {
+				if err := sec.LoadNext(); err != nil {
+					if err != io.EOF {
+						errs[i] = err
+					}
+					return
+				}
+			}
+		}(i, sec)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	// The section is only released once all of its readers are closed.
+	require.NoError(t, sections[0].Close())
+	require.NoError(t, sections[0].Close())
+	assertNumSections(t, cacheDir, 2)
+	buf := make([]byte, reader.FileSize())
+	_, err = reader.ReadAt(buf, 0)
+	require.NoError(t, err)
+	require.Equal(t, expected, buf)
+
+	require.NoError(t, sections[1].Close())
+	assertNumSections(t, cacheDir, 1)
+}
+
+func TestDictionaryPreloading(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, generatePart(dir, 10000))
+
+	bucket, err := filesystem.NewBucket(dir)
+	require.NoError(t, err)
+	inspector := &bucketInspector{Bucket: bucket}
+
+	cacheDir := t.TempDir()
+	reader, err := NewFileReader("part.0", inspector, WithSectionCacheDir(cacheDir), WithDictionaryPreloading())
+	require.NoError(t, err)
+
+	// One section for bloom filters and one for the dictionary of each label column.
+	assertNumSections(t, cacheDir, 3)
+	require.Equal(t, 3, inspector.getRangeRequests)
+
+	require.NoError(t, reader.Close())
+	assertNumSections(t, cacheDir, 0)
+}
+
 func generatePart(dir string, numSeries int) error {
 	columns := []string{"a", "b"}
-	writer := NewWriter(dir, columns)
+	writer, err := NewWriter(dir, columns)
+	if err != nil {
+		return err
+	}
 	defer writer.Close()
 
 	chunks := make([]schema.Chunk, 0)
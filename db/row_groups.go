@@ -0,0 +1,206 @@
+package db
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/parquet-go"
+	"github.com/segmentio/parquet-go/format"
+
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+const copyBatchSize = 1024
+
+// rowGroupLimits decides when a writer should cut a new row group.
+// A zero value for any of the limits disables it.
+type rowGroupLimits struct {
+	// maxRows is the maximum number of rows in a row group.
+	maxRows int64
+	// maxBytes is the maximum uncompressed size of the values in a row group.
+	maxBytes int64
+	// maxDictionaryBytes is the maximum size of the dictionary of any dictionary encoded byte array column.
+	// A row group can exceed it only when a single value is larger than the limit.
+	maxDictionaryBytes int64
+	// timeAlignment cuts a row group whenever the MinT of a chunk falls into a new time bucket.
+	timeAlignment time.Duration
+}
+
+// rowGroupWriter writes rows into a parquet writer and flushes row groups once a limit is reached.
+// Byte array statistics are tracked for each row group and written into the footer of the file on Close.
+type rowGroupWriter struct {
+	file       *os.File
+	writer     *parquet.GenericWriter[any]
+	limits     rowGroupLimits
+	statistics *byteArrayStatistics
+
+	minTColumn        int
+	dictionaryColumns []int
+
+	numRows         int64
+	numBytes        int64
+	bucket          int64
+	dictionaries    []map[string]struct{}
+	dictionaryBytes []int64
+}
+
+func newRowGroupWriter(file *os.File, writer *parquet.GenericWriter[any], pqSchema *parquet.Schema, limits rowGroupLimits) *rowGroupWriter {
+	w := &rowGroupWriter{
+		file:       file,
+		writer:     writer,
+		limits:     limits,
+		statistics: newByteArrayStatistics(pqSchema),
+		minTColumn: -1,
+	}
+	if limits.timeAlignment > 0 {
+		if minT, ok := pqSchema.Lookup(schema.MinTColumn); ok {
+			w.minTColumn = minT.ColumnIndex
+		}
+	}
+	if limits.maxDictionaryBytes > 0 {
+		for _, path := range pqSchema.Columns() {
+			column, _ := pqSchema.Lookup(path...)
+			if column.Node.Type().Kind() != parquet.ByteArray {
+				continue
+			}
+			if encoding := column.Node.Encoding(); encoding != nil && encoding.Encoding() == format.RLEDictionary {
+				w.dictionaryColumns = append(w.dictionaryColumns, column.ColumnIndex)
+			}
+		}
+	}
+	w.reset()
+	return w
+}
+
+// CopyRows writes all rows into the writer, cutting row groups along the way.
+func (w *rowGroupWriter) CopyRows(rows parquet.RowReader) error {
+	batch := make([]parquet.Row, copyBatchSize)
+	for {
+		n, err := rows.ReadRows(batch)
+		if n > 0 {
+			if writeErr := w.WriteRows(batch[:n]); writeErr != nil {
+				return writeErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (w *rowGroupWriter) WriteRows(rows []parquet.Row) error {
+	from := 0
+	for i, row := range rows {
+		if !w.cutBefore(row) {
+			w.add(row)
+			continue
+		}
+		if _, err := w.writer.WriteRows(rows[from:i]); err != nil {
+			return err
+		}
+		if err := w.writer.Flush(); err != nil {
+			return err
+		}
+		w.statistics.cut()
+		w.reset()
+		w.add(row)
+		from = i
+	}
+	_, err := w.writer.WriteRows(rows[from:])
+	return err
+}
+
+func (w *rowGroupWriter) Close() error {
+	if w.numRows > 0 {
+		w.statistics.cut()
+	}
+	if err := w.writer.Close(); err != nil {
+		return err
+	}
+	return errors.Wrap(w.statistics.rewriteFooter(w.file), "failed writing byte array statistics")
+}
+
+// cutBefore returns true if the row should be written into a new row group.
+func (w *rowGroupWriter) cutBefore(row parquet.Row) bool {
+	if w.numRows == 0 {
+		return false
+	}
+	if w.limits.maxRows > 0 && w.numRows >= w.limits.maxRows {
+		return true
+	}
+	if w.limits.maxBytes > 0 && w.numBytes >= w.limits.maxBytes {
+		return true
+	}
+	if w.minTColumn >= 0 && timeBucket(row[w.minTColumn].Int64(), w.limits.timeAlignment) != w.bucket {
+		return true
+	}
+	for i, column := range w.dictionaryColumns {
+		value := row[column].ByteArray()
+		if _, ok := w.dictionaries[i][string(value)]; ok {
+			continue
+		}
+		if w.dictionaryBytes[i]+dictionaryValueSize(value) > w.limits.maxDictionaryBytes {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *rowGroupWriter) add(row parquet.Row) {
+	w.numRows++
+	w.statistics.add(row)
+	for _, value := range row {
+		w.numBytes += valueSize(value)
+	}
+	if w.minTColumn >= 0 {
+		w.bucket = timeBucket(row[w.minTColumn].Int64(), w.limits.timeAlignment)
+	}
+	for i, column := range w.dictionaryColumns {
+		value := row[column].ByteArray()
+		if _, ok := w.dictionaries[i][string(value)]; ok {
+			continue
+		}
+		w.dictionaries[i][string(value)] = struct{}{}
+		w.dictionaryBytes[i] += dictionaryValueSize(value)
+	}
+}
+
+func (w *rowGroupWriter) reset() {
+	w.numRows = 0
+	w.numBytes = 0
+	w.dictionaries = make([]map[string]struct{}, len(w.dictionaryColumns))
+	for i := range w.dictionaries {
+		w.dictionaries[i] = make(map[string]struct{})
+	}
+	w.dictionaryBytes = make([]int64, len(w.dictionaryColumns))
+}
+
+func valueSize(value parquet.Value) int64 {
+	switch value.Kind() {
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		return int64(len(value.ByteArray()))
+	default:
+		return 8
+	}
+}
+
+// dictionaryValueSize is the size of a value in a dictionary page.
+// Plain encoded byte arrays are prefixed by their 4 byte length.
+func dictionaryValueSize(value []byte) int64 {
+	return int64(len(value) + 4)
+}
+
+// timeBucket returns the start of the time bucket which contains the timestamp in milliseconds.
+func timeBucket(t int64, alignment time.Duration) int64 {
+	size := alignment.Milliseconds()
+	bucket := t - t%size
+	if t < 0 && t%size != 0 {
+		bucket -= size
+	}
+	return bucket
+}
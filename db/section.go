@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"path"
+	"sync"
 	"time"
 )
 
@@ -17,69 +18,126 @@ type Section interface {
 	LoadAll() error
 }
 
+// section is a byte range of the file which is loaded into the cache dir. Sections are shared by all
+// readers of byte ranges which they cover, so they are loaded under a lock and only released
+// once all of their readers are closed.
 type section struct {
 	sections *sections
 
-	from       int64
-	to         int64
-	readBuffer []byte
+	from int64
+	to   int64
+	// refs is the number of open readers of the section, and is guarded by the lock of sections.
+	refs int
 
-	reader io.Reader
-	bytes  sectionBytes
+	mu         sync.Mutex
+	readBuffer []byte
+	reader     io.Reader
+	bytes      sectionBytes
+	// loadedTo is the end of the bytes which are loaded.
+	loadedTo int64
 }
 
-func (fs *sections) newDiskSection(from, to, readBatchSize int64, dir string, reader io.Reader) (section, error) {
+func (fs *sections) newDiskSection(from, to, readBatchSize int64, dir string, reader io.Reader) (*section, error) {
 	filePath := path.Join(dir, fmt.Sprintf("%d-%d.section", from, to))
 	f, err := os.Create(filePath)
 	if err != nil {
-		return section{}, err
+		return nil, err
 	}
 
-	return section{
+	return &section{
 		sections:   fs,
 		from:       from,
 		to:         to,
 		readBuffer: make([]byte, readBatchSize),
 		reader:     reader,
 		bytes:      fileBytes{path: filePath, File: f},
+		loadedTo:   from,
 	}, nil
 }
 
-func (fs *sections) newMemorySection(from, to, readBatchSize int64, reader io.Reader) (section, error) {
+func (fs *sections) newMemorySection(from, to, readBatchSize int64, reader io.Reader) (*section, error) {
 	buffer := make([]byte, 0, to-from)
 
-	return section{
+	return &section{
 		sections:   fs,
 		from:       from,
 		to:         to,
 		readBuffer: make([]byte, readBatchSize),
 		reader:     reader,
 		bytes:      &memoryBytes{bytes: buffer},
+		loadedTo:   from,
 	}, nil
 }
 
-func (s section) LoadNext() error {
+// open returns a new reader of the section which loads it from the given offset in steps of size bytes.
+// It must be called with the lock of sections held.
+func (s *section) open(from, size int64) *sectionReader {
+	s.refs++
+	return &sectionReader{section: s, next: from, size: size}
+}
+
+// loadTo loads the bytes of the section until the given offset, unless they are already loaded.
+func (s *section) loadTo(to int64) (int64, error) {
+	if s.loadedTo >= to {
+		return 0, nil
+	}
+	n, err := io.CopyBuffer(s.bytes, io.LimitReader(s.reader, to-s.loadedTo), s.readBuffer)
+	s.loadedTo += n
+	return n, err
+}
+
+// sectionReader is the view of a single reader on a shared section. Each reader loads the section
+// from the start of its own byte range, and bytes which other readers already loaded are not loaded again.
+type sectionReader struct {
+	section *section
+	next    int64
+	size    int64
+	closed  bool
+}
+
+func (r *sectionReader) LoadNext() error {
+	s := r.section
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r.next >= s.to {
+		return io.EOF
+	}
+	to := r.next + r.size
+	if to > s.to {
+		to = s.to
+	}
 	start := time.Now()
-	bufferReader := io.LimitReader(s.reader, int64(len(s.readBuffer)))
-	n, err := io.CopyBuffer(s.bytes, bufferReader, s.readBuffer)
+	n, err := s.loadTo(to)
 	if err != nil {
 		return err
 	}
-	if n == 0 {
+	if s.loadedTo < to {
 		return io.EOF
 	}
-
-	fmt.Printf("Read %dKB in %s. Estimated throughput: %f MB/s\n", n, time.Since(start), float64(n)/1024/1024/time.Since(start).Seconds())
+	r.next = to
+	if n > 0 {
+		fmt.Printf("Read %dKB in %s. Estimated throughput: %f MB/s\n", n, time.Since(start), float64(n)/1024/1024/time.Since(start).Seconds())
+	}
 	return nil
 }
 
-func (s section) LoadAll() error {
-	_, err := io.Copy(s.bytes, s.reader)
+func (r *sectionReader) LoadAll() error {
+	s := r.section
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.loadTo(s.to)
+	r.next = s.to
 	return err
 }
 
-func (s section) Close() error {
-	return s.sections.release(s)
+func (r *sectionReader) Close() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	return r.section.sections.release(r.section)
 }
 
 type asyncSection struct {
@@ -21,7 +21,7 @@ type sections struct {
 	cacheDir string
 
 	mu             sync.RWMutex
-	loadedSections []section
+	loadedSections []*section
 }
 
 func newFilesystemLoader(reader *storage.BucketReader, fileSize int64, cacheDir string) (*sections, error) {
@@ -29,7 +29,7 @@ func newFilesystemLoader(reader *storage.BucketReader, fileSize int64, cacheDir
 		reader:         reader,
 		cacheDir:       cacheDir,
 		fileSize:       fileSize,
-		loadedSections: make([]section, 0),
+		loadedSections: make([]*section, 0),
 	}, nil
 }
 
@@ -37,25 +37,24 @@ func (fs *sections) NewSection(from, to int64) (Section, error) {
 	return fs.NewSectionSize(from, to, prefetchBufferSize)
 }
 
+// NewSectionSize returns a section which loads the byte range in steps of size bytes.
+// Sections which cover the range are shared, and each returned section must be closed.
 func (fs *sections) NewSectionSize(from, to, size int64) (Section, error) {
-	fs.mu.RLock()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
 	sec, ok := fs.find(from, to)
 	if ok {
-		fs.mu.RUnlock()
-		return sec, nil
+		return sec.open(from, size), nil
 	}
-	fs.mu.RUnlock()
 
 	to = to + ReadBufferSize
 	if to > fs.fileSize {
 		to = fs.fileSize
 	}
-
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
 	sec, ok = fs.find(from, to)
 	if ok {
-		return sec, nil
+		return sec.open(from, size), nil
 	}
 
 	sectionReader, err := fs.reader.ReaderAt(from, to-from)
@@ -69,7 +68,7 @@ func (fs *sections) NewSectionSize(from, to, size int64) (Section, error) {
 	}
 
 	fs.loadedSections = append(fs.loadedSections, sec)
-	return sec, nil
+	return sec.open(from, size), nil
 }
 
 func (fs *sections) ReadAt(p []byte, absOffset int64) (int, error) {
@@ -85,22 +84,27 @@ func (fs *sections) ReadAt(p []byte, absOffset int64) (int, error) {
 	return 0, errSectionNotFound
 }
 
-func (fs *sections) find(from, to int64) (section, bool) {
+func (fs *sections) find(from, to int64) (*section, bool) {
 	for _, sec := range fs.loadedSections {
 		if sec.from <= from && to <= sec.to {
 			return sec, true
 		}
 	}
 
-	return section{}, false
+	return nil, false
 }
 
-func (fs *sections) release(s section) error {
+// release closes a reader of the section, and removes the section once it has no more readers.
+func (fs *sections) release(s *section) error {
 	fs.mu.Lock()
 	defer fs.mu.Unlock()
 
+	s.refs--
+	if s.refs > 0 {
+		return nil
+	}
 	for i := 0; i < len(fs.loadedSections); i++ {
-		if fs.loadedSections[i].from == s.from && fs.loadedSections[i].to == s.to {
+		if fs.loadedSections[i] == s {
 			fs.loadedSections = append(fs.loadedSections[:i], fs.loadedSections[i+1:]...)
 			break
 		}
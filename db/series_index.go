@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/parquet-go"
+	"github.com/thanos-io/objstore"
+
+	"Shopify/thanos-parquet-engine/index"
+)
+
+// ReadSeriesIndex reads the series index written next to a parquet file.
+// The whole index is fetched with a single request to the bucket.
+func ReadSeriesIndex(partName string, bucket objstore.Bucket) (*index.Index, error) {
+	indexReader, err := bucket.Get(context.Background(), partName+indexFileSuffix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get index file "+partName+indexFileSuffix)
+	}
+	defer indexReader.Close()
+
+	indexBytes, err := io.ReadAll(indexReader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading index file")
+	}
+	return index.Decode(indexBytes)
+}
+
+func createIndexFile(partName string) error {
+	f, err := os.Open(partName + dataFileSuffix)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	pqFile, err := parquet.OpenFile(f, stat.Size())
+	if err != nil {
+		return err
+	}
+	seriesIndex, err := index.Build(pqFile)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(partName+indexFileSuffix, seriesIndex.Encode(), 0644)
+}
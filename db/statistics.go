@@ -0,0 +1,124 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/encoding/thrift"
+	"github.com/segmentio/parquet-go"
+	"github.com/segmentio/parquet-go/format"
+)
+
+// ByteArrayStatisticsKey is set in the key-value metadata of files for which the writer
+// replaced the min and max values of byte array columns with the ones it tracked itself.
+// Files written by segmentio/parquet-go without it only have valid byte array statistics in their last row group.
+const ByteArrayStatisticsKey = "byte_array_statistics"
+
+const parquetMagic = "PAR1"
+
+// byteArrayStatistics tracks the min and max values of byte array columns for each row group.
+// The segmentio/parquet-go writer keeps references to its page and dictionary buffers for these values,
+// and the buffers are reused by the following row groups before the footer is written.
+type byteArrayStatistics struct {
+	columns []int
+
+	min, max  [][]byte
+	rowGroups [][]columnBounds
+}
+
+type columnBounds struct {
+	min, max []byte
+}
+
+func newByteArrayStatistics(pqSchema *parquet.Schema) *byteArrayStatistics {
+	s := &byteArrayStatistics{}
+	for _, path := range pqSchema.Columns() {
+		column, _ := pqSchema.Lookup(path...)
+		switch column.Node.Type().Kind() {
+		case parquet.ByteArray, parquet.FixedLenByteArray:
+			s.columns = append(s.columns, column.ColumnIndex)
+		}
+	}
+	s.min = make([][]byte, len(s.columns))
+	s.max = make([][]byte, len(s.columns))
+	return s
+}
+
+// add updates the bounds of the current row group with the values of the row.
+// Values are copied since rows can be reused by their readers.
+func (s *byteArrayStatistics) add(row parquet.Row) {
+	for i, column := range s.columns {
+		value := row[column]
+		if value.IsNull() {
+			continue
+		}
+		data := value.ByteArray()
+		if s.min[i] == nil || bytes.Compare(data, s.min[i]) < 0 {
+			s.min[i] = append(s.min[i][:0:0], data...)
+		}
+		if s.max[i] == nil || bytes.Compare(data, s.max[i]) > 0 {
+			s.max[i] = append(s.max[i][:0:0], data...)
+		}
+	}
+}
+
+// cut completes the bounds of the current row group.
+func (s *byteArrayStatistics) cut() {
+	bounds := make([]columnBounds, len(s.columns))
+	for i := range s.columns {
+		bounds[i] = columnBounds{min: s.min[i], max: s.max[i]}
+		s.min[i], s.max[i] = nil, nil
+	}
+	s.rowGroups = append(s.rowGroups, bounds)
+}
+
+// rewriteFooter replaces the byte array statistics in the footer of a closed parquet file.
+func (s *byteArrayStatistics) rewriteFooter(f *os.File) error {
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var trailer [8]byte
+	if _, err := f.ReadAt(trailer[:], stat.Size()-int64(len(trailer))); err != nil {
+		return errors.Wrap(err, "failed reading footer length")
+	}
+	if string(trailer[4:]) != parquetMagic {
+		return errors.New("invalid magic footer")
+	}
+	footerOffset := stat.Size() - int64(len(trailer)) - int64(binary.LittleEndian.Uint32(trailer[:4]))
+	footer := make([]byte, binary.LittleEndian.Uint32(trailer[:4]))
+	if _, err := f.ReadAt(footer, footerOffset); err != nil {
+		return errors.Wrap(err, "failed reading footer")
+	}
+
+	var (
+		protocol thrift.CompactProtocol
+		metadata format.FileMetaData
+	)
+	if err := thrift.Unmarshal(&protocol, footer, &metadata); err != nil {
+		return errors.Wrap(err, "failed decoding footer")
+	}
+	if len(metadata.RowGroups) != len(s.rowGroups) {
+		return errors.Errorf("file has %d row groups, but statistics were tracked for %d", len(metadata.RowGroups), len(s.rowGroups))
+	}
+	for i, rowGroup := range metadata.RowGroups {
+		for j, column := range s.columns {
+			statistics := &rowGroup.Columns[column].MetaData.Statistics
+			statistics.MinValue = s.rowGroups[i][j].min
+			statistics.MaxValue = s.rowGroups[i][j].max
+		}
+	}
+	metadata.KeyValueMetadata = append(metadata.KeyValueMetadata, format.KeyValue{Key: ByteArrayStatisticsKey, Value: "true"})
+
+	footer, err = thrift.Marshal(&protocol, &metadata)
+	if err != nil {
+		return errors.Wrap(err, "failed encoding footer")
+	}
+	binary.LittleEndian.PutUint32(trailer[:4], uint32(len(footer)))
+	if _, err := f.WriteAt(append(footer, trailer[:]...), footerOffset); err != nil {
+		return errors.Wrap(err, "failed writing footer")
+	}
+	return f.Truncate(footerOffset + int64(len(footer)) + int64(len(trailer)))
+}
@@ -6,11 +6,13 @@ import (
 	"path"
 	"regexp"
 	"sort"
+	"time"
 
 	"github.com/apache/arrow/go/v10/parquet/file"
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/segmentio/parquet-go"
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 
 	"Shopify/thanos-parquet-engine/schema"
@@ -22,70 +24,276 @@ const (
 	writeBufferSize    = 256 * 1024
 	dataFileSuffix     = ".parquet"
 	metadataFileSuffix = ".metadata"
+	indexFileSuffix    = ".index"
+	labelsSuffix       = ".labels"
 )
 
-var partRegex = regexp.MustCompile(`part.(\d+).parquet`)
+var (
+	partRegex       = regexp.MustCompile(`part.(\d+).parquet`)
+	labelsPartRegex = regexp.MustCompile(`part.(\d+).labels.parquet`)
+)
 
 type WriterOption func(*Writer)
 
+// SortOrder is the order of rows in files which contain labels and chunks.
+type SortOrder int
+
+const (
+	// SortByTime sorts rows by metric name, MinT, MaxT and then the other labels.
+	// Chunks of a series are spread across the file by time.
+	SortByTime SortOrder = iota
+	// SortBySeries sorts rows by metric name, the other labels, series ID and MinT.
+	// Chunks of each series are contiguous, so series can be deduplicated and iterated
+	// without hashing. With time aligned row groups, series are only contiguous within each time bucket.
+	SortBySeries
+)
+
 type Writer struct {
-	dir        string
-	partID     int
-	buffer     *parquet.GenericBuffer[any]
-	rowsBuffer []parquet.Row
+	dir    string
+	partID int
+
+	chunks *partFile
+	// labels is only set for the split layout.
+	labels     *partFile
+	seenSeries map[int64]struct{}
+
+	// lastSeriesID and lastSeriesHash avoid hashing the labels of a series for each of its chunks.
+	lastSeriesID   int64
+	lastSeriesHash schema.SeriesHash
+
+	labelColumns   []string
+	labelsPageSize int
+	chunksPageSize int
+	rowGroupLimits rowGroupLimits
+	seriesIndex    bool
+	splitLayout    bool
+	sortOrder      SortOrder
+	schemaOptions  []schema.Option
+
+	metadata  map[schema.Metadata]struct{}
+	exemplars []schema.Exemplar
+}
 
-	sortingColumns []parquet.SortingColumn
-	schema         *schema.ChunkSchema
-	bloomFilters   []parquet.BloomFilterColumn
+// WithRowGroupRows limits the number of rows in each row group.
+func WithRowGroupRows(rows int64) WriterOption {
+	return func(w *Writer) {
+		w.rowGroupLimits.maxRows = rows
+	}
+}
 
-	pageBufferSize int
+// WithRowGroupBytes limits the uncompressed size of the values in each row group.
+func WithRowGroupBytes(bytes int64) WriterOption {
+	return func(w *Writer) {
+		w.rowGroupLimits.maxBytes = bytes
+	}
 }
 
-func NewWriter(dir string, labelColumns []string, option ...WriterOption) *Writer {
-	sortingColums := make([]parquet.SortingColumn, 0, len(labelColumns)+2)
-	sortingColums = append(sortingColums, parquet.Ascending(schema.MinTColumn))
-	sortingColums = append(sortingColums, parquet.Ascending(schema.MaxTColumn))
-	for _, lbl := range labelColumns {
-		sortingColums = append(sortingColums, parquet.Ascending(lbl))
+// WithMaxDictionarySize cuts a new row group when the dictionary of any
+// dictionary encoded column grows over the given size in bytes.
+// This bounds the size of dictionary pages which predicates need to read.
+func WithMaxDictionarySize(bytes int64) WriterOption {
+	return func(w *Writer) {
+		w.rowGroupLimits.maxDictionaryBytes = bytes
 	}
-	slices.SortFunc(sortingColums, func(a, b parquet.SortingColumn) bool {
-		return CompareColumns(a.Path()[0], b.Path()[0])
-	})
+}
 
-	bloomFilters := make([]parquet.BloomFilterColumn, 0, len(labelColumns))
-	for _, lbl := range labelColumns {
-		bloomFilters = append(bloomFilters, parquet.SplitBlockFilter(10, lbl))
+// WithTimeAlignedRowGroups writes chunks into row groups aligned to the given duration,
+// for example one row group per hour of MinT, so that time predicates can discard entire row groups.
+// Rows are ordered by their time bucket first, and by the sorting columns within each bucket.
+// The alignment must be at least one millisecond.
+func WithTimeAlignedRowGroups(alignment time.Duration) WriterOption {
+	return func(w *Writer) {
+		w.rowGroupLimits.timeAlignment = alignment
 	}
+}
+
+// WithLabelsPageSize sets the target size of pages in files which only contain labels.
+func WithLabelsPageSize(bytes int) WriterOption {
+	return func(w *Writer) {
+		w.labelsPageSize = bytes
+	}
+}
 
+// WithChunksPageSize sets the target size of pages in files which contain chunks.
+// The page size applies to all columns in the file, so in the default layout it also
+// applies to label columns. Use the split layout to size label and chunk pages separately.
+func WithChunksPageSize(bytes int) WriterOption {
+	return func(w *Writer) {
+		w.chunksPageSize = bytes
+	}
+}
+
+// WithSeriesIndex writes a series index file next to the compacted parquet file.
+// The index can be read with ReadSeriesIndex.
+func WithSeriesIndex() WriterOption {
+	return func(w *Writer) {
+		w.seriesIndex = true
+	}
+}
+
+// WithSplitLayout writes labels and chunks into separate parquet files.
+// The labels file has one row for each series and is written with the ".labels" suffix,
+// and the chunks file has one row for each chunk sorted by series ID and time.
+// Queries which only need labels then never read chunk data.
+func WithSplitLayout() WriterOption {
+	return func(w *Writer) {
+		w.splitLayout = true
+	}
+}
+
+// WithSortOrder sets the order of rows in the default layout. The chunks file
+// of the split layout is always sorted by series ID and time.
+func WithSortOrder(order SortOrder) WriterOption {
+	return func(w *Writer) {
+		w.sortOrder = order
+	}
+}
+
+// WithSchemaOptions configures the codec and encoding of columns in the written files.
+func WithSchemaOptions(opts ...schema.Option) WriterOption {
+	return func(w *Writer) {
+		w.schemaOptions = append(w.schemaOptions, opts...)
+	}
+}
+
+// NewWriter creates a writer for parquet files in dir. It returns an error if the options are invalid.
+func NewWriter(dir string, labelColumns []string, option ...WriterOption) (*Writer, error) {
 	writer := &Writer{
 		dir:            dir,
 		partID:         -1,
-		sortingColumns: sortingColums,
-		bloomFilters:   bloomFilters,
-		schema:         schema.MakeChunkSchema(labelColumns),
-		pageBufferSize: MaxPageSize,
-		rowsBuffer:     make([]parquet.Row, 0),
+		labelColumns:   labelColumns,
+		labelsPageSize: MaxPageSize,
+		chunksPageSize: MaxPageSize,
 	}
 	for _, opt := range option {
 		opt(writer)
 	}
-	writer.openBuffer()
+	// Time buckets are computed in milliseconds, the unit of chunk timestamps.
+	if alignment := writer.rowGroupLimits.timeAlignment; alignment != 0 && alignment < time.Millisecond {
+		return nil, errors.Errorf("time alignment of row groups must be at least 1ms, got %s", alignment)
+	}
+
+	if writer.splitLayout {
+		writer.initSplitLayout()
+	} else {
+		writer.initDefaultLayout()
+	}
+	return writer, nil
+}
+
+func (w *Writer) initDefaultLayout() {
+	chunkSchema := schema.MakeChunkSchema(w.labelColumns, w.schemaOptions...)
+	var sortingColumns []parquet.SortingColumn
+	switch w.sortOrder {
+	case SortBySeries:
+		sortingColumns = append(labelSortingColumns(w.labelColumns),
+			parquet.Ascending(schema.SeriesIDColumn),
+			parquet.Ascending(schema.MinTColumn),
+			parquet.Ascending(schema.MaxTColumn),
+		)
+	default:
+		sortingColumns = append(labelSortingColumns(w.labelColumns),
+			parquet.Ascending(schema.MinTColumn),
+			parquet.Ascending(schema.MaxTColumn),
+		)
+		slices.SortFunc(sortingColumns, func(a, b parquet.SortingColumn) bool {
+			return CompareColumns(a.Path()[0], b.Path()[0])
+		})
+	}
+
+	w.chunks = newPartFile(
+		false,
+		"",
+		partRegex,
+		chunkSchema.ParquetSchema(),
+		sortingColumns,
+		labelBloomFilters(w.labelColumns),
+		chunkSchema.MakeChunkRow,
+		w.rowGroupLimits.timeAlignment,
+	)
+}
+
+func (w *Writer) initSplitLayout() {
+	labelsSchema := schema.MakeSeriesLabelsSchema(w.labelColumns, w.schemaOptions...)
+	chunksSchema := schema.MakeSeriesChunksSchema(w.schemaOptions...)
+
+	w.labels = newPartFile(
+		true,
+		labelsSuffix,
+		labelsPartRegex,
+		labelsSchema.ParquetSchema(),
+		// Series whose chunks are written in several parts have a labels row in each part,
+		// which are next to each other when parts are merged by labels and series ID.
+		append(labelSortingColumns(w.labelColumns), parquet.Ascending(schema.SeriesIDColumn)),
+		labelBloomFilters(w.labelColumns),
+		labelsSchema.MakeSeriesRow,
+		0,
+	)
+	w.chunks = newPartFile(
+		false,
+		"",
+		partRegex,
+		chunksSchema.ParquetSchema(),
+		[]parquet.SortingColumn{
+			parquet.Ascending(schema.SeriesIDColumn),
+			parquet.Ascending(schema.MinTColumn),
+			parquet.Ascending(schema.MaxTColumn),
+		},
+		nil,
+		chunksSchema.MakeChunkRow,
+		w.rowGroupLimits.timeAlignment,
+	)
+	w.seenSeries = make(map[int64]struct{})
+}
+
+func labelSortingColumns(labelColumns []string) []parquet.SortingColumn {
+	sortingColumns := make([]parquet.SortingColumn, 0, len(labelColumns)+2)
+	for _, lbl := range labelColumns {
+		sortingColumns = append(sortingColumns, parquet.Ascending(lbl))
+	}
+	slices.SortFunc(sortingColumns, func(a, b parquet.SortingColumn) bool {
+		return CompareColumns(a.Path()[0], b.Path()[0])
+	})
+	return sortingColumns
+}
 
-	return writer
+// labelBloomFilters returns bloom filters for the label columns and the series hash.
+func labelBloomFilters(labelColumns []string) []parquet.BloomFilterColumn {
+	bloomFilters := make([]parquet.BloomFilterColumn, 0, len(labelColumns)+1)
+	bloomFilters = append(bloomFilters, parquet.SplitBlockFilter(10, schema.SeriesHashColumn))
+	for _, lbl := range labelColumns {
+		bloomFilters = append(bloomFilters, parquet.SplitBlockFilter(10, lbl))
+	}
+	return bloomFilters
 }
 
 func (w *Writer) Write(chunks []schema.Chunk) error {
-	defer func() {
-		w.rowsBuffer = w.rowsBuffer[:0]
-	}()
 	for _, chunk := range chunks {
-		w.rowsBuffer = append(w.rowsBuffer, w.schema.MakeChunkRow(chunk))
+		if chunk.SeriesID != w.lastSeriesID || w.lastSeriesHash == (schema.SeriesHash{}) {
+			w.lastSeriesID = chunk.SeriesID
+			w.lastSeriesHash = schema.HashSeries(chunk.Labels)
+		}
+		chunk.SeriesHash = w.lastSeriesHash
+		w.chunks.add(chunk)
+		if w.labels == nil {
+			continue
+		}
+		if _, ok := w.seenSeries[chunk.SeriesID]; ok {
+			continue
+		}
+		w.seenSeries[chunk.SeriesID] = struct{}{}
+		w.labels.add(chunk)
 	}
-	if _, err := w.buffer.WriteRows(w.rowsBuffer); err != nil {
+	if err := w.chunks.writeRows(); err != nil {
 		return err
 	}
+	if w.labels != nil {
+		if err := w.labels.writeRows(); err != nil {
+			return err
+		}
+	}
 
-	if w.buffer.NumRows() >= writeBufferSize {
+	if w.chunks.numRows >= writeBufferSize {
 		if err := w.flushBuffer(); err != nil {
 			return err
 		}
@@ -95,6 +303,30 @@ func (w *Writer) Write(chunks []schema.Chunk) error {
 }
 
 func (w *Writer) Compact() error {
+	if err := w.compact(w.chunks); err != nil {
+		return err
+	}
+	if w.labels != nil {
+		if err := w.compact(w.labels); err != nil {
+			return errors.Wrap(err, "failed compacting labels")
+		}
+	}
+
+	if w.seriesIndex {
+		// The series index is built from the file which contains labels.
+		indexedFile := w.chunks
+		if w.labels != nil {
+			indexedFile = w.labels
+		}
+		if err := createIndexFile(path.Join(w.dir, "compact"+indexedFile.suffix)); err != nil {
+			return errors.Wrap(err, "failed writing series index")
+		}
+	}
+
+	return w.writeMetadataFiles()
+}
+
+func (w *Writer) compact(part *partFile) error {
 	files, err := os.ReadDir(w.dir)
 	if err != nil {
 		return errors.Wrap(err, "failed listing directory")
@@ -105,7 +337,7 @@ func (w *Writer) Compact() error {
 		if fileName.IsDir() {
 			continue
 		}
-		if !partRegex.MatchString(fileName.Name()) {
+		if !part.regex.MatchString(fileName.Name()) {
 			continue
 		}
 		fileReader, err := os.Open(w.dir + "/" + fileName.Name())
@@ -123,41 +355,90 @@ func (w *Writer) Compact() error {
 		pqFiles = append(pqFiles, pqFile)
 	}
 
-	output, err := os.Create(w.dir + "/compact.parquet")
+	compactName := path.Join(w.dir, "compact"+part.suffix)
+	output, err := os.Create(compactName + dataFileSuffix)
 	if err != nil {
 		return errors.Wrap(err, "failed creating output file")
 	}
-	readers := make([]parquet.RowGroup, 0)
-	for _, pqFile := range pqFiles {
-		for _, rowGroup := range pqFile.RowGroups() {
-			readers = append(readers, newCopyingRowGroup(rowGroup))
-		}
-	}
+	defer output.Close()
 
-	mergeGroups, err := parquet.MergeRowGroups(
-		readers,
-		w.schema.ParquetSchema(),
-		parquet.SortingRowGroupConfig(parquet.SortingColumns(w.sortingColumns...)),
-	)
+	// Parts are written with time aligned row groups, so row groups from the same
+	// time bucket are merged separately to keep the compacted file aligned as well.
+	buckets, err := w.rowGroupsByBucket(pqFiles, part)
 	if err != nil {
-		return errors.Wrap(err, "failed merging row groups")
+		return err
 	}
-	writer := w.openWriter(output)
-	_, err = parquet.CopyRows(writer, mergeGroups.Rows())
-	if err != nil {
-		return errors.Wrap(err, "failed copying rows")
+	writer := w.openWriter(output, part)
+	for _, readers := range buckets {
+		mergeGroups, err := parquet.MergeRowGroups(
+			readers,
+			part.schema,
+			parquet.SortingRowGroupConfig(parquet.SortingColumns(part.sortingColumns...)),
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed merging row groups")
+		}
+		var rows parquet.RowReader = mergeGroups.Rows()
+		if part.labelsOnly {
+			rows = dedupeSeries(rows, part.schema)
+		}
+		if err := writer.CopyRows(rows); err != nil {
+			return errors.Wrap(err, "failed copying rows")
+		}
 	}
 	if err := writer.Close(); err != nil {
 		return errors.Wrap(err, "failed closing writer")
 	}
 
-	if err := w.createMetadataFile(path.Join(w.dir, "compact")); err != nil {
+	if err := w.createMetadataFile(compactName); err != nil {
 		return errors.Wrap(err, "failed writing metadata")
 	}
 
 	return nil
 }
 
+// dedupeSeries drops consecutive rows with the same series ID, which are labels rows of a series from different parts.
+func dedupeSeries(rows parquet.RowReader, pqSchema *parquet.Schema) parquet.RowReader {
+	seriesID, _ := pqSchema.Lookup(schema.SeriesIDColumn)
+	return parquet.DedupeRowReader(rows, func(a, b parquet.Row) int {
+		return parquet.Int64Type.Compare(a[seriesID.ColumnIndex], b[seriesID.ColumnIndex])
+	})
+}
+
+// rowGroupsByBucket groups the row groups of the files by their time bucket, in ascending order of buckets.
+// All row groups are in a single group if row groups are not time aligned.
+func (w *Writer) rowGroupsByBucket(pqFiles []*parquet.File, part *partFile) ([][]parquet.RowGroup, error) {
+	var (
+		buckets = make(map[int64][]parquet.RowGroup)
+		keys    []int64
+	)
+	for _, pqFile := range pqFiles {
+		minT, aligned := pqFile.Schema().Lookup(schema.MinTColumn)
+		aligned = aligned && w.rowGroupLimits.timeAlignment > 0 && !part.labelsOnly
+		for i, rowGroup := range pqFile.RowGroups() {
+			var bucket int64
+			if aligned {
+				statistics := pqFile.Metadata().RowGroups[i].Columns[minT.ColumnIndex].MetaData.Statistics
+				if statistics.MinValue == nil {
+					return nil, errors.New("missing statistics for aligning row groups")
+				}
+				bucket = timeBucket(parquet.Int64.Value(statistics.MinValue).Int64(), w.rowGroupLimits.timeAlignment)
+			}
+			if _, ok := buckets[bucket]; !ok {
+				keys = append(keys, bucket)
+			}
+			buckets[bucket] = append(buckets[bucket], newCopyingRowGroup(rowGroup))
+		}
+	}
+	slices.Sort(keys)
+
+	result := make([][]parquet.RowGroup, 0, len(keys))
+	for _, bucket := range keys {
+		result = append(result, buckets[bucket])
+	}
+	return result, nil
+}
+
 func (w *Writer) Close() error {
 	return w.Flush()
 }
@@ -167,52 +448,196 @@ func (w *Writer) Flush() error {
 }
 
 func (w *Writer) flushBuffer() error {
-	defer w.buffer.Reset()
-	if w.buffer.NumRows() == 0 {
+	if w.chunks.numRows == 0 {
 		return nil
 	}
 
 	w.partID++
 	partName := fmt.Sprintf("%s/part.%d", w.dir, w.partID)
-	if err := w.flushBufferToFile(partName); err != nil {
+	if err := w.flushPart(partName, w.chunks); err != nil {
 		return err
 	}
-	return w.createMetadataFile(partName)
+	if w.labels != nil {
+		if err := w.flushPart(partName, w.labels); err != nil {
+			return err
+		}
+		// Series are only tracked within a part, so that memory does not grow with all
+		// series written. Duplicate labels rows of different parts are dropped by Compact.
+		w.seenSeries = make(map[int64]struct{})
+	}
+	return nil
 }
 
-func (w *Writer) flushBufferToFile(partName string) error {
+func (w *Writer) flushPart(partName string, part *partFile) error {
+	defer part.reset()
+	if err := w.flushBufferToFile(partName+part.suffix, part); err != nil {
+		return err
+	}
+	return w.createMetadataFile(partName + part.suffix)
+}
+
+func (w *Writer) flushBufferToFile(partName string, part *partFile) error {
 	f, err := os.Create(partName + dataFileSuffix)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	sort.Sort(w.buffer)
-	pqWriter := w.openWriter(f)
-	defer pqWriter.Close()
-
-	_, err = parquet.CopyRows(pqWriter, w.buffer.Rows())
-	return err
+	pqWriter := w.openWriter(f, part)
+	if err := part.writeTo(pqWriter); err != nil {
+		return err
+	}
+	return pqWriter.Close()
 }
 
-func (w *Writer) openWriter(f *os.File) *parquet.GenericWriter[any] {
-	return parquet.NewGenericWriter[any](f,
-		w.schema.ParquetSchema(),
-		parquet.SortingWriterConfig(parquet.SortingColumns(w.sortingColumns...)),
+func (w *Writer) openWriter(f *os.File, part *partFile) *rowGroupWriter {
+	pageSize := w.chunksPageSize
+	if part.labelsOnly {
+		pageSize = w.labelsPageSize
+	}
+	options := []parquet.WriterOption{
+		part.schema,
+		parquet.SortingWriterConfig(parquet.SortingColumns(part.sortingColumns...)),
 		parquet.DefaultWriterConfig(),
 		parquet.WriteBufferSize(writeBufferSize),
-		parquet.PageBufferSize(w.pageBufferSize),
+		parquet.PageBufferSize(pageSize),
 		parquet.DataPageStatistics(true),
-		parquet.BloomFilters(w.bloomFilters...),
-	)
+		parquet.BloomFilters(part.bloomFilters...),
+	}
+	if part.minTColumn < 0 {
+		// Rows which are not time aligned are written in a single sorted run.
+		options = append(options, parquet.KeyValueMetadata(SortedRowGroupsKey, "true"))
+	}
+	pqWriter := parquet.NewGenericWriter[any](f, options...)
+	return newRowGroupWriter(f, pqWriter, part.schema, w.rowGroupLimits)
 }
 
-func (w *Writer) openBuffer() {
-	w.buffer = parquet.NewGenericBuffer[any](
-		w.schema.ParquetSchema(),
-		parquet.ColumnBufferCapacity(writeBufferSize),
-		parquet.SortingRowGroupConfig(parquet.SortingColumns(w.sortingColumns...)),
-	)
+// partFile buffers the rows of one kind of parquet file until they are flushed into a part.
+type partFile struct {
+	// labelsOnly is set for files which do not contain chunks.
+	labelsOnly     bool
+	suffix         string
+	regex          *regexp.Regexp
+	schema         *parquet.Schema
+	sortingColumns []parquet.SortingColumn
+	bloomFilters   []parquet.BloomFilterColumn
+	makeRow        func(schema.Chunk) parquet.Row
+
+	// With time aligned row groups, rows are buffered separately for each time bucket of their MinT,
+	// so that they can be written bucket by bucket without sorting all rows by bucket.
+	// Otherwise all rows are buffered in bucket 0.
+	minTColumn    int
+	timeAlignment time.Duration
+	buckets       map[int64]*parquet.GenericBuffer[any]
+	numRows       int64
+
+	rowsBuffer []parquet.Row
+}
+
+func newPartFile(
+	labelsOnly bool,
+	suffix string,
+	regex *regexp.Regexp,
+	pqSchema *parquet.Schema,
+	sortingColumns []parquet.SortingColumn,
+	bloomFilters []parquet.BloomFilterColumn,
+	makeRow func(schema.Chunk) parquet.Row,
+	timeAlignment time.Duration,
+) *partFile {
+	part := &partFile{
+		labelsOnly:     labelsOnly,
+		suffix:         suffix,
+		regex:          regex,
+		schema:         pqSchema,
+		sortingColumns: sortingColumns,
+		bloomFilters:   bloomFilters,
+		makeRow:        makeRow,
+		minTColumn:     -1,
+		buckets:        make(map[int64]*parquet.GenericBuffer[any]),
+		rowsBuffer:     make([]parquet.Row, 0),
+	}
+	if minT, ok := pqSchema.Lookup(schema.MinTColumn); ok && timeAlignment > 0 && !labelsOnly {
+		part.minTColumn = minT.ColumnIndex
+		part.timeAlignment = timeAlignment
+	}
+	return part
+}
+
+func (p *partFile) add(chunk schema.Chunk) {
+	p.rowsBuffer = append(p.rowsBuffer, p.makeRow(chunk))
+}
+
+func (p *partFile) writeRows() error {
+	defer func() {
+		p.rowsBuffer = p.rowsBuffer[:0]
+	}()
+	if p.minTColumn < 0 {
+		return p.writeBucket(0, p.rowsBuffer)
+	}
+	// Chunks are usually written in time order, so consecutive rows tend to share a bucket.
+	from := 0
+	for i := 1; i <= len(p.rowsBuffer); i++ {
+		bucket := p.bucket(p.rowsBuffer[from])
+		if i < len(p.rowsBuffer) && p.bucket(p.rowsBuffer[i]) == bucket {
+			continue
+		}
+		if err := p.writeBucket(bucket, p.rowsBuffer[from:i]); err != nil {
+			return err
+		}
+		from = i
+	}
+	return nil
+}
+
+func (p *partFile) bucket(row parquet.Row) int64 {
+	return timeBucket(row[p.minTColumn].Int64(), p.timeAlignment)
+}
+
+func (p *partFile) writeBucket(bucket int64, rows []parquet.Row) error {
+	buffer, ok := p.buckets[bucket]
+	if !ok {
+		options := []parquet.RowGroupOption{
+			p.schema,
+			parquet.SortingRowGroupConfig(parquet.SortingColumns(p.sortingColumns...)),
+		}
+		if p.minTColumn < 0 {
+			options = append(options, parquet.ColumnBufferCapacity(writeBufferSize))
+		}
+		buffer = parquet.NewGenericBuffer[any](options...)
+		p.buckets[bucket] = buffer
+	}
+	n, err := buffer.WriteRows(rows)
+	p.numRows += int64(n)
+	return err
+}
+
+// writeTo writes the buffered rows ordered by their time bucket first, and by the sorting columns within each bucket.
+func (p *partFile) writeTo(writer *rowGroupWriter) error {
+	buckets := maps.Keys(p.buckets)
+	slices.Sort(buckets)
+	for _, bucket := range buckets {
+		buffer := p.buckets[bucket]
+		if buffer.NumRows() == 0 {
+			continue
+		}
+		sort.Sort(buffer)
+		if err := writer.CopyRows(buffer.Rows()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reset empties the buffered rows. Buffers of time buckets are dropped since the following parts
+// usually cover different buckets, while the single buffer of unaligned parts is reused.
+func (p *partFile) reset() {
+	if p.minTColumn >= 0 {
+		p.buckets = make(map[int64]*parquet.GenericBuffer[any])
+	}
+	for _, buffer := range p.buckets {
+		buffer.Reset()
+	}
+	p.numRows = 0
 }
 
 func (w *Writer) createMetadataFile(partName string) error {
@@ -235,6 +660,32 @@ func (w *Writer) createMetadataFile(partName string) error {
 	return err
 }
 
+// SortedRowGroupsKey is set in the key-value metadata of files whose rows are sorted across all row groups,
+// and not only within each row group. Files with time aligned row groups are sorted within each time bucket,
+// which can span several row groups, so they do not have it.
+const SortedRowGroupsKey = "sorted_row_groups"
+
+// IsSortedAcrossRowGroups returns true if the rows of the file are sorted across all of its row groups,
+// so that rows of consecutive row groups can be read as a single sorted run.
+func IsSortedAcrossRowGroups(file *parquet.File) bool {
+	_, ok := file.Lookup(SortedRowGroupsKey)
+	return ok
+}
+
+// IsSortedBySeries returns true if the rows of the row group are sorted by labels and
+// series ID, as written with SortBySeries, so that the chunks of each series are contiguous.
+func IsSortedBySeries(rowGroup parquet.RowGroup) bool {
+	for _, column := range rowGroup.SortingColumns() {
+		switch column.Path()[0] {
+		case schema.SeriesIDColumn:
+			return true
+		case schema.MinTColumn, schema.MaxTColumn:
+			return false
+		}
+	}
+	return false
+}
+
 func CompareColumns(aName string, bName string) bool {
 	if aName == labels.MetricName {
 		return true
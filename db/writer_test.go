@@ -1,10 +1,12 @@
 package db_test
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
@@ -48,12 +50,15 @@ func TestWriter(t *testing.T) {
 
 			for _, row := range rows[:n] {
 				expectedInstance := rowID % len(instanceValues)
-				require.Equal(t, row[4].String(), "http_requests_total")
-				require.Equal(t, row[5].String(), instanceValues[expectedInstance])
-				require.Equal(t, row[6].String(), "api-server")
-				chk, err := chunkenc.FromData(chunkenc.EncXOR, row[schema.ChunkPos].ByteArray())
+				require.Equal(t, row[7].String(), "http_requests_total")
+				require.Equal(t, row[8].String(), instanceValues[expectedInstance])
+				require.Equal(t, row[9].String(), "api-server")
+				encoding := chunkenc.Encoding(row[schema.ChunkEncodingPos].Int32())
+				require.Equal(t, chunkenc.EncXOR, encoding)
+				chk, err := chunkenc.FromData(encoding, row[schema.ChunkPos].ByteArray())
 				require.NoError(t, err)
 				require.Equal(t, 120, chk.NumSamples())
+				require.Equal(t, int64(120), row[schema.NumSamplesPos].Int64())
 
 				rowID++
 			}
@@ -62,8 +67,125 @@ func TestWriter(t *testing.T) {
 	}
 }
 
+func TestWriterSplitLayout(t *testing.T) {
+	instanceValues := []string{"abc", "def", "ghi", "jke"}
+	chunkSeries := make([]storage.ChunkSeries, 0, len(instanceValues))
+	for _, instanceVal := range instanceValues {
+		instanceSeries := newSeries(t, 3, labels.MetricName, "http_requests_total", "job", "api-server", "instance", instanceVal)
+		chunkSeries = append(chunkSeries, instanceSeries)
+	}
+
+	dir := createParquetFile(t, chunkSeries, db.WithSplitLayout())
+
+	labelsFile, err := openParquetPart(dir, "compact.labels")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(instanceValues)), labelsFile.NumRows())
+	rows := make([]parquet.Row, len(instanceValues))
+	n, err := labelsFile.RowGroups()[0].Rows().ReadRows(rows)
+	if err != io.EOF {
+		require.NoError(t, err)
+	}
+	require.Equal(t, len(instanceValues), n)
+	for i, row := range rows {
+		require.Len(t, row, 5)
+		require.Equal(t, int64(i), row[0].Int64())
+		require.Equal(t, "http_requests_total", row[2].String())
+		require.Equal(t, instanceValues[i], row[3].String())
+		require.Equal(t, "api-server", row[4].String())
+	}
+
+	chunksFile, err := openParquetPart(dir, "compact")
+	require.NoError(t, err)
+	require.Len(t, chunksFile.Schema().Columns(), 6)
+	_, ok := chunksFile.Schema().Lookup(schema.ChunkBytesColumn)
+	require.True(t, ok)
+	_, ok = chunksFile.Schema().Lookup(labels.MetricName)
+	require.False(t, ok)
+}
+
+func TestWriterSplitLayoutParts(t *testing.T) {
+	series := []map[string]string{
+		{labels.MetricName: "http_requests_total", "instance": "abc"},
+		{labels.MetricName: "http_requests_total", "instance": "def"},
+	}
+	dir := t.TempDir()
+	writer, err := db.NewWriter(dir, []string{labels.MetricName, "instance"}, db.WithSplitLayout())
+	require.NoError(t, err)
+	// Each part has a chunk of each series, so each part has a labels row for each series.
+	for part := int64(0); part < 3; part++ {
+		for i, lbls := range series {
+			require.NoError(t, writer.Write([]schema.Chunk{
+				{Labels: lbls, SeriesID: int64(i), MinT: part * 10, MaxT: part*10 + 10, ChunkBytes: []byte{0}},
+			}))
+		}
+		require.NoError(t, writer.Flush())
+	}
+	require.NoError(t, writer.Close())
+	partFile, err := openParquetPart(dir, "part.2.labels")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(series)), partFile.NumRows())
+	require.NoError(t, writer.Compact())
+
+	labelsFile, err := openParquetPart(dir, "compact.labels")
+	require.NoError(t, err)
+	require.Equal(t, int64(len(series)), labelsFile.NumRows())
+	chunksFile, err := openParquetPart(dir, "compact")
+	require.NoError(t, err)
+	require.Equal(t, int64(3*len(series)), chunksFile.NumRows())
+}
+
+func TestWriterByteArrayStatistics(t *testing.T) {
+	instanceValues := []string{"abc", "def", "ghi", "jke", "lmn"}
+	chunkSeries := make([]storage.ChunkSeries, 0, len(instanceValues))
+	for _, instanceVal := range instanceValues {
+		chunkSeries = append(chunkSeries, newSeries(t, 1, labels.MetricName, "http_requests_total", "instance", instanceVal))
+	}
+	dir := createParquetFile(t, chunkSeries, db.WithRowGroupRows(2))
+	pqFile, err := openParquetFile(dir)
+	require.NoError(t, err)
+	require.Len(t, pqFile.RowGroups(), 3)
+	_, ok := pqFile.Lookup(db.ByteArrayStatisticsKey)
+	require.True(t, ok)
+
+	// The statistics of each row group match its values, and are not overwritten by the following row groups.
+	for i, rowGroup := range pqFile.RowGroups() {
+		rows := make([]parquet.Row, rowGroup.NumRows())
+		n, err := rowGroup.Rows().ReadRows(rows)
+		if err != io.EOF {
+			require.NoError(t, err)
+		}
+		require.Equal(t, len(rows), n)
+
+		for _, column := range pqFile.Schema().Columns() {
+			leaf, _ := pqFile.Schema().Lookup(column...)
+			switch leaf.Node.Type().Kind() {
+			case parquet.ByteArray, parquet.FixedLenByteArray:
+			default:
+				continue
+			}
+			var minValue, maxValue string
+			for j, row := range rows {
+				value := string(row[leaf.ColumnIndex].ByteArray())
+				if j == 0 || value < minValue {
+					minValue = value
+				}
+				if j == 0 || value > maxValue {
+					maxValue = value
+				}
+			}
+			statistics := pqFile.Metadata().RowGroups[i].Columns[leaf.ColumnIndex].MetaData.Statistics
+			require.Equal(t, minValue, string(statistics.MinValue), "row group %d, column %s", i, column)
+			require.Equal(t, maxValue, string(statistics.MaxValue), "row group %d, column %s", i, column)
+		}
+	}
+}
+
 func openParquetFile(dir string) (*parquet.File, error) {
-	fpath := path.Join(dir, "compact.parquet")
+	return openParquetPart(dir, "compact")
+}
+
+func openParquetPart(dir string, partName string) (*parquet.File, error) {
+	fpath := path.Join(dir, partName+".parquet")
 	file, err := os.Open(fpath)
 	if err != nil {
 		return nil, err
@@ -81,7 +203,7 @@ func openParquetFile(dir string) (*parquet.File, error) {
 	return pqFile, nil
 }
 
-func createParquetFile(t testing.TB, series []storage.ChunkSeries) string {
+func createParquetFile(t testing.TB, series []storage.ChunkSeries, opts ...db.WriterOption) string {
 	allLabels := make(map[string]struct{})
 	for _, chunkSeries := range series {
 		for lblName := range chunkSeries.Labels().Map() {
@@ -90,7 +212,8 @@ func createParquetFile(t testing.TB, series []storage.ChunkSeries) string {
 	}
 
 	dir := t.TempDir()
-	writer := db.NewWriter(dir, maps.Keys(allLabels))
+	writer, err := db.NewWriter(dir, maps.Keys(allLabels), opts...)
+	require.NoError(t, err)
 	for i, chunkSeries := range series {
 		seriesChunks, err := storage.ExpandChunks(chunkSeries.Iterator(nil))
 		require.NoError(t, err)
@@ -104,6 +227,8 @@ func createParquetFile(t testing.TB, series []storage.ChunkSeries) string {
 				MinT:       chk.MinTime,
 				MaxT:       chk.MaxTime,
 				ChunkBytes: chk.Chunk.Bytes(),
+				Encoding:   chk.Chunk.Encoding(),
+				NumSamples: int64(chk.Chunk.NumSamples()),
 			}
 			chunkRows = append(chunkRows, chunkRow)
 		}
@@ -149,3 +274,122 @@ func makeChunk(tb testing.TB, ts int64, val float64) (*chunkenc.XORChunk, int64,
 	}
 	return chunk, ts, val
 }
+
+func TestWriterRowGroupLimits(t *testing.T) {
+	const (
+		numSeries = 4
+		numChunks = 6
+		oneHour   = int64(time.Hour / time.Millisecond)
+	)
+	chunkRows := make([]schema.Chunk, 0, numSeries*numChunks)
+	for i := 0; i < numSeries; i++ {
+		for j := 0; j < numChunks; j++ {
+			chunkRows = append(chunkRows, schema.Chunk{
+				Labels:     map[string]string{labels.MetricName: "http_requests_total", "instance": fmt.Sprintf("%d", i)},
+				SeriesID:   int64(i),
+				MinT:       int64(j) * oneHour / 2,
+				MaxT:       int64(j+1) * oneHour / 2,
+				ChunkBytes: make([]byte, 100),
+			})
+		}
+	}
+
+	cases := []struct {
+		name              string
+		opts              []db.WriterOption
+		expectedRowGroups []int64
+		timeAligned       bool
+	}{
+		{
+			name:              "no limits",
+			expectedRowGroups: []int64{24},
+		},
+		{
+			name:              "row limit",
+			opts:              []db.WriterOption{db.WithRowGroupRows(10)},
+			expectedRowGroups: []int64{10, 10, 4},
+		},
+		{
+			name:              "byte limit",
+			opts:              []db.WriterOption{db.WithRowGroupBytes(1000)},
+			expectedRowGroups: []int64{6, 6, 6, 6},
+		},
+		{
+			name:              "dictionary limit",
+			opts:              []db.WriterOption{db.WithMaxDictionarySize(12)},
+			expectedRowGroups: []int64{2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2},
+		},
+		{
+			name:              "time aligned",
+			opts:              []db.WriterOption{db.WithTimeAlignedRowGroups(time.Hour)},
+			expectedRowGroups: []int64{8, 8, 8},
+			timeAligned:       true,
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writer, err := db.NewWriter(dir, []string{labels.MetricName, "instance"}, tcase.opts...)
+			require.NoError(t, err)
+			// Write chunks in two parts to exercise compaction.
+			require.NoError(t, writer.Write(chunkRows[:len(chunkRows)/2]))
+			require.NoError(t, writer.Flush())
+			require.NoError(t, writer.Write(chunkRows[len(chunkRows)/2:]))
+			require.NoError(t, writer.Close())
+			require.NoError(t, writer.Compact())
+
+			pqFile, err := openParquetFile(dir)
+			require.NoError(t, err)
+			rowGroups := make([]int64, 0, len(pqFile.RowGroups()))
+			for _, rowGroup := range pqFile.RowGroups() {
+				rowGroups = append(rowGroups, rowGroup.NumRows())
+			}
+			require.Equal(t, tcase.expectedRowGroups, rowGroups)
+			// Time aligned row groups are only sorted within each time bucket.
+			require.Equal(t, !tcase.timeAligned, db.IsSortedAcrossRowGroups(pqFile))
+		})
+	}
+}
+
+func TestWriterInvalidTimeAlignment(t *testing.T) {
+	_, err := db.NewWriter(t.TempDir(), []string{labels.MetricName}, db.WithTimeAlignedRowGroups(time.Microsecond))
+	require.Error(t, err)
+}
+
+func TestWriterSeriesHash(t *testing.T) {
+	series := []storage.ChunkSeries{
+		newSeries(t, 2, labels.MetricName, "http_requests_total", "job", "api-server", "instance", "abc"),
+		newSeries(t, 2, labels.MetricName, "http_requests_total", "job", "api-server", "instance", "def"),
+		newSeries(t, 2, labels.MetricName, "up", "job", "api-server"),
+	}
+	dir := createParquetFile(t, series, db.WithRowGroupRows(2))
+	pqFile, err := openParquetFile(dir)
+	require.NoError(t, err)
+
+	hashColumn, ok := pqFile.Schema().Lookup(schema.SeriesHashColumn)
+	require.True(t, ok)
+	require.Equal(t, schema.SeriesHashPos, hashColumn.ColumnIndex)
+
+	expected := make(map[int64]schema.SeriesHash, len(series))
+	for i, s := range series {
+		expected[int64(i)] = schema.HashLabels(s.Labels())
+	}
+	for _, rowGroup := range pqFile.RowGroups() {
+		rows := make([]parquet.Row, rowGroup.NumRows())
+		_, err := rowGroup.Rows().ReadRows(rows)
+		if err != io.EOF {
+			require.NoError(t, err)
+		}
+
+		bloomFilter := rowGroup.ColumnChunks()[hashColumn.ColumnIndex].BloomFilter()
+		require.NotNil(t, bloomFilter)
+		for _, row := range rows {
+			hash := expected[row[schema.SeriesIDPos].Int64()]
+			require.Equal(t, hash[:], row[schema.SeriesHashPos].ByteArray())
+
+			found, err := bloomFilter.Check(hash.Value())
+			require.NoError(t, err)
+			require.True(t, found)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Package flight serves scans of parquet files over Arrow Flight, so that selected series
+// and chunks can be read by Arrow clients such as pyarrow or DuckDB without Prometheus.
+package flight
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/apache/arrow/go/v10/arrow"
+	arrowflight "github.com/apache/arrow/go/v10/arrow/flight"
+	"github.com/apache/arrow/go/v10/arrow/ipc"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/segmentio/parquet-go"
+	"github.com/thanos-io/objstore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"Shopify/thanos-parquet-engine/compute"
+	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/prometheus"
+)
+
+const defaultBatchSize = 32 * 1024
+
+// Ticket is a scan of a parquet file. It is serialized as JSON into the ticket of DoGet requests, for example
+//
+//	{"file": "compact", "matchers": "{__name__=\"up\"}", "mint": 0, "maxt": 3600000, "columns": ["__series__id", "__chunk_bytes"]}
+type Ticket struct {
+	// File is the name of the parquet file in the bucket without the ".parquet" suffix.
+	// Only files at the root of the bucket can be read, so it must not contain path separators or "..".
+	File string `json:"file"`
+	// Matchers is a series selector which rows must match, such as `{job="api-server"}`.
+	// All rows are selected when it is empty.
+	Matchers string `json:"matchers,omitempty"`
+	// MinT and MaxT select chunks which overlap the time range in milliseconds.
+	// They default to all time when omitted from the JSON ticket. Tickets created
+	// with NewTicket always contain both, so Go clients need to set them.
+	MinT int64 `json:"mint"`
+	MaxT int64 `json:"maxt"`
+	// Columns are the projected columns. All columns of the file are projected when it is empty.
+	Columns []string `json:"columns,omitempty"`
+}
+
+// NewTicket returns the Flight ticket for a scan.
+func NewTicket(t Ticket) (*arrowflight.Ticket, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed encoding ticket")
+	}
+	return &arrowflight.Ticket{Ticket: data}, nil
+}
+
+func parseTicket(data []byte) (Ticket, error) {
+	t := Ticket{MinT: math.MinInt64, MaxT: math.MaxInt64}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return Ticket{}, errors.Wrap(err, "failed decoding ticket")
+	}
+	if t.File == "" {
+		return Ticket{}, errors.New("ticket has no file")
+	}
+	if strings.ContainsAny(t.File, `/\`) || strings.Contains(t.File, "..") {
+		return Ticket{}, errors.Errorf("invalid file name %q", t.File)
+	}
+	return t, nil
+}
+
+type ServerOption func(*Server)
+
+// WithBatchSize sets the maximum number of rows in each streamed record batch.
+func WithBatchSize(rows int64) ServerOption {
+	return func(s *Server) {
+		s.batchSize = rows
+	}
+}
+
+// WithFileReaderOptions sets the options used to open files from the bucket.
+func WithFileReaderOptions(opts ...db.FileReaderOpt) ServerOption {
+	return func(s *Server) {
+		s.readerOpts = append(s.readerOpts, opts...)
+	}
+}
+
+// Server is a Flight service which streams the rows selected by a ticket as record batches.
+// Files are read from the bucket and must have been written together with their metadata file.
+type Server struct {
+	arrowflight.BaseFlightServer
+
+	bucket     objstore.Bucket
+	readerOpts []db.FileReaderOpt
+	batchSize  int64
+}
+
+func NewServer(bucket objstore.Bucket, opts ...ServerOption) *Server {
+	server := &Server{
+		bucket:    bucket,
+		batchSize: defaultBatchSize,
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+	return server
+}
+
+// DoGet runs the scan of the ticket and streams the projected columns of the selected rows.
+func (s *Server) DoGet(tkt *arrowflight.Ticket, stream arrowflight.FlightService_DoGetServer) error {
+	ticket, err := parseTicket(tkt.GetTicket())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	matchers, err := parseMatchers(ticket.Matchers)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	reader, err := db.NewFileReader(ticket.File, s.bucket, s.readerOpts...)
+	if err != nil {
+		return status.Error(codes.NotFound, errors.Wrap(err, "failed opening file").Error())
+	}
+	defer reader.Close()
+	pqFile, err := parquet.OpenFile(reader, reader.FileSize(), parquet.ReadBufferSize(db.ReadBufferSize))
+	if err != nil {
+		return errors.Wrap(err, "failed opening parquet file")
+	}
+
+	columns := ticket.Columns
+	if len(columns) == 0 {
+		for _, path := range pqFile.Schema().Columns() {
+			columns = append(columns, path[0])
+		}
+	}
+	schema, err := recordSchema(pqFile, columns)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	opts := append(prometheus.MatcherOptions(matchers), compute.TimeRangeOverlaps(ticket.MinT, ticket.MaxT))
+	selections, err := compute.NewScanner(pqFile, reader.SectionLoader(), opts...).Select()
+	if err != nil {
+		return errors.Wrap(err, "failed scanning file")
+	}
+
+	writer := arrowflight.NewRecordWriter(stream, ipc.WithSchema(schema))
+	defer writer.Close()
+	for _, selection := range selections {
+		if selection.NumRows() == 0 {
+			continue
+		}
+		projection, err := compute.ProjectRecords(selection, reader.SectionLoader(), s.batchSize, columns...)
+		if err != nil {
+			return errors.Wrap(err, "failed projecting columns")
+		}
+		records := compute.NewRecordReader(projection)
+		for records.Next() {
+			if err := writer.Write(records.Record()); err != nil {
+				records.Release()
+				return errors.Wrap(err, "failed writing record")
+			}
+		}
+		err = records.Err()
+		records.Release()
+		if err != nil {
+			return errors.Wrap(err, "failed reading records")
+		}
+	}
+	return nil
+}
+
+func parseMatchers(selector string) ([]*labels.Matcher, error) {
+	if selector == "" {
+		return nil, nil
+	}
+	return parser.ParseMetricSelector(selector)
+}
+
+// recordSchema returns the schema of records with the given columns of the file.
+func recordSchema(pqFile *parquet.File, columns []string) (*arrow.Schema, error) {
+	fields := make([]arrow.Field, 0, len(columns))
+	for _, name := range columns {
+		column, ok := pqFile.Schema().Lookup(name)
+		if !ok {
+			return nil, errors.Errorf("column %s does not exist", name)
+		}
+		field, err := compute.ArrowField(column)
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, field)
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
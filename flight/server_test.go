@@ -0,0 +1,157 @@
+package flight
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/apache/arrow/go/v10/arrow"
+	"github.com/apache/arrow/go/v10/arrow/array"
+	arrowflight "github.com/apache/arrow/go/v10/arrow/flight"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/stretchr/testify/require"
+	"github.com/thanos-io/objstore/providers/filesystem"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+func TestServerDoGet(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "instance", "abc"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "instance", "def"),
+		labels.FromStrings(labels.MetricName, "up", "instance", "abc"),
+	}
+	dir := t.TempDir()
+	writer, err := db.NewWriter(dir, []string{labels.MetricName, "instance"})
+	require.NoError(t, err)
+	for i, s := range series {
+		require.NoError(t, writer.Write([]schema.Chunk{
+			{Labels: s.Map(), SeriesID: int64(i), MinT: 0, MaxT: 60_000, ChunkBytes: []byte{byte(i), 0}},
+			{Labels: s.Map(), SeriesID: int64(i), MinT: 60_000, MaxT: 120_000, ChunkBytes: []byte{byte(i), 1}},
+		}))
+	}
+	require.NoError(t, writer.Close())
+	require.NoError(t, writer.Compact())
+
+	bucket, err := filesystem.NewBucket(dir)
+	require.NoError(t, err)
+	server := arrowflight.NewServerWithMiddleware(nil)
+	server.RegisterFlightService(NewServer(bucket, WithBatchSize(2), WithFileReaderOptions(db.WithSectionCacheDir(t.TempDir()))))
+	require.NoError(t, server.Init("localhost:0"))
+	go server.Serve()
+	defer server.Shutdown()
+
+	client, err := arrowflight.NewClientWithMiddleware(server.Addr().String(), nil, nil, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer client.Close()
+
+	cases := []struct {
+		name     string
+		ticket   Ticket
+		expected [][]string
+	}{
+		{
+			name: "matchers and time range",
+			ticket: Ticket{
+				File:     "compact",
+				Matchers: `{__name__="http_requests_total"}`,
+				MinT:     70_000,
+				MaxT:     130_000,
+				Columns:  []string{"instance", schema.SeriesIDColumn, schema.ChunkBytesColumn},
+			},
+			expected: [][]string{
+				{"abc", "0", "\x00\x01"},
+				{"def", "1", "\x01\x01"},
+			},
+		},
+		{
+			name: "all rows",
+			ticket: Ticket{
+				File:    "compact",
+				MinT:    math.MinInt64,
+				MaxT:    math.MaxInt64,
+				Columns: []string{labels.MetricName, schema.SeriesIDColumn},
+			},
+			expected: [][]string{
+				{"http_requests_total", "0"},
+				{"http_requests_total", "1"},
+				{"http_requests_total", "0"},
+				{"http_requests_total", "1"},
+				{"up", "2"},
+				{"up", "2"},
+			},
+		},
+		{
+			name: "no matching rows",
+			ticket: Ticket{
+				File:     "compact",
+				Matchers: `{instance="ghi"}`,
+				MinT:     math.MinInt64,
+				MaxT:     math.MaxInt64,
+				Columns:  []string{labels.MetricName},
+			},
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			ticket, err := NewTicket(tcase.ticket)
+			require.NoError(t, err)
+			stream, err := client.DoGet(context.Background(), ticket)
+			require.NoError(t, err)
+			reader, err := arrowflight.NewRecordReader(stream)
+			require.NoError(t, err)
+			defer reader.Release()
+			require.Len(t, reader.Schema().Fields(), len(tcase.ticket.Columns))
+
+			var rows [][]string
+			for reader.Next() {
+				rows = append(rows, recordRows(reader.Record())...)
+			}
+			require.NoError(t, reader.Err())
+			require.Equal(t, tcase.expected, rows)
+		})
+	}
+
+	t.Run("invalid ticket", func(t *testing.T) {
+		for _, ticket := range []string{`{`, `{"matchers": "{job=\"a\"}"}`, `{"file": "compact", "matchers": "{"}`, `{"file": "compact", "columns": ["missing"]}`,
+			`{"file": "../compact"}`, `{"file": "dir/compact"}`, `{"file": ".."}`,
+		} {
+			stream, err := client.DoGet(context.Background(), &arrowflight.Ticket{Ticket: []byte(ticket)})
+			require.NoError(t, err)
+			_, err = stream.Recv()
+			require.Equal(t, codes.InvalidArgument, status.Code(err), ticket)
+		}
+	})
+}
+
+// recordRows returns the values of each row of the record as strings.
+func recordRows(record arrow.Record) [][]string {
+	rows := make([][]string, record.NumRows())
+	for i := range rows {
+		for _, column := range record.Columns() {
+			rows[i] = append(rows[i], valueString(column, i))
+		}
+	}
+	return rows
+}
+
+func valueString(column arrow.Array, i int) string {
+	switch column := column.(type) {
+	case *array.Dictionary:
+		return valueString(column.Dictionary(), column.GetValueIndex(i))
+	case *array.String:
+		return column.Value(i)
+	case *array.Binary:
+		return string(column.Value(i))
+	case *array.Int64:
+		return strconv.FormatInt(column.Value(i), 10)
+	default:
+		return column.String()
+	}
+}
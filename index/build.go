@@ -0,0 +1,100 @@
+package index
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/segmentio/parquet-go"
+
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+// Build creates a series index by reading the series ID and label columns of a parquet file.
+// Chunk columns are not read.
+func Build(file *parquet.File) (*Index, error) {
+	seriesID, ok := file.Schema().Lookup(schema.SeriesIDColumn)
+	if !ok {
+		return nil, errors.New("file does not contain a series ID column")
+	}
+	var labelColumns []parquet.LeafColumn
+	for _, path := range file.Schema().Columns() {
+		if schema.IsChunkColumn(path[0]) {
+			continue
+		}
+		column, _ := file.Schema().Lookup(path...)
+		labelColumns = append(labelColumns, column)
+	}
+
+	series := make(map[int64]*Series)
+	for i, rowGroup := range file.RowGroups() {
+		chunks := rowGroup.ColumnChunks()
+		ids := make([]int64, 0, rowGroup.NumRows())
+		if err := readColumn(chunks[seriesID.ColumnIndex], func(value parquet.Value) {
+			ids = append(ids, value.Int64())
+		}); err != nil {
+			return nil, errors.Wrap(err, "failed reading series IDs")
+		}
+
+		for row, id := range ids {
+			s, ok := series[id]
+			if !ok {
+				s = &Series{ID: id}
+				series[id] = s
+			}
+			if n := len(s.Rows); n > 0 && s.Rows[n-1].RowGroup == i && s.Rows[n-1].To == int64(row) {
+				s.Rows[n-1].To++
+				continue
+			}
+			s.Rows = append(s.Rows, SeriesRows{
+				RowGroup: i,
+				RowRange: RowRange{From: int64(row), To: int64(row) + 1},
+			})
+		}
+
+		for _, column := range labelColumns {
+			row := 0
+			if err := readColumn(chunks[column.ColumnIndex], func(value parquet.Value) {
+				s := series[ids[row]]
+				row++
+				// Labels are the same in all chunks of a series.
+				if value.IsNull() || len(value.ByteArray()) == 0 || s.Labels.Has(column.Path[0]) {
+					return
+				}
+				s.Labels = append(s.Labels, labels.Label{Name: column.Path[0], Value: value.String()})
+			}); err != nil {
+				return nil, errors.Wrap(err, "failed reading label column "+column.Path[0])
+			}
+		}
+	}
+
+	result := make([]Series, 0, len(series))
+	for _, s := range series {
+		s.Labels = labels.New(s.Labels...)
+		result = append(result, *s)
+	}
+	return newIndex(len(file.RowGroups()), result), nil
+}
+
+func readColumn(chunk parquet.ColumnChunk, f func(value parquet.Value)) error {
+	pages := chunk.Pages()
+	defer pages.Close()
+
+	for {
+		page, err := pages.ReadPage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		values := make([]parquet.Value, page.NumValues())
+		n, err := page.Values().ReadValues(values)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		for _, value := range values[:n] {
+			f(value)
+		}
+	}
+}
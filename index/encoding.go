@@ -0,0 +1,211 @@
+package index
+
+import (
+	"hash/crc32"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// MagicIndex is the first 4 bytes of an encoded series index.
+	MagicIndex = 0x5E1E5D1C
+
+	formatVersion = 1
+	checksumSize  = 4
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Encode returns the binary representation of the index.
+//
+// The index starts with a header containing the magic number, the format version and
+// the number of row groups. It is followed by a symbol table with all label names and values,
+// the series with their labels as symbol references and their row ranges,
+// and the postings list for each label name and value as delta encoded series IDs.
+// The last 4 bytes are a CRC32 checksum of everything before them.
+func (i *Index) Encode() []byte {
+	symbols, symbolRefs := i.symbols()
+
+	var buf encoding.Encbuf
+	buf.PutBE32(MagicIndex)
+	buf.PutByte(formatVersion)
+	buf.PutUvarint(i.numRowGroups)
+
+	buf.PutUvarint(len(symbols))
+	for _, symbol := range symbols {
+		buf.PutUvarintStr(symbol)
+	}
+
+	buf.PutUvarint(len(i.series))
+	for _, s := range i.series {
+		buf.PutVarint64(s.ID)
+		buf.PutUvarint(len(s.Labels))
+		for _, l := range s.Labels {
+			buf.PutUvarint(symbolRefs[l.Name])
+			buf.PutUvarint(symbolRefs[l.Value])
+		}
+		buf.PutUvarint(len(s.Rows))
+		for _, rows := range s.Rows {
+			buf.PutUvarint(rows.RowGroup)
+			buf.PutUvarint64(uint64(rows.From))
+			buf.PutUvarint64(uint64(rows.To - rows.From))
+		}
+	}
+
+	names := make([]string, 0, len(i.postings))
+	for name := range i.postings {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	buf.PutUvarint(len(names))
+	for _, name := range names {
+		values := i.LabelValues(name)
+		buf.PutUvarint(symbolRefs[name])
+		buf.PutUvarint(len(values))
+		for _, value := range values {
+			ids := i.postings[name][value]
+			buf.PutUvarint(symbolRefs[value])
+			buf.PutUvarint(len(ids))
+			var prev int64
+			for _, id := range ids {
+				buf.PutVarint64(id - prev)
+				prev = id
+			}
+		}
+	}
+
+	buf.PutBE32(crc32.Checksum(buf.Get(), castagnoliTable))
+	return buf.Get()
+}
+
+// Decode reads an index from its binary representation.
+func Decode(b []byte) (*Index, error) {
+	if len(b) < checksumSize {
+		return nil, errors.New("index is too short")
+	}
+	content := b[:len(b)-checksumSize]
+	checksum := encoding.Decbuf{B: b[len(b)-checksumSize:]}
+	if crc32.Checksum(content, castagnoliTable) != checksum.Be32() {
+		return nil, errors.New("index checksum mismatch")
+	}
+
+	buf := encoding.Decbuf{B: content}
+	if magic := buf.Be32(); magic != MagicIndex {
+		return nil, errors.Errorf("invalid index magic number %x", magic)
+	}
+	if version := buf.Byte(); version != formatVersion {
+		return nil, errors.Errorf("unsupported index version %d", version)
+	}
+	numRowGroups := buf.Uvarint()
+
+	// Symbols take at least one byte for their length.
+	symbols := make([]string, readLength(&buf, 1))
+	for j := range symbols {
+		symbols[j] = buf.UvarintStr()
+	}
+	symbol := func() string {
+		ref := buf.Uvarint()
+		if ref >= len(symbols) {
+			buf.E = errors.Errorf("invalid symbol reference %d", ref)
+			return ""
+		}
+		return symbols[ref]
+	}
+
+	// Series take at least one byte for their ID, and one for each of their number of labels and rows.
+	series := make([]Series, readLength(&buf, 3))
+	for j := range series {
+		series[j].ID = buf.Varint64()
+		// Labels take at least one byte for each symbol reference of their name and value.
+		series[j].Labels = make(labels.Labels, readLength(&buf, 2))
+		for k := range series[j].Labels {
+			series[j].Labels[k].Name = symbol()
+			series[j].Labels[k].Value = symbol()
+		}
+		// Rows take at least one byte for their row group, first row and number of rows.
+		series[j].Rows = make([]SeriesRows, readLength(&buf, 3))
+		for k := range series[j].Rows {
+			rows := &series[j].Rows[k]
+			rows.RowGroup = buf.Uvarint()
+			rows.From = int64(buf.Uvarint64())
+			rows.To = rows.From + int64(buf.Uvarint64())
+			if rows.RowGroup >= numRowGroups {
+				return nil, errors.Errorf("invalid row group %d for series %d", rows.RowGroup, series[j].ID)
+			}
+		}
+		if buf.Err() != nil {
+			return nil, errors.Wrap(buf.Err(), "failed decoding series")
+		}
+	}
+
+	postings := make(map[string]map[string][]int64)
+	// Label names take at least one byte for their symbol reference and their number of values,
+	// and so do label values for their symbol reference and their number of series.
+	numNames := readLength(&buf, 2)
+	for j := 0; j < numNames; j++ {
+		name := symbol()
+		values := make(map[string][]int64)
+		numValues := readLength(&buf, 2)
+		for k := 0; k < numValues; k++ {
+			value := symbol()
+			ids := make([]int64, readLength(&buf, 1))
+			var prev int64
+			for l := range ids {
+				ids[l] = prev + buf.Varint64()
+				prev = ids[l]
+			}
+			values[value] = ids
+		}
+		postings[name] = values
+		if buf.Err() != nil {
+			return nil, errors.Wrap(buf.Err(), "failed decoding postings")
+		}
+	}
+	if buf.Err() != nil {
+		return nil, errors.Wrap(buf.Err(), "failed decoding index")
+	}
+
+	return &Index{
+		numRowGroups: numRowGroups,
+		series:       series,
+		postings:     postings,
+	}, nil
+}
+
+// readLength reads the number of items which follow in the buffer. Since each item takes at least
+// minSize bytes, the number is invalid if they do not fit into the rest of the buffer.
+// This prevents large allocations for corrupted lengths.
+func readLength(buf *encoding.Decbuf, minSize int) int {
+	n := buf.Uvarint()
+	if buf.Err() != nil {
+		return 0
+	}
+	if n < 0 || n > buf.Len()/minSize {
+		buf.E = errors.Errorf("invalid length %d with %d bytes left", n, buf.Len())
+		return 0
+	}
+	return n
+}
+
+// symbols returns the sorted label names and values in the index, and the position of each of them.
+func (i *Index) symbols() ([]string, map[string]int) {
+	refs := make(map[string]int)
+	for name, values := range i.postings {
+		refs[name] = 0
+		for value := range values {
+			refs[value] = 0
+		}
+	}
+	symbols := make([]string, 0, len(refs))
+	for symbol := range refs {
+		symbols = append(symbols, symbol)
+	}
+	slices.Sort(symbols)
+	for j, symbol := range symbols {
+		refs[symbol] = j
+	}
+	return symbols, refs
+}
@@ -0,0 +1,190 @@
+package index
+
+import (
+	"sort"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"golang.org/x/exp/slices"
+)
+
+// RowRange is a range of rows [From, To) inside a single row group.
+type RowRange struct {
+	From int64
+	To   int64
+}
+
+// SeriesRows is a range of rows containing chunks of a series.
+type SeriesRows struct {
+	RowGroup int
+	RowRange
+}
+
+// Series is a single series stored in a parquet file.
+type Series struct {
+	ID     int64
+	Labels labels.Labels
+	Rows   []SeriesRows
+}
+
+// Index is a series index for a single parquet file. It maps each series
+// to its labels and to the rows which contain its chunks, and holds postings
+// for each label name and value, similar to the TSDB index.
+// Label matchers can then be resolved into row ranges without reading any label columns.
+type Index struct {
+	numRowGroups int
+	series       []Series
+	postings     map[string]map[string][]int64
+}
+
+func newIndex(numRowGroups int, series []Series) *Index {
+	slices.SortFunc(series, func(a, b Series) bool {
+		return a.ID < b.ID
+	})
+	postings := make(map[string]map[string][]int64)
+	for _, s := range series {
+		for _, l := range s.Labels {
+			values, ok := postings[l.Name]
+			if !ok {
+				values = make(map[string][]int64)
+				postings[l.Name] = values
+			}
+			values[l.Value] = append(values[l.Value], s.ID)
+		}
+	}
+	return &Index{
+		numRowGroups: numRowGroups,
+		series:       series,
+		postings:     postings,
+	}
+}
+
+// NumSeries returns the number of series in the index.
+func (i *Index) NumSeries() int {
+	return len(i.series)
+}
+
+// Series returns the series with the given ID.
+func (i *Index) Series(id int64) (Series, bool) {
+	pos := sort.Search(len(i.series), func(j int) bool {
+		return i.series[j].ID >= id
+	})
+	if pos == len(i.series) || i.series[pos].ID != id {
+		return Series{}, false
+	}
+	return i.series[pos], true
+}
+
+// LabelValues returns the sorted values of a label.
+func (i *Index) LabelValues(name string) []string {
+	values := make([]string, 0, len(i.postings[name]))
+	for value := range i.postings[name] {
+		values = append(values, value)
+	}
+	slices.Sort(values)
+	return values
+}
+
+// Postings returns the sorted IDs of series which match all matchers.
+func (i *Index) Postings(matchers ...*labels.Matcher) []int64 {
+	postings := i.allPostings()
+	for _, m := range matchers {
+		postings = intersect(postings, i.matcherPostings(m))
+	}
+	return postings
+}
+
+// RowRanges returns the sorted and merged row ranges of the given series in each row group.
+func (i *Index) RowRanges(ids []int64) [][]RowRange {
+	rowGroups := make([][]RowRange, i.numRowGroups)
+	for _, id := range ids {
+		s, ok := i.Series(id)
+		if !ok {
+			continue
+		}
+		for _, rows := range s.Rows {
+			rowGroups[rows.RowGroup] = append(rowGroups[rows.RowGroup], rows.RowRange)
+		}
+	}
+	for j, ranges := range rowGroups {
+		rowGroups[j] = mergeRanges(ranges)
+	}
+	return rowGroups
+}
+
+func (i *Index) allPostings() []int64 {
+	postings := make([]int64, 0, len(i.series))
+	for _, s := range i.series {
+		postings = append(postings, s.ID)
+	}
+	return postings
+}
+
+func (i *Index) matcherPostings(m *labels.Matcher) []int64 {
+	// Series without the label have an empty value for it, so when the matcher
+	// matches the empty value we remove series with non-matching values instead.
+	matchesEmpty := m.Matches("")
+	var postings []int64
+	for value, ids := range i.postings[m.Name] {
+		if m.Matches(value) != matchesEmpty {
+			postings = append(postings, ids...)
+		}
+	}
+	slices.Sort(postings)
+	if matchesEmpty {
+		return subtract(i.allPostings(), postings)
+	}
+	return postings
+}
+
+func intersect(a, b []int64) []int64 {
+	result := make([]int64, 0, len(a))
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+func subtract(a, b []int64) []int64 {
+	result := make([]int64, 0, len(a))
+	j := 0
+	for _, id := range a {
+		for j < len(b) && b[j] < id {
+			j++
+		}
+		if j < len(b) && b[j] == id {
+			continue
+		}
+		result = append(result, id)
+	}
+	return result
+}
+
+func mergeRanges(ranges []RowRange) []RowRange {
+	if len(ranges) == 0 {
+		return ranges
+	}
+	slices.SortFunc(ranges, func(a, b RowRange) bool {
+		return a.From < b.From
+	})
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.From > last.To {
+			merged = append(merged, r)
+			continue
+		}
+		if r.To > last.To {
+			last.To = r.To
+		}
+	}
+	return merged
+}
@@ -0,0 +1,103 @@
+package index
+
+import (
+	"hash/crc32"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostings(t *testing.T) {
+	idx := newIndex(2, []Series{
+		{ID: 2, Labels: labels.FromStrings("job", "kubelet", "instance", "0"), Rows: []SeriesRows{{0, RowRange{2, 3}}}},
+		{ID: 0, Labels: labels.FromStrings("job", "api-server", "instance", "0"), Rows: []SeriesRows{{0, RowRange{0, 1}}, {1, RowRange{0, 1}}}},
+		{ID: 1, Labels: labels.FromStrings("job", "api-server", "instance", "1", "zone", "a"), Rows: []SeriesRows{{0, RowRange{1, 2}}, {1, RowRange{1, 3}}}},
+	})
+
+	cases := []struct {
+		name     string
+		matchers []*labels.Matcher
+		expected []int64
+	}{
+		{
+			name:     "no matchers",
+			expected: []int64{0, 1, 2},
+		},
+		{
+			name:     "equal",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "api-server")},
+			expected: []int64{0, 1},
+		},
+		{
+			name: "multiple matchers",
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, "job", "api-server"),
+				labels.MustNewMatcher(labels.MatchRegexp, "instance", "1|2"),
+			},
+			expected: []int64{1},
+		},
+		{
+			name:     "not equal",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchNotEqual, "job", "api-server")},
+			expected: []int64{2},
+		},
+		{
+			name:     "not equal on missing label",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchNotEqual, "zone", "a")},
+			expected: []int64{0, 2},
+		},
+		{
+			name:     "empty value",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "zone", "")},
+			expected: []int64{0, 2},
+		},
+		{
+			name:     "no matching series",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "node")},
+			expected: []int64{},
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			require.Equal(t, tcase.expected, idx.Postings(tcase.matchers...))
+		})
+	}
+
+	require.Equal(t, [][]RowRange{{{0, 2}}, {{0, 3}}}, idx.RowRanges([]int64{0, 1}))
+	require.Equal(t, [][]RowRange{{{2, 3}}, nil}, idx.RowRanges([]int64{2}))
+}
+
+func TestEncodeDecode(t *testing.T) {
+	idx := newIndex(2, []Series{
+		{ID: 0, Labels: labels.FromStrings("job", "api-server", "instance", "0"), Rows: []SeriesRows{{0, RowRange{0, 1}}, {1, RowRange{4, 10}}}},
+		{ID: 1, Labels: labels.FromStrings("job", "api-server", "instance", "1"), Rows: []SeriesRows{{0, RowRange{1, 2}}}},
+		{ID: 5, Labels: labels.FromStrings("job", "kubelet", "instance", "0"), Rows: []SeriesRows{{1, RowRange{0, 4}}}},
+	})
+
+	encoded := idx.Encode()
+	decoded, err := Decode(encoded)
+	require.NoError(t, err)
+	require.Equal(t, idx, decoded)
+
+	encoded[len(encoded)/2]++
+	_, err = Decode(encoded)
+	require.Error(t, err)
+}
+
+func TestDecodeInvalidLength(t *testing.T) {
+	// Lengths which do not fit into the index are rejected even if the checksum is valid.
+	for _, numItems := range []uint64{1 << 62, 1 << 40, 3} {
+		var buf encoding.Encbuf
+		buf.PutBE32(MagicIndex)
+		buf.PutByte(formatVersion)
+		buf.PutUvarint(1)
+		buf.PutUvarint64(numItems)
+		buf.PutUvarintStr("job")
+		buf.PutBE32(crc32.Checksum(buf.Get(), castagnoliTable))
+
+		_, err := Decode(buf.Get())
+		require.Error(t, err)
+	}
+}
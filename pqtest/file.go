@@ -20,6 +20,15 @@ func TwoColumnRow(columnA string, columnB string) Row {
 }
 
 func CreateFile(parts [][]Row) (*parquet.File, error) {
+	return createFile(parts, false)
+}
+
+// CreateFileWithRowGroups creates a file where each part is written as a separate row group.
+func CreateFileWithRowGroups(rowGroups [][]Row) (*parquet.File, error) {
+	return createFile(rowGroups, true)
+}
+
+func createFile(parts [][]Row, flushParts bool) (*parquet.File, error) {
 	var buffer bytes.Buffer
 	writer := parquet.NewGenericWriter[Row](&buffer,
 		parquet.PageBufferSize(4),
@@ -30,6 +39,12 @@ func CreateFile(parts [][]Row) (*parquet.File, error) {
 		if err != nil {
 			return nil, err
 		}
+		if !flushParts {
+			continue
+		}
+		if err := writer.Flush(); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := writer.Close(); err != nil {
@@ -0,0 +1,238 @@
+package prometheus
+
+import (
+	"context"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	promparser "github.com/prometheus/prometheus/promql/parser"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/util/stats"
+	"github.com/thanos-io/promql-engine/logicalplan"
+	"github.com/thanos-io/promql-engine/parser"
+	"golang.org/x/exp/slices"
+
+	"Shopify/thanos-parquet-engine/compute"
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+// defaultLookbackDelta is the lookback of the Prometheus engine, which is used
+// when queries do not set one.
+const defaultLookbackDelta = 5 * time.Minute
+
+// aggregateFuncs are the PromQL aggregations which are pushed down to compute.
+// They are keyed by name, since expressions are parsed by both the engine and the Prometheus parser.
+var aggregateFuncs = map[string]compute.AggregateFunc{
+	"sum":   compute.AggregateSum,
+	"count": compute.AggregateCount,
+	"min":   compute.AggregateMin,
+	"max":   compute.AggregateMax,
+	"avg":   compute.AggregateAvg,
+}
+
+type aggregationPushdown struct {
+	engine *aggregationEngine
+}
+
+// NewAggregationPushdown creates a logical optimizer for the thanos-io/promql-engine which executes
+// sum, count, min, max and avg aggregations of vector selectors, like `sum by (job) (metric)`,
+// with a hash aggregate over the chunks of the queryable, so that only aggregated series are
+// returned to the engine. Aggregations of other expressions, with `without` or with offset and @
+// modifiers are left to the engine. Queryables which are not single parquet files are not optimized.
+//
+// Aggregated chunks must be XOR encoded; queries over native histograms fail with compute.ErrUnsupportedChunkEncoding.
+func NewAggregationPushdown(queryable storage.Queryable) logicalplan.Optimizer {
+	file, ok := queryable.(*parquetFile)
+	if !ok || file.chunksFile != nil {
+		return aggregationPushdown{}
+	}
+	return aggregationPushdown{engine: &aggregationEngine{file: file}}
+}
+
+func (a aggregationPushdown) Optimize(expr parser.Expr, opts *logicalplan.Opts) parser.Expr {
+	if a.engine == nil {
+		return expr
+	}
+	a.pushdown(&expr, opts)
+	return expr
+}
+
+// pushdown replaces aggregations in the expression which can be executed by compute with remote executions.
+// Subqueries and step invariant expressions are evaluated with other steps than the query, so they are not traversed.
+func (a aggregationPushdown) pushdown(expr *parser.Expr, opts *logicalplan.Opts) {
+	switch node := (*expr).(type) {
+	case *parser.AggregateExpr:
+		if canPushdown(node) {
+			*expr = logicalplan.RemoteExecution{
+				Engine:          a.engine,
+				Query:           node.String(),
+				QueryRangeStart: opts.Start,
+			}
+			return
+		}
+		a.pushdown(&node.Expr, opts)
+	case *parser.Call:
+		for i := range node.Args {
+			a.pushdown(&node.Args[i], opts)
+		}
+	case *parser.BinaryExpr:
+		a.pushdown(&node.LHS, opts)
+		a.pushdown(&node.RHS, opts)
+	case *parser.UnaryExpr:
+		a.pushdown(&node.Expr, opts)
+	case *parser.ParenExpr:
+		a.pushdown(&node.Expr, opts)
+	}
+}
+
+func canPushdown(node *parser.AggregateExpr) bool {
+	if _, ok := aggregateFuncs[node.Op.String()]; !ok || node.Without || node.Param != nil {
+		return false
+	}
+	selector, ok := node.Expr.(*parser.VectorSelector)
+	return ok && selector.Timestamp == nil && selector.StartOrEnd == 0 && selector.OriginalOffset == 0
+}
+
+// aggregationEngine executes the aggregations which were pushed down as remote executions.
+// Aggregations can run concurrently, since readers of overlapping byte ranges load the sections they share under a lock.
+type aggregationEngine struct {
+	file *parquetFile
+}
+
+func (e *aggregationEngine) MaxT() int64                { return math.MaxInt64 }
+func (e *aggregationEngine) MinT() int64                { return math.MinInt64 }
+func (e *aggregationEngine) LabelSets() []labels.Labels { return nil }
+
+func (e *aggregationEngine) NewRangeQuery(_ context.Context, opts *promql.QueryOpts, qs string, start, end time.Time, interval time.Duration) (promql.Query, error) {
+	expr, err := promparser.ParseExpr(qs)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing aggregation %s", qs)
+	}
+	aggregate, ok := expr.(*promparser.AggregateExpr)
+	if !ok {
+		return nil, errors.Errorf("expression %s is not an aggregation", qs)
+	}
+	lookback := defaultLookbackDelta
+	if opts != nil && opts.LookbackDelta > 0 {
+		lookback = opts.LookbackDelta
+	}
+	return &aggregationQuery{
+		engine:    e,
+		aggregate: aggregate,
+		steps: compute.Steps{
+			Start:    start.UnixMilli(),
+			End:      end.UnixMilli(),
+			Interval: interval.Milliseconds(),
+			Lookback: lookback.Milliseconds(),
+		},
+	}, nil
+}
+
+type aggregationQuery struct {
+	engine    *aggregationEngine
+	aggregate *promparser.AggregateExpr
+	steps     compute.Steps
+}
+
+func (q *aggregationQuery) Exec(ctx context.Context) *promql.Result {
+	querier, err := q.engine.file.Querier(ctx, q.steps.Start-q.steps.Lookback, q.steps.End)
+	if err != nil {
+		return &promql.Result{Err: err}
+	}
+	matrix, err := querier.(*parquetFileQuerier).aggregate(q.aggregate, q.steps)
+	if err != nil {
+		return &promql.Result{Err: err}
+	}
+	return &promql.Result{Value: matrix}
+}
+
+func (q *aggregationQuery) Close()                   {}
+func (q *aggregationQuery) Stats() *stats.Statistics { return nil }
+func (q *aggregationQuery) Cancel()                  {}
+func (q *aggregationQuery) String() string           { return q.aggregate.String() }
+
+func (q *aggregationQuery) Statement() promparser.Statement {
+	return &promparser.EvalStmt{
+		Expr:          q.aggregate,
+		Start:         time.UnixMilli(q.steps.Start),
+		End:           time.UnixMilli(q.steps.End),
+		Interval:      time.Duration(q.steps.Interval) * time.Millisecond,
+		LookbackDelta: time.Duration(q.steps.Lookback) * time.Millisecond,
+	}
+}
+
+// aggregate executes the aggregation of series selected by the vector selector of the expression at each step.
+func (q *parquetFileQuerier) aggregate(expr *promparser.AggregateExpr, steps compute.Steps) (promql.Matrix, error) {
+	selections, err := q.selectRows(expr.Expr.(*promparser.VectorSelector).LabelMatchers)
+	if err != nil {
+		return nil, err
+	}
+	selections = selectedRowGroups(selections)
+
+	// Grouping labels which are not in the file are empty for all series, so they do not split groups.
+	groupingColumns := q.fileColumns(expr.Grouping)
+	columns := append([]string{schema.SeriesIDColumn}, groupingColumns...)
+	columns = append(columns, q.fileColumns(chunkColumns[1:])...)
+	batchSize := int64(defaultChunksBatchSize)
+	if q.labelsBatchSize < batchSize {
+		batchSize = q.labelsBatchSize
+	}
+	fn := aggregateFuncs[expr.Op.String()]
+	var aggregate *compute.HashAggregate
+	if len(selections) > 0 && isSortedBySeries(selections) {
+		// Chunks of each series are contiguous, so only the steps of one series are kept at a time.
+		aggregate = compute.NewSortedHashAggregate(q.projectSortedSeries(selections, batchSize, columns...), fn, len(groupingColumns), steps)
+	} else {
+		projection := compute.ProjectSelections(selections, q.sectionLoader, batchSize, columns...)
+		aggregate = compute.NewHashAggregate(projection, fn, len(groupingColumns), steps)
+	}
+	defer aggregate.Close()
+
+	var (
+		matrix    promql.Matrix
+		lastGroup []string
+	)
+	for {
+		batch, err := aggregate.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		for row := range batch[0] {
+			group := make([]string, len(groupingColumns))
+			for i := range group {
+				group[i] = batch[i][row].String()
+			}
+			if len(matrix) == 0 || !slices.Equal(group, lastGroup) {
+				matrix = append(matrix, promql.Series{Metric: groupLabels(groupingColumns, group)})
+				lastGroup = group
+			}
+			series := &matrix[len(matrix)-1]
+			series.Floats = append(series.Floats, promql.FPoint{
+				T: batch[len(groupingColumns)][row].Int64(),
+				F: batch[len(groupingColumns)+1][row].Double(),
+			})
+		}
+		aggregate.Release(batch)
+	}
+	sort.Sort(matrix)
+	return matrix, nil
+}
+
+// groupLabels returns the labels of a group, without labels with empty values.
+func groupLabels(names, values []string) labels.Labels {
+	lbls := make([]labels.Label, 0, len(names))
+	for i, name := range names {
+		if values[i] != "" {
+			lbls = append(lbls, labels.Label{Name: name, Value: values[i]})
+		}
+	}
+	return labels.New(lbls...)
+}
@@ -1,40 +1,27 @@
 package prometheus
 
 import (
-	"github.com/prometheus/prometheus/model/histogram"
+	"math"
+
+	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
 )
 
-type constValIterator struct {
-	ts int64
-}
-
-func (c *constValIterator) Next() chunkenc.ValueType {
-	c.ts += 30_000
-	return chunkenc.ValFloat
-}
-
-func (c *constValIterator) Seek(t int64) chunkenc.ValueType {
-	c.ts = t
-	return chunkenc.ValFloat
-}
-
-func (c *constValIterator) At() (int64, float64) {
-	return c.ts, 1
-}
-
-func (c *constValIterator) AtHistogram() (int64, *histogram.Histogram) {
-	return 0, nil
-}
-
-func (c *constValIterator) AtFloatHistogram() (int64, *histogram.FloatHistogram) {
-	return 0, nil
-}
-
-func (c *constValIterator) AtT() int64 {
-	return c.ts
-}
-
-func (c *constValIterator) Err() error {
-	return nil
+// newTrimmingIterator returns an iterator which only returns samples within [mint, maxt].
+// Chunks which overlap the query time range can contain samples outside of it,
+// and these samples must not leak into the query result. Samples outside of the
+// range are skipped the same way TSDB blocks skip deleted samples.
+func newTrimmingIterator(it chunkenc.Iterator, mint, maxt int64) chunkenc.Iterator {
+	var outside tombstones.Intervals
+	if mint > math.MinInt64 {
+		outside = outside.Add(tombstones.Interval{Mint: math.MinInt64, Maxt: mint - 1})
+	}
+	if maxt < math.MaxInt64 {
+		outside = outside.Add(tombstones.Interval{Mint: maxt + 1, Maxt: math.MaxInt64})
+	}
+	if len(outside) == 0 {
+		return it
+	}
+	return &tsdb.DeletedIterator{Iter: it, Intervals: outside}
 }
@@ -0,0 +1,38 @@
+package prometheus
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrimmingIterator(t *testing.T) {
+	chunk, err := chunkenc.FromData(chunkenc.EncXOR, makeConstChunk(t, 10_000, 130_000, 30_000))
+	require.NoError(t, err)
+	metas := []chunks.Meta{{MinTime: 10_000, MaxTime: 130_000, Chunk: chunk}}
+
+	it := newTrimmingIterator(storage.ChainSampleIteratorFromMetas(nil, metas), 40_000, 100_000)
+
+	var timestamps []int64
+	for it.Next() != chunkenc.ValNone {
+		timestamps = append(timestamps, it.AtT())
+	}
+	require.Equal(t, []int64{40_000, 70_000, 100_000}, timestamps)
+	require.Equal(t, chunkenc.ValNone, it.Next())
+
+	it = newTrimmingIterator(storage.ChainSampleIteratorFromMetas(nil, metas), 40_000, 100_000)
+	require.Equal(t, chunkenc.ValFloat, it.Seek(0))
+	require.Equal(t, int64(40_000), it.AtT())
+	require.Equal(t, chunkenc.ValNone, it.Seek(100_001))
+
+	it = newTrimmingIterator(storage.ChainSampleIteratorFromMetas(nil, metas), math.MinInt64, math.MaxInt64)
+	timestamps = timestamps[:0]
+	for it.Next() != chunkenc.ValNone {
+		timestamps = append(timestamps, it.AtT())
+	}
+	require.Equal(t, []int64{10_000, 40_000, 70_000, 100_000, 130_000}, timestamps)
+}
@@ -0,0 +1,204 @@
+package prometheus
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/segmentio/parquet-go"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+
+	"Shopify/thanos-parquet-engine/compute"
+	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+const (
+	defaultExemplarsBatchSize = 1024
+	// maxSeriesIDRanges is the maximum number of series ID ranges used to select exemplars.
+	maxSeriesIDRanges = 64
+)
+
+type exemplarQueryable struct {
+	seriesFile      *parquet.File
+	seriesLoader    db.SectionLoader
+	exemplarsFile   *parquet.File
+	exemplarsLoader db.SectionLoader
+}
+
+// NewExemplarQueryable creates a queryable for exemplars in an exemplars file.
+// Matchers are resolved against the series file, which is the parquet file in the
+// default layout or the labels file in the split layout.
+func NewExemplarQueryable(
+	seriesFile *parquet.File,
+	seriesLoader db.SectionLoader,
+	exemplarsFile *parquet.File,
+	exemplarsLoader db.SectionLoader,
+) storage.ExemplarQueryable {
+	return &exemplarQueryable{
+		seriesFile:      seriesFile,
+		seriesLoader:    seriesLoader,
+		exemplarsFile:   exemplarsFile,
+		exemplarsLoader: exemplarsLoader,
+	}
+}
+
+func (q *exemplarQueryable) ExemplarQuerier(_ context.Context) (storage.ExemplarQuerier, error) {
+	return q, nil
+}
+
+// Select returns the exemplars in [start, end] of series matching any of the matcher sets.
+func (q *exemplarQueryable) Select(start, end int64, matchers ...[]*labels.Matcher) ([]exemplar.QueryResult, error) {
+	series := make(map[int64]labels.Labels)
+	for _, ms := range matchers {
+		if err := q.selectSeries(ms, series); err != nil {
+			return nil, err
+		}
+	}
+	if len(series) == 0 {
+		return nil, nil
+	}
+
+	scanner := compute.NewScanner(q.exemplarsFile, q.exemplarsLoader,
+		seriesIDRanges(maps.Keys(series)),
+		compute.GreaterThanOrEqual(schema.ExemplarTimestampColumn, parquet.Int64Value(start)),
+		compute.LessThanOrEqual(schema.ExemplarTimestampColumn, parquet.Int64Value(end)),
+	)
+	selections, err := scanner.Select()
+	if err != nil {
+		return nil, err
+	}
+	exemplars := make(map[int64][]exemplar.Exemplar)
+	for _, selection := range selections {
+		projection := compute.ProjectColumns(selection, q.exemplarsLoader, defaultExemplarsBatchSize,
+			schema.SeriesIDColumn,
+			schema.ExemplarTimestampColumn,
+			schema.ExemplarValueColumn,
+			schema.ExemplarLabelsColumn,
+		)
+		err := readBatches(projection, func(batch compute.Batch) error {
+			for row := range batch[0] {
+				seriesID := batch[0][row].Int64()
+				if _, ok := series[seriesID]; !ok {
+					continue
+				}
+				lbls, err := schema.DecodeLabels(batch[3][row].ByteArray())
+				if err != nil {
+					return err
+				}
+				exemplars[seriesID] = append(exemplars[seriesID], exemplar.Exemplar{
+					Labels: lbls,
+					Ts:     batch[1][row].Int64(),
+					Value:  batch[2][row].Double(),
+					HasTs:  true,
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]exemplar.QueryResult, 0, len(exemplars))
+	for seriesID, seriesExemplars := range exemplars {
+		result = append(result, exemplar.QueryResult{
+			SeriesLabels: series[seriesID],
+			Exemplars:    seriesExemplars,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return labels.Compare(result[i].SeriesLabels, result[j].SeriesLabels) < 0
+	})
+	return result, nil
+}
+
+// seriesIDRanges selects rows of the series with the given IDs. Exemplars are sorted by series ID,
+// so consecutive IDs are selected as a single range, and pages and row groups of other series are skipped.
+// When there are too many ranges, all IDs between the lowest and highest ID are selected instead,
+// and exemplars of other series are dropped after they are read.
+func seriesIDRanges(ids []int64) compute.ScannerOption {
+	slices.Sort(ids)
+	type idRange struct{ from, to int64 }
+	ranges := []idRange{{from: ids[0], to: ids[0]}}
+	for _, id := range ids[1:] {
+		if last := &ranges[len(ranges)-1]; id == last.to+1 {
+			last.to = id
+			continue
+		}
+		ranges = append(ranges, idRange{from: id, to: id})
+	}
+	if len(ranges) > maxSeriesIDRanges {
+		ranges = []idRange{{from: ids[0], to: ids[len(ids)-1]}}
+	}
+
+	options := make([]compute.ScannerOption, 0, len(ranges))
+	for _, r := range ranges {
+		options = append(options, compute.And(
+			compute.GreaterThanOrEqual(schema.SeriesIDColumn, parquet.Int64Value(r.from)),
+			compute.LessThanOrEqual(schema.SeriesIDColumn, parquet.Int64Value(r.to)),
+		))
+	}
+	return compute.Or(options...)
+}
+
+// selectSeries adds the labels of all series matching the matchers to the series map.
+func (q *exemplarQueryable) selectSeries(matchers []*labels.Matcher, series map[int64]labels.Labels) error {
+	selections, err := compute.NewScanner(q.seriesFile, q.seriesLoader, MatcherOptions(matchers)...).Select()
+	if err != nil {
+		return err
+	}
+
+	columns := []string{schema.SeriesIDColumn}
+	for _, path := range q.seriesFile.Schema().Columns() {
+		if !schema.IsChunkColumn(path[0]) {
+			columns = append(columns, path[0])
+		}
+	}
+	for _, selection := range selections {
+		// Series are deduplicated by the series map, which holds all of them anyway.
+		projection := compute.ProjectColumns(selection, q.seriesLoader, defaultLabelsBatchSize, columns...)
+		err := readBatches(projection, func(batch compute.Batch) error {
+			for row := range batch[0] {
+				seriesID := batch[0][row].Int64()
+				if _, ok := series[seriesID]; ok {
+					continue
+				}
+				lbls := make(labels.Labels, 0, len(columns)-1)
+				for i, name := range columns[1:] {
+					if value := batch[i+1][row].String(); value != "" {
+						lbls = append(lbls, labels.Label{Name: name, Value: value})
+					}
+				}
+				series[seriesID] = labels.New(lbls...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBatches calls fn with each batch of the fragment and closes the fragment once it is exhausted.
+func readBatches(fragment compute.Fragment, fn func(batch compute.Batch) error) error {
+	defer fragment.Close()
+	for {
+		batch, err := fragment.NextBatch()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(batch); err != nil {
+			return err
+		}
+		fragment.Release(batch)
+	}
+}
@@ -0,0 +1,128 @@
+package prometheus
+
+import (
+	"regexp"
+	"regexp/syntax"
+
+	"github.com/prometheus/prometheus/model/labels"
+
+	"Shopify/thanos-parquet-engine/compute"
+)
+
+// maxSetMatches is the maximum number of values a regex can be expanded to
+// before it is evaluated as a regular expression instead.
+const maxSetMatches = 256
+
+// MatcherOptions returns scanner options which select rows matching all matchers.
+func MatcherOptions(matchers []*labels.Matcher) []compute.ScannerOption {
+	opts := make([]compute.ScannerOption, 0, len(matchers))
+	for _, m := range matchers {
+		opts = append(opts, matcherOption(m))
+	}
+	return opts
+}
+
+func matcherOption(m *labels.Matcher) compute.ScannerOption {
+	switch m.Type {
+	case labels.MatchEqual:
+		return compute.Equals(m.Name, m.Value)
+	case labels.MatchNotEqual:
+		return compute.NotEquals(m.Name, m.Value)
+	case labels.MatchRegexp:
+		return regexOption(m)
+	case labels.MatchNotRegexp:
+		inverse, err := m.Inverse()
+		if err != nil {
+			return compute.Matches(m.Name, "", m.Matches)
+		}
+		return compute.Not(regexOption(inverse))
+	default:
+		return compute.Matches(m.Name, "", m.Matches)
+	}
+}
+
+// regexOption turns regular expressions which are alternations of literals,
+// like `api-server|kubelet`, into an OR of equality predicates.
+func regexOption(m *labels.Matcher) compute.ScannerOption {
+	values, ok := setMatches(m.Value)
+	if !ok {
+		return compute.Matches(m.Name, literalPrefix(m.Value), m.Matches)
+	}
+	options := make([]compute.ScannerOption, 0, len(values))
+	for _, v := range values {
+		options = append(options, compute.Equals(m.Name, v))
+	}
+	return compute.Or(options...)
+}
+
+// literalPrefix returns the literal string which all values matched by the regex start with.
+func literalPrefix(pattern string) string {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return ""
+	}
+	prefix, _ := re.LiteralPrefix()
+	return prefix
+}
+
+// setMatches returns the finite set of strings matched by the regex, if there is one.
+func setMatches(pattern string) ([]string, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, false
+	}
+	return expandRegex(re.Simplify())
+}
+
+func expandRegex(re *syntax.Regexp) ([]string, bool) {
+	if re.Flags&syntax.FoldCase != 0 {
+		return nil, false
+	}
+	switch re.Op {
+	case syntax.OpEmptyMatch:
+		return []string{""}, true
+	case syntax.OpLiteral:
+		return []string{string(re.Rune)}, true
+	case syntax.OpCharClass:
+		var values []string
+		for i := 0; i < len(re.Rune); i += 2 {
+			for r := re.Rune[i]; r <= re.Rune[i+1]; r++ {
+				if len(values) == maxSetMatches {
+					return nil, false
+				}
+				values = append(values, string(r))
+			}
+		}
+		return values, true
+	case syntax.OpAlternate:
+		var values []string
+		for _, sub := range re.Sub {
+			subValues, ok := expandRegex(sub)
+			if !ok || len(values)+len(subValues) > maxSetMatches {
+				return nil, false
+			}
+			values = append(values, subValues...)
+		}
+		return values, true
+	case syntax.OpConcat:
+		values := []string{""}
+		for _, sub := range re.Sub {
+			subValues, ok := expandRegex(sub)
+			if !ok || len(values)*len(subValues) > maxSetMatches {
+				return nil, false
+			}
+			product := make([]string, 0, len(values)*len(subValues))
+			for _, prefix := range values {
+				for _, suffix := range subValues {
+					product = append(product, prefix+suffix)
+				}
+			}
+			values = product
+		}
+		return values, true
+	case syntax.OpCapture:
+		return expandRegex(re.Sub[0])
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,28 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetMatches(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		expected []string
+	}{
+		{pattern: "api-server", expected: []string{"api-server"}},
+		{pattern: "api-server|kubelet", expected: []string{"api-server", "kubelet"}},
+		{pattern: "api-(server|gateway)", expected: []string{"api-server", "api-gateway"}},
+		{pattern: "instance-[0-2]", expected: []string{"instance-0", "instance-1", "instance-2"}},
+		{pattern: "api-.*"},
+		{pattern: "(?i)api"},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.pattern, func(t *testing.T) {
+			values, ok := setMatches(tcase.pattern)
+			require.Equal(t, tcase.expected != nil, ok)
+			require.ElementsMatch(t, tcase.expected, values)
+		})
+	}
+}
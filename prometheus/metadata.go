@@ -0,0 +1,113 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/segmentio/parquet-go"
+	"golang.org/x/exp/slices"
+
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+const metadataBatchSize = 1024
+
+// ReadMetadata reads the metadata of all metrics in a metadata file, keyed by metric name.
+func ReadMetadata(file *parquet.File) (map[string][]metadata.Metadata, error) {
+	result := make(map[string][]metadata.Metadata)
+	rows := make([]parquet.Row, metadataBatchSize)
+	for _, rowGroup := range file.RowGroups() {
+		reader := rowGroup.Rows()
+		for {
+			n, err := reader.ReadRows(rows)
+			for _, row := range rows[:n] {
+				m := schema.MetadataFromRow(row)
+				result[m.MetricName] = append(result[m.MetricName], metadata.Metadata{
+					Type: m.Type,
+					Help: m.Help,
+					Unit: m.Unit,
+				})
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				reader.Close()
+				return nil, err
+			}
+		}
+		if err := reader.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+type metadataResponse struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	ErrorType string      `json:"errorType,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+type metadataResponseEntry struct {
+	Type string `json:"type"`
+	Help string `json:"help"`
+	Unit string `json:"unit"`
+}
+
+// MetadataHandler serves metric metadata in the format of the Prometheus /api/v1/metadata endpoint.
+// The metric parameter returns the metadata of a single metric, and the limit parameter
+// limits the number of returned metrics.
+func MetadataHandler(md map[string][]metadata.Metadata) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := -1
+		if s := r.FormValue("limit"); s != "" {
+			var err error
+			if limit, err = strconv.Atoi(s); err != nil {
+				writeMetadataResponse(w, http.StatusBadRequest, metadataResponse{
+					Status:    "error",
+					ErrorType: "bad_data",
+					Error:     "limit must be a number",
+				})
+				return
+			}
+		}
+
+		names := make([]string, 0, len(md))
+		if metric := r.FormValue("metric"); metric != "" {
+			if _, ok := md[metric]; ok {
+				names = append(names, metric)
+			}
+		} else {
+			for name := range md {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+		}
+
+		data := make(map[string][]metadataResponseEntry)
+		for _, name := range names {
+			if limit >= 0 && len(data) >= limit {
+				break
+			}
+			for _, m := range md[name] {
+				data[name] = append(data[name], metadataResponseEntry{
+					Type: string(m.Type),
+					Help: m.Help,
+					Unit: m.Unit,
+				})
+			}
+		}
+		writeMetadataResponse(w, http.StatusOK, metadataResponse{Status: "success", Data: data})
+	})
+}
+
+func writeMetadataResponse(w http.ResponseWriter, status int, response metadataResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
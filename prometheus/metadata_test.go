@@ -0,0 +1,133 @@
+package prometheus
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/stretchr/testify/require"
+
+	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+func TestMetadataAndExemplars(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "up", "job", "kubelet", "instance", "0"),
+	}
+
+	dir := t.TempDir()
+	writer, err := db.NewWriter(dir, []string{labels.MetricName, "job", "instance"})
+	require.NoError(t, err)
+	for i, s := range series {
+		require.NoError(t, writer.Write([]schema.Chunk{{
+			Labels:     s.Map(),
+			SeriesID:   int64(i),
+			MinT:       0,
+			MaxT:       60_000,
+			ChunkBytes: makeConstChunk(t, 0, 60_000, 30_000),
+			Encoding:   chunkenc.EncXOR,
+		}}))
+	}
+	writer.WriteMetadata([]schema.Metadata{
+		{MetricName: "http_requests_total", Type: textparse.MetricTypeCounter, Help: "Total requests."},
+		{MetricName: "http_requests_total", Type: textparse.MetricTypeCounter, Help: "Total requests."},
+		{MetricName: "up", Type: textparse.MetricTypeGauge, Help: "Target is up."},
+	})
+	traceID := labels.FromStrings("trace_id", "abc")
+	writer.WriteExemplars([]schema.Exemplar{
+		{SeriesID: 1, Labels: traceID, Ts: 30_000, Value: 2},
+		{SeriesID: 0, Labels: traceID, Ts: 40_000, Value: 1},
+		{SeriesID: 0, Labels: traceID, Ts: 10_000, Value: 3},
+		{SeriesID: 2, Labels: traceID, Ts: 20_000, Value: 1},
+	})
+	require.NoError(t, writer.Close())
+	require.NoError(t, writer.Compact())
+
+	t.Run("metadata", func(t *testing.T) {
+		metadataFile, _, err := openParquetPart(dir, t.TempDir(), "compact.metric_metadata")
+		require.NoError(t, err)
+		md, err := ReadMetadata(metadataFile)
+		require.NoError(t, err)
+		require.Len(t, md, 2)
+		require.Len(t, md["http_requests_total"], 1)
+
+		cases := []struct {
+			query    string
+			expected string
+		}{
+			{
+				query:    "",
+				expected: `{"status":"success","data":{"http_requests_total":[{"type":"counter","help":"Total requests.","unit":""}],"up":[{"type":"gauge","help":"Target is up.","unit":""}]}}`,
+			},
+			{
+				query:    "?metric=up",
+				expected: `{"status":"success","data":{"up":[{"type":"gauge","help":"Target is up.","unit":""}]}}`,
+			},
+			{
+				query:    "?limit=1",
+				expected: `{"status":"success","data":{"http_requests_total":[{"type":"counter","help":"Total requests.","unit":""}]}}`,
+			},
+			{
+				query:    "?metric=unknown",
+				expected: `{"status":"success","data":{}}`,
+			},
+		}
+		for _, tcase := range cases {
+			recorder := httptest.NewRecorder()
+			MetadataHandler(md).ServeHTTP(recorder, httptest.NewRequest("GET", "/api/v1/metadata"+tcase.query, nil))
+			require.Equal(t, 200, recorder.Code)
+			require.JSONEq(t, tcase.expected, recorder.Body.String())
+		}
+	})
+
+	t.Run("exemplars", func(t *testing.T) {
+		pqFile, reader, err := openParquetFile(dir, t.TempDir())
+		require.NoError(t, err)
+		exemplarsFile, exemplarsReader, err := openParquetPart(dir, t.TempDir(), "compact.exemplars")
+		require.NoError(t, err)
+
+		queryable := NewExemplarQueryable(pqFile, reader.SectionLoader(), exemplarsFile, exemplarsReader.SectionLoader())
+		q, err := queryable.ExemplarQuerier(context.Background())
+		require.NoError(t, err)
+
+		result, err := q.Select(0, 35_000, []*labels.Matcher{
+			labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "http_requests_total"),
+		})
+		require.NoError(t, err)
+		require.Equal(t, []exemplar.QueryResult{
+			{
+				SeriesLabels: series[0],
+				Exemplars:    []exemplar.Exemplar{{Labels: traceID, Ts: 10_000, Value: 3, HasTs: true}},
+			},
+			{
+				SeriesLabels: series[1],
+				Exemplars:    []exemplar.Exemplar{{Labels: traceID, Ts: 30_000, Value: 2, HasTs: true}},
+			},
+		}, result)
+
+		result, err = q.Select(0, 60_000, []*labels.Matcher{
+			labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "up"),
+		})
+		require.NoError(t, err)
+		require.Len(t, result, 1)
+		require.Equal(t, series[2], result[0].SeriesLabels)
+
+		// Series which are not consecutive are selected with separate ranges of series IDs.
+		result, err = q.Select(0, 60_000,
+			[]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "api-server")},
+			[]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "up")},
+		)
+		require.NoError(t, err)
+		require.Len(t, result, 2)
+		require.Equal(t, series[0], result[0].SeriesLabels)
+		require.Len(t, result[0].Exemplars, 2)
+		require.Equal(t, series[2], result[1].SeriesLabels)
+	})
+}
@@ -2,13 +2,27 @@ package prometheus
 
 import (
 	"context"
+	"math"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
 	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
 	"github.com/stretchr/testify/require"
 	"github.com/thanos-io/promql-engine/engine"
+	"github.com/thanos-io/promql-engine/logicalplan"
+	"github.com/thanos-io/promql-engine/parser"
+
+	"Shopify/thanos-parquet-engine/db"
 )
 
 func TestPromQL(t *testing.T) {
@@ -57,3 +71,252 @@ func TestPromQL(t *testing.T) {
 	}
 	require.Equal(t, expectedSeries, result.Value)
 }
+
+func TestPromQLNativeHistograms(t *testing.T) {
+	const (
+		numSamples = 40
+		interval   = 15_000
+	)
+	var floatSamples, histogramSamples, floatHistogramSamples []tsdbutil.Sample
+	for i := 0; i < numSamples; i++ {
+		ts := int64(i * interval)
+		floatSamples = append(floatSamples, testSample{t: ts, f: float64(i)})
+		histogramSamples = append(histogramSamples, testSample{t: ts, h: tsdbutil.GenerateTestHistogram(i)})
+		floatHistogramSamples = append(floatHistogramSamples, testSample{t: ts, fh: tsdbutil.GenerateTestFloatHistogram(i)})
+	}
+	series := []storage.Series{
+		storage.NewListSeries(labels.FromStrings(labels.MetricName, "requests_total", "job", "api-server"), floatSamples),
+		storage.NewListSeries(labels.FromStrings(labels.MetricName, "request_duration_seconds", "job", "api-server"), histogramSamples),
+		storage.NewListSeries(labels.FromStrings(labels.MetricName, "request_size_bytes", "job", "api-server"), floatHistogramSamples),
+	}
+
+	blockDir, err := tsdb.CreateBlock(series, t.TempDir(), 0, log.NewNopLogger())
+	require.NoError(t, err)
+	block, err := tsdb.OpenBlock(log.NewNopLogger(), blockDir, nil)
+	require.NoError(t, err)
+	defer block.Close()
+
+	labelNames, err := block.LabelNames()
+	require.NoError(t, err)
+	dir := t.TempDir()
+	writer, err := db.NewWriter(dir, labelNames)
+	require.NoError(t, err)
+	require.NoError(t, db.ConvertBlock(block, writer))
+	pqFile, reader, err := openParquetFile(dir, t.TempDir())
+	require.NoError(t, err)
+
+	expected := storage.QueryableFunc(func(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
+		return tsdb.NewBlockQuerier(block, mint, maxt)
+	})
+	actual := NewParquetFile(pqFile, reader.SectionLoader())
+
+	ng := promql.NewEngine(promql.EngineOpts{
+		MaxSamples: 1_000_000,
+		Timeout:    30 * time.Second,
+	})
+	queries := []string{
+		`sum(requests_total)`,
+		`sum(rate(requests_total[1m]))`,
+		`sum(request_duration_seconds)`,
+		`sum(rate(request_duration_seconds[1m]))`,
+		`histogram_quantile(0.9, sum(rate(request_duration_seconds[1m])))`,
+		`histogram_count(sum(request_size_bytes))`,
+		`histogram_sum(sum(rate(request_size_bytes[2m])))`,
+	}
+	var (
+		start = time.Unix(0, 0)
+		end   = time.Unix(numSamples*interval/1000, 0)
+		step  = 30 * time.Second
+	)
+	for _, queryStr := range queries {
+		t.Run(queryStr, func(t *testing.T) {
+			expectedQuery, err := ng.NewRangeQuery(context.Background(), expected, nil, queryStr, start, end, step)
+			require.NoError(t, err)
+			expectedResult := expectedQuery.Exec(context.Background())
+			require.NoError(t, expectedResult.Err)
+
+			actualQuery, err := ng.NewRangeQuery(context.Background(), actual, nil, queryStr, start, end, step)
+			require.NoError(t, err)
+			actualResult := actualQuery.Exec(context.Background())
+			require.NoError(t, actualResult.Err)
+
+			require.NotEmpty(t, expectedResult.Value)
+			require.Equal(t, expectedResult.Value, actualResult.Value)
+		})
+	}
+}
+
+type testSample struct {
+	t  int64
+	f  float64
+	h  *histogram.Histogram
+	fh *histogram.FloatHistogram
+}
+
+func (s testSample) T() int64                      { return s.t }
+func (s testSample) F() float64                    { return s.f }
+func (s testSample) H() *histogram.Histogram       { return s.h }
+func (s testSample) FH() *histogram.FloatHistogram { return s.fh }
+
+func (s testSample) Type() chunkenc.ValueType {
+	switch {
+	case s.h != nil:
+		return chunkenc.ValHistogram
+	case s.fh != nil:
+		return chunkenc.ValFloatHistogram
+	default:
+		return chunkenc.ValFloat
+	}
+}
+
+func TestPromQLAggregationPushdown(t *testing.T) {
+	const (
+		numSamples = 60
+		interval   = 15_000
+	)
+	var series []storage.Series
+	for i, lbls := range []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "1"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "instance", "2"),
+		labels.FromStrings(labels.MetricName, "up", "job", "kubelet", "instance", "0"),
+	} {
+		var samples []tsdbutil.Sample
+		for j := 0; j < numSamples; j++ {
+			// Series stop having samples at different times, so that groups lose series after the lookback.
+			if j > numSamples-i*10 {
+				break
+			}
+			ts := int64(j * interval)
+			if j == 20 && i == 1 {
+				samples = append(samples, testSample{t: ts, f: math.Float64frombits(value.StaleNaN)})
+				continue
+			}
+			samples = append(samples, testSample{t: ts, f: float64((i + 1) * (j%7 + 1))})
+		}
+		series = append(series, storage.NewListSeries(lbls, samples))
+	}
+
+	blockDir, err := tsdb.CreateBlock(series, t.TempDir(), 0, log.NewNopLogger())
+	require.NoError(t, err)
+	block, err := tsdb.OpenBlock(log.NewNopLogger(), blockDir, nil)
+	require.NoError(t, err)
+	defer block.Close()
+
+	labelNames, err := block.LabelNames()
+	require.NoError(t, err)
+
+	queries := []struct {
+		query    string
+		pushdown bool
+	}{
+		{query: `sum(http_requests_total)`, pushdown: true},
+		{query: `sum by (job) (http_requests_total)`, pushdown: true},
+		{query: `count by (job) (http_requests_total)`, pushdown: true},
+		{query: `min by (instance) (http_requests_total)`, pushdown: true},
+		{query: `max by (job, instance) (http_requests_total)`, pushdown: true},
+		{query: `avg by (job) (http_requests_total{instance=~"0|1"})`, pushdown: true},
+		{query: `sum by (missing) (http_requests_total)`, pushdown: true},
+		{query: `count(up)`, pushdown: true},
+		{query: `sum(http_requests_total) / 2`, pushdown: true},
+		{query: `abs(-max by (job) (http_requests_total))`, pushdown: true},
+		{query: `sum by (job) (nonexistent)`, pushdown: true},
+		{query: `sum without (instance) (http_requests_total)`},
+		{query: `sum by (job) (rate(http_requests_total[1m]))`},
+		{query: `topk(1, http_requests_total)`},
+	}
+	var (
+		start = time.Unix(0, 0)
+		end   = time.Unix(numSamples*interval/1000+600, 0)
+		step  = 30 * time.Second
+	)
+	// Series of files sorted by series are aggregated one at a time, and time aligned row groups are merged.
+	layouts := []struct {
+		name string
+		opts []db.WriterOption
+	}{
+		{name: "sorted by time"},
+		{name: "sorted by series", opts: []db.WriterOption{db.WithSortOrder(db.SortBySeries), db.WithRowGroupRows(2)}},
+		{name: "time aligned", opts: []db.WriterOption{db.WithSortOrder(db.SortBySeries), db.WithTimeAlignedRowGroups(time.Minute), db.WithRowGroupRows(2)}},
+	}
+	for _, layout := range layouts {
+		dir := t.TempDir()
+		writer, err := db.NewWriter(dir, labelNames, layout.opts...)
+		require.NoError(t, err)
+		require.NoError(t, db.ConvertBlock(block, writer))
+		pqFile, reader, err := openParquetFile(dir, t.TempDir())
+		require.NoError(t, err)
+		q := NewParquetFile(pqFile, reader.SectionLoader())
+
+		engineOpts := promql.EngineOpts{
+			MaxSamples: 1_000_000,
+			Timeout:    30 * time.Second,
+		}
+		expectedEngine := engine.New(engine.Opts{EngineOpts: engineOpts})
+		actualEngine := engine.New(engine.Opts{
+			EngineOpts:        engineOpts,
+			LogicalOptimizers: append(logicalplan.DefaultOptimizers, NewAggregationPushdown(q)),
+		})
+
+		for _, tcase := range queries {
+			t.Run(layout.name+"/"+tcase.query, func(t *testing.T) {
+				expr, err := parser.ParseExpr(tcase.query)
+				require.NoError(t, err)
+				optimized := NewAggregationPushdown(q).Optimize(expr, &logicalplan.Opts{Start: start, End: end, Step: step})
+				require.Equal(t, tcase.pushdown, strings.Contains(optimized.String(), "remote("))
+
+				expectedQuery, err := expectedEngine.NewRangeQuery(context.Background(), q, nil, tcase.query, start, end, step)
+				require.NoError(t, err)
+				expectedResult := expectedQuery.Exec(context.Background())
+				require.NoError(t, expectedResult.Err)
+
+				actualQuery, err := actualEngine.NewRangeQuery(context.Background(), q, nil, tcase.query, start, end, step)
+				require.NoError(t, err)
+				actualResult := actualQuery.Exec(context.Background())
+				require.NoError(t, actualResult.Err)
+				require.Equal(t, expectedResult.Value, actualResult.Value)
+
+				expectedInstant, err := expectedEngine.NewInstantQuery(context.Background(), q, nil, tcase.query, end.Add(-10*time.Minute))
+				require.NoError(t, err)
+				expectedResult = expectedInstant.Exec(context.Background())
+				require.NoError(t, expectedResult.Err)
+
+				actualInstant, err := actualEngine.NewInstantQuery(context.Background(), q, nil, tcase.query, end.Add(-10*time.Minute))
+				require.NoError(t, err)
+				actualResult = actualInstant.Exec(context.Background())
+				require.NoError(t, actualResult.Err)
+				// Vectors are not sorted by the engine, and series of aggregations are returned in order of their labels.
+				require.ElementsMatch(t, expectedResult.Value, actualResult.Value)
+			})
+		}
+
+		t.Run(layout.name+"/concurrent", func(t *testing.T) {
+			// Aggregations of the same file share its sections, and are executed concurrently.
+			var wg sync.WaitGroup
+			results := make([]*promql.Result, len(queries))
+			for i, tcase := range queries {
+				wg.Add(1)
+				go func(i int, query string) {
+					defer wg.Done()
+					actualQuery, err := actualEngine.NewRangeQuery(context.Background(), q, nil, query, start, end, step)
+					if err != nil {
+						results[i] = &promql.Result{Err: err}
+						return
+					}
+					results[i] = actualQuery.Exec(context.Background())
+				}(i, tcase.query)
+			}
+			wg.Wait()
+
+			for i, tcase := range queries {
+				expectedQuery, err := expectedEngine.NewRangeQuery(context.Background(), q, nil, tcase.query, start, end, step)
+				require.NoError(t, err)
+				expectedResult := expectedQuery.Exec(context.Background())
+				require.NoError(t, expectedResult.Err)
+				require.NoError(t, results[i].Err)
+				require.Equal(t, expectedResult.Value, results[i].Value)
+			}
+		})
+	}
+}
@@ -2,13 +2,18 @@ package prometheus
 
 import (
 	"context"
+	"io"
+	"strconv"
 
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/segmentio/parquet-go"
+	"golang.org/x/exp/slices"
 
 	"Shopify/thanos-parquet-engine/compute"
+	"Shopify/thanos-parquet-engine/dataset"
 	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/index"
 	"Shopify/thanos-parquet-engine/schema"
 )
 
@@ -21,12 +26,35 @@ type parquetFile struct {
 	file          *parquet.File
 	sectionLoader db.SectionLoader
 	opts          []QuerierOpts
+
+	chunksFile   *parquet.File
+	chunksLoader db.SectionLoader
 }
 
 func NewParquetFile(file *parquet.File, sectionLoader db.SectionLoader, opts ...QuerierOpts) storage.Queryable {
 	return &parquetFile{file: file, sectionLoader: sectionLoader, opts: opts}
 }
 
+// NewSplitParquetFiles creates a queryable for files written with the split layout.
+// Matchers are resolved against the labels file, and series are joined with the chunks file
+// to only return series with chunks in the query time range.
+// Series queries, which only need labels, never read the chunks file.
+func NewSplitParquetFiles(
+	labelsFile *parquet.File,
+	labelsLoader db.SectionLoader,
+	chunksFile *parquet.File,
+	chunksLoader db.SectionLoader,
+	opts ...QuerierOpts,
+) storage.Queryable {
+	return &parquetFile{
+		file:          labelsFile,
+		sectionLoader: labelsLoader,
+		opts:          opts,
+		chunksFile:    chunksFile,
+		chunksLoader:  chunksLoader,
+	}
+}
+
 func (q parquetFile) Querier(ctx context.Context, mint, maxt int64) (storage.Querier, error) {
 	pq := &parquetFileQuerier{
 		ctx:  ctx,
@@ -35,6 +63,8 @@ func (q parquetFile) Querier(ctx context.Context, mint, maxt int64) (storage.Que
 
 		file:          q.file,
 		sectionLoader: q.sectionLoader,
+		chunksFile:    q.chunksFile,
+		chunksLoader:  q.chunksLoader,
 
 		labelsBatchSize: defaultLabelsBatchSize,
 	}
@@ -52,6 +82,30 @@ func WithLabelsBatchSize(val int64) QuerierOpts {
 	}
 }
 
+// WithSeriesLimit limits the number of series returned by Select. Chunks are not read
+// for series over the limit. A limit of zero or less returns all series.
+func WithSeriesLimit(limit int) QuerierOpts {
+	return func(q *parquetFileQuerier) {
+		q.seriesLimit = limit
+	}
+}
+
+// WithSpillOptions sets the memory limit and directory of spill files for deduplicating series,
+// such as the section cache dir of the file reader.
+func WithSpillOptions(opts ...compute.SpillOption) QuerierOpts {
+	return func(q *parquetFileQuerier) {
+		q.spillOpts = append(q.spillOpts, opts...)
+	}
+}
+
+// WithSeriesIndex resolves matchers using the series index of the file
+// instead of scanning its label columns.
+func WithSeriesIndex(idx *index.Index) QuerierOpts {
+	return func(q *parquetFileQuerier) {
+		q.seriesIndex = idx
+	}
+}
+
 type parquetFileQuerier struct {
 	ctx  context.Context
 	mint int64
@@ -59,43 +113,318 @@ type parquetFileQuerier struct {
 
 	file          *parquet.File
 	sectionLoader db.SectionLoader
+	chunksFile    *parquet.File
+	chunksLoader  db.SectionLoader
 
 	labelsBatchSize int64
+	seriesIndex     *index.Index
+	seriesLimit     int
+	spillOpts       []compute.SpillOption
 }
 
 func (q *parquetFileQuerier) Select(_ bool, hints *storage.SelectHints, matchers ...*labels.Matcher) storage.SeriesSet {
-	opts := []compute.ScannerOption{
-		compute.GreaterThanOrEqual(schema.MinTColumn, parquet.Int64Value(q.mint)),
-		compute.LessThanOrEqual(schema.MaxTColumn, parquet.Int64Value(q.maxt)),
+	if q.seriesIndex != nil {
+		return q.selectIndexed(hints, matchers)
+	}
+	selections, err := q.selectRows(matchers)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+	// Projections skip missing columns, so only columns in the file are projected
+	// to keep columns at known offsets.
+	labelColumns := q.fileColumns(append([]string{schema.SeriesIDColumn}, hints.Grouping...))
+	// Chunks of each series are contiguous in files sorted by series, so series are
+	// deduplicated and read together with their chunks in a single pass.
+	selections = selectedRowGroups(selections)
+	sortedBySeries := q.chunksFile == nil && len(selections) > 0 && isSortedBySeries(selections)
+	if sortedBySeries && hints.Func != "series" {
+		columns := append(labelColumns, q.fileColumns(chunkColumns[1:])...)
+		batchSize := int64(defaultChunksBatchSize)
+		if q.labelsBatchSize < batchSize {
+			batchSize = q.labelsBatchSize
+		}
+		projection := q.projectSortedSeries(selections, batchSize, columns...)
+		return q.limitSeries(newSortedSeriesSet(labelColumns, projection, q.mint, q.maxt))
 	}
-	for _, m := range matchers {
-		opts = append(opts, compute.Equals(m.Name, m.Value))
+
+	var uniqueLabels compute.Fragment
+	if sortedBySeries {
+		uniqueLabels = compute.UniqueBySortedColumn(0, q.projectSortedSeries(selections, q.labelsBatchSize, labelColumns...))
+	} else {
+		labelsProjection := compute.ProjectSelections(selections, q.sectionLoader, q.labelsBatchSize, labelColumns...)
+		uniqueLabels = compute.UniqueByColumns([]int{0}, labelsProjection, q.spillOpts...)
+	}
+	// All unique series of a single file have chunks in the time range, so the series limit
+	// stops reading labels once enough series are found. Series of the split layout can still
+	// be dropped when their chunks are read.
+	if q.seriesLimit > 0 && (hints.Func == "series" || q.chunksFile == nil) {
+		uniqueLabels = compute.NewLimit(uniqueLabels, int64(q.seriesLimit))
+	}
+	if hints.Func == "series" {
+		return newSeriesSet(labelColumns, uniqueLabels, q.mint, q.maxt)
 	}
 
-	scanner := compute.NewScanner(q.file, q.sectionLoader, opts...)
-	selection, err := scanner.Select()
+	// Series are resolved before their chunks, so that chunk bytes are only read for series which are returned.
+	series, err := readSeriesLabels(labelColumns, uniqueLabels, q.mint, q.maxt)
 	if err != nil {
 		return storage.ErrSeriesSet(err)
 	}
-	labelColumns := append([]string{schema.SeriesIDColumn}, hints.Grouping...)
-	labelsProjection := compute.UniqueByColumn(0, compute.ProjectColumns(
-		selection[0],
-		q.sectionLoader,
-		q.labelsBatchSize,
-		labelColumns...,
-	))
+	chunksSelections, chunksLoader := selections, q.sectionLoader
+	if q.chunksFile != nil {
+		chunksSelections, err = q.selectSplitChunks()
+		if err != nil {
+			return storage.ErrSeriesSet(err)
+		}
+		chunksLoader = q.chunksLoader
+	}
+	sset, err := newLateChunksSeriesSet(series, chunksSelections, chunksLoader, q.seriesLimit, chunksSeriesBatchSize)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+	return sset
+}
 
-	return newSeriesSet(labelColumns, labelsProjection)
+// selectIndexed returns series matching the matchers with labels from the series index,
+// so that label columns are not read. Only chunk columns are read to find series
+// with chunks in the query time range, and to read their chunks.
+func (q *parquetFileQuerier) selectIndexed(hints *storage.SelectHints, matchers []*labels.Matcher) storage.SeriesSet {
+	ids := q.seriesIndex.Postings(matchers...)
+	labelColumns := q.fileColumns(append([]string{schema.SeriesIDColumn}, hints.Grouping...))
+	resolved := make([]resolvedSeries, 0, len(ids))
+	for _, id := range ids {
+		indexed, ok := q.seriesIndex.Series(id)
+		if !ok {
+			continue
+		}
+		lbls := make(labels.Labels, len(labelColumns))
+		for i, name := range labelColumns {
+			lbls[i] = labels.Label{Name: name, Value: indexed.Labels.Get(name)}
+		}
+		lbls[0].Value = strconv.FormatInt(id, 10)
+		resolved = append(resolved, resolvedSeries{
+			id:     id,
+			series: &series{labels: lbls, mint: q.mint, maxt: q.maxt},
+		})
+	}
+
+	var (
+		selections []dataset.SelectionResult
+		loader     = q.sectionLoader
+		err        error
+	)
+	if q.chunksFile != nil {
+		selections, err = q.selectSplitChunks()
+		loader = q.chunksLoader
+	} else {
+		scanner := compute.NewScanner(q.file, q.sectionLoader,
+			compute.TimeRangeOverlaps(q.mint, q.maxt),
+			compute.RowRanges(indexRowRanges(q.seriesIndex, ids)),
+		)
+		selections, err = scanner.Select()
+	}
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+	sset, err := newLateChunksSeriesSet(resolved, selectedRowGroups(selections), loader, q.seriesLimit, chunksSeriesBatchSize)
+	if err != nil {
+		return storage.ErrSeriesSet(err)
+	}
+	if hints.Func == "series" {
+		return newResolvedSeriesSet(sset.series)
+	}
+	return sset
+}
+
+// selectRows selects the rows of series matching the matchers which overlap the query time range.
+func (q *parquetFileQuerier) selectRows(matchers []*labels.Matcher) ([]dataset.SelectionResult, error) {
+	opts := []compute.ScannerOption{
+		compute.TimeRangeOverlaps(q.mint, q.maxt),
+	}
+	if q.seriesIndex != nil {
+		opts = append(opts, compute.RowRanges(seriesRowRanges(q.seriesIndex, matchers)))
+	} else {
+		opts = append(opts, MatcherOptions(matchers)...)
+	}
+	return compute.NewScanner(q.file, q.sectionLoader, opts...).Select()
+}
+
+// limitSeries returns at most the series limit of series from the series set.
+func (q *parquetFileQuerier) limitSeries(sset storage.SeriesSet) storage.SeriesSet {
+	if q.seriesLimit <= 0 {
+		return sset
+	}
+	return &limitSeriesSet{SeriesSet: sset, limit: q.seriesLimit}
+}
+
+// fileColumns returns the columns which exist in the file.
+func (q *parquetFileQuerier) fileColumns(columns []string) []string {
+	result := make([]string, 0, len(columns))
+	for _, column := range columns {
+		if _, ok := q.file.Schema().Lookup(column); ok {
+			result = append(result, column)
+		}
+	}
+	return result
+}
+
+// selectSplitChunks selects the chunks in the query time range from the chunks file of the split layout.
+// Series without chunks in the time range are dropped when their chunks are read.
+func (q *parquetFileQuerier) selectSplitChunks() ([]dataset.SelectionResult, error) {
+	scanner := compute.NewScanner(q.chunksFile, q.chunksLoader, compute.TimeRangeOverlaps(q.mint, q.maxt))
+	return scanner.Select()
+}
+
+// projectSortedSeries projects the columns of row groups sorted by series, so that the rows of each series
+// are contiguous in the projection. Row groups of files which are sorted across row groups are read one
+// after the other. Time aligned row groups are only sorted within each time bucket, so they are projected
+// separately and merged by their sorting columns up to the series ID. Rows of a series are then returned
+// in the order of the row groups, which is the order of their time buckets.
+func (q *parquetFileQuerier) projectSortedSeries(selections []dataset.SelectionResult, batchSize int64, columns ...string) compute.Fragment {
+	if len(selections) == 1 || db.IsSortedAcrossRowGroups(q.file) {
+		return compute.ProjectSelections(selections, q.sectionLoader, batchSize, columns...)
+	}
+
+	// Sorting columns which are not projected are only read to compare rows, and are dropped by the merge.
+	numColumns := len(columns)
+	columns = slices.Clip(columns)
+	var keyColumns []int
+	for _, sortingColumn := range selections[0].RowGroup().SortingColumns() {
+		name := sortingColumn.Path()[0]
+		column := slices.Index(columns, name)
+		if column < 0 {
+			column = len(columns)
+			columns = append(columns, name)
+		}
+		keyColumns = append(keyColumns, column)
+		if name == schema.SeriesIDColumn {
+			break
+		}
+	}
+	inputs := make([]compute.Fragment, 0, len(selections))
+	for _, selection := range selections {
+		inputs = append(inputs, compute.ProjectSelections([]dataset.SelectionResult{selection}, q.sectionLoader, batchSize, columns...))
+	}
+	return compute.NewSortedMerge(inputs, keyColumns, numColumns)
+}
+
+// isSortedBySeries returns true if all selected row groups are sorted by series.
+func isSortedBySeries(selections []dataset.SelectionResult) bool {
+	for _, selection := range selections {
+		if !db.IsSortedBySeries(selection.RowGroup()) {
+			return false
+		}
+	}
+	return true
+}
+
+// selectedRowGroups returns the selections of row groups which have selected rows.
+func selectedRowGroups(selections []dataset.SelectionResult) []dataset.SelectionResult {
+	result := make([]dataset.SelectionResult, 0, len(selections))
+	for _, selection := range selections {
+		if selection.NumRows() > 0 {
+			result = append(result, selection)
+		}
+	}
+	return result
+}
+
+// seriesRowRanges returns the rows of all series matching the matchers in each row group.
+func seriesRowRanges(idx *index.Index, matchers []*labels.Matcher) [][]dataset.PickRange {
+	return indexRowRanges(idx, idx.Postings(matchers...))
+}
+
+// indexRowRanges returns the rows of the series with the given IDs in each row group.
+func indexRowRanges(idx *index.Index, ids []int64) [][]dataset.PickRange {
+	rowGroups := idx.RowRanges(ids)
+	ranges := make([][]dataset.PickRange, len(rowGroups))
+	for i, rowRanges := range rowGroups {
+		ranges[i] = make([]dataset.PickRange, 0, len(rowRanges))
+		for _, r := range rowRanges {
+			ranges[i] = append(ranges[i], dataset.Pick(r.From, r.To))
+		}
+	}
+	return ranges
 }
 
 func (q *parquetFileQuerier) Close() error { return nil }
 
+// LabelValues returns the sorted non-empty values of a label in series matching the matchers.
+// Series of the split layout are not joined with their chunks, so values of series without
+// chunks in the query time range can be returned.
 func (q *parquetFileQuerier) LabelValues(name string, matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
-	//TODO implement me
-	panic("implement me")
+	if _, ok := q.file.Schema().Lookup(name); !ok || schema.IsChunkColumn(name) {
+		return nil, nil, nil
+	}
+	selections, err := q.selectRows(matchers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var values []string
+	projection := compute.ProjectSelections(selectedRowGroups(selections), q.sectionLoader, q.labelsBatchSize, name)
+	err = readBatches(compute.UniqueByColumns([]int{0}, projection, q.spillOpts...), func(batch compute.Batch) error {
+		for _, value := range batch[0] {
+			if value := value.String(); value != "" {
+				values = append(values, value)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	slices.Sort(values)
+	return values, nil, nil
 }
 
+// LabelNames returns the sorted names of labels with a non-empty value in series matching the matchers.
+// Like LabelValues, it does not join series of the split layout with their chunks.
 func (q *parquetFileQuerier) LabelNames(matchers ...*labels.Matcher) ([]string, storage.Warnings, error) {
-	//TODO implement me
-	panic("implement me")
+	var columns []string
+	for _, path := range q.file.Schema().Columns() {
+		if !schema.IsChunkColumn(path[0]) {
+			columns = append(columns, path[0])
+		}
+	}
+	selections, err := q.selectRows(matchers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Each label column is read until its first non-empty value.
+	var names []string
+	selections = selectedRowGroups(selections)
+	for _, column := range columns {
+		projection := compute.ProjectSelections(selections, q.sectionLoader, q.labelsBatchSize, column)
+		found, err := hasNonEmptyValue(projection)
+		if err != nil {
+			return nil, nil, err
+		}
+		if found {
+			names = append(names, column)
+		}
+	}
+	slices.Sort(names)
+	return names, nil, nil
+}
+
+// hasNonEmptyValue returns true if the first column of the fragment has a non-empty value.
+// The fragment is closed once a value is found.
+func hasNonEmptyValue(fragment compute.Fragment) (bool, error) {
+	defer fragment.Close()
+	for {
+		batch, err := fragment.NextBatch()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		for _, value := range batch[0] {
+			if len(value.ByteArray()) > 0 {
+				return true, nil
+			}
+		}
+		fragment.Release(batch)
+	}
 }
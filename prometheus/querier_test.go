@@ -4,14 +4,23 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/segmentio/parquet-go"
+	"github.com/segmentio/parquet-go/encoding"
 	"github.com/stretchr/testify/require"
 	"github.com/thanos-io/objstore/providers/filesystem"
+	"golang.org/x/exp/slices"
 
+	"Shopify/thanos-parquet-engine/compute"
 	"Shopify/thanos-parquet-engine/db"
 	"Shopify/thanos-parquet-engine/schema"
 )
@@ -129,12 +138,16 @@ func TestQuerier(t *testing.T) {
 }
 
 func openParquetFile(dir string, cacheDir string) (*parquet.File, *db.FileReader, error) {
+	return openParquetPart(dir, cacheDir, "compact")
+}
+
+func openParquetPart(dir string, cacheDir string, partName string) (*parquet.File, *db.FileReader, error) {
 	bucket, err := filesystem.NewBucket(dir)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	reader, err := db.NewFileReader("compact", bucket, db.WithSectionCacheDir(cacheDir))
+	reader, err := db.NewFileReader(partName, bucket, db.WithSectionCacheDir(cacheDir))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -148,23 +161,26 @@ func openParquetFile(dir string, cacheDir string) (*parquet.File, *db.FileReader
 	return pqFile, reader, nil
 }
 
-func createParquetFile(t *testing.T, sset []labels.Labels) string {
+func createParquetFile(t *testing.T, sset []labels.Labels, opts ...db.WriterOption) string {
 	const (
 		numChunks = 3
 		oneMinute = 60_000
 	)
 
 	dir := t.TempDir()
-	writer := db.NewWriter(dir, []string{labels.MetricName, "job", "instance"})
+	writer, err := db.NewWriter(dir, []string{labels.MetricName, "job", "instance"}, opts...)
+	require.NoError(t, err)
 	minTime := int64(0)
 	for iChunk := 0; iChunk < numChunks; iChunk++ {
 		chunks := make([]schema.Chunk, 0, len(sset))
 		for iSeries, s := range sset {
 			chunk := schema.Chunk{
-				Labels:   s.Map(),
-				SeriesID: int64(iSeries),
-				MinT:     minTime,
-				MaxT:     minTime + oneMinute,
+				Labels:     s.Map(),
+				SeriesID:   int64(iSeries),
+				MinT:       minTime,
+				MaxT:       minTime + oneMinute,
+				ChunkBytes: makeConstChunk(t, minTime, minTime+oneMinute, 30_000),
+				Encoding:   chunkenc.EncXOR,
 			}
 			chunks = append(chunks, chunk)
 		}
@@ -176,6 +192,17 @@ func createParquetFile(t *testing.T, sset []labels.Labels) string {
 	return dir
 }
 
+// makeConstChunk returns the bytes of an XOR chunk with samples of value 1 from mint to maxt.
+func makeConstChunk(t testing.TB, mint, maxt, interval int64) []byte {
+	chunk := chunkenc.NewXORChunk()
+	app, err := chunk.Appender()
+	require.NoError(t, err)
+	for ts := mint; ts <= maxt; ts += interval {
+		app.Append(ts, 1)
+	}
+	return chunk.Bytes()
+}
+
 func expandSeries(sset storage.SeriesSet) ([]labels.Labels, error) {
 	var result []labels.Labels
 	for sset.Next() {
@@ -183,3 +210,833 @@ func expandSeries(sset storage.SeriesSet) ([]labels.Labels, error) {
 	}
 	return result, sset.Err()
 }
+
+func TestQuerierTimeRangeOverlaps(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+	}
+	dir := createParquetFile(t, series)
+	pqFile, reader, err := openParquetFile(dir, t.TempDir())
+	require.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		mint, maxt int64
+		expected   []labels.Labels
+	}{
+		{
+			name: "range within a single chunk",
+			mint: 70_000,
+			maxt: 80_000,
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0"),
+			},
+		},
+		{
+			name: "range straddling chunk boundaries",
+			mint: 170_000,
+			maxt: 200_000,
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0"),
+			},
+		},
+		{
+			name: "range ending at the first sample",
+			mint: -60_000,
+			maxt: 0,
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0"),
+			},
+		},
+		{
+			name: "range after all chunks",
+			mint: 180_001,
+			maxt: 240_000,
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			q, err := NewParquetFile(pqFile, reader.SectionLoader()).Querier(context.Background(), tcase.mint, tcase.maxt)
+			require.NoError(t, err)
+
+			matchers := []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "http_requests_total"),
+			}
+			result, err := expandSeries(q.Select(false, &storage.SelectHints{}, matchers...))
+			require.NoError(t, err)
+			require.Equal(t, tcase.expected, result)
+		})
+	}
+}
+
+func TestQuerierWithSeriesIndex(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "1"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "up", "job", "kubelet", "instance", "0"),
+	}
+	dir := createParquetFile(t, series, db.WithSeriesIndex())
+	pqFile, reader, err := openParquetFile(dir, t.TempDir())
+	require.NoError(t, err)
+
+	bucket, err := filesystem.NewBucket(dir)
+	require.NoError(t, err)
+	seriesIndex, err := db.ReadSeriesIndex("compact", bucket)
+	require.NoError(t, err)
+	require.Equal(t, len(series), seriesIndex.NumSeries())
+
+	cases := []struct {
+		name     string
+		matchers []*labels.Matcher
+		expected []labels.Labels
+	}{
+		{
+			name: "equal",
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "http_requests_total"),
+				labels.MustNewMatcher(labels.MatchEqual, "job", "api-server"),
+			},
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+			},
+		},
+		{
+			name: "regex and not equal",
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchRegexp, labels.MetricName, ".+"),
+				labels.MustNewMatcher(labels.MatchNotEqual, "job", "api-server"),
+			},
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "2", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "3", "instance", "0"),
+			},
+		},
+		{
+			name: "no matching series",
+			matchers: []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, "job", "node"),
+			},
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			for _, function := range []string{"", "series"} {
+				hints := &storage.SelectHints{Func: function, Grouping: []string{"instance"}}
+				for _, opts := range [][]QuerierOpts{nil, {WithSeriesIndex(seriesIndex)}} {
+					q, err := NewParquetFile(pqFile, reader.SectionLoader(), opts...).Querier(context.Background(), math.MinInt64, math.MaxInt64)
+					require.NoError(t, err)
+
+					result, err := expandSeries(q.Select(false, hints, tcase.matchers...))
+					require.NoError(t, err)
+					require.ElementsMatch(t, tcase.expected, result)
+
+					// No series have chunks after the last chunk.
+					q, err = NewParquetFile(pqFile, reader.SectionLoader(), opts...).Querier(context.Background(), 200_000, math.MaxInt64)
+					require.NoError(t, err)
+					result, err = expandSeries(q.Select(false, hints, tcase.matchers...))
+					require.NoError(t, err)
+					require.Empty(t, result)
+				}
+			}
+		})
+	}
+
+	t.Run("labels are read from the index", func(t *testing.T) {
+		loader := &recordingSectionLoader{SectionLoader: reader.SectionLoader()}
+		q, err := NewParquetFile(pqFile, loader, WithSeriesIndex(seriesIndex)).Querier(context.Background(), math.MinInt64, math.MaxInt64)
+		require.NoError(t, err)
+		sset := q.Select(false, &storage.SelectHints{Grouping: []string{"job", "instance"}}, labels.MustNewMatcher(labels.MatchEqual, "job", "kubelet"))
+		result, err := expandSeries(sset)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []labels.Labels{
+			{{Name: schema.SeriesIDColumn, Value: "2"}, {Name: "job", Value: "kubelet"}, {Name: "instance", Value: "0"}},
+			{{Name: schema.SeriesIDColumn, Value: "3"}, {Name: "job", Value: "kubelet"}, {Name: "instance", Value: "0"}},
+		}, result)
+		require.NotEmpty(t, loader.sections)
+
+		for _, rowGroup := range pqFile.Metadata().RowGroups {
+			for _, column := range rowGroup.Columns {
+				if !slices.Contains([]string{labels.MetricName, "job", "instance"}, column.MetaData.PathInSchema[0]) {
+					continue
+				}
+				from := column.MetaData.DataPageOffset
+				if column.MetaData.DictionaryPageOffset > 0 {
+					from = column.MetaData.DictionaryPageOffset
+				}
+				to := from + column.MetaData.TotalCompressedSize
+				for _, section := range loader.sections {
+					require.False(t, section[0] < to && section[1] > from, "section %v overlaps column %v", section, column.MetaData.PathInSchema)
+				}
+			}
+		}
+	})
+}
+
+// recordingSectionLoader records the byte ranges of the sections it creates.
+// Columns are projected concurrently, so sections are recorded under a lock.
+type recordingSectionLoader struct {
+	db.SectionLoader
+
+	mu       sync.Mutex
+	sections [][2]int64
+}
+
+func (r *recordingSectionLoader) NewSectionSize(from, to, size int64) (db.Section, error) {
+	r.record(from, to)
+	return r.SectionLoader.NewSectionSize(from, to, size)
+}
+
+func (r *recordingSectionLoader) NewSection(from, to int64) (db.Section, error) {
+	r.record(from, to)
+	return r.SectionLoader.NewSection(from, to)
+}
+
+func (r *recordingSectionLoader) record(from, to int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sections = append(r.sections, [2]int64{from, to})
+}
+
+func TestQuerierSplitLayout(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "1"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+	}
+	dir := createParquetFile(t, series, db.WithSplitLayout())
+	labelsFile, labelsReader, err := openParquetPart(dir, t.TempDir(), "compact.labels")
+	require.NoError(t, err)
+	chunksFile, chunksReader, err := openParquetPart(dir, t.TempDir(), "compact")
+	require.NoError(t, err)
+
+	cases := []struct {
+		name       string
+		mint, maxt int64
+		function   string
+		expected   []labels.Labels
+	}{
+		{
+			name: "series with chunks in the time range",
+			mint: 0,
+			maxt: 180_000,
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+			},
+		},
+		{
+			name: "no chunks in the time range",
+			mint: 200_000,
+			maxt: 300_000,
+		},
+		{
+			name:     "series query without chunks in the time range",
+			mint:     200_000,
+			maxt:     300_000,
+			function: "series",
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+			},
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			queryable := NewSplitParquetFiles(labelsFile, labelsReader.SectionLoader(), chunksFile, chunksReader.SectionLoader())
+			q, err := queryable.Querier(context.Background(), tcase.mint, tcase.maxt)
+			require.NoError(t, err)
+
+			matchers := []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, "job", "api-server"),
+			}
+			hints := &storage.SelectHints{Grouping: []string{"instance"}, Func: tcase.function}
+			result, err := expandSeries(q.Select(false, hints, matchers...))
+			require.NoError(t, err)
+			require.ElementsMatch(t, tcase.expected, result)
+		})
+	}
+}
+
+func TestQuerierSpillOptions(t *testing.T) {
+	var series []labels.Labels
+	for i := 0; i < 6; i++ {
+		series = append(series, labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", strconv.Itoa(i)))
+	}
+	// Series span multiple row groups, so they are deduplicated by hash.
+	pqFile, reader, err := openParquetFile(createParquetFile(t, series, db.WithRowGroupRows(4)), t.TempDir())
+	require.NoError(t, err)
+	require.Greater(t, len(pqFile.RowGroups()), 1)
+
+	// The spill dir does not exist until rows are spilled.
+	spillDir := filepath.Join(reader.SectionCacheDir(), "spill")
+	spillOpts := WithSpillOptions(compute.WithMemoryLimit(1), compute.WithSpillDir(spillDir))
+	for _, function := range []string{"", "series"} {
+		hints := &storage.SelectHints{Func: function, Grouping: []string{"instance"}}
+		var results [][]labels.Labels
+		for _, opts := range [][]QuerierOpts{nil, {spillOpts}} {
+			q, err := NewParquetFile(pqFile, reader.SectionLoader(), opts...).Querier(context.Background(), math.MinInt64, math.MaxInt64)
+			require.NoError(t, err)
+			result, err := expandSeries(q.Select(false, hints))
+			require.NoError(t, err)
+			results = append(results, result)
+		}
+		require.Len(t, results[0], len(series))
+		require.ElementsMatch(t, results[0], results[1])
+	}
+
+	q, err := NewParquetFile(pqFile, reader.SectionLoader(), spillOpts).Querier(context.Background(), math.MinInt64, math.MaxInt64)
+	require.NoError(t, err)
+	values, _, err := q.LabelValues("instance")
+	require.NoError(t, err)
+	require.Equal(t, []string{"0", "1", "2", "3", "4", "5"}, values)
+
+	files, err := os.ReadDir(spillDir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestQuerierSeriesLimit(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "1"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "up", "job", "kubelet", "instance", "0"),
+	}
+	pqFile, reader, err := openParquetFile(createParquetFile(t, series), t.TempDir())
+	require.NoError(t, err)
+	splitDir := createParquetFile(t, series, db.WithSplitLayout())
+	labelsFile, labelsReader, err := openParquetPart(splitDir, t.TempDir(), "compact.labels")
+	require.NoError(t, err)
+	chunksFile, chunksReader, err := openParquetPart(splitDir, t.TempDir(), "compact")
+	require.NoError(t, err)
+
+	queryables := map[string]func(opts ...QuerierOpts) storage.Queryable{
+		"single file": func(opts ...QuerierOpts) storage.Queryable {
+			return NewParquetFile(pqFile, reader.SectionLoader(), opts...)
+		},
+		"split layout": func(opts ...QuerierOpts) storage.Queryable {
+			return NewSplitParquetFiles(labelsFile, labelsReader.SectionLoader(), chunksFile, chunksReader.SectionLoader(), opts...)
+		},
+	}
+	cases := []struct {
+		name     string
+		limit    int
+		function string
+		expected []labels.Labels
+	}{
+		{
+			name:  "limit below the number of series",
+			limit: 2,
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "2", "instance", "0"),
+			},
+		},
+		{
+			name:  "limit above the number of series",
+			limit: 10,
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "2", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+			},
+		},
+		{
+			name:     "series query",
+			limit:    1,
+			function: "series",
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+			},
+		},
+	}
+	for name, queryable := range queryables {
+		for _, tcase := range cases {
+			t.Run(name+"/"+tcase.name, func(t *testing.T) {
+				matchers := []*labels.Matcher{
+					labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "http_requests_total"),
+				}
+				hints := &storage.SelectHints{Grouping: []string{"instance"}, Func: tcase.function}
+
+				q, err := queryable(WithSeriesLimit(tcase.limit)).Querier(context.Background(), math.MinInt64, math.MaxInt64)
+				require.NoError(t, err)
+				result, err := expandSeries(q.Select(false, hints, matchers...))
+				require.NoError(t, err)
+				require.ElementsMatch(t, tcase.expected, result)
+				if tcase.function == "series" {
+					return
+				}
+
+				// Series within the limit have all their samples.
+				q, err = queryable(WithSeriesLimit(tcase.limit)).Querier(context.Background(), math.MinInt64, math.MaxInt64)
+				require.NoError(t, err)
+				samples, err := expandSamples(q.Select(false, hints, matchers...))
+				require.NoError(t, err)
+				require.Len(t, samples, len(tcase.expected))
+				for _, timestamps := range samples {
+					require.Len(t, timestamps, 7)
+				}
+			})
+		}
+	}
+}
+
+func TestQuerierSortedBySeries(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "1"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "up", "job", "kubelet", "instance", "0"),
+	}
+	timeSortedFile, timeSortedReader, err := openParquetFile(createParquetFile(t, series), t.TempDir())
+	require.NoError(t, err)
+	require.False(t, db.IsSortedBySeries(timeSortedFile.RowGroups()[0]))
+	seriesSortedFile, seriesSortedReader, err := openParquetFile(createParquetFile(t, series, db.WithSortOrder(db.SortBySeries)), t.TempDir())
+	require.NoError(t, err)
+	require.True(t, db.IsSortedBySeries(seriesSortedFile.RowGroups()[0]))
+
+	cases := []struct {
+		name       string
+		mint, maxt int64
+		function   string
+		grouping   []string
+		expected   []labels.Labels
+	}{
+		{
+			name: "all chunks",
+			mint: math.MinInt64,
+			maxt: math.MaxInt64,
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "2", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+			},
+			grouping: []string{"instance"},
+		},
+		{
+			name: "chunks in the time range",
+			mint: 70_000,
+			maxt: 130_000,
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "2", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+			},
+			grouping: []string{"instance"},
+		},
+		{
+			name:     "series query",
+			mint:     math.MinInt64,
+			maxt:     math.MaxInt64,
+			function: "series",
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "job", "api-server"),
+				labels.FromStrings(schema.SeriesIDColumn, "2", "job", "kubelet"),
+				labels.FromStrings(schema.SeriesIDColumn, "1", "job", "api-server"),
+			},
+			grouping: []string{"job"},
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			matchers := []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "http_requests_total"),
+			}
+			hints := &storage.SelectHints{Grouping: tcase.grouping, Func: tcase.function}
+
+			q, err := NewParquetFile(timeSortedFile, timeSortedReader.SectionLoader()).Querier(context.Background(), tcase.mint, tcase.maxt)
+			require.NoError(t, err)
+			expectedSamples, err := expandSamples(q.Select(false, hints, matchers...))
+			require.NoError(t, err)
+
+			for _, batchSize := range []int64{1, 2, defaultLabelsBatchSize} {
+				q, err := NewParquetFile(seriesSortedFile, seriesSortedReader.SectionLoader(), WithLabelsBatchSize(batchSize)).Querier(context.Background(), tcase.mint, tcase.maxt)
+				require.NoError(t, err)
+
+				result, err := expandSeries(q.Select(false, hints, matchers...))
+				require.NoError(t, err)
+				require.Equal(t, tcase.expected, result)
+
+				samples, err := expandSamples(q.Select(false, hints, matchers...))
+				require.NoError(t, err)
+				require.Equal(t, expectedSamples, samples)
+			}
+		})
+	}
+}
+
+func TestQuerierRowGroups(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "1"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+	}
+	expectedSeries := []labels.Labels{
+		labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+		labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+		labels.FromStrings(schema.SeriesIDColumn, "2", "instance", "0"),
+	}
+	file, reader, err := openParquetFile(createParquetFile(t, series), t.TempDir())
+	require.NoError(t, err)
+	require.Len(t, file.RowGroups(), 1)
+	expectedSamples, err := expandSamples(selectAll(t, NewParquetFile(file, reader.SectionLoader()), ""))
+	require.NoError(t, err)
+
+	cases := []struct {
+		name string
+		opts []db.WriterOption
+		// sortedBySeries is set when series are streamed with their chunks across all row groups.
+		sortedBySeries bool
+	}{
+		{name: "sorted by time", opts: []db.WriterOption{db.WithRowGroupRows(2)}},
+		{name: "sorted by series", opts: []db.WriterOption{db.WithRowGroupRows(2), db.WithSortOrder(db.SortBySeries)}, sortedBySeries: true},
+		{name: "time aligned", opts: []db.WriterOption{db.WithTimeAlignedRowGroups(time.Minute), db.WithSortOrder(db.SortBySeries)}, sortedBySeries: true},
+		{name: "split layout", opts: []db.WriterOption{db.WithRowGroupRows(2), db.WithSplitLayout()}},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			dir := createParquetFile(t, series, tcase.opts...)
+			var queryable storage.Queryable
+			if tcase.name == "split layout" {
+				labelsFile, labelsReader, err := openParquetPart(dir, t.TempDir(), "compact.labels")
+				require.NoError(t, err)
+				chunksFile, chunksReader, err := openParquetPart(dir, t.TempDir(), "compact")
+				require.NoError(t, err)
+				require.Greater(t, len(labelsFile.RowGroups()), 1)
+				require.Greater(t, len(chunksFile.RowGroups()), 1)
+				queryable = NewSplitParquetFiles(labelsFile, labelsReader.SectionLoader(), chunksFile, chunksReader.SectionLoader())
+			} else {
+				file, reader, err := openParquetFile(dir, t.TempDir())
+				require.NoError(t, err)
+				require.Greater(t, len(file.RowGroups()), 1)
+				queryable = NewParquetFile(file, reader.SectionLoader())
+			}
+
+			result, err := expandSeries(selectAll(t, queryable, "series"))
+			require.NoError(t, err)
+			require.ElementsMatch(t, expectedSeries, result)
+
+			sset := selectAll(t, queryable, "")
+			_, sorted := sset.(*sortedSeriesSet)
+			require.Equal(t, tcase.sortedBySeries, sorted)
+			result, err = expandSeries(sset)
+			require.NoError(t, err)
+			require.ElementsMatch(t, expectedSeries, result)
+
+			samples, err := expandSamples(selectAll(t, queryable, ""))
+			require.NoError(t, err)
+			require.Equal(t, expectedSamples, samples)
+		})
+	}
+}
+
+func TestQuerierRowGroupStats(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "1"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+	}
+	// Each row group has the three chunks of one series. Rows are sorted by instance
+	// before job, so the series of the kubelet job is in the second row group.
+	dir := createParquetFile(t, series, db.WithRowGroupRows(3), db.WithSortOrder(db.SortBySeries))
+	file, reader, err := openParquetFile(dir, t.TempDir())
+	require.NoError(t, err)
+	require.Len(t, file.RowGroups(), 3)
+
+	// Each row group has a single job, so the other row groups are skipped by footer statistics.
+	cases := []struct {
+		job            string
+		expected       []labels.Labels
+		skippedByStats int64
+	}{
+		{
+			job: "api-server",
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+			},
+			skippedByStats: 1,
+		},
+		{
+			job: "kubelet",
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "2", "instance", "0"),
+			},
+			skippedByStats: 2,
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.job, func(t *testing.T) {
+			matchers := []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", tcase.job)}
+			q, err := NewParquetFile(file, reader.SectionLoader()).Querier(context.Background(), math.MinInt64, math.MaxInt64)
+			require.NoError(t, err)
+			result, err := expandSeries(q.Select(false, &storage.SelectHints{Grouping: []string{"instance"}}, matchers...))
+			require.NoError(t, err)
+			require.ElementsMatch(t, tcase.expected, result)
+
+			// The querier does not expose its stats, so the scan of the querier is repeated.
+			scanner := compute.NewScanner(file, reader.SectionLoader(), MatcherOptions(matchers)...)
+			_, err = scanner.Select()
+			require.NoError(t, err)
+			stats := scanner.Stats().Children[0]
+			require.Equal(t, "Predicate[job]", stats.Name)
+			require.Contains(t, stats.Stats, compute.Stat{Name: "row_groups_skipped_by_stats", Value: tcase.skippedByStats})
+			require.Contains(t, stats.Stats, compute.Stat{Name: "row_groups_skipped_by_bloom", Value: int64(0)})
+		})
+	}
+}
+
+func TestQuerierLabelsEncoding(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "1"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+	}
+	matchers := []struct {
+		matcher  *labels.Matcher
+		expected []labels.Labels
+	}{
+		{
+			matcher: labels.MustNewMatcher(labels.MatchEqual, "job", "kubelet"),
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "2", "instance", "0"),
+			},
+		},
+		{
+			matcher: labels.MustNewMatcher(labels.MatchNotEqual, "instance", "0"),
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+			},
+		},
+		{
+			matcher: labels.MustNewMatcher(labels.MatchRegexp, "job", "api-.*"),
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+			},
+		},
+		{
+			matcher: labels.MustNewMatcher(labels.MatchNotRegexp, "job", "kubelet|scheduler"),
+			expected: []labels.Labels{
+				labels.FromStrings(schema.SeriesIDColumn, "0", "instance", "0"),
+				labels.FromStrings(schema.SeriesIDColumn, "1", "instance", "1"),
+			},
+		},
+	}
+	for _, enc := range []encoding.Encoding{&parquet.Plain, &parquet.DeltaByteArray, &parquet.DeltaLengthByteArray} {
+		t.Run(enc.String(), func(t *testing.T) {
+			dir := createParquetFile(t, series, db.WithSchemaOptions(schema.WithLabelsEncoding(enc)))
+			file, reader, err := openParquetFile(dir, t.TempDir())
+			require.NoError(t, err)
+			job, ok := file.Schema().Lookup("job")
+			require.True(t, ok)
+			require.Equal(t, enc.Encoding(), job.Node.Encoding().Encoding())
+
+			for _, m := range matchers {
+				t.Run(m.matcher.String(), func(t *testing.T) {
+					q, err := NewParquetFile(file, reader.SectionLoader()).Querier(context.Background(), math.MinInt64, math.MaxInt64)
+					require.NoError(t, err)
+					hints := &storage.SelectHints{Grouping: []string{"instance"}}
+					result, err := expandSeries(q.Select(false, hints, m.matcher))
+					require.NoError(t, err)
+					require.ElementsMatch(t, m.expected, result)
+				})
+			}
+		})
+	}
+}
+
+func TestLateChunksSeriesSet(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "1"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+	}
+	file, reader, err := openParquetFile(createParquetFile(t, series, db.WithRowGroupRows(2)), t.TempDir())
+	require.NoError(t, err)
+	expectedSamples, err := expandSamples(selectAll(t, NewParquetFile(file, reader.SectionLoader()), ""))
+	require.NoError(t, err)
+	require.Len(t, expectedSamples, len(series))
+
+	newSeriesSet := func(limit, batchSize int) *lateChunksSeriesSet {
+		selections, err := compute.NewScanner(file, reader.SectionLoader()).Select()
+		require.NoError(t, err)
+		labelColumns := []string{schema.SeriesIDColumn}
+		projection := compute.ProjectSelections(selections, reader.SectionLoader(), defaultLabelsBatchSize, labelColumns...)
+		resolved, err := readSeriesLabels(labelColumns, compute.UniqueByColumn(0, projection), math.MinInt64, math.MaxInt64)
+		require.NoError(t, err)
+		sset, err := newLateChunksSeriesSet(resolved, selections, reader.SectionLoader(), limit, batchSize)
+		require.NoError(t, err)
+		return sset
+	}
+
+	for _, batchSize := range []int{1, 2, 3, chunksSeriesBatchSize} {
+		t.Run(fmt.Sprintf("batch size %d", batchSize), func(t *testing.T) {
+			samples, err := expandSamples(newSeriesSet(0, batchSize))
+			require.NoError(t, err)
+			require.Equal(t, expectedSamples, samples)
+
+			samples, err = expandSamples(newSeriesSet(2, batchSize))
+			require.NoError(t, err)
+			require.Len(t, samples, 2)
+			for id, timestamps := range samples {
+				require.Equal(t, expectedSamples[id], timestamps)
+			}
+		})
+	}
+
+	t.Run("chunks are read by batch", func(t *testing.T) {
+		sset := newSeriesSet(0, 2)
+		require.True(t, sset.Next())
+		require.NotEmpty(t, sset.series[0].chunks)
+		require.NotEmpty(t, sset.series[1].chunks)
+		require.Empty(t, sset.series[2].chunks)
+		require.True(t, sset.Next())
+		require.Nil(t, sset.series[0].series)
+		require.True(t, sset.Next())
+		require.NotEmpty(t, sset.series[2].chunks)
+		require.False(t, sset.Next())
+		require.False(t, sset.Next())
+		require.NoError(t, sset.Err())
+	})
+}
+
+// selectAll selects all http_requests_total series, grouped by instance.
+func selectAll(t *testing.T, queryable storage.Queryable, function string) storage.SeriesSet {
+	q, err := queryable.Querier(context.Background(), math.MinInt64, math.MaxInt64)
+	require.NoError(t, err)
+	hints := &storage.SelectHints{Grouping: []string{"instance"}, Func: function}
+	return q.Select(false, hints, labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "http_requests_total"))
+}
+
+// expandSamples returns the timestamps of the samples of each series by its series ID.
+func expandSamples(sset storage.SeriesSet) (map[string][]int64, error) {
+	result := make(map[string][]int64)
+	for sset.Next() {
+		s := sset.At()
+		seriesID := s.Labels().Get(schema.SeriesIDColumn)
+		result[seriesID] = []int64{}
+		it := s.Iterator(nil)
+		for it.Next() != chunkenc.ValNone {
+			result[seriesID] = append(result[seriesID], it.AtT())
+		}
+		if it.Err() != nil {
+			return nil, it.Err()
+		}
+	}
+	return result, sset.Err()
+}
+
+func TestQuerierMissingLabel(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "1"),
+	}
+	pqFile, reader, err := openParquetFile(createParquetFile(t, series), t.TempDir())
+	require.NoError(t, err)
+
+	allSeries := []labels.Labels{
+		labels.FromStrings(schema.SeriesIDColumn, "0"),
+		labels.FromStrings(schema.SeriesIDColumn, "1"),
+	}
+	// Labels which are not in the file have empty values, like in Prometheus.
+	cases := []struct {
+		matcher  *labels.Matcher
+		expected []labels.Labels
+	}{
+		{matcher: labels.MustNewMatcher(labels.MatchEqual, "zone", "eu"), expected: nil},
+		{matcher: labels.MustNewMatcher(labels.MatchEqual, "zone", ""), expected: allSeries},
+		{matcher: labels.MustNewMatcher(labels.MatchNotEqual, "zone", "eu"), expected: allSeries},
+		{matcher: labels.MustNewMatcher(labels.MatchNotEqual, "zone", ""), expected: nil},
+		{matcher: labels.MustNewMatcher(labels.MatchRegexp, "zone", "eu.*"), expected: nil},
+		{matcher: labels.MustNewMatcher(labels.MatchRegexp, "zone", "eu|us"), expected: nil},
+		{matcher: labels.MustNewMatcher(labels.MatchRegexp, "zone", "eu|"), expected: allSeries},
+		{matcher: labels.MustNewMatcher(labels.MatchRegexp, "zone", ".*"), expected: allSeries},
+		{matcher: labels.MustNewMatcher(labels.MatchNotRegexp, "zone", "eu.*"), expected: allSeries},
+		{matcher: labels.MustNewMatcher(labels.MatchNotRegexp, "zone", "eu|us"), expected: allSeries},
+		{matcher: labels.MustNewMatcher(labels.MatchNotRegexp, "zone", "eu|"), expected: nil},
+		{matcher: labels.MustNewMatcher(labels.MatchNotRegexp, "zone", ".*"), expected: nil},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.matcher.String(), func(t *testing.T) {
+			q, err := NewParquetFile(pqFile, reader.SectionLoader()).Querier(context.Background(), math.MinInt64, math.MaxInt64)
+			require.NoError(t, err)
+
+			matchers := []*labels.Matcher{
+				labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "http_requests_total"),
+				tcase.matcher,
+			}
+			result, err := expandSeries(q.Select(false, &storage.SelectHints{}, matchers...))
+			require.NoError(t, err)
+			require.ElementsMatch(t, tcase.expected, result)
+		})
+	}
+}
+
+func TestQuerierLabelValuesAndNames(t *testing.T) {
+	series := []labels.Labels{
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "api-server", "instance", "1"),
+		labels.FromStrings(labels.MetricName, "http_requests_total", "job", "kubelet", "instance", "0"),
+		labels.FromStrings(labels.MetricName, "up", "job", "kubelet"),
+	}
+	pqFile, reader, err := openParquetFile(createParquetFile(t, series), t.TempDir())
+	require.NoError(t, err)
+
+	cases := []struct {
+		name           string
+		matchers       []*labels.Matcher
+		expectedValues map[string][]string
+		expectedNames  []string
+	}{
+		{
+			name: "all series",
+			expectedValues: map[string][]string{
+				labels.MetricName:     {"http_requests_total", "up"},
+				"job":                 {"api-server", "kubelet"},
+				"instance":            {"0", "1"},
+				"zone":                nil,
+				schema.SeriesIDColumn: nil,
+			},
+			expectedNames: []string{labels.MetricName, "instance", "job"},
+		},
+		{
+			name:     "matching series",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "kubelet")},
+			expectedValues: map[string][]string{
+				labels.MetricName: {"http_requests_total", "up"},
+				"instance":        {"0"},
+			},
+			expectedNames: []string{labels.MetricName, "instance", "job"},
+		},
+		{
+			name:     "series without a label",
+			matchers: []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, labels.MetricName, "up")},
+			expectedValues: map[string][]string{
+				"instance": nil,
+			},
+			expectedNames: []string{labels.MetricName, "job"},
+		},
+		{
+			name:          "no matching series",
+			matchers:      []*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, "job", "node")},
+			expectedNames: nil,
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			q, err := NewParquetFile(pqFile, reader.SectionLoader()).Querier(context.Background(), math.MinInt64, math.MaxInt64)
+			require.NoError(t, err)
+
+			for name, expected := range tcase.expectedValues {
+				values, _, err := q.LabelValues(name, tcase.matchers...)
+				require.NoError(t, err)
+				require.Equal(t, expected, values, name)
+			}
+			names, _, err := q.LabelNames(tcase.matchers...)
+			require.NoError(t, err)
+			require.Equal(t, tcase.expectedNames, names)
+		})
+	}
+}
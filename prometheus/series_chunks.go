@@ -0,0 +1,297 @@
+package prometheus
+
+import (
+	"io"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"golang.org/x/exp/slices"
+
+	"Shopify/thanos-parquet-engine/compute"
+	"Shopify/thanos-parquet-engine/dataset"
+	"Shopify/thanos-parquet-engine/db"
+	"Shopify/thanos-parquet-engine/schema"
+)
+
+// chunkColumns are the columns projected to read chunks. Files written before the
+// encoding column was added do not have it, and only contain XOR chunks.
+var chunkColumns = []string{
+	schema.SeriesIDColumn,
+	schema.MinTColumn,
+	schema.MaxTColumn,
+	schema.ChunkBytesColumn,
+	schema.ChunkEncodingColumn,
+}
+
+// chunksSeriesBatchSize is the number of series whose chunks are read together
+// when chunks are read after labels.
+const chunksSeriesBatchSize = 1024
+
+// maxChunkPageGap is the largest gap in bytes between selected pages of chunk columns
+// which are read in the same section.
+const maxChunkPageGap = 1024 * 1024
+
+// resolvedSeries is a series whose labels have been read before its chunks.
+type resolvedSeries struct {
+	id int64
+	*series
+}
+
+// readSeriesLabels reads the labels of all series from a projection of the label columns,
+// which must have the series ID as its first column.
+func readSeriesLabels(labelNames []string, fragment compute.Fragment, mint, maxt int64) ([]resolvedSeries, error) {
+	var result []resolvedSeries
+	err := readBatches(fragment, func(batch compute.Batch) error {
+		for row := range batch[0] {
+			lbls := make(labels.Labels, len(labelNames))
+			for i, name := range labelNames {
+				lbls[i] = labels.Label{Name: name, Value: batch[i][row].String()}
+			}
+			result = append(result, resolvedSeries{
+				id:     batch[0][row].Int64(),
+				series: &series{labels: lbls, mint: mint, maxt: maxt},
+			})
+		}
+		return nil
+	})
+	return result, err
+}
+
+// lateChunksSeriesSet reads the chunks of series whose labels have already been resolved.
+// Chunk bytes are materialized last, only for the rows of series which are returned:
+//  1. The series ID column of each row group is projected to find the selected rows of each series.
+//  2. Series without selected rows are dropped, and at most limit series are kept when limit is positive.
+//  3. The other chunk columns are projected for the rows of a batch of series at a time, with
+//     pages which are close to each other read together. Chunks of the next batch are only
+//     read once all series of the current batch have been returned.
+type lateChunksSeriesSet struct {
+	selections []dataset.SelectionResult
+	loader     db.SectionLoader
+	batchSize  int
+
+	series []resolvedSeries
+	// batches has the selected rows of each row group for each batch of series.
+	batches [][]seriesRows
+	current int
+	err     error
+}
+
+// seriesRows are selected rows of a row group, with the series ID of each row.
+type seriesRows struct {
+	rows   []int64
+	series []int64
+}
+
+func newLateChunksSeriesSet(resolved []resolvedSeries, selections []dataset.SelectionResult, loader db.SectionLoader, limit int, batchSize int) (*lateChunksSeriesSet, error) {
+	rowGroups := make([]seriesRows, len(selections))
+	hasRows := make(map[int64]struct{}, len(resolved))
+	for i, selection := range selections {
+		if selection.NumRows() == 0 {
+			continue
+		}
+		var err error
+		rowGroups[i].rows, rowGroups[i].series, err = readSeriesRows(selection, loader)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range rowGroups[i].series {
+			hasRows[id] = struct{}{}
+		}
+	}
+
+	batchOf := make(map[int64]int, len(resolved))
+	result := resolved[:0]
+	for _, s := range resolved {
+		if limit > 0 && len(result) == limit {
+			break
+		}
+		if _, ok := hasRows[s.id]; ok {
+			batchOf[s.id] = len(result) / batchSize
+			result = append(result, s)
+		}
+	}
+
+	batches := make([][]seriesRows, (len(result)+batchSize-1)/batchSize)
+	for i := range batches {
+		batches[i] = make([]seriesRows, len(selections))
+	}
+	for i, rowGroup := range rowGroups {
+		for j, row := range rowGroup.rows {
+			batch, ok := batchOf[rowGroup.series[j]]
+			if !ok {
+				continue
+			}
+			batches[batch][i].rows = append(batches[batch][i].rows, row)
+			batches[batch][i].series = append(batches[batch][i].series, rowGroup.series[j])
+		}
+	}
+
+	return &lateChunksSeriesSet{
+		selections: selections,
+		loader:     loader,
+		batchSize:  batchSize,
+		series:     result,
+		batches:    batches,
+		current:    -1,
+	}, nil
+}
+
+func (s *lateChunksSeriesSet) Next() bool {
+	if s.current >= 0 && s.current < len(s.series) {
+		// Series which have been returned are not referenced anymore, so that their chunks can be freed.
+		s.series[s.current] = resolvedSeries{}
+	}
+	s.current++
+	if s.err != nil || s.current >= len(s.series) {
+		return false
+	}
+	if s.current%s.batchSize == 0 {
+		batch := s.current / s.batchSize
+		if err := s.readBatch(batch); err != nil {
+			s.err = err
+			return false
+		}
+		s.batches[batch] = nil
+	}
+	return true
+}
+
+// readBatch reads the chunks of the series of a batch from all row groups.
+func (s *lateChunksSeriesSet) readBatch(batch int) error {
+	to := (batch + 1) * s.batchSize
+	if to > len(s.series) {
+		to = len(s.series)
+	}
+	seriesByID := make(map[int64]*series, to-batch*s.batchSize)
+	for _, resolved := range s.series[batch*s.batchSize : to] {
+		seriesByID[resolved.id] = resolved.series
+	}
+
+	for i, rows := range s.batches[batch] {
+		if len(rows.rows) == 0 {
+			continue
+		}
+		if err := readRowGroupChunks(s.selections[i], s.loader, rows, seriesByID); err != nil {
+			return err
+		}
+	}
+	for _, batchSeries := range seriesByID {
+		slices.SortFunc(batchSeries.chunks, func(a, b chunks.Meta) bool {
+			return a.MinTime < b.MinTime
+		})
+	}
+	return nil
+}
+
+func (s *lateChunksSeriesSet) At() storage.Series { return s.series[s.current].series }
+
+func (s *lateChunksSeriesSet) Err() error { return s.err }
+
+func (s *lateChunksSeriesSet) Warnings() storage.Warnings { return nil }
+
+// readRowGroupChunks appends the chunks in the rows of a row group to their series.
+func readRowGroupChunks(selection dataset.SelectionResult, loader db.SectionLoader, rows seriesRows, seriesByID map[int64]*series) error {
+	// Rows are picked in ranges of consecutive rows.
+	var (
+		ranges   []dataset.PickRange
+		from, to int64 = -1, -1
+	)
+	for _, row := range rows.rows {
+		if row != to {
+			if from >= 0 {
+				ranges = append(ranges, dataset.Pick(from, to))
+			}
+			from = row
+		}
+		to = row + 1
+	}
+	selection = dataset.NewSelectionResult(selection.RowGroup(), append(ranges, dataset.Pick(from, to)))
+
+	projection, err := compute.ProjectSparseColumns(selection, loader, defaultChunksBatchSize, maxChunkPageGap, chunkColumns[1:]...)
+	if err != nil {
+		return err
+	}
+	defer projection.Close()
+	rowSeries := rows.series
+	for {
+		batch, err := projection.NextBatch()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for row := 0; row < batch[0].Len(); row++ {
+			encoding := chunkenc.EncXOR
+			if len(batch) == len(chunkColumns)-1 {
+				encoding = chunkenc.Encoding(batch[3].Int32[row])
+			}
+			chk, err := decodeChunk(encoding, batch[0].Int64[row], batch[1].Int64[row], batch[2].ByteArray(row))
+			if err != nil {
+				projection.Release(batch)
+				return err
+			}
+			s := seriesByID[rowSeries[0]]
+			s.chunks = append(s.chunks, chk)
+			rowSeries = rowSeries[1:]
+		}
+		projection.Release(batch)
+	}
+}
+
+// readSeriesRows returns the selected rows and the series ID of each row.
+func readSeriesRows(selection dataset.SelectionResult, loader db.SectionLoader) ([]int64, []int64, error) {
+	projection, err := compute.ProjectTypedColumns(selection, loader, defaultLabelsBatchSize, schema.SeriesIDColumn)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer projection.Close()
+
+	rowSeries := make([]int64, 0, selection.NumRows())
+	for {
+		batch, err := projection.NextBatch()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		rowSeries = append(rowSeries, batch[0].Int64...)
+		projection.Release(batch)
+	}
+
+	rows := make([]int64, 0, len(rowSeries))
+	for ranges := dataset.NewRowRangeIterator(selection); ranges.Next(); {
+		from, to := ranges.At()
+		for row := from; row < to; row++ {
+			rows = append(rows, row)
+		}
+	}
+	return rows, rowSeries, nil
+}
+
+// readChunk decodes the chunk in a row of the chunk columns following the series ID.
+// The encoding column is optional.
+func readChunk(columns compute.Batch, row int) (chunks.Meta, error) {
+	encoding := chunkenc.EncXOR
+	if len(columns) == len(chunkColumns)-1 {
+		encoding = chunkenc.Encoding(columns[3][row].Int32())
+	}
+	return decodeChunk(encoding, columns[0][row].Int64(), columns[1][row].Int64(), columns[2][row].ByteArray())
+}
+
+// decodeChunk decodes chunk bytes. They point into buffers which are reused by the next batch, so they are copied.
+func decodeChunk(encoding chunkenc.Encoding, mint, maxt int64, data []byte) (chunks.Meta, error) {
+	chk, err := chunkenc.FromData(encoding, slices.Clone(data))
+	if err != nil {
+		return chunks.Meta{}, errors.Wrap(err, "failed decoding chunk")
+	}
+	return chunks.Meta{
+		MinTime: mint,
+		MaxTime: maxt,
+		Chunk:   chk,
+	}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
 
 	"Shopify/thanos-parquet-engine/compute"
 )
@@ -17,9 +18,14 @@ type seriesSet struct {
 	currentRow    int
 	currentLabels labels.Labels
 	err           error
+
+	mint int64
+	maxt int64
 }
 
-func newSeriesSet(labelNames []string, labelsProjection compute.Fragment) *seriesSet {
+// newSeriesSet creates a series set with labels from the labels projection, which must
+// have the series ID as its first column. Series have no samples.
+func newSeriesSet(labelNames []string, labelsProjection compute.Fragment, mint, maxt int64) *seriesSet {
 	lbls := make(labels.Labels, len(labelNames))
 	for i, name := range labelNames {
 		lbls[i].Name = name
@@ -27,23 +33,22 @@ func newSeriesSet(labelNames []string, labelsProjection compute.Fragment) *serie
 	return &seriesSet{
 		currentLabels: lbls,
 		labelsPlan:    labelsProjection,
+		mint:          mint,
+		maxt:          maxt,
 	}
 }
 
 func (s *seriesSet) Next() bool {
 	s.currentRow++
-	if s.currentBatch == nil || s.currentRow == len(s.currentBatch[0]) {
-		err := s.nextBatch()
-		if err == io.EOF {
-			return false
-		}
-		if s.err != nil {
-			s.err = err
+	for s.currentBatch == nil || s.currentRow >= len(s.currentBatch[0]) {
+		if err := s.nextBatch(); err != nil {
+			if err != io.EOF {
+				s.err = err
+			}
 			return false
 		}
 	}
-
-	return s.currentRow < len(s.currentBatch[0])
+	return true
 }
 
 func (s *seriesSet) nextBatch() error {
@@ -64,6 +69,8 @@ func (s *seriesSet) At() storage.Series {
 	}
 	return &series{
 		labels: s.currentLabels,
+		mint:   s.mint,
+		maxt:   s.maxt,
 	}
 }
 
@@ -73,14 +80,58 @@ func (s *seriesSet) Err() error {
 
 func (s *seriesSet) Warnings() storage.Warnings { return nil }
 
+// resolvedSeriesSet returns series whose labels have been resolved, without reading their chunks.
+type resolvedSeriesSet struct {
+	series  []resolvedSeries
+	current int
+}
+
+func newResolvedSeriesSet(series []resolvedSeries) *resolvedSeriesSet {
+	return &resolvedSeriesSet{series: series, current: -1}
+}
+
+func (s *resolvedSeriesSet) Next() bool {
+	s.current++
+	return s.current < len(s.series)
+}
+
+func (s *resolvedSeriesSet) At() storage.Series { return s.series[s.current].series }
+
+func (s *resolvedSeriesSet) Err() error { return nil }
+
+func (s *resolvedSeriesSet) Warnings() storage.Warnings { return nil }
+
+// limitSeriesSet stops after a limit of series.
+type limitSeriesSet struct {
+	storage.SeriesSet
+	limit int
+	n     int
+}
+
+func (s *limitSeriesSet) Next() bool {
+	if s.n == s.limit || !s.SeriesSet.Next() {
+		return false
+	}
+	s.n++
+	return true
+}
+
 type series struct {
 	labels labels.Labels
+	chunks []chunks.Meta
+	mint   int64
+	maxt   int64
 }
 
 func (s series) Labels() labels.Labels {
 	return s.labels
 }
 
+// Iterator returns the samples of all chunks of the series within the query time range.
+// Float, histogram and float histogram chunks are all decoded by their own iterator.
 func (s series) Iterator(_ chunkenc.Iterator) chunkenc.Iterator {
-	return &constValIterator{}
+	if len(s.chunks) == 0 {
+		return chunkenc.NewNopIterator()
+	}
+	return newTrimmingIterator(storage.ChainSampleIteratorFromMetas(nil, s.chunks), s.mint, s.maxt)
 }
@@ -0,0 +1,107 @@
+package prometheus
+
+import (
+	"io"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+
+	"Shopify/thanos-parquet-engine/compute"
+)
+
+// sortedSeriesSet streams series from files sorted by series, in which the chunks of
+// each series are in contiguous rows. Series are returned in the order of the file
+// and their chunks are read as part of the same projection, without grouping chunks in a map.
+type sortedSeriesSet struct {
+	fragment   compute.Fragment
+	labelNames []string
+
+	batch compute.Batch
+	row   int
+	done  bool
+
+	current *series
+	err     error
+	mint    int64
+	maxt    int64
+}
+
+// newSortedSeriesSet creates a series set from a projection of the label columns,
+// starting with the series ID, followed by the chunk columns without the series ID.
+func newSortedSeriesSet(labelNames []string, fragment compute.Fragment, mint, maxt int64) *sortedSeriesSet {
+	return &sortedSeriesSet{
+		fragment:   fragment,
+		labelNames: labelNames,
+		mint:       mint,
+		maxt:       maxt,
+	}
+}
+
+func (s *sortedSeriesSet) Next() bool {
+	if !s.hasRow() && !s.nextBatch() {
+		return false
+	}
+
+	seriesID := s.batch[0][s.row].Int64()
+	lbls := make(labels.Labels, len(s.labelNames))
+	for i, name := range s.labelNames {
+		lbls[i] = labels.Label{Name: name, Value: s.batch[i][s.row].String()}
+	}
+	s.current = &series{labels: lbls, mint: s.mint, maxt: s.maxt}
+	for {
+		chk, err := readChunk(s.batch[len(s.labelNames):], s.row)
+		if err != nil {
+			s.err = err
+			return false
+		}
+		s.current.chunks = append(s.current.chunks, chk)
+
+		s.row++
+		if !s.hasRow() && !s.nextBatch() {
+			return s.err == nil
+		}
+		if s.batch[0][s.row].Int64() != seriesID {
+			return true
+		}
+	}
+}
+
+func (s *sortedSeriesSet) hasRow() bool {
+	return s.batch != nil && s.row < len(s.batch[0])
+}
+
+// nextBatch releases the current batch and reads the next non-empty batch.
+func (s *sortedSeriesSet) nextBatch() bool {
+	for !s.done {
+		if s.batch != nil {
+			s.fragment.Release(s.batch)
+			s.batch = nil
+		}
+		batch, err := s.fragment.NextBatch()
+		if err != nil {
+			if err != io.EOF {
+				s.err = err
+			}
+			s.done = true
+			if err := s.fragment.Close(); err != nil && s.err == nil {
+				s.err = err
+			}
+			break
+		}
+		s.batch, s.row = batch, 0
+		if len(batch[0]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sortedSeriesSet) At() storage.Series {
+	return s.current
+}
+
+func (s *sortedSeriesSet) Err() error {
+	return s.err
+}
+
+func (s *sortedSeriesSet) Warnings() storage.Warnings { return nil }
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"sort"
 
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
 	"github.com/segmentio/parquet-go"
 	"github.com/segmentio/parquet-go/compress"
 	"github.com/segmentio/parquet-go/encoding"
@@ -15,79 +16,138 @@ const (
 	MinTColumn       = "__mint"
 	MaxTColumn       = "__maxt"
 	ChunkBytesColumn = "__chunk_bytes"
-
-	SeriesIDPos = 0
-	MinTPos     = 1
-	MaxTPos     = 2
-	ChunkPos    = 3
+	// ChunkEncodingColumn contains the chunkenc.Encoding of the chunk bytes.
+	ChunkEncodingColumn = "__chunk_encoding"
+	// NumSamplesColumn contains the number of samples in the chunk.
+	NumSamplesColumn = "__num_samples"
+
+	SeriesIDPos      = 0
+	MinTPos          = 1
+	MaxTPos          = 2
+	ChunkPos         = 3
+	ChunkEncodingPos = 4
+	NumSamplesPos    = 5
+	// SeriesHashPos is the position of the series hash column in a ChunkSchema.
+	// Label columns follow it.
+	SeriesHashPos = 6
+
+	numChunkColumns = 6
 )
 
+// IsChunkColumn returns true if the column is one of the fixed chunk columns, and not a label column.
+func IsChunkColumn(name string) bool {
+	switch name {
+	case SeriesIDColumn, SeriesHashColumn, MinTColumn, MaxTColumn, ChunkBytesColumn, ChunkEncodingColumn, NumSamplesColumn:
+		return true
+	default:
+		return false
+	}
+}
+
 type Chunk struct {
 	Labels map[string]string
 
 	// SeriesID is the ID of the series inside the parquet file.
 	// It can be used to compare series within a single file, but not across files.
 	SeriesID int64
+	// SeriesHash is the hash of the labels of the series, which can be used to compare series across files.
+	// It is computed from Labels by db.Writer. Queriers still identify the series they return by
+	// SeriesID, so series of different files are not merged or deduplicated by their hash.
+	SeriesHash SeriesHash
 	// MinT is the min time for the chunk.
 	MinT int64
 	// MaxT is the max time for the chunk.
 	MaxT int64
 	// ChunkBytes are the encoded bytes of the chunk.
 	ChunkBytes []byte
+	// Encoding is the encoding of ChunkBytes, for example XOR or histogram.
+	Encoding chunkenc.Encoding
+	// NumSamples is the number of samples in the chunk.
+	NumSamples int64
 }
 
-type chunkLabels []string
+// makeChunkColumns returns the values of the fixed chunk columns of a row.
+func makeChunkColumns(row parquet.Row, chunk Chunk) parquet.Row {
+	return append(row,
+		parquet.Int64Value(chunk.SeriesID).Level(0, 0, SeriesIDPos),
+		parquet.Int64Value(chunk.MinT).Level(0, 0, MinTPos),
+		parquet.Int64Value(chunk.MaxT).Level(0, 0, MaxTPos),
+		parquet.ByteArrayValue(chunk.ChunkBytes).Level(0, 0, ChunkPos),
+		parquet.Int32Value(int32(chunk.Encoding)).Level(0, 0, ChunkEncodingPos),
+		parquet.Int64Value(chunk.NumSamples).Level(0, 0, NumSamplesPos),
+	)
+}
 
-type chunkRow struct {
-	labels chunkLabels
+// row is the root node of a schema with the given columns.
+type row struct {
+	fields []parquet.Field
 }
 
-func newChunkRow(labels chunkLabels) *chunkRow {
-	return &chunkRow{labels: labels}
+func newRow(fields []parquet.Field) *row {
+	return &row{fields: fields}
 }
 
-func (c chunkRow) String() string {
-	return fmt.Sprintf("%v", c.labels)
+// newChunkFields creates the fixed chunk columns, leaving room for the given number of additional columns.
+func newChunkFields(configs *columnConfigs, capacity int) []parquet.Field {
+	fields := make([]parquet.Field, numChunkColumns, numChunkColumns+capacity)
+	fields[SeriesIDPos] = newInt64Column(SeriesIDColumn, configs)
+	fields[MinTPos] = newInt64Column(MinTColumn, configs)
+	fields[MaxTPos] = newInt64Column(MaxTColumn, configs)
+	fields[ChunkPos] = newByteArrayColumn(ChunkBytesColumn, configs)
+	fields[ChunkEncodingPos] = newInt32Column(ChunkEncodingColumn, configs)
+	fields[NumSamplesPos] = newInt64Column(NumSamplesColumn, configs)
+	return fields
 }
 
-func (c chunkRow) Type() parquet.Type { return groupType{} }
+// newChunkRow creates the root node of a schema with chunk columns and the series hash
+// followed by the given label columns.
+func newChunkRow(labels []string, configs *columnConfigs) *row {
+	fields := newChunkFields(configs, 1+len(labels))
+	fields = append(fields, newSeriesHashColumn(SeriesHashColumn, configs))
+	for _, lbl := range labels {
+		fields = append(fields, newStringColumn(lbl, configs))
+	}
+	return newRow(fields)
+}
 
-func (c chunkRow) Optional() bool { return false }
+func (r row) String() string {
+	names := make([]string, 0, len(r.fields))
+	for _, field := range r.fields {
+		names = append(names, field.Name())
+	}
+	return fmt.Sprintf("%v", names)
+}
 
-func (c chunkRow) Repeated() bool { return false }
+func (r row) Type() parquet.Type { return groupType{} }
 
-func (c chunkRow) Required() bool { return true }
+func (r row) Optional() bool { return false }
 
-func (c chunkRow) Leaf() bool { return false }
+func (r row) Repeated() bool { return false }
 
-func (c chunkRow) Fields() []parquet.Field {
-	fields := make([]parquet.Field, 4, 4+len(c.labels))
-	fields[0] = newInt64Column(SeriesIDColumn)
-	fields[1] = newInt64Column(MinTColumn)
-	fields[2] = newInt64Column(MaxTColumn)
-	fields[3] = newByteArrayColumn(ChunkBytesColumn)
+func (r row) Required() bool { return true }
 
-	for _, lbl := range c.labels {
-		fields = append(fields, newStringColumn(lbl))
-	}
-	return fields
-}
+func (r row) Leaf() bool { return false }
+
+func (r row) Fields() []parquet.Field { return r.fields }
 
-func (c chunkRow) Encoding() encoding.Encoding { return nil }
+func (r row) Encoding() encoding.Encoding { return nil }
 
-func (c chunkRow) Compression() compress.Codec { return nil }
+func (r row) Compression() compress.Codec { return nil }
 
-func (c chunkRow) GoType() reflect.Type { return reflect.TypeOf(chunkRow{}) }
+func (r row) GoType() reflect.Type { return reflect.TypeOf(row{}) }
 
 type ChunkSchema struct {
 	schema *parquet.Schema
 	labels []string
 }
 
-func MakeChunkSchema(lbls []string) *ChunkSchema {
+// MakeChunkSchema creates a schema with chunk columns followed by the given label columns.
+// By default, chunk columns are zstd compressed and label columns are dictionary encoded
+// without compression. Options can override the codec and encoding of any column.
+func MakeChunkSchema(lbls []string, opts ...Option) *ChunkSchema {
 	sort.Strings(lbls)
 
-	schema := parquet.NewSchema("chunk", newChunkRow(lbls))
+	schema := parquet.NewSchema("chunk", newChunkRow(lbls, newColumnConfigs(opts)))
 	return &ChunkSchema{
 		schema: schema,
 		labels: lbls,
@@ -99,16 +159,12 @@ func (c *ChunkSchema) ParquetSchema() *parquet.Schema {
 }
 
 func (c *ChunkSchema) MakeChunkRow(chunk Chunk) parquet.Row {
-	row := make(parquet.Row, 4, len(c.labels)+4)
-
-	row[0] = parquet.Int64Value(chunk.SeriesID).Level(0, 0, SeriesIDPos)
-	row[1] = parquet.Int64Value(chunk.MinT).Level(0, 0, MinTPos)
-	row[2] = parquet.Int64Value(chunk.MaxT).Level(0, 0, MaxTPos)
-	row[3] = parquet.ByteArrayValue(chunk.ChunkBytes).Level(0, 0, ChunkPos)
+	row := makeChunkColumns(make(parquet.Row, 0, len(c.labels)+numChunkColumns+1), chunk)
+	row = append(row, chunk.SeriesHash.Value().Level(0, 0, SeriesHashPos))
 
 	for labelIndex, labelName := range c.labels {
 		labelVal := chunk.Labels[labelName]
-		colVal := parquet.ByteArrayValue([]byte(labelVal)).Level(0, 0, 4+labelIndex)
+		colVal := parquet.ByteArrayValue([]byte(labelVal)).Level(0, 0, SeriesHashPos+1+labelIndex)
 		row = append(row, colVal)
 	}
 
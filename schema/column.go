@@ -18,24 +18,48 @@ func newColumn(name string, node parquet.Node) *column {
 	return &column{Node: node, name: name}
 }
 
-func newInt64Column(name string) *column {
-	node := parquet.Leaf(parquet.Int64Type)
-	node = parquet.Encoded(node, &parquet.DeltaBinaryPacked)
-	node = parquet.Compressed(node, &zstd.Codec{})
-	return newColumn(name, node)
+var (
+	defaultInt64Config      = columnConfig{encoding: &parquet.DeltaBinaryPacked, codec: &zstd.Codec{}}
+	defaultInt32Config      = columnConfig{encoding: &parquet.RLEDictionary}
+	defaultSeriesHashConfig = columnConfig{encoding: &parquet.Plain}
+	defaultDoubleConfig     = columnConfig{encoding: &parquet.ByteStreamSplit, codec: &zstd.Codec{}}
+	defaultStringConfig     = columnConfig{encoding: &parquet.RLEDictionary}
+	defaultByteArrayConfig  = columnConfig{encoding: &parquet.DeltaLengthByteArray, codec: &zstd.Codec{}}
+)
+
+func newInt64Column(name string, configs *columnConfigs) *column {
+	return newConfiguredColumn(name, parquet.Int64Type, configs.column(name, defaultInt64Config))
+}
+
+func newInt32Column(name string, configs *columnConfigs) *column {
+	return newConfiguredColumn(name, parquet.Int32Type, configs.column(name, defaultInt32Config))
+}
+
+func newDoubleColumn(name string, configs *columnConfigs) *column {
+	return newConfiguredColumn(name, parquet.DoubleType, configs.column(name, defaultDoubleConfig))
+}
+
+func newSeriesHashColumn(name string, configs *columnConfigs) *column {
+	return newConfiguredColumn(name, parquet.FixedLenByteArrayType(seriesHashSize), configs.column(name, defaultSeriesHashConfig))
 }
 
-func newStringColumn(name string) *column {
-	node := parquet.Leaf(parquet.ByteArrayType)
+func newStringColumn(name string, configs *columnConfigs) *column {
 	//node = parquet.Optional(node)
-	node = parquet.Encoded(node, &parquet.RLEDictionary)
-	return newColumn(name, node)
+	return newConfiguredColumn(name, parquet.ByteArrayType, configs.label(name, defaultStringConfig))
+}
+
+func newByteArrayColumn(name string, configs *columnConfigs) *column {
+	return newConfiguredColumn(name, parquet.ByteArrayType, configs.column(name, defaultByteArrayConfig))
 }
 
-func newByteArrayColumn(name string) *column {
-	node := parquet.Leaf(parquet.ByteArrayType)
-	node = parquet.Encoded(node, &parquet.DeltaLengthByteArray)
-	node = parquet.Compressed(node, &zstd.Codec{})
+func newConfiguredColumn(name string, typ parquet.Type, config columnConfig) *column {
+	node := parquet.Leaf(typ)
+	if config.encoding != nil {
+		node = parquet.Encoded(node, config.encoding)
+	}
+	if config.codec != nil {
+		node = parquet.Compressed(node, config.codec)
+	}
 	return newColumn(name, node)
 }
 
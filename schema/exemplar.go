@@ -0,0 +1,89 @@
+package schema
+
+import (
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+	"github.com/segmentio/parquet-go"
+)
+
+const (
+	ExemplarTimestampColumn = "__timestamp"
+	ExemplarValueColumn     = "__value"
+	ExemplarLabelsColumn    = "__exemplar_labels"
+
+	exemplarSeriesIDPos  = 0
+	exemplarTimestampPos = 1
+	exemplarValuePos     = 2
+	exemplarLabelsPos    = 3
+)
+
+// Exemplar is an exemplar of the series with the given ID.
+type Exemplar struct {
+	SeriesID int64
+	Labels   labels.Labels
+	Ts       int64
+	Value    float64
+}
+
+// ExemplarSchema is the schema of an exemplars file with one row for each exemplar.
+// Exemplar labels are stored in a single column since every exemplar can have different label names.
+type ExemplarSchema struct {
+	schema *parquet.Schema
+}
+
+func MakeExemplarSchema(opts ...Option) *ExemplarSchema {
+	configs := newColumnConfigs(opts)
+	fields := []parquet.Field{
+		exemplarSeriesIDPos:  newInt64Column(SeriesIDColumn, configs),
+		exemplarTimestampPos: newInt64Column(ExemplarTimestampColumn, configs),
+		exemplarValuePos:     newDoubleColumn(ExemplarValueColumn, configs),
+		exemplarLabelsPos:    newByteArrayColumn(ExemplarLabelsColumn, configs),
+	}
+	return &ExemplarSchema{
+		schema: parquet.NewSchema("exemplar", newRow(fields)),
+	}
+}
+
+func (s *ExemplarSchema) ParquetSchema() *parquet.Schema {
+	return s.schema
+}
+
+func (s *ExemplarSchema) MakeExemplarRow(e Exemplar) parquet.Row {
+	return parquet.Row{
+		parquet.Int64Value(e.SeriesID).Level(0, 0, exemplarSeriesIDPos),
+		parquet.Int64Value(e.Ts).Level(0, 0, exemplarTimestampPos),
+		parquet.DoubleValue(e.Value).Level(0, 0, exemplarValuePos),
+		parquet.ByteArrayValue(EncodeLabels(e.Labels)).Level(0, 0, exemplarLabelsPos),
+	}
+}
+
+// EncodeLabels encodes labels as the number of labels followed by each name and value.
+func EncodeLabels(lbls labels.Labels) []byte {
+	var buf encoding.Encbuf
+	buf.PutUvarint(len(lbls))
+	for _, l := range lbls {
+		buf.PutUvarintStr(l.Name)
+		buf.PutUvarintStr(l.Value)
+	}
+	return buf.Get()
+}
+
+// DecodeLabels decodes labels encoded with EncodeLabels.
+func DecodeLabels(b []byte) (labels.Labels, error) {
+	buf := encoding.Decbuf{B: b}
+	n := buf.Uvarint()
+	// Each label takes at least one byte for the length of its name and one for its value.
+	if buf.Err() == nil && n > buf.Len()/2 {
+		return nil, errors.Errorf("failed decoding labels: %d labels do not fit into %d bytes", n, buf.Len())
+	}
+	lbls := make(labels.Labels, n)
+	for i := range lbls {
+		lbls[i].Name = buf.UvarintStr()
+		lbls[i].Value = buf.UvarintStr()
+	}
+	if buf.Err() != nil {
+		return nil, errors.Wrap(buf.Err(), "failed decoding labels")
+	}
+	return lbls, nil
+}
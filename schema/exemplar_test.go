@@ -0,0 +1,28 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeLabels(t *testing.T) {
+	lbls := labels.FromStrings("span_id", "def", "trace_id", "abc")
+	decoded, err := DecodeLabels(EncodeLabels(lbls))
+	require.NoError(t, err)
+	require.Equal(t, lbls, decoded)
+
+	decoded, err = DecodeLabels(EncodeLabels(nil))
+	require.NoError(t, err)
+	require.Empty(t, decoded)
+
+	var tooMany encoding.Encbuf
+	tooMany.PutUvarint64(1 << 60)
+	tooMany.PutUvarintStr("trace_id")
+	for _, b := range [][]byte{nil, tooMany.Get(), EncodeLabels(lbls)[:5]} {
+		_, err := DecodeLabels(b)
+		require.Error(t, err)
+	}
+}
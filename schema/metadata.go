@@ -0,0 +1,67 @@
+package schema
+
+import (
+	"github.com/prometheus/prometheus/model/textparse"
+	"github.com/segmentio/parquet-go"
+)
+
+const (
+	MetadataMetricColumn = "metric"
+	MetadataTypeColumn   = "type"
+	MetadataHelpColumn   = "help"
+	MetadataUnitColumn   = "unit"
+
+	metadataMetricPos = 0
+	metadataTypePos   = 1
+	metadataHelpPos   = 2
+	metadataUnitPos   = 3
+)
+
+// Metadata is the TYPE, HELP and UNIT of a metric.
+type Metadata struct {
+	MetricName string
+	Type       textparse.MetricType
+	Help       string
+	Unit       string
+}
+
+// MetadataSchema is the schema of a metadata file with one row for each metadata entry of a metric.
+type MetadataSchema struct {
+	schema *parquet.Schema
+}
+
+func MakeMetadataSchema(opts ...Option) *MetadataSchema {
+	configs := newColumnConfigs(opts)
+	fields := []parquet.Field{
+		metadataMetricPos: newStringColumn(MetadataMetricColumn, configs),
+		metadataTypePos:   newStringColumn(MetadataTypeColumn, configs),
+		metadataHelpPos:   newByteArrayColumn(MetadataHelpColumn, configs),
+		metadataUnitPos:   newStringColumn(MetadataUnitColumn, configs),
+	}
+	return &MetadataSchema{
+		schema: parquet.NewSchema("metadata", newRow(fields)),
+	}
+}
+
+func (s *MetadataSchema) ParquetSchema() *parquet.Schema {
+	return s.schema
+}
+
+func (s *MetadataSchema) MakeMetadataRow(m Metadata) parquet.Row {
+	return parquet.Row{
+		parquet.ByteArrayValue([]byte(m.MetricName)).Level(0, 0, metadataMetricPos),
+		parquet.ByteArrayValue([]byte(m.Type)).Level(0, 0, metadataTypePos),
+		parquet.ByteArrayValue([]byte(m.Help)).Level(0, 0, metadataHelpPos),
+		parquet.ByteArrayValue([]byte(m.Unit)).Level(0, 0, metadataUnitPos),
+	}
+}
+
+// MetadataFromRow returns the metadata stored in a row of a metadata file.
+func MetadataFromRow(row parquet.Row) Metadata {
+	return Metadata{
+		MetricName: row[metadataMetricPos].String(),
+		Type:       textparse.MetricType(row[metadataTypePos].String()),
+		Help:       row[metadataHelpPos].String(),
+		Unit:       row[metadataUnitPos].String(),
+	}
+}
@@ -0,0 +1,140 @@
+package schema
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/segmentio/parquet-go"
+	"github.com/segmentio/parquet-go/compress"
+	"github.com/segmentio/parquet-go/compress/lz4"
+	"github.com/segmentio/parquet-go/compress/snappy"
+	"github.com/segmentio/parquet-go/compress/uncompressed"
+	"github.com/segmentio/parquet-go/compress/zstd"
+	"github.com/segmentio/parquet-go/encoding"
+)
+
+// Option configures the codec and encoding of columns in a schema.
+type Option func(*columnConfigs)
+
+// WithCodec sets the compression codec of a single column, which can be a label or a chunk column.
+func WithCodec(column string, codec compress.Codec) Option {
+	return func(c *columnConfigs) {
+		config := c.columns[column]
+		config.codec = codec
+		c.columns[column] = config
+	}
+}
+
+// WithEncoding sets the encoding of a single column, which can be a label or a chunk column.
+// The encoding must support the type of the column.
+func WithEncoding(column string, enc encoding.Encoding) Option {
+	return func(c *columnConfigs) {
+		config := c.columns[column]
+		config.encoding = enc
+		c.columns[column] = config
+	}
+}
+
+// WithLabelsCodec sets the compression codec of all label columns
+// which are not configured individually.
+func WithLabelsCodec(codec compress.Codec) Option {
+	return func(c *columnConfigs) {
+		c.labels.codec = codec
+	}
+}
+
+// WithLabelsEncoding sets the encoding of all label columns
+// which are not configured individually.
+// Matchers on label columns which are not dictionary encoded cannot skip row groups by
+// their dictionary, and are evaluated by decoding every value of the selected pages.
+func WithLabelsEncoding(enc encoding.Encoding) Option {
+	return func(c *columnConfigs) {
+		c.labels.encoding = enc
+	}
+}
+
+type columnConfig struct {
+	codec    compress.Codec
+	encoding encoding.Encoding
+}
+
+// merge returns the config with unset fields taken from the defaults.
+func (c columnConfig) merge(defaults columnConfig) columnConfig {
+	if c.codec == nil {
+		c.codec = defaults.codec
+	}
+	if c.encoding == nil {
+		c.encoding = defaults.encoding
+	}
+	return c
+}
+
+type columnConfigs struct {
+	columns map[string]columnConfig
+	labels  columnConfig
+}
+
+func newColumnConfigs(opts []Option) *columnConfigs {
+	configs := &columnConfigs{columns: make(map[string]columnConfig)}
+	for _, opt := range opts {
+		opt(configs)
+	}
+	return configs
+}
+
+func (c *columnConfigs) column(name string, defaults columnConfig) columnConfig {
+	return c.columns[name].merge(defaults)
+}
+
+func (c *columnConfigs) label(name string, defaults columnConfig) columnConfig {
+	return c.columns[name].merge(c.labels.merge(defaults))
+}
+
+// ParseCodec returns the compression codec with the given name.
+// Supported names are none, snappy, lz4, zstd, and zstd with a level suffix
+// of fastest, default, better or best, for example zstd-best.
+func ParseCodec(name string) (compress.Codec, error) {
+	switch name {
+	case "none":
+		return &uncompressed.Codec{}, nil
+	case "snappy":
+		return &snappy.Codec{}, nil
+	case "lz4":
+		return &lz4.Codec{}, nil
+	case "zstd":
+		return &zstd.Codec{}, nil
+	}
+
+	if !strings.HasPrefix(name, "zstd-") {
+		return nil, errors.Errorf("unknown codec %q", name)
+	}
+	switch level := strings.TrimPrefix(name, "zstd-"); level {
+	case "fastest":
+		return &zstd.Codec{Level: zstd.SpeedFastest}, nil
+	case "default":
+		return &zstd.Codec{Level: zstd.SpeedDefault}, nil
+	case "better":
+		return &zstd.Codec{Level: zstd.SpeedBetterCompression}, nil
+	case "best":
+		return &zstd.Codec{Level: zstd.SpeedBestCompression}, nil
+	default:
+		return nil, errors.Errorf("unknown zstd level %q", level)
+	}
+}
+
+// ParseEncoding returns the encoding with the given name, for example plain or rle_dictionary.
+func ParseEncoding(name string) (encoding.Encoding, error) {
+	for _, enc := range []encoding.Encoding{
+		&parquet.Plain,
+		&parquet.RLEDictionary,
+		&parquet.DeltaBinaryPacked,
+		&parquet.DeltaLengthByteArray,
+		&parquet.DeltaByteArray,
+		&parquet.ByteStreamSplit,
+	} {
+		if strings.EqualFold(enc.String(), name) {
+			return enc, nil
+		}
+	}
+	return nil, errors.Errorf("unknown encoding %q", name)
+}
@@ -0,0 +1,57 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/segmentio/parquet-go"
+	"github.com/segmentio/parquet-go/format"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColumnOptions(t *testing.T) {
+	snappy, err := ParseCodec("snappy")
+	require.NoError(t, err)
+	zstdBest, err := ParseCodec("zstd-best")
+	require.NoError(t, err)
+	plain, err := ParseEncoding("plain")
+	require.NoError(t, err)
+
+	chunkSchema := MakeChunkSchema([]string{"job", "instance", "pod"},
+		WithCodec(ChunkBytesColumn, zstdBest),
+		WithEncoding(MinTColumn, &parquet.Plain),
+		WithLabelsCodec(snappy),
+		WithEncoding("pod", plain),
+		WithCodec("pod", zstdBest),
+	)
+
+	type columnFormat struct {
+		codec    format.CompressionCodec
+		encoding format.Encoding
+	}
+	expected := map[string]columnFormat{
+		SeriesIDColumn:   {codec: format.Zstd, encoding: format.DeltaBinaryPacked},
+		MinTColumn:       {codec: format.Zstd, encoding: format.Plain},
+		MaxTColumn:       {codec: format.Zstd, encoding: format.DeltaBinaryPacked},
+		ChunkBytesColumn: {codec: format.Zstd, encoding: format.DeltaLengthByteArray},
+		"instance":       {codec: format.Snappy, encoding: format.RLEDictionary},
+		"job":            {codec: format.Snappy, encoding: format.RLEDictionary},
+		"pod":            {codec: format.Zstd, encoding: format.Plain},
+	}
+	for name, want := range expected {
+		column, ok := chunkSchema.ParquetSchema().Lookup(name)
+		require.True(t, ok, name)
+		require.Equal(t, want.codec, column.Node.Compression().CompressionCodec(), name)
+		require.Equal(t, want.encoding, column.Node.Encoding().Encoding(), name)
+	}
+}
+
+func TestParseCodec(t *testing.T) {
+	for _, name := range []string{"none", "snappy", "lz4", "zstd", "zstd-fastest", "zstd-default", "zstd-better", "zstd-best"} {
+		_, err := ParseCodec(name)
+		require.NoError(t, err, name)
+	}
+	_, err := ParseCodec("gzip")
+	require.Error(t, err)
+	_, err = ParseCodec("zstd-ultra")
+	require.Error(t, err)
+}
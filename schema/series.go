@@ -0,0 +1,68 @@
+package schema
+
+import (
+	"sort"
+
+	"github.com/segmentio/parquet-go"
+)
+
+// seriesLabelsHashPos is the position of the series hash column in a SeriesLabelsSchema.
+const seriesLabelsHashPos = 1
+
+// SeriesLabelsSchema is the schema of a labels file in the split layout.
+// It has one row for each series with its ID, its hash and its labels, and no chunk data.
+type SeriesLabelsSchema struct {
+	schema *parquet.Schema
+	labels []string
+}
+
+func MakeSeriesLabelsSchema(lbls []string, opts ...Option) *SeriesLabelsSchema {
+	sort.Strings(lbls)
+
+	configs := newColumnConfigs(opts)
+	fields := make([]parquet.Field, 2, 2+len(lbls))
+	fields[SeriesIDPos] = newInt64Column(SeriesIDColumn, configs)
+	fields[seriesLabelsHashPos] = newSeriesHashColumn(SeriesHashColumn, configs)
+	for _, lbl := range lbls {
+		fields = append(fields, newStringColumn(lbl, configs))
+	}
+	return &SeriesLabelsSchema{
+		schema: parquet.NewSchema("series", newRow(fields)),
+		labels: lbls,
+	}
+}
+
+func (s *SeriesLabelsSchema) ParquetSchema() *parquet.Schema {
+	return s.schema
+}
+
+func (s *SeriesLabelsSchema) MakeSeriesRow(chunk Chunk) parquet.Row {
+	row := make(parquet.Row, 2, len(s.labels)+2)
+	row[SeriesIDPos] = parquet.Int64Value(chunk.SeriesID).Level(0, 0, SeriesIDPos)
+	row[seriesLabelsHashPos] = chunk.SeriesHash.Value().Level(0, 0, seriesLabelsHashPos)
+	for labelIndex, labelName := range s.labels {
+		labelVal := chunk.Labels[labelName]
+		row = append(row, parquet.ByteArrayValue([]byte(labelVal)).Level(0, 0, 2+labelIndex))
+	}
+	return row
+}
+
+// SeriesChunksSchema is the schema of a chunks file in the split layout.
+// It has one row for each chunk, keyed by the ID of its series, and no label columns.
+type SeriesChunksSchema struct {
+	schema *parquet.Schema
+}
+
+func MakeSeriesChunksSchema(opts ...Option) *SeriesChunksSchema {
+	return &SeriesChunksSchema{
+		schema: parquet.NewSchema("chunk", newRow(newChunkFields(newColumnConfigs(opts), 0))),
+	}
+}
+
+func (s *SeriesChunksSchema) ParquetSchema() *parquet.Schema {
+	return s.schema
+}
+
+func (s *SeriesChunksSchema) MakeChunkRow(chunk Chunk) parquet.Row {
+	return makeChunkColumns(make(parquet.Row, 0, numChunkColumns), chunk)
+}
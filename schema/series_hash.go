@@ -0,0 +1,60 @@
+package schema
+
+import (
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/segmentio/parquet-go"
+	"github.com/zeebo/xxh3"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	// SeriesHashColumn contains the SeriesHash of the labels of a series.
+	SeriesHashColumn = "__series_hash"
+
+	seriesHashSize = 16
+	labelSeparator = '\xff'
+)
+
+// SeriesHash is a 128-bit hash of the sorted label set of a series.
+// Unlike the series ID it only depends on the labels, so it identifies
+// the same series in every file.
+type SeriesHash [seriesHashSize]byte
+
+// HashLabels returns the hash of a label set.
+func HashLabels(lbls labels.Labels) SeriesHash {
+	b := make([]byte, 0, 1024)
+	for _, l := range lbls {
+		b = appendLabel(b, l.Name, l.Value)
+	}
+	return xxh3.Hash128(b).Bytes()
+}
+
+// HashSeries returns the hash of a label set given as a map. Labels with empty values are
+// ignored, so the hash is equal to the hash of the same labels passed to HashLabels.
+func HashSeries(lbls map[string]string) SeriesHash {
+	names := make([]string, 0, len(lbls))
+	for name, value := range lbls {
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	b := make([]byte, 0, 1024)
+	for _, name := range names {
+		b = appendLabel(b, name, lbls[name])
+	}
+	return xxh3.Hash128(b).Bytes()
+}
+
+func appendLabel(b []byte, name, value string) []byte {
+	b = append(b, name...)
+	b = append(b, labelSeparator)
+	b = append(b, value...)
+	return append(b, labelSeparator)
+}
+
+// Value returns the hash as a parquet value of the series hash column.
+func (h SeriesHash) Value() parquet.Value {
+	return parquet.FixedLenByteArrayValue(h[:])
+}